@@ -1,16 +1,18 @@
-// @title Sample Service API
-// @version 1.0
-// @description API for managing users
-// @host localhost:1323
-// @BasePath /
 package main
 
 import (
 	"log"
+	"os"
+	"strconv"
+	"time"
+	"context"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"sample-service/internal/controllers"
 	"sample-service/internal/database"
+	"sample-service/internal/repository"
 	"sample-service/internal/routes"
+	"sample-service/internal/scheduler"
 )
 
 func main() {
@@ -25,9 +27,46 @@ func main() {
 		log.Fatalf("Failed to seed database: %v", err)
 	}
 
+	// IDEMPOTENCY_TTL is how long responses to POST requests with an
+	// Idempotency-Key are replayed, as a Go duration such as "12h"
+	idempotencyTTL := controllers.DefaultIdempotencyTTL
+	if ttl := os.Getenv("IDEMPOTENCY_TTL"); ttl != "" {
+		idempotencyTTL, err = time.ParseDuration(ttl)
+		if err != nil {
+			log.Fatalf("Invalid IDEMPOTENCY_TTL: %v", err)
+		}
+	}
+
+	// SCHEDULER_INTERVAL is how often scheduled changes that have fallen due
+	// are applied, as a Go duration such as "30s"
+	schedulerInterval := scheduler.DefaultInterval
+	if interval := os.Getenv("SCHEDULER_INTERVAL"); interval != "" {
+		schedulerInterval, err = time.ParseDuration(interval)
+		if err != nil || schedulerInterval <= 0 {
+			log.Fatalf("Invalid SCHEDULER_INTERVAL: %q", interval)
+		}
+	}
+
+	// TRUST_ACTOR_ROLE, when true, believes the role the gateway passes in
+	// X-Actor-Role and lets administrators purge users. Leave it off unless
+	// the gateway sets that header itself and drops any sent by clients.
+	trustActorRole := false
+	if trust := os.Getenv("TRUST_ACTOR_ROLE"); trust != "" {
+		trustActorRole, err = strconv.ParseBool(trust)
+		if err != nil {
+			log.Fatalf("Invalid TRUST_ACTOR_ROLE: %q", trust)
+		}
+	}
+
+	// The scheduler catches up on changes that fell due while the service
+	// was down before waiting for the next interval
+	userRepo := repository.NewUserRepository(db)
+	go scheduler.New(repository.NewScheduledChangeRepository(db, userRepo), schedulerInterval).Run(context.Background())
+
 	e := echo.New()
+	e.HTTPErrorHandler = controllers.HTTPErrorHandler
 	e.Use(middleware.Logger())
-	routes.RegisterUserRoutes(e, db)
+	routes.RegisterUserRoutes(e, db, userRepo, idempotencyTTL, trustActorRole)
 	routes.RegisterSwaggerRoutes(e)
 	e.Logger.Fatal(e.Start(":1323"))
 }
\ No newline at end of file
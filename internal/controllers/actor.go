@@ -0,0 +1,39 @@
+package controllers
+
+import (
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// The service has no authentication of its own: the gateway in front of it
+// authenticates callers and passes who they are in these headers
+const (
+	headerActor     = "X-Actor"
+	headerActorRole = "X-Actor-Role"
+)
+
+// adminRole may permanently purge users
+const adminRole = "admin"
+
+// actorName is who is making the request, for audit columns such as deleted_by
+func actorName(ctx echo.Context) string {
+	if name := strings.TrimSpace(ctx.Request().Header.Get(headerActor)); name != "" {
+		return name
+	}
+	return "anonymous"
+}
+
+// TrustActorRole makes the controller believe the role passed in
+// X-Actor-Role, so that administrators can purge users. Only call it when
+// the gateway sets that header itself and drops any sent by clients.
+func (uc *UserController) TrustActorRole() {
+	uc.trustActorRole = true
+}
+
+// isAdmin reports whether the request claims to come from an administrator.
+// Anyone who can reach the service can make that claim, so it is only
+// believed by controllers told to trust the gateway; see TrustActorRole.
+func isAdmin(ctx echo.Context) bool {
+	return strings.EqualFold(strings.TrimSpace(ctx.Request().Header.Get(headerActorRole)), adminRole)
+}
@@ -0,0 +1,238 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sample-service/internal/model"
+	"sample-service/internal/repository"
+	"sample-service/internal/response"
+
+	"github.com/labstack/echo/v4"
+)
+
+// MaxBulkItems is the most operations one bulk request may carry
+const MaxBulkItems = 1000
+
+// errBulkItemFailed makes an atomic bulk request roll back
+var errBulkItemFailed = errors.New("bulk item failed")
+
+// @Summary Create, update and delete users in bulk
+// @Description Apply a batch of create, update and delete operations in order and report the outcome of each.
+// @Description Every item is checked before anything is written, including for usernames used twice in the batch.
+// @Description With atomic=true the batch runs in one transaction: if any item fails, none is applied.
+// @Description Otherwise failed items are skipped and the others applied. The response is 207 unless every item succeeded.
+// @Accept json,application/hal+json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Produce json,application/hal+json,application/vnd.api+json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Param request body model.BulkRequest true "Operations to apply"
+// @Param atomic query bool false "Apply all the operations or none of them"
+// @Param X-Actor header string false "Who is deleting users"
+// @Param Idempotency-Key header string false "Key under which the response is replayed to retries of the same request"
+// @Success 200 {object} response.SuccessResponse{data=[]model.BulkResult}
+// @Success 207 {object} response.SuccessResponse{data=[]model.BulkResult}
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 406 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Failure 413 {object} response.ErrorResponse
+// @Failure 415 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /users/bulk [post]
+func (uc *UserController) BulkUsers(ctx echo.Context) error {
+	atomic, err := queryBool(ctx, "atomic")
+	if err != nil {
+		return badRequest(codeInvalidParameter, "Invalid atomic", err)
+	}
+
+	var request model.BulkRequest
+	if err := bind(ctx, &request); err != nil {
+		return fail("Invalid request body", err)
+	}
+	if len(request.Items) == 0 {
+		return failWithStatus(http.StatusBadRequest, codeInvalidBody, "Invalid request body", "items must not be empty")
+	}
+	if len(request.Items) > MaxBulkItems {
+		return failWithStatus(http.StatusRequestEntityTooLarge, codeTooLarge, "Too many items",
+			fmt.Sprintf("a bulk request may carry at most %d items", MaxBulkItems))
+	}
+
+	results := checkBulkItems(request.Items)
+	invalid := false
+	for _, result := range results {
+		invalid = invalid || result.Status != 0
+	}
+
+	actor := actorName(ctx)
+	message := "Bulk operation completed"
+	if atomic {
+		if invalid {
+			skipPending(results, "not applied: the batch has invalid items")
+			message = "Bulk operation not applied"
+		} else {
+			err := uc.repo.InTransaction(func(tx repository.UserRepository) error {
+				for i, item := range request.Items {
+					results[i] = applyBulkItem(tx, item, actor)
+					results[i].Index = i
+					if !succeeded(results[i]) {
+						rollBack(results, i)
+						return errBulkItemFailed
+					}
+				}
+				return nil
+			})
+			if errors.Is(err, errBulkItemFailed) {
+				message = "Bulk operation rolled back"
+			} else if err != nil {
+				return fail("Failed to apply bulk operation", err)
+			}
+		}
+	} else {
+		for i, item := range request.Items {
+			if results[i].Status == 0 {
+				results[i] = applyBulkItem(uc.repo, item, actor)
+				results[i].Index = i
+			}
+		}
+	}
+
+	status := http.StatusOK
+	for _, result := range results {
+		if !succeeded(result) {
+			status = http.StatusMultiStatus
+		}
+	}
+	return response.JSONSuccessResponseWithStatus(ctx, status, message, results)
+}
+
+// checkBulkItems validates every item of a batch without touching the
+// database. Items that pass are left with a zero status; a username given
+// to more than one item fails all of them.
+func checkBulkItems(items []model.BulkItem) []model.BulkResult {
+	results := make([]model.BulkResult, len(items))
+	claimed := map[string][]int{}
+
+	for i, item := range items {
+		results[i] = model.BulkResult{Index: i, Op: item.Op}
+		fail := func(status int, err string) {
+			results[i].Status = status
+			results[i].Error = err
+			results[i].Code = codeInvalidBody
+		}
+
+		switch item.Op {
+		case model.BulkCreate, model.BulkUpdate:
+			if item.User == nil {
+				fail(http.StatusBadRequest, "user is required")
+				continue
+			}
+			if item.Op == model.BulkUpdate && item.UserID == 0 {
+				fail(http.StatusBadRequest, "user_id is required")
+				continue
+			}
+			if err := validateUser(*item.User); err != nil {
+				fail(errorStatus(err), err.Error())
+				results[i].Code, results[i].Errors = errorCode(err), errorFields(err)
+				continue
+			}
+			claimed[item.User.UserName] = append(claimed[item.User.UserName], i)
+		case model.BulkDelete:
+			if item.UserID == 0 {
+				fail(http.StatusBadRequest, "user_id is required")
+			}
+		default:
+			fail(http.StatusBadRequest, fmt.Sprintf("unknown op %q: must be create, update or delete", item.Op))
+		}
+	}
+
+	for name, indexes := range claimed {
+		if len(indexes) < 2 {
+			continue
+		}
+		for _, i := range indexes {
+			results[i].Status = http.StatusConflict
+			results[i].Error = fmt.Sprintf("username '%s' is used by more than one item of the batch", name)
+			results[i].Code = repository.CodeUsernameTaken
+		}
+	}
+	return results
+}
+
+// applyBulkItem applies one checked item through repo, which may be
+// transactional, and reports how it went
+func applyBulkItem(repo repository.UserRepository, item model.BulkItem, actor string) model.BulkResult {
+	result := model.BulkResult{Op: item.Op}
+	failed := func(err error) model.BulkResult {
+		result.Status = errorStatus(err)
+		if errors.Is(err, repository.ErrVersionConflict) {
+			result.Status = http.StatusPreconditionFailed
+		}
+		result.Error = err.Error()
+		result.Code, result.Errors = errorCode(err), errorFields(err)
+		return result
+	}
+
+	switch item.Op {
+	case model.BulkCreate:
+		user := *item.User
+		user.ID = 0
+		created, err := repo.CreateUser(user)
+		if err != nil {
+			return failed(err)
+		}
+		result.Status = http.StatusCreated
+		result.User = created
+
+	case model.BulkUpdate:
+		user := *item.User
+		user.ID = item.UserID
+		user.Version = item.Version
+		user.UpdatedBy = actor
+		updated, err := repo.UpdateUser(user)
+		if err != nil {
+			return failed(err)
+		}
+		result.Status = http.StatusOK
+		result.User = updated
+
+	case model.BulkDelete:
+		deleted, err := repo.DeleteUser(int(item.UserID), item.Version, actor)
+		if err != nil {
+			return failed(err)
+		}
+		if !deleted {
+			return failed(repository.Errorf(repository.ErrNotFound, "no user found with ID %d", item.UserID))
+		}
+		result.Status = http.StatusOK
+	}
+
+	return result
+}
+
+// succeeded reports whether a bulk item was applied
+func succeeded(result model.BulkResult) bool {
+	return result.Status >= 200 && result.Status < 300
+}
+
+// rollBack marks the results of an atomic batch after item failed at
+// index: what was applied before it is undone and the rest never ran
+func rollBack(results []model.BulkResult, failed int) {
+	for i := 0; i < failed; i++ {
+		results[i].Status = http.StatusFailedDependency
+		results[i].User = nil
+		results[i].Error = fmt.Sprintf("rolled back: item %d failed", failed)
+		results[i].Code = codeRolledBack
+	}
+	skipPending(results[failed+1:], fmt.Sprintf("not applied: item %d failed", failed))
+}
+
+// skipPending marks the items that have not been given a status as not
+// applied
+func skipPending(results []model.BulkResult, reason string) {
+	for i := range results {
+		if results[i].Status == 0 {
+			results[i].Status = http.StatusFailedDependency
+			results[i].Error = reason
+			results[i].Code = codeNotApplied
+		}
+	}
+}
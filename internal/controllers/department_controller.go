@@ -0,0 +1,257 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"sample-service/internal/filter"
+	"sample-service/internal/model"
+	"sample-service/internal/repository"
+	"sample-service/internal/response"
+	"sample-service/internal/validate"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// DepartmentController serves the departments users belong to, and the
+// users of each department as users shows them
+type DepartmentController struct {
+	repo  repository.DepartmentRepository
+	users *UserController
+}
+
+// NewDepartmentController creates a new DepartmentController
+func NewDepartmentController(repo repository.DepartmentRepository, users *UserController) *DepartmentController {
+	return &DepartmentController{repo: repo, users: users}
+}
+
+// DepartmentInclude makes the department of each user available to
+// ?include=department
+func DepartmentInclude(repo repository.DepartmentRepository) Include {
+	return Include{
+		Fields:  []string{"department_id"},
+		Type:    "departments",
+		IDField: "department_id",
+		Load: func(users []model.User) (map[int64]interface{}, error) {
+			departments, err := repo.ListDepartments()
+			if err != nil {
+				return nil, err
+			}
+			byID := map[int64]model.Department{}
+			for _, department := range departments {
+				byID[department.ID] = department
+			}
+
+			related := map[int64]interface{}{}
+			for _, user := range users {
+				if department, ok := byID[user.DepartmentID]; ok {
+					related[user.ID] = department
+				}
+			}
+			return related, nil
+		},
+	}
+}
+
+// departmentID reads the department ID from the path
+func departmentID(ctx echo.Context) (int, error) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return 0, failWithStatus(http.StatusBadRequest, codeInvalidID, "Invalid department ID", fmt.Sprintf("department ID must be an integer, got %q", ctx.Param("id")))
+	}
+	return id, nil
+}
+
+// bindDepartment reads and validates a department from the request body
+func bindDepartment(ctx echo.Context) (model.Department, error) {
+	var department model.Department
+	if err := bind(ctx, &department); err != nil {
+		return department, fail("Invalid request body", err)
+	}
+	if fields := validate.Struct(department); len(fields) > 0 {
+		return department, fail("Invalid department", repository.ValidationError(fields))
+	}
+	return department, nil
+}
+
+// @Summary Get all departments
+// @Description Retrieve every department, ordered by name
+// @Tags departments
+// @Accept json
+// @Produce json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Success 200 {object} response.SuccessResponse{data=[]model.Department}
+// @Failure 406 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /departments [get]
+func (dc *DepartmentController) GetAllDepartments(ctx echo.Context) error {
+	departments, err := dc.repo.ListDepartments()
+	if err != nil {
+		return fail("Failed to retrieve departments", err)
+	}
+	return response.JSONSuccessResponse(ctx, "Departments retrieved successfully", departments)
+}
+
+// @Summary Get department by ID
+// @Description Retrieve a department by its ID
+// @Tags departments
+// @Accept json
+// @Produce json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Param id path int true "Department ID"
+// @Success 200 {object} response.SuccessResponse{data=model.Department}
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 406 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /departments/{id} [get]
+func (dc *DepartmentController) GetDepartmentByID(ctx echo.Context) error {
+	id, err := departmentID(ctx)
+	if err != nil {
+		return err
+	}
+
+	department, err := dc.repo.GetDepartmentByID(id)
+	if err != nil {
+		return fail("Failed to retrieve department", err)
+	}
+	return response.JSONSuccessResponse(ctx, "Department retrieved successfully", department)
+}
+
+// @Summary Create a department
+// @Description Create a department. Its name must not be taken by another department in any case.
+// @Tags departments
+// @Accept json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Produce json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Param department body model.Department true "Department details"
+// @Param Idempotency-Key header string false "Key under which the response is replayed to retries of the same request"
+// @Success 200 {object} response.SuccessResponse{data=model.Department}
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 406 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Failure 415 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /departments [post]
+func (dc *DepartmentController) CreateDepartment(ctx echo.Context) error {
+	department, err := bindDepartment(ctx)
+	if err != nil {
+		return err
+	}
+
+	created, err := dc.repo.CreateDepartment(department)
+	if err != nil {
+		return fail("Failed to create department", err)
+	}
+	return response.JSONSuccessResponse(ctx, "Department created successfully", created)
+}
+
+// @Summary Rename a department
+// @Description Rename the department with the given ID, and its users with it; each of its users gets a new version. A department_id in the body must match the path.
+// @Tags departments
+// @Accept json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Produce json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Param id path int true "Department ID"
+// @Param department body model.Department true "Department details"
+// @Success 200 {object} response.SuccessResponse{data=model.Department}
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 406 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Failure 415 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /departments/{id} [put]
+func (dc *DepartmentController) UpdateDepartment(ctx echo.Context) error {
+	id, err := departmentID(ctx)
+	if err != nil {
+		return err
+	}
+	department, err := bindDepartment(ctx)
+	if err != nil {
+		return err
+	}
+	if department.ID != 0 && department.ID != int64(id) {
+		return failWithStatus(http.StatusBadRequest, codeIDMismatch, "Invalid department ID",
+			fmt.Sprintf("department_id %d in the body does not match %d in the path", department.ID, id))
+	}
+	department.ID = int64(id)
+
+	updated, err := dc.repo.UpdateDepartment(department)
+	if err != nil {
+		return fail("Failed to update department", err)
+	}
+	return response.JSONSuccessResponse(ctx, "Department updated successfully", updated)
+}
+
+// @Summary Delete a department
+// @Description Delete a department. A department that still has users, deleted ones included, cannot be deleted unless reassign_to names the department to move them to.
+// @Tags departments
+// @Accept json
+// @Produce json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Param id path int true "Department ID"
+// @Param reassign_to query int false "Department to move the users of the deleted department to"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 406 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /departments/{id} [delete]
+func (dc *DepartmentController) DeleteDepartment(ctx echo.Context) error {
+	id, err := departmentID(ctx)
+	if err != nil {
+		return err
+	}
+	reassignTo, err := queryInt(ctx, "reassign_to")
+	if err != nil {
+		return badRequest(codeInvalidParameter, "Invalid reassign_to", err)
+	}
+
+	deleted, err := dc.repo.DeleteDepartment(id, reassignTo)
+	if err != nil {
+		return fail("Failed to delete department", err)
+	}
+	if !deleted {
+		return fail("Failed to delete department", repository.Errorf(repository.ErrNotFound, "no department found with ID %d", id))
+	}
+
+	return response.JSONSuccessResponse(ctx, "Department deleted successfully", nil)
+}
+
+// @Summary Get the users of a department
+// @Description Retrieve a page of the users of a department, with the same parameters as listing all users
+// @Tags departments
+// @Accept json
+// @Produce json,application/hal+json,application/vnd.api+json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Param id path int true "Department ID"
+// @Param limit query int false "Page size (default 50, max 200)"
+// @Param offset query int false "Number of users to skip; cannot be combined with cursor"
+// @Param cursor query string false "Opaque cursor taken from next_cursor or prev_cursor of a previous page"
+// @Param filter query string false "Filter expression, e.g. user_status ne \"T\""
+// @Param sort query string false "Comma-separated columns to sort by, prefixed with - for descending, e.g. last_name,first_name"
+// @Param fields query string false "Comma-separated user fields to return, e.g. user_id,user_name"
+// @Param include query string false "Comma-separated related resources to embed under _embedded"
+// @Param include_deleted query bool false "Also list soft-deleted users"
+// @Success 200 {object} response.PaginatedResponse{data=[]model.User}
+// @Header 200 {string} Link "RFC 8288 links to the first, next and previous pages"
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 406 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /departments/{id}/users [get]
+func (dc *DepartmentController) GetDepartmentUsers(ctx echo.Context) error {
+	id, err := departmentID(ctx)
+	if err != nil {
+		return err
+	}
+	if _, err := dc.repo.GetDepartmentByID(id); err != nil {
+		return fail("Failed to retrieve users", err)
+	}
+
+	return dc.users.listUsers(ctx, repository.ListOptions{Filter: &filter.Comparison{
+		Field:  "department_id",
+		Op:     filter.Eq,
+		Values: []filter.Value{{Kind: filter.NumberValue, Text: strconv.Itoa(id)}},
+	}})
+}
@@ -0,0 +1,133 @@
+package controllers
+
+import (
+	"sample-service/internal/repository"
+
+	"github.com/labstack/echo/v4"
+)
+
+// DepartmentControllerV2 serves the departments in version 2 of the API. The
+// departments are the same as in version 1; the users of a department are
+// shown as version 2 shows users. Its methods carry the documentation of
+// the version.
+type DepartmentControllerV2 struct {
+	*DepartmentController
+}
+
+// NewDepartmentControllerV2 creates a new DepartmentControllerV2
+func NewDepartmentControllerV2(repo repository.DepartmentRepository, users *UserControllerV2) *DepartmentControllerV2 {
+	return &DepartmentControllerV2{DepartmentController: NewDepartmentController(repo, users.UserController)}
+}
+
+// @Summary Get all departments
+// @Description Retrieve every department, ordered by name
+// @Tags v2
+// @Accept json
+// @Produce json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Success 200 {object} response.SuccessResponse{data=[]model.Department}
+// @Failure 406 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /departments [get]
+func (dc *DepartmentControllerV2) GetAllDepartments(ctx echo.Context) error {
+	return dc.DepartmentController.GetAllDepartments(ctx)
+}
+
+// @Summary Get department by ID
+// @Description Retrieve a department by its ID
+// @Tags v2
+// @Accept json
+// @Produce json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Param id path int true "Department ID"
+// @Success 200 {object} response.SuccessResponse{data=model.Department}
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 406 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /departments/{id} [get]
+func (dc *DepartmentControllerV2) GetDepartmentByID(ctx echo.Context) error {
+	return dc.DepartmentController.GetDepartmentByID(ctx)
+}
+
+// @Summary Create a department
+// @Description Create a department. Its name must not be taken by another department in any case.
+// @Tags v2
+// @Accept json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Produce json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Param department body model.Department true "Department details"
+// @Param Idempotency-Key header string false "Key under which the response is replayed to retries of the same request"
+// @Success 200 {object} response.SuccessResponse{data=model.Department}
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 406 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Failure 415 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /departments [post]
+func (dc *DepartmentControllerV2) CreateDepartment(ctx echo.Context) error {
+	return dc.DepartmentController.CreateDepartment(ctx)
+}
+
+// @Summary Rename a department
+// @Description Rename the department with the given ID, and its users with it; each of its users gets a new version. A department_id in the body must match the path.
+// @Tags v2
+// @Accept json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Produce json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Param id path int true "Department ID"
+// @Param department body model.Department true "Department details"
+// @Success 200 {object} response.SuccessResponse{data=model.Department}
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 406 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Failure 415 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /departments/{id} [put]
+func (dc *DepartmentControllerV2) UpdateDepartment(ctx echo.Context) error {
+	return dc.DepartmentController.UpdateDepartment(ctx)
+}
+
+// @Summary Delete a department
+// @Description Delete a department. A department that still has users, deleted ones included, cannot be deleted unless reassign_to names the department to move them to.
+// @Tags v2
+// @Accept json
+// @Produce json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Param id path int true "Department ID"
+// @Param reassign_to query int false "Department to move the users of the deleted department to"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 406 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /departments/{id} [delete]
+func (dc *DepartmentControllerV2) DeleteDepartment(ctx echo.Context) error {
+	return dc.DepartmentController.DeleteDepartment(ctx)
+}
+
+// @Summary Get the users of a department
+// @Description Retrieve a page of the users of a department, with the same parameters as listing all users
+// @Tags v2
+// @Accept json
+// @Produce json,application/hal+json,application/vnd.api+json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Param id path int true "Department ID"
+// @Param limit query int false "Page size (default 50, max 200)"
+// @Param offset query int false "Number of users to skip; cannot be combined with cursor"
+// @Param cursor query string false "Opaque cursor taken from next_cursor or prev_cursor of a previous page"
+// @Param filter query string false "Filter expression, e.g. user_status ne \"terminated\""
+// @Param sort query string false "Comma-separated columns to sort by, prefixed with - for descending, e.g. last_name,first_name"
+// @Param fields query string false "Comma-separated user fields to return, e.g. user_id,user_name,created_at"
+// @Param include query string false "Comma-separated related resources to embed under _embedded"
+// @Param include_deleted query bool false "Also list soft-deleted users"
+// @Success 200 {object} response.PaginatedResponse{data=[]model.UserV2}
+// @Header 200 {string} Link "RFC 8288 links to the first, next and previous pages"
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 406 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /departments/{id}/users [get]
+func (dc *DepartmentControllerV2) GetDepartmentUsers(ctx echo.Context) error {
+	return dc.DepartmentController.GetDepartmentUsers(ctx)
+}
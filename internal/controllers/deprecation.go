@@ -0,0 +1,49 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Headers announcing that a route is going away
+const (
+	headerDeprecation = "Deprecation"
+	headerSunset      = "Sunset"
+	headerLink        = "Link"
+)
+
+// Deprecation describes routes that are still served but going away
+type Deprecation struct {
+	// Since is when the routes were deprecated
+	Since time.Time
+	// Sunset is when the routes stop being served, zero while undecided
+	Sunset time.Time
+	// Prefix is the path the deprecated routes start with, and Successor
+	// what replaces it in the paths of the routes that take over
+	Prefix    string
+	Successor string
+}
+
+// Deprecated marks every response of the routes it wraps as deprecated,
+// with an RFC 9745 Deprecation header, an RFC 8594 Sunset header once the
+// date is set, and a link to the same resource under the successor.
+func Deprecated(d Deprecation) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			header := ctx.Response().Header()
+			header.Set(headerDeprecation, fmt.Sprintf("@%d", d.Since.Unix()))
+			if !d.Sunset.IsZero() {
+				header.Set(headerSunset, d.Sunset.UTC().Format(http.TimeFormat))
+			}
+			if d.Successor != "" {
+				path := d.Successor + strings.TrimPrefix(ctx.Request().URL.Path, d.Prefix)
+				header.Add(headerLink, fmt.Sprintf(`<%s>; rel="successor-version"`, path))
+			}
+			return next(ctx)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sample-service/internal/model"
+	"sample-service/internal/repository"
+	"sample-service/internal/response"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Stable codes of the errors the handlers raise themselves, alongside the
+// repository's codes. Plain HTTP errors, such as echo's for an unknown
+// route, take a code made from their status text, like "not_found".
+const (
+	codeInvalidID            = "invalid_id"
+	codeIDMismatch           = "id_mismatch"
+	codeTypeMismatch         = "type_mismatch"
+	codeInvalidParameter     = "invalid_parameter"
+	codeInvalidFilter        = "invalid_filter"
+	codeInvalidSort          = "invalid_sort"
+	codeInvalidBody          = "invalid_body"
+	codeInvalidPatch         = "invalid_patch"
+	codePatchTestFailed      = "patch_test_failed"
+	codeInvalidUpload        = "invalid_upload"
+	codeForbidden            = "forbidden"
+	codePreconditionFailed   = "precondition_failed"
+	codeTooLarge             = "too_large"
+	codeRolledBack           = "rolled_back"
+	codeNotApplied           = "not_applied"
+	codeIdempotencyKey       = "idempotency_key_invalid"
+	codeIdempotencyReused    = "idempotency_key_reused"
+	codeIdempotencyInUse     = "idempotency_key_in_use"
+	codeNotAcceptable        = "not_acceptable"
+	codeUnsupportedMediaType = "unsupported_media_type"
+	codeInternal             = "internal_error"
+)
+
+// failure is an error returned by a handler together with the message the
+// client is shown for it, and the code when the error has none of its own.
+// The status is worked out from the error itself.
+type failure struct {
+	message string
+	code    string
+	err     error
+}
+
+func (f *failure) Error() string {
+	return f.message + ": " + f.err.Error()
+}
+
+func (f *failure) Unwrap() error {
+	return f.err
+}
+
+// fail returns err from a handler with the message to show for it
+func fail(message string, err error) error {
+	return &failure{message: message, err: err}
+}
+
+// failWithStatus returns an error from a handler that is answered with the
+// given status and code, for failures that are not about the data
+func failWithStatus(status int, code, message, detail string) error {
+	return &failure{message: message, code: code, err: echo.NewHTTPError(status, detail)}
+}
+
+// badRequest returns an error for a request that cannot be understood,
+// such as a malformed ID or query parameter
+func badRequest(code, message string, err error) error {
+	return failWithStatus(http.StatusBadRequest, code, message, err.Error())
+}
+
+// errorStatus maps an error to the HTTP status it is answered with.
+// Repository errors are mapped by kind; anything unrecognised is a 500.
+func errorStatus(err error) int {
+	var httpErr *echo.HTTPError
+	switch {
+	case errors.As(err, &httpErr):
+		return httpErr.Code
+	case errors.Is(err, repository.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, repository.ErrConflict), errors.Is(err, repository.ErrConstraint):
+		return http.StatusConflict
+	case errors.Is(err, repository.ErrValidation):
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusInternalServerError
+}
+
+// errorCode finds the stable code of an error: the code a handler gave
+// it, or else the code of the repository or HTTP error it wraps
+func errorCode(err error) string {
+	for err != nil {
+		switch e := err.(type) {
+		case *failure:
+			if e.code != "" {
+				return e.code
+			}
+		case *repository.Error:
+			return e.ErrorCode()
+		case *echo.HTTPError:
+			return strings.ReplaceAll(strings.ToLower(http.StatusText(e.Code)), " ", "_")
+		}
+		err = errors.Unwrap(err)
+	}
+	return codeInternal
+}
+
+// errorFields lists the fields at fault in a validation error
+func errorFields(err error) []model.FieldError {
+	var repoErr *repository.Error
+	if errors.As(err, &repoErr) {
+		return repoErr.Fields
+	}
+	return nil
+}
+
+// HTTPErrorHandler is the echo error handler for the service. Every error
+// a handler returns, and echo's own routing errors, are answered with an
+// ErrorResponse whose status and code follow from the error, in the format
+// the client accepts, or with RFC 9457 problem details when it asks for
+// them.
+func HTTPErrorHandler(err error, ctx echo.Context) {
+	if ctx.Response().Committed {
+		return
+	}
+
+	status := errorStatus(err)
+	message := http.StatusText(status)
+	detail := err
+	var f *failure
+	if errors.As(err, &f) {
+		message, detail = f.message, f.err
+	}
+
+	text := detail.Error()
+	var httpErr *echo.HTTPError
+	if errors.As(detail, &httpErr) {
+		text = fmt.Sprint(httpErr.Message)
+	}
+	if status >= http.StatusInternalServerError {
+		ctx.Logger().Error(err)
+	}
+
+	code, fields := errorCode(err), errorFields(err)
+	ctx.Response().Header().Add(echo.HeaderVary, echo.HeaderAccept)
+	switch {
+	case ctx.Request().Method == http.MethodHead:
+		err = ctx.NoContent(status)
+	case response.WantsProblem(ctx.Request()):
+		err = response.JSONProblemResponse(ctx, response.NewProblem(ctx, status, code, text, fields))
+	default:
+		err = response.Render(ctx, status, response.ErrorResponse{Message: message, Error: text, Code: code, Errors: fields})
+	}
+	if err != nil {
+		ctx.Logger().Error(err)
+	}
+}
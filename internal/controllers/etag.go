@@ -0,0 +1,69 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"sample-service/internal/model"
+	"sample-service/internal/response"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Conditional request headers, which echo does not define
+const (
+	headerETag        = "ETag"
+	headerIfMatch     = "If-Match"
+	headerIfNoneMatch = "If-None-Match"
+)
+
+// userETag is the strong entity tag of the full representation of a user
+// in the version of the API and the format the request is answered in,
+// such as "v1-json-4". It changes whenever the user is written, and, being
+// strong, differs between representations of the same write.
+func (uc *UserController) userETag(ctx echo.Context, user model.User) string {
+	format, _ := response.Negotiate(ctx.Request().Header.Get(echo.HeaderAccept))
+	return fmt.Sprintf(`"%s-%s-%d"`, uc.view.name(), strings.TrimPrefix(format.MediaType, "application/"), user.Version)
+}
+
+// etagMatches reports whether a list of entity tags from an If-Match or
+// If-None-Match header contains etag, or is "*". Weak tags never match
+// with strong comparison.
+func etagMatches(header, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// ifMatchVersion evaluates an If-Match header against the current user. It
+// returns the version a write must be conditional on, or 0 when there is no
+// header, and false when the precondition fails.
+func (uc *UserController) ifMatchVersion(ctx echo.Context, current model.User) (int64, bool) {
+	header := ctx.Request().Header.Get(headerIfMatch)
+	if header == "" {
+		return 0, true
+	}
+	if !etagMatches(header, uc.userETag(ctx, current), false) {
+		return 0, false
+	}
+	return current.Version, true
+}
+
+// preconditionFailed fails a request with 412, with the current ETag when it
+// is known so the client can fetch the user again and retry
+func (uc *UserController) preconditionFailed(ctx echo.Context, current *model.User) error {
+	if current != nil {
+		ctx.Response().Header().Set(headerETag, uc.userETag(ctx, *current))
+	}
+	return failWithStatus(http.StatusPreconditionFailed, codePreconditionFailed, "Precondition failed", "the user has been modified since it was last read")
+}
@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"sample-service/internal/repository"
+	"sample-service/internal/response"
+
+	"github.com/labstack/echo/v4"
+)
+
+// @Summary Get the reports of a user
+// @Description Retrieve a page of the users who report to a user, with the same parameters as listing all users. Only direct reports are listed unless recursive is set, which lists everyone below the user in the hierarchy; each user's manager_id tells who they report to.
+// @Accept json
+// @Produce json,application/hal+json,application/vnd.api+json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Param id path int true "User ID"
+// @Param recursive query bool false "Also list the reports of reports, at any depth"
+// @Param limit query int false "Page size (default 50, max 200)"
+// @Param offset query int false "Number of users to skip; cannot be combined with cursor"
+// @Param cursor query string false "Opaque cursor taken from next_cursor or prev_cursor of a previous page"
+// @Param filter query string false "Filter expression, e.g. user_status ne \"T\""
+// @Param sort query string false "Comma-separated columns to sort by, prefixed with - for descending, e.g. last_name,first_name"
+// @Param fields query string false "Comma-separated user fields to return, e.g. user_id,user_name,manager_id"
+// @Param include query string false "Comma-separated related resources to embed under _embedded"
+// @Param include_deleted query bool false "Also list soft-deleted users"
+// @Success 200 {object} response.PaginatedResponse{data=[]model.User}
+// @Header 200 {string} Link "RFC 8288 links to the first, next and previous pages"
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 406 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /users/{id}/reports [get]
+func (uc *UserController) GetUserReports(ctx echo.Context) error {
+	id, err := pathID(ctx)
+	if err != nil {
+		return err
+	}
+	recursive, err := queryBool(ctx, "recursive")
+	if err != nil {
+		return badRequest(codeInvalidParameter, "Invalid recursive", err)
+	}
+	if _, err := uc.repo.GetUserByID(id, "user_id"); err != nil {
+		return fail("Failed to retrieve reports", err)
+	}
+
+	return uc.listUsers(ctx, repository.ListOptions{ReportsTo: int64(id), Recursive: recursive})
+}
+
+// @Summary Get the management chain of a user
+// @Description Retrieve the managers of a user, from the one they report to up to the top of the hierarchy. Deleted managers are left out.
+// @Accept json
+// @Produce json,application/hal+json,application/vnd.api+json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Param id path int true "User ID"
+// @Param fields query string false "Comma-separated user fields to return, e.g. user_id,user_name,manager_id"
+// @Param include query string false "Comma-separated related resources to embed under _embedded"
+// @Success 200 {object} response.SuccessResponse{data=[]model.User}
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 406 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /users/{id}/chain [get]
+func (uc *UserController) GetUserChain(ctx echo.Context) error {
+	id, err := pathID(ctx)
+	if err != nil {
+		return err
+	}
+	shape, err := uc.parseShape(ctx)
+	if err != nil {
+		return badRequest(codeInvalidParameter, "Invalid fields or include", err)
+	}
+
+	managers, err := uc.repo.ManagementChain(id)
+	if err != nil {
+		return fail("Failed to retrieve management chain", err)
+	}
+	data, err := uc.shapeUsers(managers, shape)
+	if err != nil {
+		return fail("Failed to retrieve management chain", err)
+	}
+	return response.JSONSuccessResponse(ctx, "Management chain retrieved successfully", data)
+}
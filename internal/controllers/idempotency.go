@@ -0,0 +1,164 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"sample-service/internal/repository"
+	"sample-service/internal/response"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Headers of the IETF Idempotency-Key draft
+const (
+	headerIdempotencyKey     = "Idempotency-Key"
+	headerIdempotentReplayed = "Idempotent-Replayed"
+)
+
+// maxIdempotencyKeyLength bounds the keys clients may send
+const maxIdempotencyKeyLength = 255
+
+// DefaultIdempotencyTTL is how long a response is replayed for retries
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+// replayedHeaders are the response headers stored with a response and
+// replayed with it
+var replayedHeaders = []string{echo.HeaderContentType, echo.HeaderLocation, headerETag, echo.HeaderVary}
+
+// Idempotency makes POST handlers safe to retry. A request carrying an
+// Idempotency-Key is handled once; retries with the same key and the same
+// request get the stored response until it expires after ttl, while
+// reusing the key for a different request is refused with 422. Keys are
+// scoped to the actor, so callers cannot run into each other's keys. Server
+// errors are not stored, so the request can be retried after them, and a
+// key whose handler panics is given up too.
+func Idempotency(repo repository.IdempotencyRepository, ttl time.Duration) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			key := ctx.Request().Header.Get(headerIdempotencyKey)
+			if key == "" {
+				return next(ctx)
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				return failWithStatus(http.StatusBadRequest, codeIdempotencyKey, "Invalid Idempotency-Key",
+					fmt.Sprintf("the key must be at most %d characters", maxIdempotencyKeyLength))
+			}
+
+			fingerprint, err := requestFingerprint(ctx)
+			if err != nil {
+				return fail("Invalid request body", err)
+			}
+			actor := actorName(ctx)
+			now := time.Now()
+			existing, err := repo.ClaimKey(repository.IdempotencyRecord{
+				Actor:       actor,
+				Key:         key,
+				Fingerprint: fingerprint,
+				ExpiresAt:   now.Add(ttl),
+			}, now)
+			if err != nil {
+				return fail("Failed to check Idempotency-Key", err)
+			}
+			switch {
+			case existing == nil:
+			case existing.Fingerprint != fingerprint:
+				return failWithStatus(http.StatusUnprocessableEntity, codeIdempotencyReused, "Idempotency-Key reused",
+					"the key was already used for a different request")
+			case existing.Status == 0:
+				return failWithStatus(http.StatusConflict, codeIdempotencyInUse, "Idempotency-Key in use",
+					"a request with this key is still being handled")
+			default:
+				return replay(ctx, *existing)
+			}
+
+			// Errors are answered here rather than by echo, so that the
+			// response they get can be stored too
+			recorder := &bodyRecorder{ResponseWriter: ctx.Response().Writer}
+			ctx.Response().Writer = recorder
+			defer func() {
+				if recovered := recover(); recovered != nil {
+					ctx.Response().Writer = recorder.ResponseWriter
+					if err := repo.ReleaseKey(actor, key); err != nil {
+						ctx.Logger().Error(err)
+					}
+					panic(recovered)
+				}
+			}()
+			if err := next(ctx); err != nil {
+				ctx.Error(err)
+			}
+			ctx.Response().Writer = recorder.ResponseWriter
+
+			status := ctx.Response().Status
+			if status >= http.StatusInternalServerError {
+				err = repo.ReleaseKey(actor, key)
+			} else {
+				header := http.Header{}
+				for _, name := range replayedHeaders {
+					if value := ctx.Response().Header().Get(name); value != "" {
+						header.Set(name, value)
+					}
+				}
+				err = repo.CompleteKey(repository.IdempotencyRecord{
+					Actor:  actor,
+					Key:    key,
+					Status: status,
+					Header: header,
+					Body:   recorder.body.Bytes(),
+				})
+			}
+			if err != nil {
+				ctx.Logger().Error(err)
+			}
+			return nil
+		}
+	}
+}
+
+// requestFingerprint hashes what makes a request the same request: its
+// method, its target, the format it is answered in and its body. Who sends
+// it is part of the key instead. The body is put back for the handler to
+// read.
+func requestFingerprint(ctx echo.Context) (string, error) {
+	req := ctx.Request()
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return "", err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	format, _ := response.Negotiate(req.Header.Get(echo.HeaderAccept))
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s %s\n%s %t\n", req.Method, req.URL.RequestURI(), format.MediaType, response.WantsProblem(req))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// replay answers a retry with the stored response
+func replay(ctx echo.Context, record repository.IdempotencyRecord) error {
+	for name, values := range record.Header {
+		for _, value := range values {
+			ctx.Response().Header().Add(name, value)
+		}
+	}
+	ctx.Response().Header().Set(headerIdempotentReplayed, "true")
+	ctx.Response().WriteHeader(record.Status)
+	_, err := ctx.Response().Write(record.Body)
+	return err
+}
+
+// bodyRecorder keeps a copy of the response body as it is written
+type bodyRecorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *bodyRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
@@ -0,0 +1,151 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sample-service/internal/model"
+	"sample-service/internal/response"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// usersType is the JSON:API type of users
+const usersType = "users"
+
+// resources turns users into JSON:API resource objects, with their
+// requested includes as relationships and included resources. The user_id
+// is the id of the resource rather than an attribute.
+func (uc *UserController) resources(users []model.User, shape userShape, included map[string]map[int64]interface{}) (interface{}, error) {
+	compound := response.Compound{}
+	resources := make([]response.Resource, len(users))
+	seen := map[response.ResourceIdentifier]bool{}
+	for i, user := range users {
+		attributes, err := projectUser(uc.view.show(user), shape.fields)
+		if err != nil {
+			return nil, err
+		}
+		delete(attributes, "user_id")
+		resource := response.Resource{
+			Type:       usersType,
+			ID:         strconv.FormatInt(user.ID, 10),
+			Attributes: attributes,
+			Links:      response.Links{"self": {Href: fmt.Sprintf("%s/users/%d", shape.base, user.ID)}},
+		}
+
+		for _, name := range shape.includes {
+			if resource.Relationships == nil {
+				resource.Relationships = map[string]response.Relationship{}
+			}
+			related := included[name][user.ID]
+			if related == nil {
+				resource.Relationships[name] = response.Relationship{}
+				continue
+			}
+			relatedResource, err := includedResource(uc.includes[name], related, shape.typeFields)
+			if err != nil {
+				return nil, fmt.Errorf("failed to include %s: %w", name, err)
+			}
+			identifier := response.ResourceIdentifier{Type: relatedResource.Type, ID: relatedResource.ID}
+			resource.Relationships[name] = response.Relationship{Data: &identifier}
+			if !seen[identifier] {
+				seen[identifier] = true
+				compound.Included = append(compound.Included, relatedResource)
+			}
+		}
+		resources[i] = resource
+	}
+	compound.Data = resources
+	return compound, nil
+}
+
+// includedResource turns a resource loaded by an include into a JSON:API
+// resource object, keeping only the fields of its type that were asked for
+func includedResource(include Include, related interface{}, typeFields map[string][]string) (response.Resource, error) {
+	attributes, err := projectUser(related, typeFields[include.Type])
+	if err != nil {
+		return response.Resource{}, err
+	}
+	full, err := projectUser(related, nil)
+	if err != nil {
+		return response.Resource{}, err
+	}
+	id, ok := full[include.IDField]
+	if !ok {
+		return response.Resource{}, fmt.Errorf("%s has no %s", include.Type, include.IDField)
+	}
+	delete(attributes, include.IDField)
+	return response.Resource{Type: include.Type, ID: fmt.Sprint(id), Attributes: attributes}, nil
+}
+
+// resourceDocument is a JSON:API request body holding one resource object
+type resourceDocument struct {
+	Data *struct {
+		Type       string                     `json:"type"`
+		ID         *string                    `json:"id"`
+		Attributes map[string]json.RawMessage `json:"attributes"`
+	} `json:"data"`
+}
+
+// readResource reads a JSON:API user resource object into the JSON object
+// of a user, with its id as the user_id. A resource of another type, or
+// with an id other than wantID when that is not 0, conflicts with the
+// endpoint as JSON:API requires.
+func readResource(body []byte, wantID int64) ([]byte, error) {
+	var doc resourceDocument
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, badRequest(codeInvalidBody, "Invalid request body", err)
+	}
+	if doc.Data == nil {
+		return nil, badRequest(codeInvalidBody, "Invalid request body", fmt.Errorf("the body must hold a resource object in data"))
+	}
+	if doc.Data.Type != usersType {
+		return nil, failWithStatus(http.StatusConflict, codeTypeMismatch, "Invalid resource type",
+			fmt.Sprintf("resource type must be %q, got %q", usersType, doc.Data.Type))
+	}
+
+	object := map[string]json.RawMessage{}
+	for name, value := range doc.Data.Attributes {
+		object[name] = value
+	}
+	delete(object, "user_id")
+	if doc.Data.ID != nil {
+		id, err := strconv.ParseInt(*doc.Data.ID, 10, 64)
+		if err != nil || (wantID != 0 && id != wantID) {
+			return nil, failWithStatus(http.StatusConflict, codeIDMismatch, "Invalid user ID",
+				fmt.Sprintf("resource id %q does not match the user", *doc.Data.ID))
+		}
+		object["user_id"] = json.RawMessage(*doc.Data.ID)
+	}
+	return json.Marshal(object)
+}
+
+// bindUser reads a user document from the request body: from a JSON:API
+// resource object for JSON:API, in any other format as bind does
+func bindUser(ctx echo.Context, doc interface{}, wantID int64) error {
+	req := ctx.Request()
+	mediaType, params, err := mime.ParseMediaType(req.Header.Get(echo.HeaderContentType))
+	if err != nil || mediaType != response.MIMEApplicationJSONAPI {
+		return bind(ctx, doc)
+	}
+	if !response.JSONAPIParams(params) {
+		return failWithStatus(http.StatusUnsupportedMediaType, codeUnsupportedMediaType, "Unsupported media type",
+			"JSON:API bodies may only have the ext and profile parameters")
+	}
+
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return err
+	}
+	object, err := readResource(body, wantID)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(object, doc); err != nil {
+		return badRequest(codeInvalidBody, "Invalid request body", err)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"sample-service/internal/model"
+	"sample-service/internal/response"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// linkFields are the user fields userLinks reads; they are loaded even when
+// ?fields= leaves them out of the response
+var linkFields = []string{"user_id", "user_status", "deleted_at", "manager_id"}
+
+// userLinks are the HAL links of a user: itself, the collection, its place
+// in the hierarchy and the actions its state allows. A deleted user can
+// only be restored; otherwise each transition of the lifecycle that applies
+// to the user's status links to its endpoint.
+func userLinks(base string, user model.User) response.Links {
+	self := fmt.Sprintf("%s/users/%d", base, user.ID)
+	links := response.Links{
+		"self":       {Href: self},
+		"collection": {Href: base + "/users"},
+	}
+	if user.DeletedAt != nil {
+		links["restore"] = response.Link{Href: self + "/restore", Method: http.MethodPost}
+		return links
+	}
+
+	links["update"] = response.Link{Href: self, Method: http.MethodPut}
+	links["edit"] = response.Link{Href: self, Method: http.MethodPatch}
+	links["delete"] = response.Link{Href: self, Method: http.MethodDelete}
+	links["transitions"] = response.Link{Href: self + "/transitions"}
+	links["reports"] = response.Link{Href: self + "/reports"}
+	links["chain"] = response.Link{Href: self + "/chain"}
+	if user.ManagerID != 0 {
+		links["manager"] = response.Link{Href: fmt.Sprintf("%s/users/%d", base, user.ManagerID)}
+	}
+	for _, transition := range model.Transitions {
+		if transition.Allows(user.UserStatus) {
+			links[transition.Name] = response.Link{Href: self + "/" + transition.Name, Method: http.MethodPost}
+		}
+	}
+	return links
+}
+
+// apiBase is the path the version of the API a request was routed to is
+// mounted at, such as /v1, for links to stay within it
+func apiBase(ctx echo.Context) string {
+	base, _, _ := strings.Cut(ctx.Path(), "/users")
+	base, _, _ = strings.Cut(base, "/departments")
+	return base
+}
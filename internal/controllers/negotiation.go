@@ -0,0 +1,54 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sample-service/internal/response"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Negotiate refuses with 406 a request whose Accept header admits none of
+// the formats responses are written in, before its handler does any work
+func Negotiate(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		if _, ok := response.Negotiate(ctx.Request().Header.Get(echo.HeaderAccept)); !ok {
+			return failWithStatus(http.StatusNotAcceptable, codeNotAcceptable, "Not acceptable",
+				"responses are available as "+strings.Join(response.MediaTypes(), ", "))
+		}
+		return next(ctx)
+	}
+}
+
+// bind reads the request body into v in any of the formats responses are
+// written in. JSON and forms are left to echo's binder; a body of any
+// other type is refused with 415, as is JSON:API, which bindUser reads
+// for the bodies that are a single user.
+func bind(ctx echo.Context, v interface{}) error {
+	req := ctx.Request()
+	format := response.FormatOf(req.Header.Get(echo.HeaderContentType))
+	if format == response.JSONAPI {
+		return failWithStatus(http.StatusUnsupportedMediaType, codeUnsupportedMediaType, "Unsupported media type",
+			"JSON:API bodies are only accepted for single users")
+	}
+	if format == nil || format == response.JSON {
+		err := ctx.Bind(v)
+		if errors.Is(err, echo.ErrUnsupportedMediaType) {
+			return failWithStatus(http.StatusUnsupportedMediaType, codeUnsupportedMediaType, "Unsupported media type",
+				"request bodies are accepted as "+strings.Join(response.MediaTypes(), ", "))
+		}
+		return err
+	}
+
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return err
+	}
+	if err := format.Unmarshal(body, v); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid %s body: %v", format.MediaType, err)).SetInternal(err)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package controllers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"sample-service/internal/orgchart"
+	"sample-service/internal/repository"
+	"sample-service/internal/response"
+
+	"github.com/labstack/echo/v4"
+)
+
+// @Summary Get the org chart
+// @Description Draw the reporting lines below a user, or the whole hierarchy from the users who report to no one, with each user's name, department and status.
+// @Description With department_id only the users of that department are drawn, as a chart of the department.
+// @Description As json the chart is a list of nested users, each with their reports; as dot it is a Graphviz digraph; as svg it is an image laid out top down, ready to print.
+// @Description Terminated users are drawn greyed out with a dashed border. Deleted users are left out, and their reports are drawn under the nearest manager above them.
+// @Produce json
+// @Produce text/vnd.graphviz
+// @Produce image/svg+xml
+// @Param root query int false "User at the top of the chart; all users who report to no one by default"
+// @Param department_id query int false "Department to draw; its users whose manager is in another department are drawn at the top"
+// @Param depth query int false "Number of levels to draw, counting the top one; all levels by default"
+// @Param format query string false "json (default), dot or svg"
+// @Success 200 {object} response.SuccessResponse{data=[]orgchart.Node}
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /orgchart [get]
+func (uc *UserController) GetOrgChart(ctx echo.Context) error {
+	format := orgchart.JSON
+	if raw := ctx.QueryParam("format"); raw != "" {
+		var err error
+		if format, err = orgchart.ParseFormat(raw); err != nil {
+			return badRequest(codeInvalidParameter, "Invalid format", err)
+		}
+	}
+	root, err := queryInt(ctx, "root")
+	if err != nil {
+		return badRequest(codeInvalidParameter, "Invalid root", err)
+	}
+	departmentID, err := queryInt(ctx, "department_id")
+	if err != nil {
+		return badRequest(codeInvalidParameter, "Invalid department_id", err)
+	}
+	depth, err := queryInt(ctx, "depth")
+	if err == nil && depth < 0 {
+		err = errors.New("depth cannot be negative")
+	}
+	if err != nil {
+		return badRequest(codeInvalidParameter, "Invalid depth", err)
+	}
+
+	entries, err := uc.repo.OrgChart(repository.OrgChartOptions{Root: root, DepartmentID: int64(departmentID), Levels: depth})
+	if err != nil {
+		return fail("Failed to retrieve org chart", err)
+	}
+	roots := orgchart.Build(entries)
+	if format == orgchart.JSON {
+		return response.JSONSuccessResponse(ctx, "Org chart retrieved successfully", uc.view.showChart(roots))
+	}
+
+	// Drawn in full before anything is sent, so a failure is still
+	// answered with an error
+	var chart bytes.Buffer
+	write := orgchart.WriteDOT
+	if format == orgchart.SVG {
+		write = orgchart.WriteSVG
+	}
+	if err := write(&chart, roots); err != nil {
+		return fail("Failed to draw org chart", err)
+	}
+	ctx.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`inline; filename="orgchart.%s"`, format))
+	return ctx.Blob(http.StatusOK, format.ContentType(), chart.Bytes())
+}
@@ -0,0 +1,117 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"sample-service/internal/model"
+	"sample-service/internal/patch"
+	"sample-service/internal/repository"
+	"sample-service/internal/response"
+	"sample-service/internal/validate"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// errUnsupportedPatch is returned for a PATCH body in none of the patch formats
+var errUnsupportedPatch = echo.NewHTTPError(http.StatusUnsupportedMediaType,
+	fmt.Sprintf("content type must be %s, %s or %s", patch.MergePatchType, patch.JSONPatchType, response.MIMEApplicationJSONAPI))
+
+// applyUserPatch applies a merge patch, JSON Patch or JSON:API resource
+// object, chosen by content type, to the JSON form a version of the API
+// shows a user in and decodes the result back, returning the patched user
+// and the decoded document for the version to validate. A patch that is
+// not valid JSON is a bad request, a failed test operation a conflict with
+// the current user, and any other failure a validation error.
+func applyUserPatch(view userView, user model.User, contentType string, body []byte) (model.User, interface{}, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return user, nil, errUnsupportedPatch
+	}
+
+	doc, err := json.Marshal(view.show(user))
+	if err != nil {
+		return user, nil, err
+	}
+
+	var patched []byte
+	switch mediaType {
+	case patch.MergePatchType:
+		patched, err = patch.MergePatch(doc, body)
+	case patch.JSONPatchType:
+		patched, err = patch.ApplyJSONPatch(doc, body)
+	case response.MIMEApplicationJSONAPI:
+		// A JSON:API resource object changes the attributes it names, as
+		// a merge patch of them does
+		if !response.JSONAPIParams(params) {
+			return user, nil, errUnsupportedPatch
+		}
+		var merge []byte
+		if merge, err = readResource(body, user.ID); err != nil {
+			return user, nil, err
+		}
+		patched, err = patch.MergePatch(doc, merge)
+	default:
+		return user, nil, errUnsupportedPatch
+	}
+	var syntaxErr *json.SyntaxError
+	switch {
+	case errors.As(err, &syntaxErr):
+		return user, nil, failWithStatus(http.StatusBadRequest, codeInvalidPatch, "Invalid patch", err.Error())
+	case errors.Is(err, patch.ErrTestFailed):
+		return user, nil, &repository.Error{Kind: repository.ErrConflict, Code: codePatchTestFailed, Err: err}
+	case err != nil:
+		return user, nil, &repository.Error{Kind: repository.ErrValidation, Err: err}
+	}
+
+	// Unknown members would otherwise be dropped without a word
+	result := view.newDocument()
+	decoder := json.NewDecoder(bytes.NewReader(patched))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(result); err != nil {
+		return user, nil, repository.Errorf(repository.ErrValidation, "patched user is invalid: %w", err)
+	}
+	patchedUser := view.toUser(result)
+	if patchedUser.ID != user.ID {
+		return user, nil, repository.FieldErrorf("user_id", model.FieldReadOnly, "user_id cannot be changed")
+	}
+	if patchedUser.Version != user.Version {
+		return user, nil, repository.FieldErrorf("version", model.FieldReadOnly, "version cannot be changed, use If-Match instead")
+	}
+	if patchedUser.DeletedAt != nil {
+		return user, nil, repository.FieldErrorf("deleted_at", model.FieldReadOnly, "deleted_at and deleted_by cannot be set, use DELETE instead")
+	}
+	if patchedUser.DeletedBy != "" {
+		return user, nil, repository.FieldErrorf("deleted_by", model.FieldReadOnly, "deleted_at and deleted_by cannot be set, use DELETE instead")
+	}
+	// Removing a timestamp leaves it alone, as it would in a PUT
+	if patchedUser.CreatedAt != nil && !sameTime(patchedUser.CreatedAt, user.CreatedAt) {
+		return user, nil, repository.FieldErrorf("created_at", model.FieldReadOnly, "created_at cannot be changed")
+	}
+	if patchedUser.UpdatedAt != nil && !sameTime(patchedUser.UpdatedAt, user.UpdatedAt) {
+		return user, nil, repository.FieldErrorf("updated_at", model.FieldReadOnly, "updated_at cannot be changed")
+	}
+	patchedUser.CreatedAt, patchedUser.UpdatedAt = user.CreatedAt, user.UpdatedAt
+	return patchedUser, result, nil
+}
+
+// sameTime reports whether two optional times are the same instant
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// validateUser checks a user against the rules of model.User before it
+// is stored
+func validateUser(user model.User) error {
+	if fields := validate.Struct(user); len(fields) > 0 {
+		return repository.ValidationError(fields)
+	}
+	return nil
+}
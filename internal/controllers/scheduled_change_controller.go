@@ -0,0 +1,159 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"sample-service/internal/model"
+	"sample-service/internal/repository"
+	"sample-service/internal/response"
+	"sample-service/internal/validate"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ScheduledChangeController serves the changes scheduled for users, which
+// the scheduler applies once they take effect
+type ScheduledChangeController struct {
+	repo repository.ScheduledChangeRepository
+}
+
+// NewScheduledChangeController creates a new ScheduledChangeController
+func NewScheduledChangeController(repo repository.ScheduledChangeRepository) *ScheduledChangeController {
+	return &ScheduledChangeController{repo: repo}
+}
+
+// changeID reads the scheduled change ID from the path
+func changeID(ctx echo.Context) (int, error) {
+	id, err := strconv.Atoi(ctx.Param("change_id"))
+	if err != nil {
+		return 0, failWithStatus(http.StatusBadRequest, codeInvalidID, "Invalid change ID", fmt.Sprintf("change ID must be an integer, got %q", ctx.Param("change_id")))
+	}
+	return id, nil
+}
+
+// bindScheduledChange reads and validates a change from the request body,
+// keeping only the fields a client may set. A change must take effect in
+// the future and change the user's status, department or both.
+func bindScheduledChange(ctx echo.Context) (model.ScheduledChange, error) {
+	var body model.ScheduledChange
+	if err := bind(ctx, &body); err != nil {
+		return body, fail("Invalid request body", err)
+	}
+	change := model.ScheduledChange{
+		EffectiveAt:  body.EffectiveAt,
+		Transition:   body.Transition,
+		DepartmentID: body.DepartmentID,
+		Department:   strings.TrimSpace(body.Department),
+		Reason:       strings.TrimSpace(body.Reason),
+	}
+
+	var fields []model.FieldError
+	if change.EffectiveAt.IsZero() {
+		fields = append(fields, model.FieldError{Field: "effective_at", Code: model.FieldRequired, Detail: "effective_at is required"})
+	} else if !change.EffectiveAt.After(time.Now()) {
+		fields = append(fields, model.FieldError{Field: "effective_at", Code: model.FieldInvalid, Detail: "effective_at must be in the future"})
+	}
+	fields = append(fields, validate.Struct(change)...)
+	if change.Transition == "" && change.DepartmentID == 0 && change.Department == "" {
+		fields = append(fields, model.FieldError{Field: "transition", Code: model.FieldRequired,
+			Detail: "a scheduled change needs a transition, a department or both"})
+	}
+	if len(fields) > 0 {
+		return change, fail("Invalid scheduled change", repository.ValidationError(fields))
+	}
+	return change, nil
+}
+
+// @Summary Schedule a change to a user
+// @Description Schedule a transition of the user's status, a move to another department, or both, to take effect at effective_at. The department is named by department_id or by name.
+// @Description The scheduler applies the change once it is due, recording it as made by the caller (X-Actor) for the reason given. A change that no longer applies to the user by then, such as a transition from another status, fails instead.
+// @Accept json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Produce json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Param id path int true "User ID"
+// @Param change body model.ScheduledChange true "The change, when it takes effect and why"
+// @Param X-Actor header string false "Who is scheduling the change"
+// @Param Idempotency-Key header string false "Key under which the response is replayed to retries of the same request"
+// @Success 200 {object} response.SuccessResponse{data=model.ScheduledChange}
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 406 {object} response.ErrorResponse
+// @Failure 415 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /users/{id}/scheduled-changes [post]
+func (sc *ScheduledChangeController) ScheduleChange(ctx echo.Context) error {
+	id, err := pathID(ctx)
+	if err != nil {
+		return err
+	}
+	change, err := bindScheduledChange(ctx)
+	if err != nil {
+		return err
+	}
+	change.UserID = int64(id)
+	change.CreatedBy = actorName(ctx)
+
+	scheduled, err := sc.repo.ScheduleChange(change)
+	if err != nil {
+		return fail("Failed to schedule change", err)
+	}
+	return response.JSONSuccessResponse(ctx, "Change scheduled successfully", scheduled)
+}
+
+// @Summary Get the scheduled changes of a user
+// @Description Retrieve every change scheduled for a user in the order they take effect, including those applied, failed or cancelled
+// @Accept json
+// @Produce json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Param id path int true "User ID"
+// @Success 200 {object} response.SuccessResponse{data=[]model.ScheduledChange}
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 406 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /users/{id}/scheduled-changes [get]
+func (sc *ScheduledChangeController) GetScheduledChanges(ctx echo.Context) error {
+	id, err := pathID(ctx)
+	if err != nil {
+		return err
+	}
+
+	changes, err := sc.repo.ListScheduledChanges(id)
+	if err != nil {
+		return fail("Failed to retrieve scheduled changes", err)
+	}
+	return response.JSONSuccessResponse(ctx, "Scheduled changes retrieved successfully", changes)
+}
+
+// @Summary Cancel a scheduled change
+// @Description Cancel a change that has not taken effect yet, recording when and by whom (X-Actor). The change is kept, and a change that has been applied or has failed cannot be cancelled.
+// @Accept json
+// @Produce json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Param id path int true "User ID"
+// @Param change_id path int true "Scheduled change ID"
+// @Param X-Actor header string false "Who is cancelling the change"
+// @Success 200 {object} response.SuccessResponse{data=model.ScheduledChange}
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 406 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /users/{id}/scheduled-changes/{change_id} [delete]
+func (sc *ScheduledChangeController) CancelScheduledChange(ctx echo.Context) error {
+	id, err := pathID(ctx)
+	if err != nil {
+		return err
+	}
+	change, err := changeID(ctx)
+	if err != nil {
+		return err
+	}
+
+	cancelled, err := sc.repo.CancelScheduledChange(id, change, actorName(ctx))
+	if err != nil {
+		return fail("Failed to cancel scheduled change", err)
+	}
+	return response.JSONSuccessResponse(ctx, "Scheduled change cancelled successfully", cancelled)
+}
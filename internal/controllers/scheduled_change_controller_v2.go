@@ -0,0 +1,76 @@
+package controllers
+
+import (
+	"sample-service/internal/repository"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ScheduledChangeControllerV2 serves the changes scheduled for users in
+// version 2 of the API, which are the same as in version 1. Its methods
+// carry the documentation of the version.
+type ScheduledChangeControllerV2 struct {
+	*ScheduledChangeController
+}
+
+// NewScheduledChangeControllerV2 creates a new ScheduledChangeControllerV2
+func NewScheduledChangeControllerV2(repo repository.ScheduledChangeRepository) *ScheduledChangeControllerV2 {
+	return &ScheduledChangeControllerV2{ScheduledChangeController: NewScheduledChangeController(repo)}
+}
+
+// @Summary Schedule a change to a user
+// @Description Schedule a transition of the user's status, a move to another department, or both, to take effect at effective_at. The department is named by department_id or by name.
+// @Description The scheduler applies the change once it is due, recording it as made by the caller (X-Actor) for the reason given. A change that no longer applies to the user by then, such as a transition from another status, fails instead.
+// @Tags v2
+// @Accept json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Produce json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Param id path int true "User ID"
+// @Param change body model.ScheduledChange true "The change, when it takes effect and why"
+// @Param X-Actor header string false "Who is scheduling the change"
+// @Param Idempotency-Key header string false "Key under which the response is replayed to retries of the same request"
+// @Success 200 {object} response.SuccessResponse{data=model.ScheduledChange}
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 406 {object} response.ErrorResponse
+// @Failure 415 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /users/{id}/scheduled-changes [post]
+func (sc *ScheduledChangeControllerV2) ScheduleChange(ctx echo.Context) error {
+	return sc.ScheduledChangeController.ScheduleChange(ctx)
+}
+
+// @Summary Get the scheduled changes of a user
+// @Description Retrieve every change scheduled for a user in the order they take effect, including those applied, failed or cancelled
+// @Tags v2
+// @Accept json
+// @Produce json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Param id path int true "User ID"
+// @Success 200 {object} response.SuccessResponse{data=[]model.ScheduledChange}
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 406 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /users/{id}/scheduled-changes [get]
+func (sc *ScheduledChangeControllerV2) GetScheduledChanges(ctx echo.Context) error {
+	return sc.ScheduledChangeController.GetScheduledChanges(ctx)
+}
+
+// @Summary Cancel a scheduled change
+// @Description Cancel a change that has not taken effect yet, recording when and by whom (X-Actor). The change is kept, and a change that has been applied or has failed cannot be cancelled.
+// @Tags v2
+// @Accept json
+// @Produce json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Param id path int true "User ID"
+// @Param change_id path int true "Scheduled change ID"
+// @Param X-Actor header string false "Who is cancelling the change"
+// @Success 200 {object} response.SuccessResponse{data=model.ScheduledChange}
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 406 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /users/{id}/scheduled-changes/{change_id} [delete]
+func (sc *ScheduledChangeControllerV2) CancelScheduledChange(ctx echo.Context) error {
+	return sc.ScheduledChangeController.CancelScheduledChange(ctx)
+}
@@ -0,0 +1,230 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sample-service/internal/model"
+	"sample-service/internal/repository"
+	"sample-service/internal/response"
+	"sort"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// embeddedKey is the JSON key included resources are nested under in each user
+const embeddedKey = "_embedded"
+
+// Include embeds a related resource in user responses when a client asks
+// for it with ?include=, saving a request per user
+type Include struct {
+	// Fields are the user fields Load reads; they are loaded even when
+	// ?fields= leaves them out of the response
+	Fields []string
+	// Load fetches the resource for a whole batch of users at once, keyed
+	// by user ID. Users missing from the result get null.
+	Load func(users []model.User) (map[int64]interface{}, error)
+	// Type names the resources in JSON:API documents, and IDField is the
+	// member of their JSON object that identifies them. An include without
+	// a Type is not available in JSON:API.
+	Type    string
+	IDField string
+}
+
+// RegisterInclude makes a related resource available to ?include= under the given name
+func (uc *UserController) RegisterInclude(name string, include Include) {
+	uc.includes[name] = include
+}
+
+// userShape is the sparse fieldset and included resources a client asked
+// for, and whether it asked for HAL links or JSON:API resource objects
+type userShape struct {
+	fields   []string
+	includes []string
+	// links adds the HAL links of each user, to the version at base
+	links bool
+	base  string
+	// jsonAPI turns users into resource objects, keeping only the
+	// typeFields of included resources of the types named there
+	jsonAPI    bool
+	typeFields map[string][]string
+}
+
+// baseShape is the shape of a whole user in the representation the client
+// asked for
+func baseShape(ctx echo.Context) userShape {
+	return userShape{links: response.WantsHAL(ctx), jsonAPI: response.WantsJSONAPI(ctx), base: apiBase(ctx)}
+}
+
+// parseShape reads ?fields= and ?include= from the request, and the
+// fields[type]= sparse fieldsets of JSON:API
+func (uc *UserController) parseShape(ctx echo.Context) (userShape, error) {
+	shape := baseShape(ctx)
+
+	raw := ctx.QueryParam("fields")
+	if shape.jsonAPI {
+		raw = ctx.QueryParam("fields[" + usersType + "]")
+		for name, values := range ctx.QueryParams() {
+			resourceType, ok := strings.CutPrefix(name, "fields[")
+			if !ok || !strings.HasSuffix(resourceType, "]") {
+				continue
+			}
+			if shape.typeFields == nil {
+				shape.typeFields = map[string][]string{}
+			}
+			resourceType = strings.TrimSuffix(resourceType, "]")
+			for _, field := range strings.Split(values[0], ",") {
+				shape.typeFields[resourceType] = append(shape.typeFields[resourceType], strings.TrimSpace(field))
+			}
+		}
+	}
+	if raw != "" {
+		fields, err := repository.ParseFields(raw)
+		if err != nil {
+			return shape, err
+		}
+		for _, field := range fields {
+			if uc.view.hides(field) {
+				return shape, fmt.Errorf("unknown field %q", field)
+			}
+		}
+		shape.fields = fields
+	}
+
+	if raw := ctx.QueryParam("include"); raw != "" {
+		for _, name := range strings.Split(raw, ",") {
+			name = strings.TrimSpace(name)
+			if _, ok := uc.includes[name]; !ok {
+				if len(uc.includes) == 0 {
+					return shape, fmt.Errorf("unknown include %q, no related resources are available", name)
+				}
+				return shape, fmt.Errorf("unknown include %q, expected one of: %s", name, strings.Join(uc.includeNames(), ", "))
+			}
+			if shape.jsonAPI && uc.includes[name].Type == "" {
+				return shape, fmt.Errorf("include %q is not available in JSON:API", name)
+			}
+			shape.includes = append(shape.includes, name)
+		}
+	}
+
+	return shape, nil
+}
+
+func (uc *UserController) includeNames() []string {
+	names := make([]string, 0, len(uc.includes))
+	for name := range uc.includes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// loadFields is the fieldset to load from the repository: the requested
+// fields plus whatever the includes and links need, or nil for every field
+func (uc *UserController) loadFields(shape userShape) []string {
+	if len(shape.fields) == 0 {
+		return nil
+	}
+	fields := append([]string{}, shape.fields...)
+	for _, name := range shape.includes {
+		fields = append(fields, uc.includes[name].Fields...)
+	}
+	if shape.links || shape.jsonAPI {
+		fields = append(fields, linkFields...)
+	}
+	return fields
+}
+
+// shapeUsers narrows users to the requested fields, embeds the requested
+// resources and adds links. Without any of them it returns the users as
+// the version shows them.
+func (uc *UserController) shapeUsers(users []model.User, shape userShape) (interface{}, error) {
+	if len(shape.fields) == 0 && len(shape.includes) == 0 && !shape.links && !shape.jsonAPI {
+		return uc.view.showAll(users), nil
+	}
+
+	included := map[string]map[int64]interface{}{}
+	for _, name := range shape.includes {
+		resources, err := uc.includes[name].Load(users)
+		if err != nil {
+			return nil, fmt.Errorf("failed to include %s: %w", name, err)
+		}
+		included[name] = resources
+	}
+	if shape.jsonAPI {
+		return uc.resources(users, shape, included)
+	}
+
+	shaped := make([]map[string]interface{}, len(users))
+	for i, user := range users {
+		object, err := projectUser(uc.view.show(user), shape.fields)
+		if err != nil {
+			return nil, err
+		}
+		if len(shape.includes) > 0 {
+			embedded := map[string]interface{}{}
+			for _, name := range shape.includes {
+				embedded[name] = included[name][user.ID]
+			}
+			object[embeddedKey] = embedded
+		}
+		if shape.links {
+			object[response.LinksKey] = userLinks(shape.base, user)
+		}
+		shaped[i] = object
+	}
+	return shaped, nil
+}
+
+// shapeUser is shapeUsers for a single user
+func (uc *UserController) shapeUser(user model.User, shape userShape) (interface{}, error) {
+	shaped, err := uc.shapeUsers([]model.User{user}, shape)
+	if err != nil {
+		return nil, err
+	}
+	switch shaped := shaped.(type) {
+	case []map[string]interface{}:
+		return shaped[0], nil
+	case response.Compound:
+		shaped.Data = shaped.Data.([]response.Resource)[0]
+		return shaped, nil
+	}
+	return uc.view.show(user), nil
+}
+
+// projectUser converts a user, as a version of the API shows it, to its
+// JSON object, keeping only the given fields, or every field if none are
+// given
+func projectUser(user interface{}, fields []string) (map[string]interface{}, error) {
+	raw, err := json.Marshal(user)
+	if err != nil {
+		return nil, err
+	}
+	// Numbers are kept as json.Number so IDs round-trip exactly
+	var object map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&object); err != nil {
+		return nil, err
+	}
+
+	if len(fields) > 0 {
+		keep := map[string]bool{}
+		for _, field := range fields {
+			keep[field] = true
+		}
+		for key := range object {
+			if !keep[key] {
+				delete(object, key)
+			}
+		}
+	}
+	return object, nil
+}
+
+// present is a user written back to a client: whole, as the version shows
+// it, with links if the client asked for HAL
+func (uc *UserController) present(ctx echo.Context, user model.User) (interface{}, error) {
+	return uc.shapeUser(user, baseShape(ctx))
+}
@@ -0,0 +1,363 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sample-service/internal/model"
+	"sample-service/internal/response"
+	"sample-service/internal/spreadsheet"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// MaxImportRows is the most users one spreadsheet may import
+const MaxImportRows = 10000
+
+// exportColumns are the user fields exported, in column order. All but
+// user_id can be imported; users are matched by user_name instead.
+var exportColumns = []string{"user_id", "user_name", "first_name", "last_name", "email", "department", "user_status"}
+
+// @Summary Export users
+// @Description Download every user as a CSV file or XLSX workbook with a header row. Rows are streamed as they are read.
+// @Description CSV cells starting with =, +, -, @, a tab or a carriage return are prefixed with ' so that spreadsheet programs do not run them as formulas; imports take the prefix off again. XLSX cells are stored as text, which is never run, and are left as they are.
+// @Produce text/csv
+// @Produce application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Param format query string false "csv (default) or xlsx"
+// @Success 200 {file} file
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /users/export [get]
+func (uc *UserController) ExportUsers(ctx echo.Context) error {
+	format := spreadsheet.CSV
+	if raw := ctx.QueryParam("format"); raw != "" {
+		var err error
+		if format, err = spreadsheet.ParseFormat(raw); err != nil {
+			return badRequest(codeInvalidParameter, "Invalid format", err)
+		}
+	}
+
+	// The response is only started with the first user, so a failing
+	// query can still be answered with an error
+	var w spreadsheet.Writer
+	start := func() error {
+		res := ctx.Response()
+		res.Header().Set(echo.HeaderContentType, format.ContentType())
+		res.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="users.%s"`, format))
+		res.WriteHeader(http.StatusOK)
+
+		var err error
+		if w, err = spreadsheet.NewWriter(res, format); err != nil {
+			return err
+		}
+		return w.Write(exportColumns)
+	}
+
+	err := uc.repo.EachUser(func(user model.User) error {
+		if w == nil {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		row := make([]string, len(exportColumns))
+		for i, column := range exportColumns {
+			row[i] = userCell(user, column)
+		}
+		return w.Write(row)
+	})
+	if err != nil && w == nil {
+		return fail("Failed to export users", err)
+	}
+	if err != nil {
+		// Too late to change the status; the client gets a truncated file
+		return err
+	}
+
+	if w == nil {
+		if err := start(); err != nil {
+			return err
+		}
+	}
+	return w.Close()
+}
+
+// @Summary Import users
+// @Description Create and update users from an uploaded CSV file or XLSX workbook, matching users by user_name.
+// @Description Columns are matched to user fields by header ("User Name" matches user_name) or by an explicit mapping.
+// @Description Existing users keep the fields the file has no column for. Every row is checked before any is written,
+// @Description including for usernames that appear twice; rows that fail are reported and the others imported.
+// @Description With dry_run=true nothing is written and the report says what would happen.
+// @Accept multipart/form-data
+// @Produce json,application/hal+json,application/vnd.api+json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Param file formData file true "CSV file or XLSX workbook; only the first sheet is read"
+// @Param mapping formData string false "JSON object from column header to user field, e.g. {\"Login\":\"user_name\"}"
+// @Param format query string false "csv or xlsx; taken from the file name by default"
+// @Param dry_run query bool false "Validate the file and report without writing"
+// @Param Idempotency-Key header string false "Key under which the response is replayed to retries of the same request"
+// @Success 200 {object} response.SuccessResponse{data=model.ImportReport}
+// @Success 207 {object} response.SuccessResponse{data=model.ImportReport}
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 406 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Failure 413 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /users/import [post]
+func (uc *UserController) ImportUsers(ctx echo.Context) error {
+	dryRun, err := queryBool(ctx, "dry_run")
+	if err != nil {
+		return badRequest(codeInvalidParameter, "Invalid dry_run", err)
+	}
+
+	upload, err := ctx.FormFile("file")
+	if err != nil {
+		return badRequest(codeInvalidUpload, "Invalid upload", err)
+	}
+	raw := ctx.QueryParam("format")
+	var format spreadsheet.Format
+	if raw != "" {
+		format, err = spreadsheet.ParseFormat(raw)
+	} else {
+		format, err = spreadsheet.FormatOf(upload.Filename)
+	}
+	if err != nil {
+		return badRequest(codeInvalidParameter, "Invalid format", err)
+	}
+
+	mapping := map[string]string{}
+	if raw := ctx.FormValue("mapping"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &mapping); err != nil {
+			return badRequest(codeInvalidUpload, "Invalid mapping", err)
+		}
+	}
+
+	file, err := upload.Open()
+	if err != nil {
+		return fail("Failed to read upload", err)
+	}
+	defer file.Close()
+	rows, err := spreadsheet.ReadAll(file, format)
+	if err != nil {
+		return badRequest(codeInvalidUpload, "Invalid spreadsheet", err)
+	}
+	if len(rows) == 0 {
+		return failWithStatus(http.StatusBadRequest, codeInvalidUpload, "Invalid spreadsheet", "the file has no header row")
+	}
+	if len(rows)-1 > MaxImportRows {
+		return failWithStatus(http.StatusRequestEntityTooLarge, codeTooLarge, "Too many rows",
+			fmt.Sprintf("a spreadsheet may import at most %d users", MaxImportRows))
+	}
+
+	columns, err := importColumns(rows[0], mapping)
+	if err != nil {
+		return badRequest(codeInvalidUpload, "Invalid columns", err)
+	}
+
+	// Each row becomes a bulk create or update, so imports are checked and
+	// applied exactly as bulk requests are
+	var items []model.BulkItem
+	var lines []int
+	var unchanged []bool
+	for i, record := range rows[1:] {
+		if blank(record) {
+			continue
+		}
+		item, changed, err := uc.importItem(columns, record)
+		if err != nil {
+			return fail("Failed to import users", err)
+		}
+		items = append(items, item)
+		lines = append(lines, i+2)
+		unchanged = append(unchanged, !changed)
+	}
+
+	results := checkBulkItems(items)
+	actor := actorName(ctx)
+	report := model.ImportReport{DryRun: dryRun, Rows: make([]model.ImportRow, len(items))}
+	for i, item := range items {
+		result := results[i]
+		if result.Status == 0 && unchanged[i] {
+			// Re-importing an export should not bump every version
+			item.Op = model.ImportUnchanged
+			result.Status = http.StatusOK
+			result.User = item.User
+		} else if result.Status == 0 {
+			if dryRun {
+				result.Status = http.StatusOK
+				if item.Op == model.BulkCreate {
+					result.Status = http.StatusCreated
+				}
+				result.User = item.User
+			} else {
+				result = applyBulkItem(uc.repo, item, actor)
+			}
+		}
+
+		report.Rows[i] = model.ImportRow{
+			Row:    lines[i],
+			Action: item.Op,
+			Status: result.Status,
+			User:   result.User,
+			Error:  result.Error,
+			Code:   result.Code,
+			Errors: result.Errors,
+		}
+		switch {
+		case !succeeded(result):
+			report.Failed++
+		case item.Op == model.BulkCreate:
+			report.Created++
+		case item.Op == model.BulkUpdate:
+			report.Updated++
+		default:
+			report.Unchanged++
+		}
+	}
+
+	status := http.StatusOK
+	if report.Failed > 0 {
+		status = http.StatusMultiStatus
+	}
+	message := "Users imported"
+	if dryRun {
+		message = "Import checked; nothing was written"
+	}
+	return response.JSONSuccessResponseWithStatus(ctx, status, message, report)
+}
+
+// importColumns works out which user field each column of a spreadsheet
+// holds, "" for columns that are not imported. A mapping entry overrides
+// matching a header by name; headers are compared ignoring case, spaces
+// and hyphens.
+func importColumns(header []string, mapping map[string]string) ([]string, error) {
+	importable := map[string]bool{}
+	for _, column := range exportColumns[1:] {
+		importable[column] = true
+	}
+	mapped := map[string]string{}
+	for from, to := range mapping {
+		if !importable[to] {
+			return nil, fmt.Errorf("cannot map %q to %q: not an importable user field", from, to)
+		}
+		mapped[normalizeHeader(from)] = to
+	}
+
+	columns := make([]string, len(header))
+	seen := map[string]bool{}
+	for i, name := range header {
+		field, ok := mapped[normalizeHeader(name)]
+		if !ok && importable[normalizeHeader(name)] {
+			field = normalizeHeader(name)
+		}
+		if field == "" {
+			continue
+		}
+		if seen[field] {
+			return nil, fmt.Errorf("more than one column holds %s", field)
+		}
+		seen[field] = true
+		columns[i] = field
+	}
+
+	if !seen["user_name"] {
+		return nil, fmt.Errorf("no column holds user_name")
+	}
+	return columns, nil
+}
+
+// importItem turns a spreadsheet row into a create, or into an update of
+// the user already holding its username, and reports whether the row
+// changes anything. Updates start from the stored user so that fields
+// without a column keep their values.
+func (uc *UserController) importItem(columns []string, record []string) (model.BulkItem, bool, error) {
+	var user model.User
+	for i, field := range columns {
+		if field == "user_name" && i < len(record) {
+			user.UserName = strings.TrimSpace(record[i])
+		}
+	}
+
+	var current *model.User
+	if user.UserName != "" {
+		exists, err := uc.repo.CheckIfUsernameExists(user.UserName)
+		if err != nil {
+			return model.BulkItem{}, false, err
+		}
+		if exists {
+			if current, err = uc.repo.GetUserByUsername(user.UserName); err != nil {
+				return model.BulkItem{}, false, err
+			}
+			user = *current
+		}
+	}
+
+	for i, field := range columns {
+		if field != "" && i < len(record) {
+			setUserField(&user, field, strings.TrimSpace(record[i]))
+		}
+	}
+
+	if current == nil {
+		return model.BulkItem{Op: model.BulkCreate, User: &user}, true, nil
+	}
+	item := model.BulkItem{Op: model.BulkUpdate, UserID: current.ID, Version: current.Version, User: &user}
+	return item, user != *current, nil
+}
+
+// normalizeHeader folds a column header to the form of a user field name
+func normalizeHeader(header string) string {
+	header = strings.ToLower(strings.TrimSpace(header))
+	return strings.NewReplacer(" ", "_", "-", "_").Replace(header)
+}
+
+// blank reports whether a spreadsheet row has no values, as trailing rows
+// of edited spreadsheets often do
+func blank(record []string) bool {
+	for _, value := range record {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// userCell is the text of one exported field of a user
+func userCell(user model.User, field string) string {
+	switch field {
+	case "user_id":
+		return strconv.FormatInt(user.ID, 10)
+	case "user_name":
+		return user.UserName
+	case "first_name":
+		return user.FirstName
+	case "last_name":
+		return user.LastName
+	case "email":
+		return user.Email
+	case "department":
+		return user.Department
+	case "user_status":
+		return user.UserStatus
+	}
+	return ""
+}
+
+// setUserField sets one imported field of a user
+func setUserField(user *model.User, field, value string) {
+	switch field {
+	case "user_name":
+		user.UserName = value
+	case "first_name":
+		user.FirstName = value
+	case "last_name":
+		user.LastName = value
+	case "email":
+		user.Email = value
+	case "department":
+		user.Department = value
+	case "user_status":
+		user.UserStatus = value
+	}
+}
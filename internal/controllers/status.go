@@ -0,0 +1,202 @@
+package controllers
+
+import (
+	"errors"
+	"sample-service/internal/model"
+	"sample-service/internal/repository"
+	"sample-service/internal/response"
+	"sample-service/internal/validate"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// transitionUser moves the user in the path along the named transition of
+// its lifecycle, for the reason in the body. An If-Match makes it apply
+// only to that version of the user. A non-zero reassignTo first moves the
+// user's reports to that user, in the same transaction.
+func (uc *UserController) transitionUser(ctx echo.Context, name, message string, reassignTo int) error {
+	id, err := pathID(ctx)
+	if err != nil {
+		return err
+	}
+	transition, ok := model.FindTransition(name)
+	if !ok {
+		return fail("Failed to change user status", errors.New("unknown transition "+name))
+	}
+
+	var request model.TransitionRequest
+	if err := bind(ctx, &request); err != nil {
+		return fail("Invalid request body", err)
+	}
+	request.Reason = strings.TrimSpace(request.Reason)
+	if fields := validate.Struct(request); len(fields) > 0 {
+		return fail("Invalid request body", repository.ValidationError(fields))
+	}
+
+	var version int64
+	if ctx.Request().Header.Get(headerIfMatch) != "" {
+		current, err := uc.repo.GetUserByID(id)
+		if err != nil {
+			return fail("Failed to change user status", err)
+		}
+		if version, ok = uc.ifMatchVersion(ctx, *current); !ok {
+			return uc.preconditionFailed(ctx, current)
+		}
+	}
+
+	var user *model.User
+	if reassignTo == 0 {
+		user, err = uc.repo.TransitionUser(id, transition, request.Reason, actorName(ctx), version)
+	} else {
+		err = uc.repo.InTransaction(func(tx repository.UserRepository) error {
+			if _, err := tx.ReassignReports(id, reassignTo); err != nil {
+				return err
+			}
+			user, err = tx.TransitionUser(id, transition, request.Reason, actorName(ctx), version)
+			return err
+		})
+	}
+	if errors.Is(err, repository.ErrVersionConflict) {
+		return uc.preconditionFailed(ctx, nil)
+	}
+	if err != nil {
+		return fail("Failed to change user status", err)
+	}
+
+	ctx.Response().Header().Set(headerETag, uc.userETag(ctx, *user))
+	data, err := uc.present(ctx, *user)
+	if err != nil {
+		return fail("Failed to change user status", err)
+	}
+	return response.JSONSuccessResponse(ctx, message, data)
+}
+
+// @Summary Activate a user
+// @Description Move an inactive user to active, recording the reason and who did it (X-Actor)
+// @Accept json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Produce json,application/hal+json,application/vnd.api+json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Param id path int true "User ID"
+// @Param transition body model.TransitionRequest true "Why the user is activated"
+// @Param If-Match header string false "ETag the user must still have for the transition to apply"
+// @Param X-Actor header string false "Who is activating the user"
+// @Param Idempotency-Key header string false "Key under which the response is replayed to retries of the same request"
+// @Success 200 {object} response.SuccessResponse{data=model.User}
+// @Header 200 {string} ETag "New version of the user"
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 406 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Failure 412 {object} response.ErrorResponse
+// @Failure 415 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /users/{id}/activate [post]
+func (uc *UserController) ActivateUser(ctx echo.Context) error {
+	return uc.transitionUser(ctx, "activate", "User activated successfully", 0)
+}
+
+// @Summary Deactivate a user
+// @Description Move an active user to inactive, recording the reason and who did it (X-Actor)
+// @Accept json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Produce json,application/hal+json,application/vnd.api+json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Param id path int true "User ID"
+// @Param transition body model.TransitionRequest true "Why the user is deactivated"
+// @Param If-Match header string false "ETag the user must still have for the transition to apply"
+// @Param X-Actor header string false "Who is deactivating the user"
+// @Param Idempotency-Key header string false "Key under which the response is replayed to retries of the same request"
+// @Success 200 {object} response.SuccessResponse{data=model.User}
+// @Header 200 {string} ETag "New version of the user"
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 406 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Failure 412 {object} response.ErrorResponse
+// @Failure 415 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /users/{id}/deactivate [post]
+func (uc *UserController) DeactivateUser(ctx echo.Context) error {
+	return uc.transitionUser(ctx, "deactivate", "User deactivated successfully", 0)
+}
+
+// @Summary Terminate a user
+// @Description Move an active or inactive user to terminated, recording the reason and who did it (X-Actor). Writing user_status cannot terminate a user.
+// @Description Whoever reports to the user moves to reassign_to if it is given, or else up to the user's own manager.
+// @Accept json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Produce json,application/hal+json,application/vnd.api+json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Param id path int true "User ID"
+// @Param transition body model.TransitionRequest true "Why the user is terminated"
+// @Param reassign_to query int false "User to move the reports of the terminated user to"
+// @Param If-Match header string false "ETag the user must still have for the transition to apply"
+// @Param X-Actor header string false "Who is terminating the user"
+// @Param Idempotency-Key header string false "Key under which the response is replayed to retries of the same request"
+// @Success 200 {object} response.SuccessResponse{data=model.User}
+// @Header 200 {string} ETag "New version of the user"
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 406 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Failure 412 {object} response.ErrorResponse
+// @Failure 415 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /users/{id}/terminate [post]
+func (uc *UserController) TerminateUser(ctx echo.Context) error {
+	reassignTo, err := queryInt(ctx, "reassign_to")
+	if err != nil {
+		return badRequest(codeInvalidParameter, "Invalid reassign_to", err)
+	}
+	return uc.transitionUser(ctx, "terminate", "User terminated successfully", reassignTo)
+}
+
+// @Summary Rehire a user
+// @Description Move a terminated user back to active, recording the reason and who did it (X-Actor). Writing user_status cannot rehire a user.
+// @Accept json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Produce json,application/hal+json,application/vnd.api+json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Param id path int true "User ID"
+// @Param transition body model.TransitionRequest true "Why the user is rehired"
+// @Param If-Match header string false "ETag the user must still have for the transition to apply"
+// @Param X-Actor header string false "Who is rehiring the user"
+// @Param Idempotency-Key header string false "Key under which the response is replayed to retries of the same request"
+// @Success 200 {object} response.SuccessResponse{data=model.User}
+// @Header 200 {string} ETag "New version of the user"
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 406 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Failure 412 {object} response.ErrorResponse
+// @Failure 415 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /users/{id}/rehire [post]
+func (uc *UserController) RehireUser(ctx echo.Context) error {
+	return uc.transitionUser(ctx, "rehire", "User rehired successfully", 0)
+}
+
+// @Summary Get the status history of a user
+// @Description Retrieve every status transition made to a user, oldest first. Transitions made by writing user_status have no reason.
+// @Accept json
+// @Produce json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Param id path int true "User ID"
+// @Success 200 {object} response.SuccessResponse{data=[]model.StatusTransition}
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 406 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /users/{id}/transitions [get]
+func (uc *UserController) GetUserTransitions(ctx echo.Context) error {
+	id, err := pathID(ctx)
+	if err != nil {
+		return err
+	}
+	if _, err := uc.repo.GetUserByID(id, "user_id"); err != nil {
+		return fail("Failed to retrieve status history", err)
+	}
+
+	transitions, err := uc.repo.ListStatusTransitions(id)
+	if err != nil {
+		return fail("Failed to retrieve status history", err)
+	}
+	return response.JSONSuccessResponse(ctx, "Status history retrieved successfully", uc.view.showTransitions(transitions))
+}
@@ -1,135 +1,629 @@
 package controllers
 
 import (
+	"errors"
+	"net/http"
+	"io"
 	"sample-service/internal/repository"
 	"github.com/labstack/echo/v4"
 	"strconv"
 	"sample-service/internal/response"	
 	"fmt"
 	"sample-service/internal/model"
+	"sample-service/internal/filter"
 )
 
 type UserController struct {
-	repo repository.UserRepository
+	repo     repository.UserRepository
+	includes map[string]Include
+	// view is the version of the API the controller serves
+	view userView
+	// trustActorRole is whether X-Actor-Role is believed, which purging
+	// users needs
+	trustActorRole bool
 }
 
-// NewUserController creates a new UserController
+// NewUserController creates a new UserController serving version 1 of the API
 func NewUserController(repo repository.UserRepository) *UserController {
 	return &UserController{
-		repo: repo,
+		repo:     repo,
+		includes: map[string]Include{},
+		view:     v1{},
 	}
 }
 
 // @Summary Get all users
-// @Description Retrieve all users from the database
+// @Description Retrieve a page of users from the database, either by offset or by keyset cursor
 // @Accept json
-// @Produce json
-// @Success 200 {object} response.SuccessResponse
+// @Produce json,application/hal+json,application/vnd.api+json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Param limit query int false "Page size (default 50, max 200)"
+// @Param offset query int false "Number of users to skip; cannot be combined with cursor"
+// @Param cursor query string false "Opaque cursor taken from next_cursor or prev_cursor of a previous page"
+// @Param filter query string false "Filter expression, e.g. department eq \"Engineering\" and user_status ne \"T\""
+// @Param sort query string false "Comma-separated columns to sort by, prefixed with - for descending, e.g. last_name,-department"
+// @Param fields query string false "Comma-separated user fields to return, e.g. user_id,user_name"
+// @Param include query string false "Comma-separated related resources to embed under _embedded"
+// @Param include_deleted query bool false "Also list soft-deleted users"
+// @Success 200 {object} response.PaginatedResponse
+// @Header 200 {string} Link "RFC 8288 links to the first, next and previous pages"
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 406 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
 // @Failure 500 {object} response.ErrorResponse
 // @Router /users [get]
 func (uc *UserController) GetAllUsers(ctx echo.Context) error {
-	users, err := uc.repo.GetAllUsers()
+	return uc.listUsers(ctx, repository.ListOptions{})
+}
+
+// listUsers answers with a page of the users in scope, which narrows the
+// users with its Filter and ReportsTo, matching the filter, sort, fields
+// and paging the request asks for
+func (uc *UserController) listUsers(ctx echo.Context, scope repository.ListOptions) error {
+	limit, err := queryInt(ctx, "limit")
+	if err != nil {
+		return badRequest(codeInvalidParameter, "Invalid pagination parameters", err)
+	}
+	offset, err := queryInt(ctx, "offset")
+	if err != nil {
+		return badRequest(codeInvalidParameter, "Invalid pagination parameters", err)
+	}
+
+	var where filter.Expr
+	if raw := ctx.QueryParam("filter"); raw != "" {
+		where, err = filter.Parse(raw)
+		if err == nil {
+			err = filter.Validate(where, repository.UserFilterSchema)
+		}
+		if err == nil {
+			err = uc.view.storeFilter(where)
+		}
+		if err != nil {
+			return badRequest(codeInvalidFilter, "Invalid filter", err)
+		}
+	}
+	if scope.Filter != nil && where != nil {
+		where = &filter.Logical{Op: filter.And, Left: scope.Filter, Right: where}
+	} else if scope.Filter != nil {
+		where = scope.Filter
+	}
+
+	var sort []repository.SortField
+	if raw := ctx.QueryParam("sort"); raw != "" {
+		if sort, err = repository.ParseSort(raw); err != nil {
+			return badRequest(codeInvalidSort, "Invalid sort", err)
+		}
+	}
+
+	shape, err := uc.parseShape(ctx)
+	if err != nil {
+		return badRequest(codeInvalidParameter, "Invalid fields or include", err)
+	}
+
+	includeDeleted, err := queryBool(ctx, "include_deleted")
+	if err != nil {
+		return badRequest(codeInvalidParameter, "Invalid include_deleted", err)
+	}
+
+	page, err := uc.repo.ListUsers(repository.ListOptions{
+		Limit:          limit,
+		Offset:         offset,
+		Cursor:         ctx.QueryParam("cursor"),
+		Filter:         where,
+		Sort:           sort,
+		Fields:         uc.loadFields(shape),
+		IncludeDeleted: includeDeleted,
+		ReportsTo:      scope.ReportsTo,
+		Recursive:      scope.Recursive,
+	})
+	if err != nil {
+		return fail("Failed to retrieve users", err)
+	}
+
+	users, err := uc.shapeUsers(page.Users, shape)
+	if err != nil {
+		return fail("Failed to retrieve users", err)
+	}
+	return response.JSONPaginatedResponse(ctx, "Users retrieved successfully", users, response.Pagination{
+		Total:      page.Total,
+		Limit:      page.Limit,
+		Offset:     page.Offset,
+		NextCursor: page.NextCursor,
+		PrevCursor: page.PrevCursor,
+	})
+}
+
+// @Summary Search users
+// @Description Full-text search across first name, last name, username, email and department. Every word must match as a prefix; results are ranked by relevance and matches are wrapped in <mark> tags.
+// @Accept json
+// @Produce json,application/hal+json,application/vnd.api+json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Param q query string true "Words to search for"
+// @Param limit query int false "Maximum number of results (default 20, max 100)"
+// @Success 200 {object} response.SuccessResponse{data=[]model.UserSearchResult}
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 406 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /users/search [get]
+func (uc *UserController) SearchUsers(ctx echo.Context) error {
+	limit, err := queryInt(ctx, "limit")
+	if err != nil {
+		return badRequest(codeInvalidParameter, "Invalid search parameters", err)
+	}
+
+	results, err := uc.repo.SearchUsers(ctx.QueryParam("q"), limit)
+	if err != nil {
+		return fail("Failed to search users", err)
+	}
+	return response.JSONSuccessResponse(ctx, "Users found successfully", results)
+}
+
+// @Summary Suggest users
+// @Description Autocomplete for user pickers: returns the users whose first name, last name, username or email start with each typed word, tolerating typos and missing accents
+// @Accept json
+// @Produce json,application/hal+json,application/vnd.api+json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Param prefix query string true "What has been typed so far"
+// @Param limit query int false "Maximum number of suggestions (default 10, max 50)"
+// @Success 200 {object} response.SuccessResponse{data=[]model.UserSuggestion}
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 406 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /users/suggest [get]
+func (uc *UserController) SuggestUsers(ctx echo.Context) error {
+	limit, err := queryInt(ctx, "limit")
+	if err != nil {
+		return badRequest(codeInvalidParameter, "Invalid suggest parameters", err)
+	}
+
+	suggestions, err := uc.repo.SuggestUsers(ctx.QueryParam("prefix"), limit)
 	if err != nil {
-		return response.JSONErrorResponse(ctx, "Failed to retrieve users", err.Error())
+		return fail("Failed to suggest users", err)
 	}
-	return response.JSONSuccessResponse(ctx, "Users retrieved successfully", users)
+	return response.JSONSuccessResponse(ctx, "Users suggested successfully", suggestions)
+}
+
+// queryInt reads an optional integer query parameter, returning 0 when it is absent
+func queryInt(ctx echo.Context, name string) (int, error) {
+	raw := ctx.QueryParam(name)
+	if raw == "" {
+		return 0, nil
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be an integer", name)
+	}
+	return value, nil
+}
+
+// pathID reads the user ID from the path
+func pathID(ctx echo.Context) (int, error) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return 0, failWithStatus(http.StatusBadRequest, codeInvalidID, "Invalid user ID", fmt.Sprintf("user ID must be an integer, got %q", ctx.Param("id")))
+	}
+	return id, nil
+}
+
+// queryBool reads an optional boolean query parameter, defaulting to false
+func queryBool(ctx echo.Context, name string) (bool, error) {
+	raw := ctx.QueryParam(name)
+	if raw == "" {
+		return false, nil
+	}
+	value, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, fmt.Errorf("%s must be true or false", name)
+	}
+	return value, nil
 }
 
 // @Summary Get user by ID
 // @Description Retrieve a user by their ID
 // @Accept json
-// @Produce json
+// @Produce json,application/hal+json,application/vnd.api+json,application/xml,application/yaml,application/cbor,application/msgpack
 // @Param id path int true "User ID"
+// @Param fields query string false "Comma-separated user fields to return, e.g. user_id,user_name"
+// @Param include query string false "Comma-separated related resources to embed under _embedded"
+// @Param If-None-Match header string false "ETag of a cached copy; answered with 304 if it is still current"
 // @Success 200 {object} response.SuccessResponse
+// @Header 200 {string} ETag "Tag of the user in the API version and format of the response, on full representations only"
+// @Success 304 "The cached copy is current"
+// @Failure 400 {object} response.ErrorResponse
 // @Failure 404 {object} response.ErrorResponse
+// @Failure 406 {object} response.ErrorResponse
 // @Failure 500 {object} response.ErrorResponse
 // @Router /users/{id} [get]
 func (uc *UserController) GetUserByID(ctx echo.Context) error {
-	id := ctx.Param("id")
-	userID, err := strconv.Atoi(id)
+	userID, err := pathID(ctx)
 	if err != nil {
-		return response.JSONErrorResponse(ctx, "Failed to retrieve user", "Invalid user ID")
+		return err
 	}
 
-	user, err := uc.repo.GetUserByID(userID)
+	shape, err := uc.parseShape(ctx)
 	if err != nil {
-		return response.JSONErrorResponse(ctx, "User not found", err.Error())
+		return badRequest(codeInvalidParameter, "Invalid fields or include", err)
+	}
+
+	user, err := uc.repo.GetUserByID(userID, uc.loadFields(shape)...)
+	if err != nil {
+		return fail("Failed to retrieve user", err)
+	}
+
+	// Only the full representation has a strong ETag: a projection would
+	// need one per fieldset, and included resources change independently
+	if len(shape.fields) == 0 && len(shape.includes) == 0 {
+		etag := uc.userETag(ctx, *user)
+		ctx.Response().Header().Set(headerETag, etag)
+		if etagMatches(ctx.Request().Header.Get(headerIfNoneMatch), etag, true) {
+			return ctx.NoContent(http.StatusNotModified)
+		}
 	}
-	return response.JSONSuccessResponse(ctx, "User retrieved successfully", user)
+
+	data, err := uc.shapeUser(*user, shape)
+	if err != nil {
+		return fail("Failed to retrieve user", err)
+	}
+	return response.JSONSuccessResponse(ctx, "User retrieved successfully", data)
 }
 
 // @Summary Create a new user
-// @Description Create a new user in the database
-// @Accept json
-// @Produce json
+// @Description Create a new user in the database. JSON:API clients are answered with 201, as JSON:API requires; others with 200.
+// @Accept json,application/hal+json,application/vnd.api+json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Produce json,application/hal+json,application/vnd.api+json,application/xml,application/yaml,application/cbor,application/msgpack
 // @Param user body model.User true "User details"
+// @Param Idempotency-Key header string false "Key under which the response is replayed to retries of the same request"
 // @Success 200 {object} response.SuccessResponse
+// @Success 201 {object} response.SuccessResponse
+// @Header 200,201 {string} Location "URL of the created user"
 // @Failure 400 {object} response.ErrorResponse
+// @Failure 406 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Failure 415 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
 // @Failure 500 {object} response.ErrorResponse
 // @Router /users [post]
 func (uc *UserController) CreateUser(ctx echo.Context) error {
-	var user model.User
-	if err := ctx.Bind(&user); err != nil {
-		return response.JSONErrorResponse(ctx, "Invalid request body", err.Error())
+	doc := uc.view.newDocument()
+	if err := bindUser(ctx, doc, 0); err != nil {
+		return fail("Invalid request body", err)
+	}
+	if err := uc.view.validate(doc); err != nil {
+		return fail("Invalid user", err)
 	}
 
-	newUser, err := uc.repo.CreateUser(user)
+	newUser, err := uc.repo.CreateUser(uc.view.toUser(doc))
 	if err != nil {
-        if err.Error() == fmt.Sprintf("username '%s' already exists", user.UserName) {
-            return response.JSONErrorResponse(ctx, "Username already exists", err.Error())
-        }
-        return response.JSONErrorResponse(ctx, "Failed to create user", err.Error())
-    }
+		return fail("Failed to create user", err)
+	}
 
-	return response.JSONSuccessResponse(ctx, "User created successfully", newUser)
+	ctx.Response().Header().Set(echo.HeaderLocation, fmt.Sprintf("%s/users/%d", apiBase(ctx), newUser.ID))
+	ctx.Response().Header().Set(headerETag, uc.userETag(ctx, *newUser))
+	data, err := uc.present(ctx, *newUser)
+	if err != nil {
+		return fail("Failed to create user", err)
+	}
+	// JSON:API requires 201 for a resource created under an ID the server
+	// chose; other clients keep the 200 they have always had
+	status := http.StatusOK
+	if response.WantsJSONAPI(ctx) {
+		status = http.StatusCreated
+	}
+	return response.JSONSuccessResponseWithStatus(ctx, status, "User created successfully", data)
 }
 
-// @Summary Update a user
-// @Description Update a user in the database
-// @Accept json
-// @Produce json
+// @Summary Replace a user
+// @Description Replace the user with the given ID. A user_id in the body must match the path.
+// @Description Replaying a request whose changes are already stored has no further effect and answers 200, even with a stale If-Match.
+// @Description With upsert=true a user that does not exist is created under the path ID, answering 201 with its Location.
+// @Description user_status can only be changed between active and inactive, and each change is recorded as made by X-Actor; terminating and rehiring have their own endpoints.
+// @Accept json,application/hal+json,application/vnd.api+json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Produce json,application/hal+json,application/vnd.api+json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Param id path int true "User ID"
 // @Param user body model.User true "User details"
-// @Success 200 {object} response.SuccessResponse	
+// @Param upsert query bool false "Create the user if it does not exist"
+// @Param If-Match header string false "ETag the user must still have for the update to apply"
+// @Param X-Actor header string false "Who is updating the user"
+// @Success 200 {object} response.SuccessResponse
+// @Success 201 {object} response.SuccessResponse
+// @Header 200 {string} ETag "New version of the user"
+// @Header 201 {string} ETag "Version of the created user"
+// @Header 201 {string} Location "URL of the created user"
 // @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 406 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Failure 412 {object} response.ErrorResponse
+// @Failure 415 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
 // @Failure 500 {object} response.ErrorResponse
 // @Router /users/{id} [put]
 func (uc *UserController) UpdateUser(ctx echo.Context) error {
-	var user model.User
-	if err := ctx.Bind(&user); err != nil {
-		return response.JSONErrorResponse(ctx, "Invalid request body", err.Error())
+	id, err := pathID(ctx)
+	if err != nil {
+		return err
+	}
+	upsert, err := queryBool(ctx, "upsert")
+	if err != nil {
+		return badRequest(codeInvalidParameter, "Invalid upsert", err)
+	}
+
+	doc := uc.view.newDocument()
+	if err := bindUser(ctx, doc, int64(id)); err != nil {
+		return fail("Invalid request body", err)
+	}
+	user := uc.view.toUser(doc)
+	if user.ID != 0 && user.ID != int64(id) {
+		return failWithStatus(http.StatusBadRequest, codeIDMismatch, "Invalid user ID",
+			fmt.Sprintf("user_id %d in the body does not match %d in the path", user.ID, id))
+	}
+	user.ID = int64(id)
+	if err := uc.view.validate(doc); err != nil {
+		return fail("Invalid user", err)
 	}
 
-	updatedUser, err := uc.repo.UpdateUser(user)
+	current, err := uc.repo.GetUserByID(id)
+	if errors.Is(err, repository.ErrNotFound) && upsert {
+		return uc.createAt(ctx, user)
+	}
+	if err != nil {
+		return fail("Failed to update user", err)
+	}
+
+	// A replay of a request that has been applied changes nothing, even
+	// though its If-Match names the version before it
+	replaced := replaceUser(*current, user)
+	if replaced == *current {
+		ctx.Response().Header().Set(headerETag, uc.userETag(ctx, *current))
+		data, err := uc.present(ctx, *current)
+		if err != nil {
+			return fail("Failed to update user", err)
+		}
+		return response.JSONSuccessResponse(ctx, "User updated successfully", data)
+	}
+
+	// The version comes from If-Match, never from the body
+	version, ok := uc.ifMatchVersion(ctx, *current)
+	if !ok {
+		return uc.preconditionFailed(ctx, current)
+	}
+	replaced.Version = version
+	replaced.UpdatedBy = actorName(ctx)
+
+	updatedUser, err := uc.repo.UpdateUser(replaced)
+	if errors.Is(err, repository.ErrVersionConflict) {
+		return uc.preconditionFailed(ctx, nil)
+	}
+	if err != nil {
+		return fail("Failed to update user", err)
+	}
+
+	ctx.Response().Header().Set(headerETag, uc.userETag(ctx, *updatedUser))
+	data, err := uc.present(ctx, *updatedUser)
 	if err != nil {
-		return response.JSONErrorResponse(ctx, "Failed to update user", err.Error())
+		return fail("Failed to update user", err)
+	}
+	return response.JSONSuccessResponse(ctx, "User updated successfully", data)
+}
+
+// createAt creates the user a PUT names when it does not exist yet. There
+// is no current version for an If-Match to name, so any If-Match fails.
+func (uc *UserController) createAt(ctx echo.Context, user model.User) error {
+	if ctx.Request().Header.Get(headerIfMatch) != "" {
+		return uc.preconditionFailed(ctx, nil)
 	}
 
-	return response.JSONSuccessResponse(ctx, "User updated successfully", updatedUser)
+	created, err := uc.repo.CreateUserWithID(user)
+	if err != nil {
+		return fail("Failed to create user", err)
+	}
+
+	// The user is created at the URL the request named, under whichever
+	// version of the API it was made
+	ctx.Response().Header().Set(echo.HeaderLocation, ctx.Request().URL.Path)
+	ctx.Response().Header().Set(headerETag, uc.userETag(ctx, *created))
+	data, err := uc.present(ctx, *created)
+	if err != nil {
+		return fail("Failed to create user", err)
+	}
+	return response.JSONSuccessResponseWithStatus(ctx, http.StatusCreated, "User created successfully", data)
+}
+
+// replaceUser is current with every field a client may write taken from
+// user, leaving the ID, version, timestamps and deletion fields alone. A
+// user that names the current department without its ID stays in it.
+func replaceUser(current, user model.User) model.User {
+	current.UserName = user.UserName
+	current.FirstName = user.FirstName
+	current.LastName = user.LastName
+	current.Email = user.Email
+	if user.DepartmentID != 0 || user.Department != current.Department {
+		current.DepartmentID = user.DepartmentID
+	}
+	current.Department = user.Department
+	current.ManagerID = user.ManagerID
+	current.UserStatus = user.UserStatus
+	return current
+}
+
+// @Summary Patch a user
+// @Description Partially update a user with a JSON Merge Patch (RFC 7396), a JSON Patch (RFC 6902) or a JSON:API resource object.
+// @Description The patched user is validated before it is saved; a failed JSON Patch test operation leaves the user unchanged.
+// @Description The update only applies to the version of the user the patch was applied to.
+// @Description user_status can only be changed between active and inactive, and each change is recorded as made by X-Actor; terminating and rehiring have their own endpoints.
+// @Accept application/merge-patch+json
+// @Accept application/json-patch+json
+// @Accept application/vnd.api+json
+// @Produce json,application/hal+json,application/vnd.api+json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Param id path int true "User ID"
+// @Param patch body object true "Merge patch object or array of JSON Patch operations"
+// @Param If-Match header string false "ETag the user must still have for the patch to apply"
+// @Param X-Actor header string false "Who is updating the user"
+// @Success 200 {object} response.SuccessResponse
+// @Header 200 {string} ETag "New version of the user"
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 406 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Failure 412 {object} response.ErrorResponse
+// @Failure 415 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /users/{id} [patch]
+func (uc *UserController) PatchUser(ctx echo.Context) error {
+	userID, err := pathID(ctx)
+	if err != nil {
+		return err
+	}
+
+	body, err := io.ReadAll(ctx.Request().Body)
+	if err != nil {
+		return badRequest(codeInvalidBody, "Invalid request body", err)
+	}
+
+	user, err := uc.repo.GetUserByID(userID)
+	if err != nil {
+		return fail("Failed to update user", err)
+	}
+	if _, ok := uc.ifMatchVersion(ctx, *user); !ok {
+		return uc.preconditionFailed(ctx, user)
+	}
+
+	patched, doc, err := applyUserPatch(uc.view, *user, ctx.Request().Header.Get(echo.HeaderContentType), body)
+	if err != nil {
+		return fail("Failed to apply patch", err)
+	}
+	if err := uc.view.validate(doc); err != nil {
+		return fail("Invalid user", err)
+	}
+
+	// patched keeps the version it was read at, so a concurrent write in
+	// between makes the update fail rather than be overwritten
+	patched.UpdatedBy = actorName(ctx)
+	updatedUser, err := uc.repo.UpdateUser(patched)
+	if errors.Is(err, repository.ErrVersionConflict) {
+		return uc.preconditionFailed(ctx, nil)
+	}
+	if err != nil {
+		return fail("Failed to update user", err)
+	}
+
+	ctx.Response().Header().Set(headerETag, uc.userETag(ctx, *updatedUser))
+
+	data, err := uc.present(ctx, *updatedUser)
+	if err != nil {
+		return fail("Failed to update user", err)
+	}
+	return response.JSONSuccessResponse(ctx, "User updated successfully", data)
 }
 
 // @Summary Delete a user
-// @Description Delete a user from the database
+// @Description Soft-delete a user, recording when and by whom (X-Actor); it is hidden from reads until restored.
+// @Description With purge=true an administrator (X-Actor-Role: admin) deletes the user permanently instead.
+// @Description X-Actor-Role is not an authorization check: it is believed as sent, so purging is refused unless the service runs with TRUST_ACTOR_ROLE=true behind a gateway that sets the header itself.
 // @Accept json
-// @Produce json
+// @Produce json,application/hal+json,application/vnd.api+json,application/xml,application/yaml,application/cbor,application/msgpack
 // @Param id path int true "User ID"
+// @Param purge query bool false "Permanently delete the user; administrators only"
+// @Param If-Match header string false "ETag the user must still have for the delete to apply"
+// @Param X-Actor header string false "Who is deleting the user"
+// @Param X-Actor-Role header string false "Role of the caller as set by the gateway; purging requires admin and TRUST_ACTOR_ROLE=true"
 // @Success 200 {object} response.SuccessResponse	
 // @Failure 400 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 406 {object} response.ErrorResponse
+// @Failure 412 {object} response.ErrorResponse
 // @Failure 500 {object} response.ErrorResponse
 // @Router /users/{id} [delete]
 func (uc *UserController) DeleteUser(ctx echo.Context) error {
-	id, err := strconv.Atoi(ctx.Param("id"))
+	id, err := pathID(ctx)
 	if err != nil {
-		return response.JSONErrorResponse(ctx, "Invalid user ID", err.Error())
+		return err
 	}
 
-	deleted, err := uc.repo.DeleteUser(id)
+	purge, err := queryBool(ctx, "purge")
 	if err != nil {
-		return response.JSONErrorResponse(ctx, "Failed to delete user", err.Error())
+		return badRequest(codeInvalidParameter, "Invalid purge", err)
+	}
+	if purge {
+		return uc.purgeUser(ctx, id)
+	}
+
+	var version int64
+	if ctx.Request().Header.Get(headerIfMatch) != "" {
+		current, err := uc.repo.GetUserByID(id)
+		if err != nil {
+			return fail("Failed to delete user", err)
+		}
+		var ok bool
+		if version, ok = uc.ifMatchVersion(ctx, *current); !ok {
+			return uc.preconditionFailed(ctx, current)
+		}
+	}
+
+	deleted, err := uc.repo.DeleteUser(id, version, actorName(ctx))
+	if errors.Is(err, repository.ErrVersionConflict) {
+		return uc.preconditionFailed(ctx, nil)
+	}
+	if err != nil {
+		return fail("Failed to delete user", err)
 	}
 
 	if !deleted {
-		return response.JSONErrorResponse(ctx, "User not found", fmt.Sprintf("No user found with ID %d", id))
+		return fail("Failed to delete user", repository.Errorf(repository.ErrNotFound, "no user found with ID %d", id))
 	}
 
 	return response.JSONSuccessResponse(ctx, "User deleted successfully", nil)
 }
+
+// purgeUser permanently deletes a user, which only administrators may do
+func (uc *UserController) purgeUser(ctx echo.Context, id int) error {
+	if !uc.trustActorRole {
+		return failWithStatus(http.StatusForbidden, codeForbidden, "Forbidden", "purging users is not enabled")
+	}
+	if !isAdmin(ctx) {
+		return failWithStatus(http.StatusForbidden, codeForbidden, "Forbidden", "only administrators can purge users")
+	}
+
+	purged, err := uc.repo.PurgeUser(id)
+	if err != nil {
+		return fail("Failed to purge user", err)
+	}
+	if !purged {
+		return fail("Failed to purge user", repository.Errorf(repository.ErrNotFound, "no user found with ID %d", id))
+	}
+
+	return response.JSONSuccessResponse(ctx, "User purged successfully", nil)
+}
+
+// @Summary Restore a user
+// @Description Undo a soft delete. Fails if another user has taken the username since.
+// @Produce json,application/hal+json,application/vnd.api+json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Param id path int true "User ID"
+// @Param Idempotency-Key header string false "Key under which the response is replayed to retries of the same request"
+// @Success 200 {object} response.SuccessResponse
+// @Header 200 {string} ETag "New version of the user"
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 406 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /users/{id}/restore [post]
+func (uc *UserController) RestoreUser(ctx echo.Context) error {
+	id, err := pathID(ctx)
+	if err != nil {
+		return err
+	}
+
+	user, err := uc.repo.RestoreUser(id)
+	if err != nil {
+		return fail("Failed to restore user", err)
+	}
+
+	ctx.Response().Header().Set(headerETag, uc.userETag(ctx, *user))
+	data, err := uc.present(ctx, *user)
+	if err != nil {
+		return fail("Failed to restore user", err)
+	}
+	return response.JSONSuccessResponse(ctx, "User restored successfully", data)
+}
@@ -1,15 +1,25 @@
 package controllers_test
 
 import (
+	"bytes"
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"sample-service/internal/filter"
 	"sample-service/internal/controllers"
 	"sample-service/internal/model"
+	"sample-service/internal/orgchart"
+	"sample-service/internal/repository"
+	"sample-service/internal/response"
+	"sample-service/internal/spreadsheet"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/onsi/ginkgo/v2"
@@ -20,22 +30,89 @@ type MockUserRepository struct {
 	users []model.User
 	err   error
 	exists bool
+	listOptions repository.ListOptions
+	nextCursor  string
+	prevCursor  string
+	searchQuery string
+	searchLimit int
+	results     []model.UserSearchResult
+	suggestions []model.UserSuggestion
+	fields      []string
+	updates     int
+	conflict    bool
+	version     int64
+	deletedBy   string
+	purged      []int
+	taken       bool
+	rolledBack  bool
+	transitions []model.StatusTransition
+	lastUpdate  model.User
+	chartOptions repository.OrgChartOptions
 }
 
 func (m *MockUserRepository) GetAllUsers() ([]model.User, error) {
 	return m.users, m.err
 }
 
-func (m *MockUserRepository) GetUserByID(id int) (*model.User, error) {
+func (m *MockUserRepository) EachUser(fn func(model.User) error) error {
+	if m.err != nil {
+		return m.err
+	}
+	for _, user := range m.users {
+		if err := fn(user); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MockUserRepository) ListUsers(opts repository.ListOptions) (*repository.UserPage, error) {
+	m.listOptions = opts
+	if m.err != nil {
+		return nil, m.err
+	}
+	limit := opts.Limit
+	if limit == 0 {
+		limit = repository.DefaultPageLimit
+	}
+	return &repository.UserPage{
+		Users:      m.users,
+		Total:      len(m.users),
+		Limit:      limit,
+		Offset:     opts.Offset,
+		NextCursor: m.nextCursor,
+		PrevCursor: m.prevCursor,
+	}, nil
+}
+
+func (m *MockUserRepository) GetUserByID(id int, fields ...string) (*model.User, error) {
+	m.fields = fields
 	for _, user := range m.users {
 		if int(user.ID) == id {
 			return &user, nil
 		}
 	}
+	if m.err == nil {
+		return nil, repository.Errorf(repository.ErrNotFound, "no user found with ID %d", id)
+	}
 	return nil, m.err
 }
 
+func (m *MockUserRepository) GetUserByUsername(username string) (*model.User, error) {
+	for _, user := range m.users {
+		if user.UserName == username {
+			return &user, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
 func (m *MockUserRepository) CheckIfUsernameExists(username string) (bool, error) {
+	for _, user := range m.users {
+		if user.UserName == username {
+			return true, m.err
+		}
+	}
 	return m.exists, m.err
 }
 
@@ -52,25 +129,293 @@ func (m *MockUserRepository) CreateUser(user model.User) (*model.User, error) {
 	return &newUser, nil
 }
 
+func (m *MockUserRepository) CreateUserWithID(user model.User) (*model.User, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	user.Version = 1
+	m.users = append(m.users, user)
+	return &user, nil
+}
+
 func (m *MockUserRepository) UpdateUser(user model.User) (*model.User, error) {
+	// Renames to a taken username are refused before anything is written,
+	// as the repository does
+	for _, current := range m.users {
+		if current.ID == user.ID && current.UserName != user.UserName && m.exists {
+			return nil, repository.UsernameExists(user.UserName)
+		}
+	}
+	m.updates++
+	m.version = user.Version
+	m.lastUpdate = user
 	if m.err != nil {
 		return nil, m.err
 	}
+	if m.conflict {
+		return nil, repository.ErrVersionConflict
+	}
 	
 	updatedUser := user
 	
 	if updatedUser.ID == 0 {
 		updatedUser.ID = 1
 	}
+	updatedUser.Version++
 	
 	return &updatedUser, nil
 }
 
+func (m *MockUserRepository) TransitionUser(id int, transition model.Transition, reason, actor string, version int64) (*model.User, error) {
+	m.version = version
+	if m.err != nil {
+		return nil, m.err
+	}
+	if m.conflict {
+		return nil, repository.ErrVersionConflict
+	}
+	for i, user := range m.users {
+		if int(user.ID) != id {
+			continue
+		}
+		if !transition.Allows(user.UserStatus) {
+			return nil, &repository.Error{Kind: repository.ErrConflict, Code: repository.CodeInvalidTransition, Err: errors.New("cannot " + transition.Name)}
+		}
+		m.transitions = append(m.transitions, model.StatusTransition{UserID: user.ID, Transition: transition.Name,
+			FromStatus: user.UserStatus, ToStatus: transition.To, Reason: reason, Actor: actor})
+		user.UserStatus = transition.To
+		user.Version++
+		m.users[i] = user
+		return &user, nil
+	}
+	return nil, repository.Errorf(repository.ErrNotFound, "no user found with ID %d", id)
+}
+
+func (m *MockUserRepository) ListStatusTransitions(id int) ([]model.StatusTransition, error) {
+	transitions := []model.StatusTransition{}
+	for _, t := range m.transitions {
+		if int(t.UserID) == id {
+			transitions = append(transitions, t)
+		}
+	}
+	return transitions, m.err
+}
+
+func (m *MockUserRepository) ManagementChain(id int) ([]model.User, error) {
+	user, err := m.GetUserByID(id)
+	if err != nil {
+		return nil, err
+	}
+	managers := []model.User{}
+	for user.ManagerID != 0 {
+		if user, err = m.GetUserByID(int(user.ManagerID)); err != nil {
+			return nil, err
+		}
+		managers = append(managers, *user)
+	}
+	return managers, nil
+}
+
+func (m *MockUserRepository) ReassignReports(from, to int) (int, error) {
+	if _, err := m.GetUserByID(to); err != nil {
+		return 0, repository.FieldErrorf("reassign_to", model.FieldInvalid, "no user found with ID %d", to)
+	}
+	moved := 0
+	for i, user := range m.users {
+		if int(user.ManagerID) == from {
+			m.users[i].ManagerID = int64(to)
+			moved++
+		}
+	}
+	return moved, nil
+}
+
+func (m *MockUserRepository) OrgChart(opts repository.OrgChartOptions) ([]model.OrgChartEntry, error) {
+	m.chartOptions = opts
+	entries := []model.OrgChartEntry{}
+	if opts.Root != 0 {
+		user, err := m.GetUserByID(opts.Root)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, model.OrgChartEntry{User: *user})
+	} else {
+		for _, user := range m.users {
+			if user.ManagerID == 0 {
+				entries = append(entries, model.OrgChartEntry{User: user})
+			}
+		}
+	}
+	for i := 0; i < len(entries); i++ {
+		for _, user := range m.users {
+			if user.ManagerID == entries[i].User.ID && (opts.DepartmentID == 0 || user.DepartmentID == opts.DepartmentID) {
+				entries = append(entries, model.OrgChartEntry{User: user, ParentID: user.ManagerID})
+			}
+		}
+	}
+	return entries, m.err
+}
+
+func (m *MockUserRepository) SearchUsers(query string, limit int) ([]model.UserSearchResult, error) {
+	m.searchQuery = query
+	m.searchLimit = limit
+	return m.results, m.err
+}
+
+func (m *MockUserRepository) SuggestUsers(prefix string, limit int) ([]model.UserSuggestion, error) {
+	m.searchQuery = prefix
+	m.searchLimit = limit
+	return m.suggestions, m.err
+}
+
+func (m *MockUserRepository) DeleteUser(id int, version int64, deletedBy string) (bool, error) {
+	m.version = version
+	m.deletedBy = deletedBy
+	if m.err != nil {
+		return false, m.err
+	}
+	if m.conflict {
+		return false, repository.ErrVersionConflict
+	}
+	for _, user := range m.users {
+		if int(user.ID) == id {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *MockUserRepository) RestoreUser(id int) (*model.User, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	if m.taken {
+		return nil, repository.ErrUsernameTaken
+	}
+	for _, user := range m.users {
+		if int(user.ID) == id {
+			user.DeletedAt, user.DeletedBy = nil, ""
+			user.Version++
+			return &user, nil
+		}
+	}
+	return nil, errors.New("not deleted")
+}
+
+func (m *MockUserRepository) PurgeUser(id int) (bool, error) {
+	m.purged = append(m.purged, id)
+	return m.err == nil, m.err
+}
+
+func (m *MockUserRepository) InTransaction(fn func(tx repository.UserRepository) error) error {
+	err := fn(m)
+	m.rolledBack = err != nil
+	return err
+}
+
 func TestUserController(t *testing.T) {
 	gomega.RegisterFailHandler(ginkgo.Fail)
 	ginkgo.RunSpecs(t, "UserController Suite")
 }
 
+// MockIdempotencyRepository keeps idempotency records in memory
+type MockIdempotencyRepository struct {
+	records map[string]repository.IdempotencyRecord
+}
+
+func (m *MockIdempotencyRepository) ClaimKey(record repository.IdempotencyRecord, now time.Time) (*repository.IdempotencyRecord, error) {
+	if existing, ok := m.records[record.Actor+"\n"+record.Key]; ok && existing.ExpiresAt.After(now) {
+		return &existing, nil
+	}
+	m.records[record.Actor+"\n"+record.Key] = record
+	return nil, nil
+}
+
+func (m *MockIdempotencyRepository) CompleteKey(record repository.IdempotencyRecord) error {
+	claimed := m.records[record.Actor+"\n"+record.Key]
+	claimed.Status, claimed.Header, claimed.Body = record.Status, record.Header, record.Body
+	m.records[record.Actor+"\n"+record.Key] = claimed
+	return nil
+}
+
+func (m *MockIdempotencyRepository) ReleaseKey(actor, key string) error {
+	delete(m.records, actor+"\n"+key)
+	return nil
+}
+
+// MockDepartmentRepository keeps departments in memory
+type MockDepartmentRepository struct {
+	departments []model.Department
+	err         error
+	reassignTo  int
+}
+
+func (m *MockDepartmentRepository) ListDepartments() ([]model.Department, error) {
+	return m.departments, m.err
+}
+
+func (m *MockDepartmentRepository) GetDepartmentByID(id int) (*model.Department, error) {
+	for _, department := range m.departments {
+		if int(department.ID) == id {
+			return &department, nil
+		}
+	}
+	return nil, repository.Errorf(repository.ErrNotFound, "no department found with ID %d", id)
+}
+
+func (m *MockDepartmentRepository) CreateDepartment(department model.Department) (*model.Department, error) {
+	department.ID = int64(len(m.departments) + 1)
+	m.departments = append(m.departments, department)
+	return &department, nil
+}
+
+func (m *MockDepartmentRepository) UpdateDepartment(department model.Department) (*model.Department, error) {
+	return &department, m.err
+}
+
+func (m *MockDepartmentRepository) DeleteDepartment(id int, reassignTo int) (bool, error) {
+	m.reassignTo = reassignTo
+	if m.err != nil {
+		return false, m.err
+	}
+	_, err := m.GetDepartmentByID(id)
+	return err == nil, nil
+}
+
+// MockScheduledChangeRepository keeps scheduled changes in memory
+type MockScheduledChangeRepository struct {
+	changes []model.ScheduledChange
+}
+
+func (m *MockScheduledChangeRepository) ScheduleChange(change model.ScheduledChange) (*model.ScheduledChange, error) {
+	change.ID = int64(len(m.changes) + 1)
+	change.Status = model.ChangePending
+	m.changes = append(m.changes, change)
+	return &change, nil
+}
+
+func (m *MockScheduledChangeRepository) ListScheduledChanges(userID int) ([]model.ScheduledChange, error) {
+	return m.changes, nil
+}
+
+func (m *MockScheduledChangeRepository) CancelScheduledChange(userID, changeID int, cancelledBy string) (*model.ScheduledChange, error) {
+	for i, change := range m.changes {
+		if int(change.ID) != changeID {
+			continue
+		}
+		if change.Status != model.ChangePending {
+			return nil, &repository.Error{Kind: repository.ErrConflict, Code: repository.CodeChangeNotPending, Err: fmt.Errorf("scheduled change %d is %s", changeID, change.Status)}
+		}
+		m.changes[i].Status, m.changes[i].CancelledBy = model.ChangeCancelled, cancelledBy
+		return &m.changes[i], nil
+	}
+	return nil, repository.Errorf(repository.ErrNotFound, "no scheduled change %d for user %d", changeID, userID)
+}
+
+func (m *MockScheduledChangeRepository) ApplyDueChanges(now time.Time, apply func(users repository.UserRepository, change model.ScheduledChange) error) (int, error) {
+	return 0, nil
+}
+
 var _ = ginkgo.Describe("UserController", func() {
 	var (
 		e              *echo.Echo
@@ -81,6 +426,7 @@ var _ = ginkgo.Describe("UserController", func() {
 
 	ginkgo.BeforeEach(func() {
 		e = echo.New()
+		e.HTTPErrorHandler = controllers.HTTPErrorHandler
 		mockUserRepo = &MockUserRepository{}
 		userController = controllers.NewUserController(mockUserRepo)
 		
@@ -92,6 +438,7 @@ var _ = ginkgo.Describe("UserController", func() {
 			Email:      "testuser@example.com",
 			Department: "IT",
 			UserStatus: "A",
+			Version:    3,
 		}
 	})
 
@@ -148,8 +495,9 @@ var _ = ginkgo.Describe("UserController", func() {
 			// Execute
 			err := userController.GetAllUsers(c)
 
-			// Assert - in this case, the controller should have written the error response
-			gomega.Expect(err).To(gomega.BeNil()) // Controller handles the error internally
+			// Assert - the error handler writes the error response
+			gomega.Expect(err).To(gomega.HaveOccurred())
+			e.HTTPErrorHandler(err, c)
 			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusInternalServerError))
 
 			// Parse error response
@@ -162,192 +510,405 @@ var _ = ginkgo.Describe("UserController", func() {
 			gomega.Expect(response.Message).To(gomega.Equal("Failed to retrieve users"))
 			gomega.Expect(response.Error).To(gomega.Equal("database error"))
 		})
-	})
 
-	ginkgo.Context("GetUserByID", func() {
-		ginkgo.It("should return user by id successfully", func() {
-			// Setup - success case
+		ginkgo.It("should pass pagination parameters and advertise neighbouring pages", func() {
+			// Setup - a middle page
 			mockUserRepo.users = []model.User{testUser}
-			mockUserRepo.err = nil
+			mockUserRepo.nextCursor = "next-token"
+			mockUserRepo.prevCursor = "prev-token"
 
 			// Create request
-			req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
-			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			req := httptest.NewRequest(http.MethodGet, "/users?limit=1&offset=3", nil)
 			rec := httptest.NewRecorder()
 			c := e.NewContext(req, rec)
-			c.SetParamNames("id")
-    		c.SetParamValues("1")
 
 			// Execute
-			err := userController.GetUserByID(c)
+			err := userController.GetAllUsers(c)
 
 			// Assert
 			gomega.Expect(err).To(gomega.BeNil())
 			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusOK))
+			gomega.Expect(mockUserRepo.listOptions).To(gomega.Equal(repository.ListOptions{Limit: 1, Offset: 3}))
+
+			link := rec.Header().Get("Link")
+			gomega.Expect(link).To(gomega.ContainSubstring(`/users?limit=1>; rel="first"`))
+			gomega.Expect(link).To(gomega.ContainSubstring(`/users?cursor=next-token&limit=1>; rel="next"`))
+			gomega.Expect(link).To(gomega.ContainSubstring(`/users?cursor=prev-token&limit=1>; rel="prev"`))
 
 			// Parse response
 			var response struct {
-				Message string      `json:"message"`
-				Data    model.User `json:"data"`
+				Data       []model.User `json:"data"`
+				Pagination struct {
+					Total      int    `json:"total"`
+					Limit      int    `json:"limit"`
+					Offset     int    `json:"offset"`
+					NextCursor string `json:"next_cursor"`
+					PrevCursor string `json:"prev_cursor"`
+				} `json:"pagination"`
 			}
 			err = json.Unmarshal(rec.Body.Bytes(), &response)
 			gomega.Expect(err).To(gomega.BeNil())
-
-			// Verify response content
-			gomega.Expect(response.Message).To(gomega.Equal("User retrieved successfully"))
-			gomega.Expect(response.Data.ID).To(gomega.Equal(int64(1)))
-			gomega.Expect(response.Data.UserName).To(gomega.Equal("testuser"))
-			gomega.Expect(response.Data.FirstName).To(gomega.Equal("Test"))
-			gomega.Expect(response.Data.LastName).To(gomega.Equal("User"))
-			gomega.Expect(response.Data.Email).To(gomega.Equal("testuser@example.com"))
-			gomega.Expect(response.Data.Department).To(gomega.Equal("IT"))
-			gomega.Expect(response.Data.UserStatus).To(gomega.Equal("A"))
+			gomega.Expect(response.Data).To(gomega.HaveLen(1))
+			gomega.Expect(response.Pagination.Total).To(gomega.Equal(1))
+			gomega.Expect(response.Pagination.Limit).To(gomega.Equal(1))
+			gomega.Expect(response.Pagination.Offset).To(gomega.Equal(3))
+			gomega.Expect(response.Pagination.NextCursor).To(gomega.Equal("next-token"))
+			gomega.Expect(response.Pagination.PrevCursor).To(gomega.Equal("prev-token"))
 		})
 
-		ginkgo.It("should return error when user not found", func() {
-			// Setup - error case
-			mockUserRepo.users = nil
-			mockUserRepo.err = errors.New("database error")
+		ginkgo.It("should pass a parsed filter to the repository", func() {
+			// Setup - success case
+			mockUserRepo.users = []model.User{testUser}
 
 			// Create request
-			req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
-			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			req := httptest.NewRequest(http.MethodGet, "/users?filter="+url.QueryEscape(`department eq "IT"`), nil)
 			rec := httptest.NewRecorder()
 			c := e.NewContext(req, rec)
-			c.SetParamNames("id")
-    		c.SetParamValues("1")
 
 			// Execute
-			err := userController.GetUserByID(c)
+			err := userController.GetAllUsers(c)
 
-			// Assert - in this case, the controller should have written the error response
-			gomega.Expect(err).To(gomega.BeNil()) // Controller handles the error internally
-			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusInternalServerError))
+			// Assert
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusOK))
+			cmp, ok := mockUserRepo.listOptions.Filter.(*filter.Comparison)
+			gomega.Expect(ok).To(gomega.BeTrue())
+			gomega.Expect(cmp.Field).To(gomega.Equal("department"))
+			gomega.Expect(cmp.Values[0].Text).To(gomega.Equal("IT"))
+		})
+
+		ginkgo.It("should report where an invalid filter goes wrong", func() {
+			// Create request
+			req := httptest.NewRequest(http.MethodGet, "/users?filter="+url.QueryEscape(`dept eq "IT"`), nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			// Execute
+			err := userController.GetAllUsers(c)
+
+			// Assert
+			gomega.Expect(err).To(gomega.HaveOccurred())
+			e.HTTPErrorHandler(err, c)
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusBadRequest))
 
-			// Parse error response
 			var response struct {
 				Message string `json:"message"`
 				Error   string `json:"error"`
 			}
 			err = json.Unmarshal(rec.Body.Bytes(), &response)
 			gomega.Expect(err).To(gomega.BeNil())
-			gomega.Expect(response.Message).To(gomega.Equal("User not found"))
-			gomega.Expect(response.Error).To(gomega.Equal("database error"))
+			gomega.Expect(response.Message).To(gomega.Equal("Invalid filter"))
+			gomega.Expect(response.Error).To(gomega.HavePrefix(`position 1: unknown field "dept"`))
 		})
-	})
 
-	ginkgo.Context("CreateUser", func() {
-		ginkgo.It("should create user successfully", func() {
-			// Setup - success case
-			mockUserRepo.users = nil
-			mockUserRepo.err = nil
-			mockUserRepo.exists = false
-			
-			// Create a copy of testUser that will be returned by the mock
-			returnedUser := testUser
-			returnedUser.ID = 1
-			
-			// Set up the mock to return our user with ID=1
-			mockUserRepo.users = []model.User{returnedUser}
-			
-			// Create request with JSON body
-			requestBody := `{
-				"user_name": "testuser",
-				"first_name": "Test",
-				"last_name": "User",
-				"email": "testuser@example.com",
-				"department": "IT",
-				"user_status": "A"
-			}`
-			
-			req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(requestBody))
-			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		ginkgo.DescribeTable("should not filter on bookkeeping fields",
+			func(raw string, field string) {
+				req := httptest.NewRequest(http.MethodGet, "/users?filter="+url.QueryEscape(raw), nil)
+				rec := httptest.NewRecorder()
+				c := e.NewContext(req, rec)
+
+				err := userController.GetAllUsers(c)
+
+				gomega.Expect(err).To(gomega.HaveOccurred())
+				e.HTTPErrorHandler(err, c)
+				gomega.Expect(rec.Code).To(gomega.Equal(http.StatusBadRequest))
+				gomega.Expect(rec.Body.String()).To(gomega.ContainSubstring(fmt.Sprintf(`unknown field \"%s\"`, field)))
+			},
+			ginkgo.Entry("version", `version eq 1`, "version"),
+			ginkgo.Entry("deleted_by", `deleted_by eq "admin"`, "deleted_by"),
+		)
+
+		ginkgo.It("should pass the requested sort to the repository", func() {
+			// Create request
+			req := httptest.NewRequest(http.MethodGet, "/users?sort=last_name,-department", nil)
 			rec := httptest.NewRecorder()
 			c := e.NewContext(req, rec)
-			
+
 			// Execute
-			err := userController.CreateUser(c)
-			
+			err := userController.GetAllUsers(c)
+
 			// Assert
 			gomega.Expect(err).To(gomega.BeNil())
 			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusOK))
-			
-			// Parse response
-			var response struct {
-				Message string     `json:"message"`
-				Data    model.User `json:"data"`
-			}
-			err = json.Unmarshal(rec.Body.Bytes(), &response)
-			gomega.Expect(err).To(gomega.BeNil())
-			
-			// Verify response content
-			gomega.Expect(response.Message).To(gomega.Equal("User created successfully"))
-			gomega.Expect(response.Data.ID).To(gomega.Equal(int64(1)))
-			gomega.Expect(response.Data.UserName).To(gomega.Equal("testuser"))
-			gomega.Expect(response.Data.FirstName).To(gomega.Equal("Test"))
-			gomega.Expect(response.Data.LastName).To(gomega.Equal("User"))
-			gomega.Expect(response.Data.Email).To(gomega.Equal("testuser@example.com"))
-			gomega.Expect(response.Data.Department).To(gomega.Equal("IT"))
-			gomega.Expect(response.Data.UserStatus).To(gomega.Equal("A"))
+			gomega.Expect(mockUserRepo.listOptions.Sort).To(gomega.Equal([]repository.SortField{
+				{Column: "last_name"},
+				{Column: "department", Desc: true},
+			}))
 		})
 
-		ginkgo.It("should return error when username already exists", func() {
-			// Setup - error case
-			mockUserRepo.users = nil
-			mockUserRepo.err = fmt.Errorf("username 'testuser' already exists")
-			mockUserRepo.exists = true
-			
-			// Create request with JSON body
-			requestBody := `{
-				"user_name": "testuser",
-				"first_name": "Test",
-				"last_name": "User",
-				"email": "testuser@example.com",
-				"department": "IT",
-				"user_status": "A"
-			}`
-			
-			req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(requestBody))
-			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		ginkgo.It("should reject sorting by a column that does not exist", func() {
+			// Create request
+			req := httptest.NewRequest(http.MethodGet, "/users?sort=password", nil)
 			rec := httptest.NewRecorder()
 			c := e.NewContext(req, rec)
-			
+
 			// Execute
-			err := userController.CreateUser(c)
-			
-			// Assert - in this case, the controller should have written the error response
-			gomega.Expect(err).To(gomega.BeNil()) // Controller handles the error internally
-			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusInternalServerError))
-			
-			// Parse error response
+			err := userController.GetAllUsers(c)
+
+			// Assert
+			gomega.Expect(err).To(gomega.HaveOccurred())
+			e.HTTPErrorHandler(err, c)
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusBadRequest))
+			gomega.Expect(rec.Body.String()).To(gomega.ContainSubstring(`cannot sort by \"password\"`))
+		})
+
+		ginkgo.It("should return only the requested fields", func() {
+			// Setup
+			mockUserRepo.users = []model.User{testUser}
+
+			// Create request
+			req := httptest.NewRequest(http.MethodGet, "/users?fields=user_id,user_name", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			// Execute
+			err := userController.GetAllUsers(c)
+
+			// Assert
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusOK))
+			gomega.Expect(mockUserRepo.listOptions.Fields).To(gomega.Equal([]string{"user_id", "user_name"}))
+
 			var response struct {
-				Message string `json:"message"`
-				Error   string `json:"error"`
+				Data []map[string]interface{} `json:"data"`
 			}
 			err = json.Unmarshal(rec.Body.Bytes(), &response)
 			gomega.Expect(err).To(gomega.BeNil())
-			gomega.Expect(response.Message).To(gomega.Equal("Username already exists"))
-			gomega.Expect(response.Error).To(gomega.Equal("username 'testuser' already exists"))
+			gomega.Expect(response.Data).To(gomega.Equal([]map[string]interface{}{
+				{"user_id": 1.0, "user_name": "testuser"},
+			}))
 		})
 
-		ginkgo.It("should return error when database error occurs", func() {
+		ginkgo.It("should embed registered includes and load the fields they need", func() {
+			// Setup
+			mockUserRepo.users = []model.User{testUser}
+			userController.RegisterInclude("team", controllers.Include{
+				Fields: []string{"department"},
+				Load: func(users []model.User) (map[int64]interface{}, error) {
+					teams := map[int64]interface{}{}
+					for _, user := range users {
+						teams[user.ID] = map[string]string{"name": user.Department}
+					}
+					return teams, nil
+				},
+			})
+
+			// Create request
+			req := httptest.NewRequest(http.MethodGet, "/users?fields=user_name&include=team", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			// Execute
+			err := userController.GetAllUsers(c)
+
+			// Assert
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusOK))
+			gomega.Expect(mockUserRepo.listOptions.Fields).To(gomega.Equal([]string{"user_name", "department"}))
+			gomega.Expect(rec.Body.String()).To(gomega.ContainSubstring(
+				`"data":[{"_embedded":{"team":{"name":"IT"}},"user_name":"testuser"}]`))
+		})
+
+		ginkgo.It("should reject unknown fields and includes", func() {
+			for _, query := range []string{"fields=password", "include=manager"} {
+				// Create request
+				req := httptest.NewRequest(http.MethodGet, "/users?"+query, nil)
+				rec := httptest.NewRecorder()
+				c := e.NewContext(req, rec)
+
+				// Execute
+				err := userController.GetAllUsers(c)
+
+				// Assert
+				gomega.Expect(err).To(gomega.HaveOccurred())
+				e.HTTPErrorHandler(err, c)
+				gomega.Expect(rec.Code).To(gomega.Equal(http.StatusBadRequest))
+				gomega.Expect(rec.Body.String()).To(gomega.ContainSubstring("Invalid fields or include"))
+			}
+		})
+
+		ginkgo.It("should reject a non-numeric limit", func() {
+			// Create request
+			req := httptest.NewRequest(http.MethodGet, "/users?limit=ten", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			// Execute
+			err := userController.GetAllUsers(c)
+
+			// Assert
+			gomega.Expect(err).To(gomega.HaveOccurred())
+			e.HTTPErrorHandler(err, c)
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusBadRequest))
+			gomega.Expect(rec.Body.String()).To(gomega.ContainSubstring("limit must be an integer"))
+		})
+	})
+
+	ginkgo.Context("SearchUsers", func() {
+		ginkgo.It("should return ranked results with highlights", func() {
+			// Setup - success case
+			mockUserRepo.results = []model.UserSearchResult{{
+				User:       testUser,
+				Score:      2.5,
+				Snippet:    "<mark>Test</mark>",
+				Highlights: map[string]string{"first_name": "<mark>Test</mark>"},
+			}}
+
+			// Create request
+			req := httptest.NewRequest(http.MethodGet, "/users/search?q=tes&limit=5", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			// Execute
+			err := userController.SearchUsers(c)
+
+			// Assert
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusOK))
+			gomega.Expect(mockUserRepo.searchQuery).To(gomega.Equal("tes"))
+			gomega.Expect(mockUserRepo.searchLimit).To(gomega.Equal(5))
+
+			// Parse response
+			var response struct {
+				Message string                   `json:"message"`
+				Data    []model.UserSearchResult `json:"data"`
+			}
+			err = json.Unmarshal(rec.Body.Bytes(), &response)
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(response.Message).To(gomega.Equal("Users found successfully"))
+			gomega.Expect(response.Data).To(gomega.Equal(mockUserRepo.results))
+		})
+
+		ginkgo.It("should return error when the search fails", func() {
+			// Setup - error case
+			mockUserRepo.err = repository.ErrEmptySearch
+
+			// Create request
+			req := httptest.NewRequest(http.MethodGet, "/users/search?q=", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			// Execute
+			err := userController.SearchUsers(c)
+
+			// Assert
+			gomega.Expect(err).To(gomega.HaveOccurred())
+			e.HTTPErrorHandler(err, c)
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusUnprocessableEntity))
+			gomega.Expect(rec.Body.String()).To(gomega.ContainSubstring("Failed to search users"))
+		})
+	})
+
+	ginkgo.Context("SuggestUsers", func() {
+		ginkgo.It("should return suggestions for the typed prefix", func() {
+			// Setup - success case
+			mockUserRepo.suggestions = []model.UserSuggestion{{User: testUser, Score: 0.95}}
+
+			// Create request
+			req := httptest.NewRequest(http.MethodGet, "/users/suggest?prefix=tset", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			// Execute
+			err := userController.SuggestUsers(c)
+
+			// Assert
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusOK))
+			gomega.Expect(mockUserRepo.searchQuery).To(gomega.Equal("tset"))
+			gomega.Expect(mockUserRepo.searchLimit).To(gomega.Equal(0))
+
+			// Parse response
+			var response struct {
+				Data []model.UserSuggestion `json:"data"`
+			}
+			err = json.Unmarshal(rec.Body.Bytes(), &response)
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(response.Data).To(gomega.Equal(mockUserRepo.suggestions))
+		})
+	})
+
+	ginkgo.Context("GetUserByID", func() {
+		ginkgo.It("should return user by id successfully", func() {
+			// Setup - success case
+			mockUserRepo.users = []model.User{testUser}
+			mockUserRepo.err = nil
+
+			// Create request
+			req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("id")
+    		c.SetParamValues("1")
+
+			// Execute
+			err := userController.GetUserByID(c)
+
+			// Assert
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusOK))
+
+			// Parse response
+			var response struct {
+				Message string      `json:"message"`
+				Data    model.User `json:"data"`
+			}
+			err = json.Unmarshal(rec.Body.Bytes(), &response)
+			gomega.Expect(err).To(gomega.BeNil())
+
+			// Verify response content
+			gomega.Expect(response.Message).To(gomega.Equal("User retrieved successfully"))
+			gomega.Expect(response.Data.ID).To(gomega.Equal(int64(1)))
+			gomega.Expect(response.Data.UserName).To(gomega.Equal("testuser"))
+			gomega.Expect(response.Data.FirstName).To(gomega.Equal("Test"))
+			gomega.Expect(response.Data.LastName).To(gomega.Equal("User"))
+			gomega.Expect(response.Data.Email).To(gomega.Equal("testuser@example.com"))
+			gomega.Expect(response.Data.Department).To(gomega.Equal("IT"))
+			gomega.Expect(response.Data.UserStatus).To(gomega.Equal("A"))
+		})
+
+		ginkgo.It("should return only the requested fields of a user", func() {
+			// Setup
+			mockUserRepo.users = []model.User{testUser}
+
+			// Create request
+			req := httptest.NewRequest(http.MethodGet, "/users/1?fields=email", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("id")
+			c.SetParamValues("1")
+
+			// Execute
+			err := userController.GetUserByID(c)
+
+			// Assert
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusOK))
+			gomega.Expect(mockUserRepo.fields).To(gomega.Equal([]string{"email"}))
+			gomega.Expect(rec.Body.String()).To(gomega.ContainSubstring(`"data":{"email":"testuser@example.com"}`))
+		})
+
+		ginkgo.It("should return error when user not found", func() {
 			// Setup - error case
 			mockUserRepo.users = nil
-			mockUserRepo.err = errors.New("database error")
-			mockUserRepo.exists = false
+			mockUserRepo.err = repository.Errorf(repository.ErrNotFound, "no user found with ID 1")
 
 			// Create request
-			req := httptest.NewRequest(http.MethodPost, "/users", nil)
+			req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
 			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 			rec := httptest.NewRecorder()
 			c := e.NewContext(req, rec)
+			c.SetParamNames("id")
+    		c.SetParamValues("1")
 
 			// Execute
-			err := userController.CreateUser(c)
+			err := userController.GetUserByID(c)
 
-			// Assert - in this case, the controller should have written the error response
-			gomega.Expect(err).To(gomega.BeNil()) // Controller handles the error internally
-			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusInternalServerError))
+			// Assert - the error handler writes the error response
+			gomega.Expect(err).To(gomega.HaveOccurred())
+			e.HTTPErrorHandler(err, c)
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusNotFound))
 
 			// Parse error response
 			var response struct {
@@ -356,16 +917,17 @@ var _ = ginkgo.Describe("UserController", func() {
 			}
 			err = json.Unmarshal(rec.Body.Bytes(), &response)
 			gomega.Expect(err).To(gomega.BeNil())
-			gomega.Expect(response.Message).To(gomega.Equal("Failed to create user"))
-			gomega.Expect(response.Error).To(gomega.Equal("database error"))
+			gomega.Expect(response.Message).To(gomega.Equal("Failed to retrieve user"))
+			gomega.Expect(response.Error).To(gomega.Equal("no user found with ID 1"))
 		})
 	})
 
-	ginkgo.Context("UpdateUser", func() {
-		ginkgo.It("should update user successfully", func() {
+	ginkgo.Context("CreateUser", func() {
+		ginkgo.It("should create user successfully", func() {
 			// Setup - success case
 			mockUserRepo.users = nil
 			mockUserRepo.err = nil
+			mockUserRepo.exists = false
 			
 			// Create a copy of testUser that will be returned by the mock
 			returnedUser := testUser
@@ -384,19 +946,18 @@ var _ = ginkgo.Describe("UserController", func() {
 				"user_status": "A"
 			}`
 			
-			req := httptest.NewRequest(http.MethodPut, "/users/1", strings.NewReader(requestBody))
+			req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(requestBody))
 			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 			rec := httptest.NewRecorder()
 			c := e.NewContext(req, rec)
-			c.SetParamNames("id")
-    		c.SetParamValues("1")
 			
 			// Execute
-			err := userController.UpdateUser(c)
+			err := userController.CreateUser(c)
 			
 			// Assert
 			gomega.Expect(err).To(gomega.BeNil())
 			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusOK))
+			gomega.Expect(rec.Header().Get(echo.HeaderLocation)).To(gomega.Equal("/users/1"))
 			
 			// Parse response
 			var response struct {
@@ -407,7 +968,7 @@ var _ = ginkgo.Describe("UserController", func() {
 			gomega.Expect(err).To(gomega.BeNil())
 			
 			// Verify response content
-			gomega.Expect(response.Message).To(gomega.Equal("User updated successfully"))
+			gomega.Expect(response.Message).To(gomega.Equal("User created successfully"))
 			gomega.Expect(response.Data.ID).To(gomega.Equal(int64(1)))
 			gomega.Expect(response.Data.UserName).To(gomega.Equal("testuser"))
 			gomega.Expect(response.Data.FirstName).To(gomega.Equal("Test"))
@@ -417,22 +978,92 @@ var _ = ginkgo.Describe("UserController", func() {
 			gomega.Expect(response.Data.UserStatus).To(gomega.Equal("A"))
 		})
 
+		ginkgo.It("should return error when username already exists", func() {
+			// Setup - error case
+			mockUserRepo.users = nil
+			mockUserRepo.err = repository.Errorf(repository.ErrConflict, "username 'testuser' already exists")
+			mockUserRepo.exists = true
+			
+			// Create request with JSON body
+			requestBody := `{
+				"user_name": "testuser",
+				"first_name": "Test",
+				"last_name": "User",
+				"email": "testuser@example.com",
+				"department": "IT",
+				"user_status": "A"
+			}`
+			
+			req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(requestBody))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			
+			// Execute
+			err := userController.CreateUser(c)
+			
+			// Assert - the error handler writes the error response
+			gomega.Expect(err).To(gomega.HaveOccurred())
+			e.HTTPErrorHandler(err, c)
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusConflict))
+			
+			// Parse error response
+			var response struct {
+				Message string `json:"message"`
+				Error   string `json:"error"`
+			}
+			err = json.Unmarshal(rec.Body.Bytes(), &response)
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(response.Message).To(gomega.Equal("Failed to create user"))
+			gomega.Expect(response.Error).To(gomega.Equal("username 'testuser' already exists"))
+		})
+
+		ginkgo.It("should report every invalid field before touching the repository", func() {
+			// Setup - the repository fails if it is reached
+			mockUserRepo.err = errors.New("database error")
+
+			requestBody := `{"user_name": "", "first_name": "Test", "last_name": "User", "email": "not-an-email", "user_status": "Z"}`
+			req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(requestBody))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			// Execute
+			err := userController.CreateUser(c)
+
+			// Assert
+			gomega.Expect(err).To(gomega.HaveOccurred())
+			e.HTTPErrorHandler(err, c)
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusUnprocessableEntity))
+
+			var response response.ErrorResponse
+			gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &response)).To(gomega.Succeed())
+			gomega.Expect(response.Message).To(gomega.Equal("Invalid user"))
+			gomega.Expect(response.Errors).To(gomega.Equal([]model.FieldError{
+				{Field: "user_name", Code: model.FieldRequired, Detail: "user_name is required"},
+				{Field: "email", Code: model.FieldInvalid, Detail: `email "not-an-email" is not a valid address`},
+				{Field: "user_status", Code: model.FieldInvalid, Detail: `user_status must be one of A, I, T, got "Z"`},
+			}))
+		})
+
 		ginkgo.It("should return error when database error occurs", func() {
 			// Setup - error case
 			mockUserRepo.users = nil
 			mockUserRepo.err = errors.New("database error")
+			mockUserRepo.exists = false
 
 			// Create request
-			req := httptest.NewRequest(http.MethodPut, "/users/1", nil)
+			req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(`{"user_id":1,"user_name":"testuser","first_name":"Test","last_name":"User","email":"t@example.com","user_status":"A"}`))
 			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 			rec := httptest.NewRecorder()
 			c := e.NewContext(req, rec)
 
 			// Execute
-			err := userController.UpdateUser(c)
+			err := userController.CreateUser(c)
 
-			// Assert - in this case, the controller should have written the error response
-			gomega.Expect(err).To(gomega.BeNil()) // Controller handles the error internally
+			// Assert - the error handler writes the error response
+			gomega.Expect(err).To(gomega.HaveOccurred())
+			e.HTTPErrorHandler(err, c)
 			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusInternalServerError))
 
 			// Parse error response
@@ -442,10 +1073,1863 @@ var _ = ginkgo.Describe("UserController", func() {
 			}
 			err = json.Unmarshal(rec.Body.Bytes(), &response)
 			gomega.Expect(err).To(gomega.BeNil())
-			gomega.Expect(response.Message).To(gomega.Equal("Failed to update user"))
+			gomega.Expect(response.Message).To(gomega.Equal("Failed to create user"))
 			gomega.Expect(response.Error).To(gomega.Equal("database error"))
 		})
 	})
+
+	ginkgo.Context("UpdateUser", func() {
+		ginkgo.It("should update user successfully", func() {
+			// Setup - success case
+			mockUserRepo.users = nil
+			mockUserRepo.err = nil
+			
+			// Create a copy of testUser that will be returned by the mock
+			returnedUser := testUser
+			returnedUser.ID = 1
+			
+			// Set up the mock to return our user with ID=1
+			mockUserRepo.users = []model.User{returnedUser}
+			
+			// Create request with JSON body
+			requestBody := `{
+				"user_name": "testuser",
+				"first_name": "Test",
+				"last_name": "User",
+				"email": "testuser@example.com",
+				"department": "Sales",
+				"user_status": "A"
+			}`
+			
+			req := httptest.NewRequest(http.MethodPut, "/users/1", strings.NewReader(requestBody))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("id")
+    		c.SetParamValues("1")
+			
+			// Execute
+			err := userController.UpdateUser(c)
+			
+			// Assert
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusOK))
+			
+			// Parse response
+			var response struct {
+				Message string     `json:"message"`
+				Data    model.User `json:"data"`
+			}
+			err = json.Unmarshal(rec.Body.Bytes(), &response)
+			gomega.Expect(err).To(gomega.BeNil())
+			
+			// Verify response content
+			gomega.Expect(response.Message).To(gomega.Equal("User updated successfully"))
+			gomega.Expect(response.Data.ID).To(gomega.Equal(int64(1)))
+			gomega.Expect(response.Data.UserName).To(gomega.Equal("testuser"))
+			gomega.Expect(response.Data.FirstName).To(gomega.Equal("Test"))
+			gomega.Expect(response.Data.LastName).To(gomega.Equal("User"))
+			gomega.Expect(response.Data.Email).To(gomega.Equal("testuser@example.com"))
+			gomega.Expect(response.Data.Department).To(gomega.Equal("Sales"))
+			gomega.Expect(mockUserRepo.updates).To(gomega.Equal(1))
+			gomega.Expect(response.Data.UserStatus).To(gomega.Equal("A"))
+		})
+
+		ginkgo.It("should return error when database error occurs", func() {
+			// Setup - error case
+			mockUserRepo.users = nil
+			mockUserRepo.err = errors.New("database error")
+
+			// Create request
+			req := httptest.NewRequest(http.MethodPut, "/users/1", strings.NewReader(`{"user_id":1,"user_name":"testuser","first_name":"Test","last_name":"User","email":"t@example.com","user_status":"A"}`))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("id")
+			c.SetParamValues("1")
+
+			// Execute
+			err := userController.UpdateUser(c)
+
+			// Assert - the error handler writes the error response
+			gomega.Expect(err).To(gomega.HaveOccurred())
+			e.HTTPErrorHandler(err, c)
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusInternalServerError))
+
+			// Parse error response
+			var response struct {
+				Message string `json:"message"`
+				Error   string `json:"error"`
+			}
+			err = json.Unmarshal(rec.Body.Bytes(), &response)
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(response.Message).To(gomega.Equal("Failed to update user"))
+			gomega.Expect(response.Error).To(gomega.Equal("database error"))
+		})
+
+		// put sends a PUT for the user with the given ID and returns the
+		// response, with any error written by the error handler
+		put := func(id, query, ifMatch, body string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodPut, "/users/"+id+query, strings.NewReader(body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			if ifMatch != "" {
+				req.Header.Set("If-Match", ifMatch)
+			}
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("id")
+			c.SetParamValues(id)
+			if err := userController.UpdateUser(c); err != nil {
+				e.HTTPErrorHandler(err, c)
+			}
+			return rec
+		}
+		body := `{"user_name":"testuser","first_name":"Test","last_name":"User","email":"testuser@example.com","department":"IT","user_status":"A"}`
+
+		ginkgo.It("should not rename a user to a username that is taken", func() {
+			mockUserRepo.users = []model.User{testUser}
+			mockUserRepo.exists = true
+
+			rec := put("1", "", "", strings.Replace(body, `"testuser"`, `"taken"`, 1))
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusConflict))
+			gomega.Expect(rec.Body.String()).To(gomega.ContainSubstring(`"code":"username_taken"`))
+		})
+
+		ginkgo.It("should refuse a body whose user_id differs from the path", func() {
+			mockUserRepo.users = []model.User{testUser}
+
+			rec := put("5", "", "", `{"user_id":7,"user_name":"testuser","first_name":"Test","last_name":"User","email":"t@example.com","user_status":"A"}`)
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusBadRequest))
+			gomega.Expect(rec.Body.String()).To(gomega.ContainSubstring(`"code":"id_mismatch"`))
+			gomega.Expect(mockUserRepo.updates).To(gomega.BeZero())
+		})
+
+		ginkgo.It("should not write a replay of an applied request, even with a stale If-Match", func() {
+			mockUserRepo.users = []model.User{testUser}
+
+			rec := put("1", "", `"v1-json-2"`, body)
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusOK))
+			gomega.Expect(rec.Header().Get("ETag")).To(gomega.Equal(`"v1-json-3"`))
+			gomega.Expect(mockUserRepo.updates).To(gomega.BeZero())
+		})
+
+		ginkgo.It("should answer 404 for a missing user unless asked to create it", func() {
+			rec := put("5", "", "", body)
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusNotFound))
+
+			rec = put("5", "?upsert=true", "", body)
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusCreated))
+			gomega.Expect(rec.Header().Get("Location")).To(gomega.Equal("/users/5"))
+			gomega.Expect(rec.Header().Get("ETag")).To(gomega.Equal(`"v1-json-1"`))
+			gomega.Expect(mockUserRepo.users).To(gomega.HaveLen(1))
+			gomega.Expect(mockUserRepo.users[0].ID).To(gomega.Equal(int64(5)))
+
+			rec = put("5", "?upsert=true", "", body)
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusOK), "the replay finds the user it created")
+			gomega.Expect(mockUserRepo.users).To(gomega.HaveLen(1))
+			gomega.Expect(mockUserRepo.updates).To(gomega.BeZero())
+		})
+
+		ginkgo.It("should not create a user for a request conditional on its version", func() {
+			rec := put("5", "?upsert=true", `"v1-json-1"`, body)
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusPreconditionFailed))
+			gomega.Expect(mockUserRepo.users).To(gomega.BeEmpty())
+		})
+	})
+
+	ginkgo.Context("PatchUser", func() {
+		// patchUser sends a PATCH for user 1 with the given content type and body
+		patchUser := func(contentType, body string) (*httptest.ResponseRecorder, map[string]interface{}) {
+			req := httptest.NewRequest(http.MethodPatch, "/users/1", strings.NewReader(body))
+			req.Header.Set(echo.HeaderContentType, contentType)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("id")
+			c.SetParamValues("1")
+
+			if err := userController.PatchUser(c); err != nil {
+				e.HTTPErrorHandler(err, c)
+			}
+
+			var response map[string]interface{}
+			err := json.Unmarshal(rec.Body.Bytes(), &response)
+			gomega.Expect(err).To(gomega.BeNil())
+			return rec, response
+		}
+
+		ginkgo.BeforeEach(func() {
+			mockUserRepo.users = []model.User{testUser}
+		})
+
+		ginkgo.It("should list the fields at fault", func() {
+			rec, response := patchUser("application/merge-patch+json", `{"user_name":"","last_name":null}`)
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusUnprocessableEntity))
+			gomega.Expect(response["code"]).To(gomega.Equal("validation_failed"))
+			gomega.Expect(response["errors"]).To(gomega.Equal([]interface{}{
+				map[string]interface{}{"field": "user_name", "code": "required", "detail": "user_name is required"},
+				map[string]interface{}{"field": "last_name", "code": "required", "detail": "last_name is required"},
+			}))
+		})
+
+		ginkgo.It("should name a read-only field that the patch changes", func() {
+			rec, response := patchUser("application/json-patch+json", `[{"op":"replace","path":"/version","value":7}]`)
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusUnprocessableEntity))
+			gomega.Expect(response["errors"]).To(gomega.ConsistOf(
+				gomega.HaveKeyWithValue("field", "version"),
+			))
+		})
+
+		ginkgo.It("should change only the fields in a merge patch", func() {
+			// Execute
+			rec, response := patchUser("application/merge-patch+json", `{"email":"new@example.com","department":null}`)
+
+			// Assert
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusOK))
+			gomega.Expect(response["data"]).To(gomega.Equal(map[string]interface{}{
+				"user_id":     1.0,
+				"user_name":   "testuser",
+				"first_name":  "Test",
+				"last_name":   "User",
+				"email":       "new@example.com",
+				"department":  "",
+				"user_status": "A",
+				"version":     4.0,
+			}))
+		})
+
+		ginkgo.It("should apply JSON Patch operations after their tests pass", func() {
+			// Execute
+			rec, response := patchUser("application/json-patch+json; charset=utf-8", `[
+				{"op": "test", "path": "/user_status", "value": "A"},
+				{"op": "replace", "path": "/user_status", "value": "I"}
+			]`)
+
+			// Assert
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusOK))
+			gomega.Expect(response["data"]).To(gomega.HaveKeyWithValue("user_status", "I"))
+			gomega.Expect(mockUserRepo.updates).To(gomega.Equal(1))
+		})
+
+		ginkgo.DescribeTable("should not save a patch that fails",
+			func(contentType, body string, status int, message, detail string) {
+				// Execute
+				rec, response := patchUser(contentType, body)
+
+				// Assert
+				gomega.Expect(rec.Code).To(gomega.Equal(status))
+				gomega.Expect(response["message"]).To(gomega.Equal(message))
+				gomega.Expect(response["error"]).To(gomega.ContainSubstring(detail))
+				gomega.Expect(mockUserRepo.updates).To(gomega.BeZero())
+			},
+			ginkgo.Entry("a failed test operation", "application/json-patch+json",
+				`[{"op":"test","path":"/user_status","value":"I"},{"op":"remove","path":"/email"}]`,
+				http.StatusConflict, "Failed to apply patch", "test failed"),
+			ginkgo.Entry("an unsupported content type", "application/json",
+				`{"email":"new@example.com"}`, http.StatusUnsupportedMediaType, "Failed to apply patch", "application/merge-patch+json"),
+			ginkgo.Entry("an unknown field", "application/merge-patch+json",
+				`{"password":"secret"}`, http.StatusUnprocessableEntity, "Failed to apply patch", `unknown field "password"`),
+			ginkgo.Entry("a mistyped field", "application/merge-patch+json",
+				`{"email":42}`, http.StatusUnprocessableEntity, "Failed to apply patch", "patched user is invalid"),
+			ginkgo.Entry("a changed ID", "application/json-patch+json",
+				`[{"op":"replace","path":"/user_id","value":2}]`, http.StatusUnprocessableEntity, "Failed to apply patch", "user_id cannot be changed"),
+			ginkgo.Entry("a removed required field", "application/merge-patch+json",
+				`{"user_name":null,"first_name":" "}`, http.StatusUnprocessableEntity, "Invalid user", "user_name is required; first_name is required"),
+			ginkgo.Entry("an invalid email", "application/merge-patch+json",
+				`{"email":"nobody"}`, http.StatusUnprocessableEntity, "Invalid user", "not a valid address"),
+		)
+
+		ginkgo.It("should not rename a user to a username that is taken", func() {
+			// Setup
+			mockUserRepo.exists = true
+
+			// Execute
+			rec, response := patchUser("application/merge-patch+json", `{"user_name":"taken"}`)
+
+			// Assert
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusConflict))
+			gomega.Expect(response["message"]).To(gomega.Equal("Failed to update user"))
+			gomega.Expect(response["error"]).To(gomega.Equal("username 'taken' already exists"))
+			gomega.Expect(mockUserRepo.updates).To(gomega.BeZero())
+		})
+	})
+
+	ginkgo.Context("Conditional requests", func() {
+		// send runs a handler for user 1 with the given conditional header
+		send := func(method, header, value, body string, handler func(echo.Context) error) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, "/users/1", strings.NewReader(body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			if header != "" {
+				req.Header.Set(header, value)
+			}
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("id")
+			c.SetParamValues("1")
+
+			if err := handler(c); err != nil {
+				e.HTTPErrorHandler(err, c)
+			}
+			return rec
+		}
+
+		ginkgo.BeforeEach(func() {
+			mockUserRepo.users = []model.User{testUser}
+		})
+
+		ginkgo.It("should tag a user with its version and answer 304 while it is current", func() {
+			rec := send(http.MethodGet, "", "", "", userController.GetUserByID)
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusOK))
+			gomega.Expect(rec.Header().Get("ETag")).To(gomega.Equal(`"v1-json-3"`))
+
+			rec = send(http.MethodGet, "If-None-Match", `"v1-json-2", W/"v1-json-3"`, "", userController.GetUserByID)
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusNotModified))
+			gomega.Expect(rec.Body.Len()).To(gomega.BeZero())
+
+			rec = send(http.MethodGet, "If-None-Match", `"v1-json-2"`, "", userController.GetUserByID)
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusOK))
+		})
+
+		ginkgo.It("should tag each representation of a user differently", func() {
+			// get reads user 1 in the given format from the given controller
+			get := func(accept string, handler func(echo.Context) error) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+				req.Header.Set(echo.HeaderAccept, accept)
+				rec := httptest.NewRecorder()
+				c := e.NewContext(req, rec)
+				c.SetParamNames("id")
+				c.SetParamValues("1")
+				gomega.Expect(handler(c)).To(gomega.Succeed())
+				return rec
+			}
+
+			gomega.Expect(get("application/xml", userController.GetUserByID).Header().Get("ETag")).To(gomega.Equal(`"v1-xml-3"`))
+			gomega.Expect(get("application/vnd.api+json", userController.GetUserByID).Header().Get("ETag")).To(gomega.Equal(`"v1-vnd.api+json-3"`))
+			gomega.Expect(get("", controllers.NewUserControllerV2(mockUserRepo).GetUserByID).Header().Get("ETag")).To(gomega.Equal(`"v2-json-3"`))
+
+			// A tag read in one format does not let a write in another
+			// through, as the client has not seen that representation
+			rec := send(http.MethodDelete, "If-Match", `"v1-xml-3"`, "", userController.DeleteUser)
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusPreconditionFailed))
+			gomega.Expect(rec.Header().Get("ETag")).To(gomega.Equal(`"v1-json-3"`))
+		})
+
+		ginkgo.It("should update only the version named by If-Match", func() {
+			body := `{"user_id":1,"user_name":"testuser","first_name":"Test","last_name":"User","email":"t@example.com","user_status":"A","version":99}`
+
+			rec := send(http.MethodPut, "If-Match", `"v1-json-3"`, body, userController.UpdateUser)
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusOK))
+			gomega.Expect(mockUserRepo.version).To(gomega.Equal(int64(3)), "the body's version is ignored")
+			gomega.Expect(rec.Header().Get("ETag")).To(gomega.Equal(`"v1-json-4"`))
+
+			rec = send(http.MethodPut, "", "", body, userController.UpdateUser)
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusOK))
+			gomega.Expect(mockUserRepo.version).To(gomega.BeZero(), "without If-Match the update is unconditional")
+		})
+
+		ginkgo.DescribeTable("should answer 412 to a stale If-Match",
+			func(method, body string, handler func(uc *controllers.UserController) func(echo.Context) error) {
+				rec := send(method, "If-Match", `"v1-json-2"`, body, handler(userController))
+
+				gomega.Expect(rec.Code).To(gomega.Equal(http.StatusPreconditionFailed))
+				gomega.Expect(rec.Header().Get("ETag")).To(gomega.Equal(`"v1-json-3"`))
+				gomega.Expect(mockUserRepo.updates).To(gomega.BeZero())
+			},
+			ginkgo.Entry("on PUT", http.MethodPut, `{"user_id":1,"user_name":"testuser","first_name":"Test","last_name":"User","email":"t@example.com","user_status":"A"}`,
+				func(uc *controllers.UserController) func(echo.Context) error { return uc.UpdateUser }),
+			ginkgo.Entry("on PATCH", http.MethodPatch, `{}`,
+				func(uc *controllers.UserController) func(echo.Context) error { return uc.PatchUser }),
+			ginkgo.Entry("on DELETE", http.MethodDelete, "",
+				func(uc *controllers.UserController) func(echo.Context) error { return uc.DeleteUser }),
+		)
+
+		ginkgo.It("should answer 412 when another write gets in first", func() {
+			mockUserRepo.conflict = true
+
+			req := httptest.NewRequest(http.MethodPatch, "/users/1", strings.NewReader(`{"email":"t@example.com"}`))
+			req.Header.Set(echo.HeaderContentType, "application/merge-patch+json")
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("id")
+			c.SetParamValues("1")
+
+			err := userController.PatchUser(c)
+			gomega.Expect(err).To(gomega.HaveOccurred())
+			e.HTTPErrorHandler(err, c)
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusPreconditionFailed))
+			gomega.Expect(mockUserRepo.version).To(gomega.Equal(int64(3)), "the patch applies to the version it was read at")
+
+			rec = send(http.MethodDelete, "If-Match", `"v1-json-3"`, "", userController.DeleteUser)
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusPreconditionFailed))
+		})
+	})
+
+	ginkgo.Context("Soft delete", func() {
+		// send runs a handler for user 1 with the given headers
+		send := func(method, target string, headers map[string]string, handler func(echo.Context) error) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, target, nil)
+			for name, value := range headers {
+				req.Header.Set(name, value)
+			}
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("id")
+			c.SetParamValues("1")
+
+			if err := handler(c); err != nil {
+				e.HTTPErrorHandler(err, c)
+			}
+			return rec
+		}
+
+		ginkgo.BeforeEach(func() {
+			mockUserRepo.users = []model.User{testUser}
+		})
+
+		ginkgo.It("should record who deleted a user", func() {
+			rec := send(http.MethodDelete, "/users/1", map[string]string{"X-Actor": "hr.admin"}, userController.DeleteUser)
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusOK))
+			gomega.Expect(mockUserRepo.deletedBy).To(gomega.Equal("hr.admin"))
+
+			rec = send(http.MethodDelete, "/users/1", nil, userController.DeleteUser)
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusOK))
+			gomega.Expect(mockUserRepo.deletedBy).To(gomega.Equal("anonymous"))
+			gomega.Expect(mockUserRepo.purged).To(gomega.BeEmpty())
+		})
+
+		ginkgo.It("should not purge unless the role header is trusted", func() {
+			rec := send(http.MethodDelete, "/users/1?purge=true", map[string]string{"X-Actor-Role": "admin"}, userController.DeleteUser)
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusForbidden))
+			gomega.Expect(rec.Body.String()).To(gomega.ContainSubstring("purging users is not enabled"))
+			gomega.Expect(mockUserRepo.purged).To(gomega.BeEmpty())
+		})
+
+		ginkgo.It("should only let administrators purge", func() {
+			userController.TrustActorRole()
+
+			rec := send(http.MethodDelete, "/users/1?purge=true", map[string]string{"X-Actor-Role": "editor"}, userController.DeleteUser)
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusForbidden))
+			gomega.Expect(mockUserRepo.purged).To(gomega.BeEmpty())
+
+			rec = send(http.MethodDelete, "/users/1?purge=true", map[string]string{"X-Actor-Role": "admin"}, userController.DeleteUser)
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusOK))
+			gomega.Expect(rec.Body.String()).To(gomega.ContainSubstring("User purged successfully"))
+			gomega.Expect(mockUserRepo.purged).To(gomega.Equal([]int{1}))
+		})
+
+		ginkgo.It("should restore a user", func() {
+			rec := send(http.MethodPost, "/users/1/restore", nil, userController.RestoreUser)
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusOK))
+			gomega.Expect(rec.Header().Get("ETag")).To(gomega.Equal(`"v1-json-4"`))
+			gomega.Expect(rec.Body.String()).To(gomega.ContainSubstring("User restored successfully"))
+		})
+
+		ginkgo.It("should not restore a user whose username was reclaimed", func() {
+			mockUserRepo.taken = true
+
+			rec := send(http.MethodPost, "/users/1/restore", nil, userController.RestoreUser)
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusConflict))
+			gomega.Expect(rec.Body.String()).To(gomega.ContainSubstring("username has been taken"))
+		})
+
+		ginkgo.It("should list soft-deleted users only when asked", func() {
+			rec := send(http.MethodGet, "/users", nil, userController.GetAllUsers)
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusOK))
+			gomega.Expect(mockUserRepo.listOptions.IncludeDeleted).To(gomega.BeFalse())
+
+			rec = send(http.MethodGet, "/users?include_deleted=true", nil, userController.GetAllUsers)
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusOK))
+			gomega.Expect(mockUserRepo.listOptions.IncludeDeleted).To(gomega.BeTrue())
+
+			rec = send(http.MethodGet, "/users?include_deleted=maybe", nil, userController.GetAllUsers)
+			gomega.Expect(rec.Body.String()).To(gomega.ContainSubstring("include_deleted must be true or false"))
+		})
+	})
+
+	ginkgo.Context("BulkUsers", func() {
+		newUser := func(name string) *model.User {
+			return &model.User{UserName: name, FirstName: "New", LastName: "User", Email: name + "@example.com", UserStatus: "A"}
+		}
+
+		// send posts a batch and decodes the per-item results
+		send := func(target string, items []model.BulkItem) (*httptest.ResponseRecorder, []model.BulkResult) {
+			body, _ := json.Marshal(model.BulkRequest{Items: items})
+			req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(string(body)))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			if err := userController.BulkUsers(c); err != nil {
+				e.HTTPErrorHandler(err, c)
+			}
+
+			var response struct {
+				Data []model.BulkResult `json:"data"`
+			}
+			json.Unmarshal(rec.Body.Bytes(), &response)
+			return rec, response.Data
+		}
+
+		statuses := func(results []model.BulkResult) []int {
+			codes := []int{}
+			for _, result := range results {
+				codes = append(codes, result.Status)
+			}
+			return codes
+		}
+
+		ginkgo.BeforeEach(func() {
+			mockUserRepo.users = []model.User{testUser}
+		})
+
+		ginkgo.It("should apply mixed operations and report each one", func() {
+			updated := testUser
+			updated.FirstName = "Changed"
+
+			rec, results := send("/users/bulk", []model.BulkItem{
+				{Op: "create", User: newUser("newuser")},
+				{Op: "update", UserID: 1, Version: 3, User: &updated},
+				{Op: "delete", UserID: 1},
+			})
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusOK))
+			gomega.Expect(statuses(results)).To(gomega.Equal([]int{http.StatusCreated, http.StatusOK, http.StatusOK}))
+			gomega.Expect(results[1].User.FirstName).To(gomega.Equal("Changed"))
+			gomega.Expect(results[2].Index).To(gomega.Equal(2))
+			gomega.Expect(mockUserRepo.version).To(gomega.Equal(int64(0)))
+		})
+
+		ginkgo.It("should reject usernames used twice in a batch and apply the rest", func() {
+			rec, results := send("/users/bulk", []model.BulkItem{
+				{Op: "create", User: newUser("twin")},
+				{Op: "delete", UserID: 1},
+				{Op: "create", User: newUser("twin")},
+				{Op: "rename"},
+			})
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusMultiStatus))
+			gomega.Expect(statuses(results)).To(gomega.Equal([]int{http.StatusConflict, http.StatusOK, http.StatusConflict, http.StatusBadRequest}))
+			gomega.Expect(results[0].Error).To(gomega.ContainSubstring("more than one item"))
+			gomega.Expect(results[3].Error).To(gomega.ContainSubstring("unknown op"))
+		})
+
+		ginkgo.It("should not write anything in atomic mode when an item is invalid", func() {
+			updated := testUser
+			rec, results := send("/users/bulk?atomic=true", []model.BulkItem{
+				{Op: "update", UserID: 1, User: &updated},
+				{Op: "create", User: &model.User{UserName: "incomplete"}},
+			})
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusMultiStatus))
+			gomega.Expect(statuses(results)).To(gomega.Equal([]int{http.StatusFailedDependency, http.StatusUnprocessableEntity}))
+			gomega.Expect(mockUserRepo.updates).To(gomega.Equal(0))
+		})
+
+		ginkgo.It("should roll back an atomic batch when an item fails", func() {
+			mockUserRepo.conflict = true
+
+			rec, results := send("/users/bulk?atomic=true", []model.BulkItem{
+				{Op: "create", User: newUser("newuser")},
+				{Op: "delete", UserID: 1, Version: 2},
+				{Op: "create", User: newUser("other")},
+			})
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusMultiStatus))
+			gomega.Expect(rec.Body.String()).To(gomega.ContainSubstring("Bulk operation rolled back"))
+			gomega.Expect(statuses(results)).To(gomega.Equal([]int{http.StatusFailedDependency, http.StatusPreconditionFailed, http.StatusFailedDependency}))
+			gomega.Expect(results[0].User).To(gomega.BeNil())
+			gomega.Expect(results[0].Error).To(gomega.Equal("rolled back: item 1 failed"))
+			gomega.Expect([]string{results[0].Code, results[1].Code, results[2].Code}).To(gomega.Equal([]string{"rolled_back", "version_conflict", "not_applied"}))
+			gomega.Expect(mockUserRepo.rolledBack).To(gomega.BeTrue())
+		})
+
+		ginkgo.It("should refuse empty and oversized batches", func() {
+			rec, _ := send("/users/bulk", nil)
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusBadRequest))
+
+			rec, _ = send("/users/bulk", make([]model.BulkItem, controllers.MaxBulkItems+1))
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusRequestEntityTooLarge))
+		})
+	})
+
+	ginkgo.Context("Spreadsheets", func() {
+		// upload posts a file to ImportUsers with the given form fields
+		upload := func(target, filename, content string, fields map[string]string) (*httptest.ResponseRecorder, model.ImportReport) {
+			var body bytes.Buffer
+			form := multipart.NewWriter(&body)
+			part, _ := form.CreateFormFile("file", filename)
+			part.Write([]byte(content))
+			for name, value := range fields {
+				form.WriteField(name, value)
+			}
+			form.Close()
+
+			req := httptest.NewRequest(http.MethodPost, target, &body)
+			req.Header.Set(echo.HeaderContentType, form.FormDataContentType())
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			if err := userController.ImportUsers(c); err != nil {
+				e.HTTPErrorHandler(err, c)
+			}
+
+			var response struct {
+				Data model.ImportReport `json:"data"`
+			}
+			json.Unmarshal(rec.Body.Bytes(), &response)
+			return rec, response.Data
+		}
+
+		ginkgo.BeforeEach(func() {
+			mockUserRepo.users = []model.User{testUser}
+		})
+
+		ginkgo.It("should export users as CSV", func() {
+			req := httptest.NewRequest(http.MethodGet, "/users/export", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			err := userController.ExportUsers(c)
+
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusOK))
+			gomega.Expect(rec.Header().Get(echo.HeaderContentDisposition)).To(gomega.Equal(`attachment; filename="users.csv"`))
+			gomega.Expect(rec.Body.String()).To(gomega.Equal(
+				"user_id,user_name,first_name,last_name,email,department,user_status\n" +
+					"1,testuser,Test,User,testuser@example.com,IT,A\n"))
+		})
+
+		ginkgo.It("should export names that look like formulas as text", func() {
+			mockUserRepo.users[0].FirstName = "=HYPERLINK(\"http://evil\")"
+			req := httptest.NewRequest(http.MethodGet, "/users/export", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			gomega.Expect(userController.ExportUsers(c)).To(gomega.Succeed())
+			gomega.Expect(rec.Body.String()).To(gomega.ContainSubstring(`,testuser,"'=HYPERLINK(""http://evil"")",User,`))
+		})
+
+		ginkgo.It("should export users as XLSX", func() {
+			req := httptest.NewRequest(http.MethodGet, "/users/export?format=xlsx", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			err := userController.ExportUsers(c)
+
+			gomega.Expect(err).To(gomega.BeNil())
+			rows, err := spreadsheet.ReadAll(rec.Body, spreadsheet.XLSX)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(rows).To(gomega.HaveLen(2))
+			gomega.Expect(rows[1]).To(gomega.Equal([]string{"1", "testuser", "Test", "User", "testuser@example.com", "IT", "A"}))
+		})
+
+		ginkgo.It("should export names that look like formulas as they are to XLSX", func() {
+			mockUserRepo.users[0].FirstName = "-Test"
+			req := httptest.NewRequest(http.MethodGet, "/users/export?format=xlsx", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			gomega.Expect(userController.ExportUsers(c)).To(gomega.Succeed())
+			rows, err := spreadsheet.ReadAll(rec.Body, spreadsheet.XLSX)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(rows[1][2]).To(gomega.Equal("-Test"))
+		})
+
+		ginkgo.It("should answer a failed export with an error", func() {
+			mockUserRepo.err = errors.New("database is locked")
+			req := httptest.NewRequest(http.MethodGet, "/users/export?format=csv", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			err := userController.ExportUsers(c)
+
+			gomega.Expect(err).To(gomega.HaveOccurred())
+			e.HTTPErrorHandler(err, c)
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusInternalServerError))
+			gomega.Expect(rec.Body.String()).To(gomega.ContainSubstring("database is locked"))
+		})
+
+		ginkgo.It("should report a dry run without writing", func() {
+			file := "Login,First Name,Surname,E-mail,User Status,Notes\n" +
+				"testuser,Tess,User,tess@example.com,A,promoted\n" +
+				",,,,,\n" +
+				"newbie,New,Person,newbie@example.com,A,\n" +
+				"broken,No,Email,,A,\n"
+
+			rec, report := upload("/users/import?dry_run=true", "hr.csv", file, map[string]string{
+				"mapping": `{"Login": "user_name", "surname": "last_name", "E-mail": "email"}`,
+			})
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusMultiStatus))
+			gomega.Expect(report.DryRun).To(gomega.BeTrue())
+			gomega.Expect([]int{report.Created, report.Updated, report.Failed}).To(gomega.Equal([]int{1, 1, 1}))
+			gomega.Expect(report.Rows).To(gomega.HaveLen(3))
+
+			updated := report.Rows[0]
+			gomega.Expect(updated.Row).To(gomega.Equal(2))
+			gomega.Expect(updated.Action).To(gomega.Equal("update"))
+			gomega.Expect(updated.User.FirstName).To(gomega.Equal("Tess"))
+			gomega.Expect(updated.User.Department).To(gomega.Equal("IT"))
+
+			gomega.Expect(report.Rows[1].Row).To(gomega.Equal(4))
+			gomega.Expect(report.Rows[1].Status).To(gomega.Equal(http.StatusCreated))
+			gomega.Expect(report.Rows[2].Status).To(gomega.Equal(http.StatusUnprocessableEntity))
+			gomega.Expect(report.Rows[2].Error).To(gomega.ContainSubstring("email"))
+			gomega.Expect(mockUserRepo.updates).To(gomega.Equal(0))
+		})
+
+		ginkgo.It("should upsert by username and reject usernames given twice", func() {
+			file := "user_name,first_name,last_name,email,user_status\n" +
+				"testuser,Tess,User,tess@example.com,A\n" +
+				"twin,One,Twin,one@example.com,A\n" +
+				"twin,Two,Twin,two@example.com,A\n"
+
+			rec, report := upload("/users/import", "hr.CSV", file, nil)
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusMultiStatus))
+			gomega.Expect([]int{report.Created, report.Updated, report.Failed}).To(gomega.Equal([]int{0, 1, 2}))
+			gomega.Expect(report.Rows[0].User.Version).To(gomega.Equal(int64(4)))
+			gomega.Expect(mockUserRepo.version).To(gomega.Equal(int64(3)))
+			gomega.Expect(report.Rows[1].Status).To(gomega.Equal(http.StatusConflict))
+		})
+
+		ginkgo.It("should not rewrite users a row leaves unchanged", func() {
+			rec, report := upload("/users/import", "hr.csv", "user_name,first_name,department\ntestuser,Test,IT\n", nil)
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusOK))
+			gomega.Expect(report.Unchanged).To(gomega.Equal(1))
+			gomega.Expect(report.Rows[0].Action).To(gomega.Equal("unchanged"))
+			gomega.Expect(mockUserRepo.updates).To(gomega.Equal(0))
+		})
+
+		ginkgo.It("should reject files without a username column", func() {
+			rec, _ := upload("/users/import", "hr.csv", "first_name,email\nA,a@example.com\n", nil)
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusBadRequest))
+			gomega.Expect(rec.Body.String()).To(gomega.ContainSubstring("no column holds user_name"))
+
+			rec, _ = upload("/users/import", "hr.csv", "user_name\n", map[string]string{"mapping": `{"Login": "user_id"}`})
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusBadRequest))
+
+			rec, _ = upload("/users/import", "hr.ods", "user_name\n", nil)
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusBadRequest))
+		})
+	})
+
+	ginkgo.Context("HTTPErrorHandler", func() {
+		// handle answers err for a fresh request and returns the response
+		handle := func(method string, err error) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, "/users/1", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			controllers.HTTPErrorHandler(err, c)
+			return rec
+		}
+
+		ginkgo.DescribeTable("should answer each kind of error with its status",
+			func(err error, status int, message string) {
+				rec := handle(http.MethodGet, fmt.Errorf("wrapped: %w", err))
+
+				gomega.Expect(rec.Code).To(gomega.Equal(status))
+				gomega.Expect(rec.Body.String()).To(gomega.ContainSubstring(`"message":"` + message + `"`))
+			},
+			ginkgo.Entry("not found", repository.Errorf(repository.ErrNotFound, "no user"), http.StatusNotFound, "Not Found"),
+			ginkgo.Entry("conflict", repository.ErrUsernameTaken, http.StatusConflict, "Conflict"),
+			ginkgo.Entry("constraint", &repository.Error{Kind: repository.ErrConstraint, Err: errors.New("NOT NULL")}, http.StatusConflict, "Conflict"),
+			ginkgo.Entry("validation", repository.ErrInvalidCursor, http.StatusUnprocessableEntity, "Unprocessable Entity"),
+			ginkgo.Entry("echo's own errors", echo.ErrMethodNotAllowed, http.StatusMethodNotAllowed, "Method Not Allowed"),
+			ginkgo.Entry("anything else", errors.New("disk full"), http.StatusInternalServerError, "Internal Server Error"),
+		)
+
+		ginkgo.It("should show the handler's message with the error's own text", func() {
+			rec := handle(http.MethodGet, echo.NewHTTPError(http.StatusBadRequest, "user ID must be an integer"))
+			gomega.Expect(rec.Body.String()).To(gomega.ContainSubstring(`"error":"user ID must be an integer"`))
+
+			req := httptest.NewRequest(http.MethodGet, "/users/x", nil)
+			rec = httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("id")
+			c.SetParamValues("x")
+			controllers.HTTPErrorHandler(userController.GetUserByID(c), c)
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusBadRequest))
+			gomega.Expect(rec.Body.String()).To(gomega.Equal(`{"message":"Invalid user ID","error":"user ID must be an integer, got \"x\"","code":"invalid_id"}` + "\n"))
+		})
+
+		ginkgo.DescribeTable("should give every error a stable code",
+			func(err error, code string) {
+				rec := handle(http.MethodGet, err)
+
+				var body response.ErrorResponse
+				gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &body)).To(gomega.Succeed())
+				gomega.Expect(body.Code).To(gomega.Equal(code))
+			},
+			ginkgo.Entry("kind", repository.Errorf(repository.ErrNotFound, "no user"), "not_found"),
+			ginkgo.Entry("repository code", fmt.Errorf("wrapped: %w", repository.ErrVersionConflict), "version_conflict"),
+			ginkgo.Entry("status", echo.ErrMethodNotAllowed, "method_not_allowed"),
+			ginkgo.Entry("anything else", errors.New("disk full"), "internal_error"),
+		)
+
+		ginkgo.It("should answer with problem details when the client asks for them", func() {
+			req := httptest.NewRequest(http.MethodPatch, "/users/1?fields=email", nil)
+			req.Header.Set(echo.HeaderAccept, "application/problem+json, application/json;q=0.9")
+			rec := httptest.NewRecorder()
+			err := repository.FieldErrorf("email", model.FieldInvalid, "email %q is not a valid address", "nobody")
+			controllers.HTTPErrorHandler(err, e.NewContext(req, rec))
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusUnprocessableEntity))
+			gomega.Expect(rec.Header().Get(echo.HeaderContentType)).To(gomega.Equal(response.MIMEApplicationProblemJSON))
+			gomega.Expect(rec.Header().Get(echo.HeaderVary)).To(gomega.Equal(echo.HeaderAccept))
+			var problem response.Problem
+			gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &problem)).To(gomega.Succeed())
+			gomega.Expect(problem).To(gomega.Equal(response.Problem{
+				Type:     "urn:sample-service:problem:validation_failed",
+				Title:    "Unprocessable Entity",
+				Status:   http.StatusUnprocessableEntity,
+				Detail:   `email "nobody" is not a valid address`,
+				Instance: "/users/1?fields=email",
+				Code:     "validation_failed",
+				Errors: []model.FieldError{
+					{Field: "email", Code: model.FieldInvalid, Detail: `email "nobody" is not a valid address`},
+				},
+			}))
+		})
+
+		ginkgo.It("should leave HEAD responses without a body", func() {
+			rec := handle(http.MethodHead, repository.Errorf(repository.ErrNotFound, "no user"))
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusNotFound))
+			gomega.Expect(rec.Body.Len()).To(gomega.BeZero())
+		})
+	})
+
+	ginkgo.Context("Content negotiation", func() {
+		xmlBody := `<user><user_name>testuser</user_name><first_name>Test</first_name><last_name>User</last_name>` +
+			`<email>testuser@example.com</email><department>IT</department><user_status>A</user_status></user>`
+
+		ginkgo.It("should read a body in any format and answer in the accepted one", func() {
+			req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(xmlBody))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationXMLCharsetUTF8)
+			req.Header.Set(echo.HeaderAccept, response.MIMEApplicationYAML)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			err := userController.CreateUser(c)
+
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(rec.Header().Get(echo.HeaderContentType)).To(gomega.Equal(response.MIMEApplicationYAML))
+			var body struct {
+				Message string     `json:"message"`
+				Data    model.User `json:"data"`
+			}
+			gomega.Expect(response.YAML.Unmarshal(rec.Body.Bytes(), &body)).To(gomega.Succeed())
+			created := testUser
+			created.Version = 0
+			gomega.Expect(body.Message).To(gomega.Equal("User created successfully"))
+			gomega.Expect(body.Data).To(gomega.Equal(created))
+		})
+
+		ginkgo.It("should read a user_id from XML as a number", func() {
+			mockUserRepo.users = []model.User{testUser}
+
+			req := httptest.NewRequest(http.MethodPut, "/users/2", strings.NewReader(
+				strings.Replace(xmlBody, "<user>", "<user><user_id>3</user_id>", 1)))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationXML)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("id")
+			c.SetParamValues("2")
+
+			err := userController.UpdateUser(c)
+
+			gomega.Expect(err).To(gomega.MatchError(gomega.ContainSubstring("user_id 3 in the body does not match 2 in the path")))
+		})
+
+		ginkgo.It("should refuse a body in a format it does not read with 415", func() {
+			req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader("user_name=testuser"))
+			req.Header.Set(echo.HeaderContentType, echo.MIMETextPlain)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			err := userController.CreateUser(c)
+			e.HTTPErrorHandler(err, c)
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusUnsupportedMediaType))
+			gomega.Expect(rec.Body.String()).To(gomega.ContainSubstring(`"code":"unsupported_media_type"`))
+		})
+
+		ginkgo.It("should refuse a malformed body with 400", func() {
+			req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader("user_name: [unclosed"))
+			req.Header.Set(echo.HeaderContentType, response.MIMEApplicationYAML)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			err := userController.CreateUser(c)
+			e.HTTPErrorHandler(err, c)
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusBadRequest))
+		})
+
+		ginkgo.It("should refuse with 406 before handling a request it cannot answer", func() {
+			called := false
+			handler := controllers.Negotiate(func(c echo.Context) error {
+				called = true
+				return nil
+			})
+			req := httptest.NewRequest(http.MethodGet, "/users", nil)
+			req.Header.Set(echo.HeaderAccept, "text/csv")
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			err := handler(c)
+			e.HTTPErrorHandler(err, c)
+
+			gomega.Expect(called).To(gomega.BeFalse())
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusNotAcceptable))
+			gomega.Expect(rec.Header().Get(echo.HeaderContentType)).To(gomega.HavePrefix(echo.MIMEApplicationJSON))
+			gomega.Expect(rec.Body.String()).To(gomega.ContainSubstring(`"code":"not_acceptable"`))
+		})
+
+		ginkgo.It("should answer errors in the accepted format", func() {
+			req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+			req.Header.Set(echo.HeaderAccept, echo.MIMEApplicationXML)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			e.HTTPErrorHandler(repository.Errorf(repository.ErrNotFound, "no user"), c)
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusNotFound))
+			gomega.Expect(rec.Body.String()).To(gomega.ContainSubstring(`<code>not_found</code>`))
+			gomega.Expect(rec.Header().Values(echo.HeaderVary)).To(gomega.Equal([]string{echo.HeaderAccept}))
+		})
+	})
+
+	ginkgo.Context("Idempotency", func() {
+		var (
+			idempotencyRepo *MockIdempotencyRepository
+			calls           int
+			handler         echo.HandlerFunc
+		)
+
+		ginkgo.BeforeEach(func() {
+			idempotencyRepo = &MockIdempotencyRepository{records: map[string]repository.IdempotencyRecord{}}
+			calls = 0
+			handler = controllers.Idempotency(idempotencyRepo, time.Hour)(func(c echo.Context) error {
+				calls++
+				return userController.CreateUser(c)
+			})
+		})
+
+		// postAccepting sends a POST /users with the given key and body,
+		// asking for the response in the given format if one is given
+		postAccepting := func(accept, key, body string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			if accept != "" {
+				req.Header.Set(echo.HeaderAccept, accept)
+			}
+			if key != "" {
+				req.Header.Set("Idempotency-Key", key)
+			}
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			if err := handler(c); err != nil {
+				e.HTTPErrorHandler(err, c)
+			}
+			return rec
+		}
+		post := func(key, body string) *httptest.ResponseRecorder {
+			return postAccepting("", key, body)
+		}
+		body := `{"user_name":"newuser","first_name":"New","last_name":"User","email":"new@example.com","user_status":"A"}`
+
+		ginkgo.It("should replay the response to a retry without handling it again", func() {
+			first := post("key-1", body)
+			gomega.Expect(first.Code).To(gomega.Equal(http.StatusOK))
+
+			retry := post("key-1", body)
+			gomega.Expect(retry.Code).To(gomega.Equal(http.StatusOK))
+			gomega.Expect(retry.Body.String()).To(gomega.Equal(first.Body.String()))
+			gomega.Expect(retry.Header().Get("ETag")).To(gomega.Equal(first.Header().Get("ETag")))
+			gomega.Expect(retry.Header().Get("Idempotent-Replayed")).To(gomega.Equal("true"))
+			gomega.Expect(calls).To(gomega.Equal(1))
+		})
+
+		ginkgo.It("should handle every request without a key", func() {
+			post("", body)
+			post("", body)
+			gomega.Expect(calls).To(gomega.Equal(2))
+		})
+
+		ginkgo.It("should refuse a key reused for a different request", func() {
+			post("key-1", body)
+
+			rec := post("key-1", strings.Replace(body, "newuser", "newuser2", 1))
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusUnprocessableEntity))
+			gomega.Expect(rec.Body.String()).To(gomega.ContainSubstring(`"code":"idempotency_key_reused"`))
+			gomega.Expect(calls).To(gomega.Equal(1))
+		})
+
+		ginkgo.It("should keep the keys of different actors apart", func() {
+			// postAs sends the same key and body as the given actor
+			postAs := func(actor string) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(body))
+				req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+				req.Header.Set("Idempotency-Key", "key-1")
+				req.Header.Set("X-Actor", actor)
+				rec := httptest.NewRecorder()
+				c := e.NewContext(req, rec)
+				if err := handler(c); err != nil {
+					e.HTTPErrorHandler(err, c)
+				}
+				return rec
+			}
+
+			gomega.Expect(postAs("alice").Code).To(gomega.Equal(http.StatusOK))
+			rec := postAs("bob")
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusOK))
+			gomega.Expect(rec.Header().Get("Idempotent-Replayed")).To(gomega.BeEmpty())
+			gomega.Expect(calls).To(gomega.Equal(2))
+
+			gomega.Expect(postAs("alice").Header().Get("Idempotent-Replayed")).To(gomega.Equal("true"))
+			gomega.Expect(calls).To(gomega.Equal(2))
+		})
+
+		ginkgo.It("should not replay a response in another format than the retry asks for", func() {
+			post("key-1", body)
+
+			rec := postAccepting(echo.MIMEApplicationXML, "key-1", body)
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusUnprocessableEntity))
+			gomega.Expect(rec.Header().Get("Idempotent-Replayed")).To(gomega.BeEmpty())
+			gomega.Expect(calls).To(gomega.Equal(1))
+		})
+
+		ginkgo.It("should give up the key when the handler panics", func() {
+			handler = controllers.Idempotency(idempotencyRepo, time.Hour)(func(c echo.Context) error {
+				calls++
+				if calls == 1 {
+					panic("boom")
+				}
+				return userController.CreateUser(c)
+			})
+
+			gomega.Expect(func() { post("key-1", body) }).To(gomega.PanicWith("boom"))
+			gomega.Expect(idempotencyRepo.records).NotTo(gomega.HaveKey("key-1"))
+			gomega.Expect(post("key-1", body).Code).To(gomega.Equal(http.StatusOK))
+			gomega.Expect(calls).To(gomega.Equal(2))
+		})
+
+		ginkgo.It("should replay client errors too", func() {
+			invalid := `{"user_name":""}`
+			post("key-1", invalid)
+
+			rec := post("key-1", invalid)
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusUnprocessableEntity))
+			gomega.Expect(rec.Header().Get("Idempotent-Replayed")).To(gomega.Equal("true"))
+			gomega.Expect(calls).To(gomega.Equal(1))
+		})
+
+		ginkgo.It("should let a request be retried after a server error", func() {
+			mockUserRepo.err = errors.New("database error")
+			gomega.Expect(post("key-1", body).Code).To(gomega.Equal(http.StatusInternalServerError))
+
+			mockUserRepo.err = nil
+			gomega.Expect(post("key-1", body).Code).To(gomega.Equal(http.StatusOK))
+			gomega.Expect(calls).To(gomega.Equal(2))
+		})
+
+		ginkgo.It("should answer 409 while the first request is still being handled", func() {
+			var retry *httptest.ResponseRecorder
+			handler = controllers.Idempotency(idempotencyRepo, time.Hour)(func(c echo.Context) error {
+				// The retry arrives before this request has been answered
+				retry = post("key-1", body)
+				return c.NoContent(http.StatusNoContent)
+			})
+
+			gomega.Expect(post("key-1", body).Code).To(gomega.Equal(http.StatusNoContent))
+			gomega.Expect(retry.Code).To(gomega.Equal(http.StatusConflict))
+			gomega.Expect(retry.Body.String()).To(gomega.ContainSubstring(`"code":"idempotency_key_in_use"`))
+		})
+
+		ginkgo.It("should refuse an overlong key", func() {
+			rec := post(strings.Repeat("k", 256), body)
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusBadRequest))
+			gomega.Expect(calls).To(gomega.BeZero())
+		})
+	})
+
+	ginkgo.Context("Versioning", func() {
+		var userControllerV2 *controllers.UserControllerV2
+
+		ginkgo.BeforeEach(func() {
+			userControllerV2 = controllers.NewUserControllerV2(mockUserRepo)
+			created := time.Date(2026, time.January, 2, 3, 4, 5, 0, time.UTC)
+			testUser.CreatedAt, testUser.UpdatedAt = &created, &created
+			mockUserRepo.users = []model.User{testUser}
+		})
+
+		ginkgo.It("should name statuses and show timestamps in version 2", func() {
+			req := httptest.NewRequest(http.MethodGet, "/v2/users/1", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("id")
+			c.SetParamValues("1")
+
+			gomega.Expect(userControllerV2.GetUserByID(c)).To(gomega.Succeed())
+			gomega.Expect(rec.Body.String()).To(gomega.ContainSubstring(`"user_status":"active"`))
+			gomega.Expect(rec.Body.String()).To(gomega.ContainSubstring(`"created_at":"2026-01-02T03:04:05Z","updated_at":"2026-01-02T03:04:05Z"`))
+		})
+
+		ginkgo.It("should keep version 1 as it was", func() {
+			req := httptest.NewRequest(http.MethodGet, "/v1/users/1", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("id")
+			c.SetParamValues("1")
+
+			gomega.Expect(userController.GetUserByID(c)).To(gomega.Succeed())
+			gomega.Expect(rec.Body.String()).To(gomega.ContainSubstring(`"user_status":"A"`))
+			gomega.Expect(rec.Body.String()).NotTo(gomega.ContainSubstring("created_at"))
+
+			req = httptest.NewRequest(http.MethodGet, "/v1/users/1?fields=created_at", nil)
+			c = e.NewContext(req, httptest.NewRecorder())
+			c.SetParamNames("id")
+			c.SetParamValues("1")
+			gomega.Expect(userController.GetUserByID(c)).To(gomega.MatchError(gomega.ContainSubstring(`unknown field "created_at"`)))
+		})
+
+		ginkgo.It("should store the status a version 2 body names", func() {
+			body := `{"user_name":"newuser","first_name":"New","last_name":"User","email":"new@example.com","user_status":"inactive"}`
+			req := httptest.NewRequest(http.MethodPost, "/v2/users", strings.NewReader(body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			gomega.Expect(userControllerV2.CreateUser(c)).To(gomega.Succeed())
+			var response struct {
+				Data model.UserV2 `json:"data"`
+			}
+			gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &response)).To(gomega.Succeed())
+			gomega.Expect(response.Data.UserStatus).To(gomega.Equal("inactive"))
+			gomega.Expect(response.Data.User().UserStatus).To(gomega.Equal("I"))
+		})
+
+		ginkgo.It("should refuse a status code in a version 2 body", func() {
+			body := `{"user_name":"newuser","first_name":"New","last_name":"User","email":"new@example.com","user_status":"A"}`
+			req := httptest.NewRequest(http.MethodPost, "/v2/users", strings.NewReader(body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			if err := userControllerV2.CreateUser(c); err != nil {
+				e.HTTPErrorHandler(err, c)
+			}
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusUnprocessableEntity))
+			gomega.Expect(rec.Body.String()).To(gomega.ContainSubstring(`"field":"user_status"`))
+		})
+
+		ginkgo.It("should filter version 2 statuses by name", func() {
+			req := httptest.NewRequest(http.MethodGet, "/v2/users?filter="+url.QueryEscape(`user_status in ("active", "terminated")`), nil)
+			c := e.NewContext(req, httptest.NewRecorder())
+
+			gomega.Expect(userControllerV2.GetAllUsers(c)).To(gomega.Succeed())
+			cmp, ok := mockUserRepo.listOptions.Filter.(*filter.Comparison)
+			gomega.Expect(ok).To(gomega.BeTrue())
+			gomega.Expect(cmp.Values).To(gomega.HaveLen(2))
+			gomega.Expect(cmp.Values[0].Text).To(gomega.Equal("A"))
+			gomega.Expect(cmp.Values[1].Text).To(gomega.Equal("T"))
+
+			for _, raw := range []string{`user_status eq "A"`, `user_status gt "active"`} {
+				req = httptest.NewRequest(http.MethodGet, "/v2/users?filter="+url.QueryEscape(raw), nil)
+				c = e.NewContext(req, httptest.NewRecorder())
+				gomega.Expect(userControllerV2.GetAllUsers(c)).To(gomega.MatchError(gomega.ContainSubstring("user_status")), raw)
+			}
+		})
+
+		ginkgo.It("should not let a version 2 patch change the timestamps", func() {
+			req := httptest.NewRequest(http.MethodPatch, "/v2/users/1", strings.NewReader(`{"created_at":"2020-01-01T00:00:00Z"}`))
+			req.Header.Set(echo.HeaderContentType, "application/merge-patch+json")
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("id")
+			c.SetParamValues("1")
+
+			if err := userControllerV2.PatchUser(c); err != nil {
+				e.HTTPErrorHandler(err, c)
+			}
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusUnprocessableEntity))
+			gomega.Expect(rec.Body.String()).To(gomega.ContainSubstring("created_at cannot be changed"))
+			gomega.Expect(mockUserRepo.updates).To(gomega.BeZero())
+		})
+
+		ginkgo.It("should mark deprecated routes and link to their successor", func() {
+			handler := controllers.Deprecated(controllers.Deprecation{
+				Since:     time.Date(2026, time.October, 17, 0, 0, 0, 0, time.UTC),
+				Sunset:    time.Date(2027, time.April, 17, 0, 0, 0, 0, time.UTC),
+				Successor: "/v1",
+			})(userController.GetAllUsers)
+			mockUserRepo.nextCursor = "next"
+
+			req := httptest.NewRequest(http.MethodGet, "/users?limit=1", nil)
+			rec := httptest.NewRecorder()
+			gomega.Expect(handler(e.NewContext(req, rec))).To(gomega.Succeed())
+
+			gomega.Expect(rec.Header().Get("Deprecation")).To(gomega.Equal("@1792195200"))
+			gomega.Expect(rec.Header().Get("Sunset")).To(gomega.Equal("Sat, 17 Apr 2027 00:00:00 GMT"))
+			gomega.Expect(rec.Header().Values("Link")).To(gomega.HaveLen(2))
+			gomega.Expect(rec.Header().Values("Link")[0]).To(gomega.Equal(`</v1/users>; rel="successor-version"`))
+			gomega.Expect(rec.Header().Values("Link")[1]).To(gomega.ContainSubstring(`rel="next"`))
+		})
+	})
+
+	ginkgo.Context("HAL", func() {
+		// get sends a GET for the given target of version 1, accepting HAL
+		get := func(handler echo.HandlerFunc, path, target string) (*httptest.ResponseRecorder, map[string]interface{}) {
+			req := httptest.NewRequest(http.MethodGet, target, nil)
+			req.Header.Set(echo.HeaderAccept, response.MIMEApplicationHALJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetPath(path)
+			if strings.Contains(path, ":id") {
+				c.SetParamNames("id")
+				c.SetParamValues("1")
+			}
+
+			gomega.Expect(handler(c)).To(gomega.Succeed())
+			gomega.Expect(rec.Header().Get(echo.HeaderContentType)).To(gomega.Equal(response.MIMEApplicationHALJSON))
+			var body map[string]interface{}
+			gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &body)).To(gomega.Succeed())
+			return rec, body
+		}
+
+		// relations lists the relations of a _links object
+		relations := func(object interface{}) []string {
+			var rels []string
+			for rel := range object.(map[string]interface{})["_links"].(map[string]interface{}) {
+				rels = append(rels, rel)
+			}
+			return rels
+		}
+
+		ginkgo.It("should link a user to the actions its state allows", func() {
+			mockUserRepo.users = []model.User{testUser}
+
+			_, body := get(userController.GetUserByID, "/v1/users/:id", "/v1/users/1")
+
+			data := body["data"].(map[string]interface{})
+			gomega.Expect(relations(data)).To(gomega.ConsistOf("self", "collection", "update", "edit", "delete", "transitions", "reports", "chain", "deactivate", "terminate"))
+			gomega.Expect(data["_links"]).To(gomega.HaveKeyWithValue("self", map[string]interface{}{"href": "/v1/users/1"}))
+			gomega.Expect(data["_links"]).To(gomega.HaveKeyWithValue("deactivate", map[string]interface{}{"href": "/v1/users/1/deactivate", "method": "POST"}))
+		})
+
+		ginkgo.It("should only offer to rehire a terminated user", func() {
+			testUser.UserStatus = "T"
+			mockUserRepo.users = []model.User{testUser}
+
+			_, body := get(userController.GetUserByID, "/v1/users/:id", "/v1/users/1")
+
+			data := body["data"].(map[string]interface{})
+			gomega.Expect(relations(data)).To(gomega.ConsistOf("self", "collection", "update", "edit", "delete", "transitions", "reports", "chain", "rehire"))
+			gomega.Expect(data["_links"]).To(gomega.HaveKeyWithValue("rehire", map[string]interface{}{"href": "/v1/users/1/rehire", "method": "POST"}))
+		})
+
+		ginkgo.It("should link a user to their manager", func() {
+			testUser.ManagerID = 2
+			mockUserRepo.users = []model.User{testUser}
+
+			_, body := get(userController.GetUserByID, "/v1/users/:id", "/v1/users/1")
+
+			gomega.Expect(body["data"].(map[string]interface{})["_links"]).To(gomega.HaveKeyWithValue("manager", map[string]interface{}{"href": "/v1/users/2"}))
+		})
+
+		ginkgo.It("should only offer to restore a deleted user", func() {
+			deletedAt := time.Now()
+			testUser.DeletedAt = &deletedAt
+			mockUserRepo.users = []model.User{testUser}
+
+			_, body := get(userController.GetAllUsers, "/v1/users", "/v1/users?include_deleted=true")
+
+			data := body["data"].([]interface{})
+			gomega.Expect(relations(data[0])).To(gomega.ConsistOf("self", "collection", "restore"))
+			gomega.Expect(data[0].(map[string]interface{})["_links"]).To(gomega.HaveKeyWithValue("restore",
+				map[string]interface{}{"href": "/v1/users/1/restore", "method": "POST"}))
+		})
+
+		ginkgo.It("should link a page to its neighbours", func() {
+			mockUserRepo.users = []model.User{testUser}
+			mockUserRepo.nextCursor = "next"
+
+			_, body := get(userController.GetAllUsers, "/v1/users", "/v1/users?limit=1")
+
+			gomega.Expect(relations(body)).To(gomega.ConsistOf("self", "first", "next"))
+			gomega.Expect(body["_links"]).To(gomega.HaveKeyWithValue("next",
+				map[string]interface{}{"href": "http://example.com/v1/users?cursor=next&limit=1"}))
+		})
+
+		ginkgo.It("should load what the links need under a sparse fieldset", func() {
+			mockUserRepo.users = []model.User{testUser}
+
+			_, body := get(userController.GetUserByID, "/v1/users/:id", "/v1/users/1?fields=user_name")
+
+			gomega.Expect(mockUserRepo.fields).To(gomega.ContainElements("user_id", "user_status", "deleted_at"))
+			gomega.Expect(body["data"]).To(gomega.HaveKey("_links"))
+		})
+
+		ginkgo.It("should leave links out of plain JSON", func() {
+			mockUserRepo.users = []model.User{testUser}
+
+			req := httptest.NewRequest(http.MethodGet, "/v1/users/1", nil)
+			req.Header.Set(echo.HeaderAccept, "*/*")
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("id")
+			c.SetParamValues("1")
+
+			gomega.Expect(userController.GetUserByID(c)).To(gomega.Succeed())
+			gomega.Expect(rec.Header().Get(echo.HeaderContentType)).To(gomega.Equal(echo.MIMEApplicationJSON))
+			gomega.Expect(rec.Body.String()).NotTo(gomega.ContainSubstring("_links"))
+		})
+	})
+
+	ginkgo.Context("JSON:API", func() {
+		// send makes a request of version 1 as a JSON:API client, with a
+		// JSON:API body if one is given
+		send := func(handler echo.HandlerFunc, method, path, target, body string) (*httptest.ResponseRecorder, map[string]interface{}) {
+			req := httptest.NewRequest(method, target, strings.NewReader(body))
+			req.Header.Set(echo.HeaderAccept, response.MIMEApplicationJSONAPI)
+			if body != "" {
+				req.Header.Set(echo.HeaderContentType, response.MIMEApplicationJSONAPI)
+			}
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetPath(path)
+			if strings.Contains(path, ":id") {
+				c.SetParamNames("id")
+				c.SetParamValues("1")
+			}
+
+			if err := handler(c); err != nil {
+				e.HTTPErrorHandler(err, c)
+			}
+			gomega.Expect(rec.Header().Get(echo.HeaderContentType)).To(gomega.Equal(response.MIMEApplicationJSONAPI))
+			var document map[string]interface{}
+			gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &document)).To(gomega.Succeed())
+			return rec, document
+		}
+
+		ginkgo.BeforeEach(func() {
+			mockUserRepo.users = []model.User{testUser}
+		})
+
+		ginkgo.It("should answer with a resource object", func() {
+			_, document := send(userController.GetUserByID, http.MethodGet, "/v1/users/:id", "/v1/users/1", "")
+
+			gomega.Expect(document["jsonapi"]).To(gomega.Equal(map[string]interface{}{"version": "1.1"}))
+			gomega.Expect(document["meta"]).To(gomega.Equal(map[string]interface{}{"message": "User retrieved successfully"}))
+			data := document["data"].(map[string]interface{})
+			gomega.Expect(data["type"]).To(gomega.Equal("users"))
+			gomega.Expect(data["id"]).To(gomega.Equal("1"))
+			gomega.Expect(data["links"]).To(gomega.Equal(map[string]interface{}{"self": map[string]interface{}{"href": "/v1/users/1"}}))
+			gomega.Expect(data["attributes"]).To(gomega.HaveKeyWithValue("user_name", "testuser"))
+			gomega.Expect(data["attributes"]).NotTo(gomega.HaveKey("user_id"))
+		})
+
+		ginkgo.It("should include related resources once and apply sparse fieldsets", func() {
+			second := testUser
+			second.ID, second.UserName = 2, "second"
+			mockUserRepo.users = []model.User{testUser, second}
+			userController.RegisterInclude("team", controllers.Include{
+				Fields:  []string{"department"},
+				Type:    "teams",
+				IDField: "name",
+				Load: func(users []model.User) (map[int64]interface{}, error) {
+					teams := map[int64]interface{}{}
+					for _, user := range users {
+						teams[user.ID] = map[string]string{"name": user.Department, "floor": "3"}
+					}
+					return teams, nil
+				},
+			})
+
+			_, document := send(userController.GetAllUsers, http.MethodGet, "/v1/users",
+				"/v1/users?include=team&fields[users]=user_name&fields[teams]=", "")
+
+			data := document["data"].([]interface{})
+			gomega.Expect(data).To(gomega.HaveLen(2))
+			gomega.Expect(data[0].(map[string]interface{})["attributes"]).To(gomega.Equal(map[string]interface{}{"user_name": "testuser"}))
+			gomega.Expect(data[1].(map[string]interface{})["relationships"]).To(gomega.Equal(map[string]interface{}{
+				"team": map[string]interface{}{"data": map[string]interface{}{"type": "teams", "id": "IT"}},
+			}))
+			gomega.Expect(document["included"]).To(gomega.Equal([]interface{}{
+				map[string]interface{}{"type": "teams", "id": "IT"},
+			}))
+			gomega.Expect(document["meta"]).To(gomega.HaveKey("pagination"))
+			gomega.Expect(document["links"]).To(gomega.HaveKey("first"))
+		})
+
+		ginkgo.It("should create a user from a resource object", func() {
+			body := `{"data":{"type":"users","attributes":{"user_name":"newuser","first_name":"New","last_name":"User",` +
+				`"email":"new@example.com","user_status":"A"}}}`
+
+			rec, document := send(userController.CreateUser, http.MethodPost, "/v1/users", "/v1/users", body)
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusCreated))
+			gomega.Expect(rec.Header().Get(echo.HeaderLocation)).To(gomega.Equal("/v1/users/1"))
+			gomega.Expect(document["data"]).To(gomega.HaveKeyWithValue("id", "1"))
+			gomega.Expect(document["data"]).To(gomega.HaveKeyWithValue("attributes", gomega.HaveKeyWithValue("user_name", "newuser")))
+		})
+
+		ginkgo.It("should refuse a resource of another type or id with 409", func() {
+			rec, document := send(userController.CreateUser, http.MethodPost, "/v1/users", "/v1/users", `{"data":{"type":"teams","attributes":{}}}`)
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusConflict))
+			gomega.Expect(document["errors"]).To(gomega.ConsistOf(gomega.HaveKeyWithValue("code", "type_mismatch")))
+
+			rec, _ = send(userController.PatchUser, http.MethodPatch, "/v1/users/:id", "/v1/users/1", `{"data":{"type":"users","id":"2","attributes":{}}}`)
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusConflict))
+		})
+
+		ginkgo.It("should patch the attributes a resource object names", func() {
+			rec, document := send(userController.PatchUser, http.MethodPatch, "/v1/users/:id", "/v1/users/1",
+				`{"data":{"type":"users","id":"1","attributes":{"department":"Sales"}}}`)
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusOK))
+			attributes := document["data"].(map[string]interface{})["attributes"]
+			gomega.Expect(attributes).To(gomega.HaveKeyWithValue("department", "Sales"))
+			gomega.Expect(attributes).To(gomega.HaveKeyWithValue("user_name", "testuser"))
+		})
+
+		ginkgo.It("should answer with error objects pointing at the attributes at fault", func() {
+			rec, document := send(userController.PatchUser, http.MethodPatch, "/v1/users/:id", "/v1/users/1",
+				`{"data":{"type":"users","id":"1","attributes":{"email":"nobody"}}}`)
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusUnprocessableEntity))
+			gomega.Expect(document).NotTo(gomega.HaveKey("data"))
+			gomega.Expect(document["errors"]).To(gomega.ConsistOf(gomega.And(
+				gomega.HaveKeyWithValue("status", "422"),
+				gomega.HaveKeyWithValue("code", "validation_failed"),
+				gomega.HaveKeyWithValue("source", map[string]interface{}{"pointer": "/data/attributes/email"}),
+			)))
+		})
+	})
+
+	ginkgo.Context("Departments", func() {
+		var (
+			mockDepartmentRepo   *MockDepartmentRepository
+			departmentController *controllers.DepartmentController
+		)
+
+		ginkgo.BeforeEach(func() {
+			mockDepartmentRepo = &MockDepartmentRepository{departments: []model.Department{{ID: 1, Name: "IT"}, {ID: 2, Name: "Sales"}}}
+			departmentController = controllers.NewDepartmentController(mockDepartmentRepo, userController)
+			testUser.DepartmentID = 1
+			mockUserRepo.users = []model.User{testUser}
+		})
+
+		// serve runs a department handler for a request to /v1/departments
+		serve := func(handler echo.HandlerFunc, method, path, target, body string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, target, strings.NewReader(body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetPath(path)
+			if strings.Contains(path, ":id") {
+				c.SetParamNames("id")
+				c.SetParamValues(strings.Split(strings.TrimPrefix(req.URL.Path, "/v1/departments/"), "/")[0])
+			}
+			if err := handler(c); err != nil {
+				e.HTTPErrorHandler(err, c)
+			}
+			return rec
+		}
+
+		ginkgo.It("should list the users of a department, within the client's filter", func() {
+			rec := serve(departmentController.GetDepartmentUsers, http.MethodGet, "/v1/departments/:id/users",
+				"/v1/departments/1/users?filter="+url.QueryEscape(`user_status eq "A"`), "")
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusOK))
+			where, ok := mockUserRepo.listOptions.Filter.(*filter.Logical)
+			gomega.Expect(ok).To(gomega.BeTrue())
+			gomega.Expect(where.Op).To(gomega.Equal(filter.And))
+			gomega.Expect(where.Left).To(gomega.Equal(&filter.Comparison{
+				Field:  "department_id",
+				Op:     filter.Eq,
+				Values: []filter.Value{{Kind: filter.NumberValue, Text: "1"}},
+			}))
+			gomega.Expect(where.Right.(*filter.Comparison).Field).To(gomega.Equal("user_status"))
+		})
+
+		ginkgo.It("should answer 404 for the users of a department that does not exist", func() {
+			rec := serve(departmentController.GetDepartmentUsers, http.MethodGet, "/v1/departments/:id/users", "/v1/departments/9/users", "")
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusNotFound))
+		})
+
+		ginkgo.It("should validate the departments it creates", func() {
+			rec := serve(departmentController.CreateDepartment, http.MethodPost, "/v1/departments", "/v1/departments", `{"name":""}`)
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusUnprocessableEntity))
+			gomega.Expect(rec.Body.String()).To(gomega.ContainSubstring(`"field":"name"`))
+
+			rec = serve(departmentController.CreateDepartment, http.MethodPost, "/v1/departments", "/v1/departments", `{"name":"Finance"}`)
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusOK))
+			gomega.Expect(mockDepartmentRepo.departments).To(gomega.ContainElement(model.Department{ID: 3, Name: "Finance"}))
+		})
+
+		ginkgo.It("should refuse to delete a department that still has users unless they are reassigned", func() {
+			mockDepartmentRepo.err = &repository.Error{Kind: repository.ErrConflict, Code: repository.CodeDepartmentInUse, Err: errors.New("department 1 still has 1 users")}
+			rec := serve(departmentController.DeleteDepartment, http.MethodDelete, "/v1/departments/:id", "/v1/departments/1", "")
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusConflict))
+			gomega.Expect(rec.Body.String()).To(gomega.ContainSubstring(`"code":"department_in_use"`))
+
+			mockDepartmentRepo.err = nil
+			rec = serve(departmentController.DeleteDepartment, http.MethodDelete, "/v1/departments/:id", "/v1/departments/1?reassign_to=2", "")
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusOK))
+			gomega.Expect(mockDepartmentRepo.reassignTo).To(gomega.Equal(2))
+		})
+
+		ginkgo.It("should include the department of each user", func() {
+			userController.RegisterInclude("department", controllers.DepartmentInclude(mockDepartmentRepo))
+			req := httptest.NewRequest(http.MethodGet, "/v1/users?include=department", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetPath("/v1/users")
+
+			gomega.Expect(userController.GetAllUsers(c)).To(gomega.Succeed())
+
+			var body struct {
+				Data []map[string]interface{} `json:"data"`
+			}
+			gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &body)).To(gomega.Succeed())
+			gomega.Expect(body.Data[0]["_embedded"]).To(gomega.Equal(map[string]interface{}{
+				"department": map[string]interface{}{"department_id": float64(1), "name": "IT"},
+			}))
+		})
+	})
+
+	ginkgo.Context("Status transitions", func() {
+		ginkgo.BeforeEach(func() {
+			mockUserRepo.users = []model.User{testUser}
+		})
+
+		// post runs a transition handler for user 1 with a body
+		post := func(handler echo.HandlerFunc, transition, body string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodPost, "/v1/users/1/"+transition, strings.NewReader(body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			req.Header.Set("X-Actor", "hr.admin")
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetPath("/v1/users/:id/" + transition)
+			c.SetParamNames("id")
+			c.SetParamValues("1")
+			if err := handler(c); err != nil {
+				e.HTTPErrorHandler(err, c)
+			}
+			return rec
+		}
+
+		ginkgo.It("should terminate a user and record why and by whom", func() {
+			rec := post(userController.TerminateUser, "terminate", `{"reason":"  Left the company "}`)
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusOK))
+			gomega.Expect(rec.Header().Get("ETag")).To(gomega.Equal(fmt.Sprintf(`"v1-json-%d"`, testUser.Version+1)))
+			gomega.Expect(rec.Body.String()).To(gomega.ContainSubstring(`"user_status":"T"`))
+			gomega.Expect(mockUserRepo.transitions).To(gomega.Equal([]model.StatusTransition{{
+				UserID: 1, Transition: "terminate", FromStatus: "A", ToStatus: "T", Reason: "Left the company", Actor: "hr.admin",
+			}}))
+		})
+
+		ginkgo.It("should require a reason", func() {
+			rec := post(userController.DeactivateUser, "deactivate", `{"reason":" "}`)
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusUnprocessableEntity))
+			gomega.Expect(rec.Body.String()).To(gomega.ContainSubstring(`"field":"reason"`))
+			gomega.Expect(mockUserRepo.transitions).To(gomega.BeEmpty())
+		})
+
+		ginkgo.It("should refuse a transition that does not apply to the user's status", func() {
+			rec := post(userController.RehireUser, "rehire", `{"reason":"Returning"}`)
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusConflict))
+			gomega.Expect(rec.Body.String()).To(gomega.ContainSubstring(`"code":"invalid_transition"`))
+		})
+
+		ginkgo.It("should show the status history with the statuses the version names", func() {
+			userControllerV2 := controllers.NewUserControllerV2(mockUserRepo)
+			gomega.Expect(post(userControllerV2.TerminateUser, "terminate", `{"reason":"Left"}`).Code).To(gomega.Equal(http.StatusOK))
+
+			req := httptest.NewRequest(http.MethodGet, "/v2/users/1/transitions", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetPath("/v2/users/:id/transitions")
+			c.SetParamNames("id")
+			c.SetParamValues("1")
+			gomega.Expect(userControllerV2.GetUserTransitions(c)).To(gomega.Succeed())
+
+			var body struct {
+				Data []model.StatusTransition `json:"data"`
+			}
+			gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &body)).To(gomega.Succeed())
+			gomega.Expect(body.Data).To(gomega.HaveLen(1))
+			gomega.Expect(body.Data[0].FromStatus).To(gomega.Equal("active"))
+			gomega.Expect(body.Data[0].ToStatus).To(gomega.Equal("terminated"))
+		})
+
+		ginkgo.It("should record who changes the status by writing it", func() {
+			req := httptest.NewRequest(http.MethodPatch, "/v1/users/1", strings.NewReader(`{"user_status":"I"}`))
+			req.Header.Set(echo.HeaderContentType, "application/merge-patch+json")
+			req.Header.Set("X-Actor", "hr.admin")
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("id")
+			c.SetParamValues("1")
+
+			gomega.Expect(userController.PatchUser(c)).To(gomega.Succeed())
+			gomega.Expect(rec.Body.String()).To(gomega.ContainSubstring(`"user_status":"I"`))
+			gomega.Expect(mockUserRepo.lastUpdate.UpdatedBy).To(gomega.Equal("hr.admin"))
+		})
+	})
+
+	ginkgo.Context("Scheduled changes", func() {
+		var (
+			mockChangeRepo   *MockScheduledChangeRepository
+			changeController *controllers.ScheduledChangeController
+		)
+
+		ginkgo.BeforeEach(func() {
+			mockChangeRepo = &MockScheduledChangeRepository{}
+			changeController = controllers.NewScheduledChangeController(mockChangeRepo)
+		})
+
+		// schedule posts a change to user 1
+		schedule := func(body string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodPost, "/v1/users/1/scheduled-changes", strings.NewReader(body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			req.Header.Set("X-Actor", "hr.admin")
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("id")
+			c.SetParamValues("1")
+			if err := changeController.ScheduleChange(c); err != nil {
+				e.HTTPErrorHandler(err, c)
+			}
+			return rec
+		}
+
+		ginkgo.It("should schedule a change as made by the caller", func() {
+			effectiveAt := time.Now().Add(24 * time.Hour).UTC().Format(time.RFC3339)
+			rec := schedule(`{"effective_at":"` + effectiveAt + `","transition":"terminate","department":" Sales ","reason":"Leaving","status":"applied"}`)
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusOK))
+			gomega.Expect(mockChangeRepo.changes).To(gomega.HaveLen(1))
+			change := mockChangeRepo.changes[0]
+			gomega.Expect(change.UserID).To(gomega.Equal(int64(1)))
+			gomega.Expect(change.Transition).To(gomega.Equal("terminate"))
+			gomega.Expect(change.Department).To(gomega.Equal("Sales"))
+			gomega.Expect(change.CreatedBy).To(gomega.Equal("hr.admin"))
+			gomega.Expect(change.Status).To(gomega.Equal(model.ChangePending))
+		})
+
+		ginkgo.It("should refuse a change that takes effect in the past or changes nothing", func() {
+			effectiveAt := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+			rec := schedule(`{"effective_at":"` + effectiveAt + `","reason":"Too late"}`)
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusUnprocessableEntity))
+			gomega.Expect(rec.Body.String()).To(gomega.ContainSubstring(`"field":"effective_at"`))
+			gomega.Expect(rec.Body.String()).To(gomega.ContainSubstring(`"field":"transition"`))
+			gomega.Expect(mockChangeRepo.changes).To(gomega.BeEmpty())
+		})
+
+		ginkgo.It("should refuse to cancel a change that is no longer pending", func() {
+			mockChangeRepo.changes = []model.ScheduledChange{{ID: 1, UserID: 1, Transition: "deactivate", Reason: "Leave", Status: model.ChangeApplied}}
+			req := httptest.NewRequest(http.MethodDelete, "/v1/users/1/scheduled-changes/1", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("id", "change_id")
+			c.SetParamValues("1", "1")
+			if err := changeController.CancelScheduledChange(c); err != nil {
+				e.HTTPErrorHandler(err, c)
+			}
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusConflict))
+			gomega.Expect(rec.Body.String()).To(gomega.ContainSubstring(`"code":"change_not_pending"`))
+		})
+	})
+	ginkgo.Context("Manager hierarchy", func() {
+		// get runs a handler for user 1 under a path of version 1
+		get := func(handler echo.HandlerFunc, path, target string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodGet, target, nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetPath(path)
+			c.SetParamNames("id")
+			c.SetParamValues("1")
+			if err := handler(c); err != nil {
+				e.HTTPErrorHandler(err, c)
+			}
+			return rec
+		}
+
+		ginkgo.BeforeEach(func() {
+			testUser.ManagerID = 2
+			mockUserRepo.users = []model.User{
+				testUser,
+				{ID: 2, UserName: "manager", UserStatus: "A", ManagerID: 3},
+				{ID: 3, UserName: "director", UserStatus: "A"},
+			}
+		})
+
+		ginkgo.It("should list the managers of a user up to the top", func() {
+			rec := get(controllers.NewUserControllerV2(mockUserRepo).GetUserChain, "/v2/users/:id/chain", "/v2/users/1/chain")
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusOK))
+			var body struct {
+				Data []model.UserV2 `json:"data"`
+			}
+			gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &body)).To(gomega.Succeed())
+			gomega.Expect(body.Data).To(gomega.HaveLen(2))
+			gomega.Expect(body.Data[0].UserName).To(gomega.Equal("manager"))
+			gomega.Expect(body.Data[1].UserName).To(gomega.Equal("director"))
+			gomega.Expect(body.Data[1].UserStatus).To(gomega.Equal("active"))
+		})
+
+		ginkgo.It("should list the reports of a user at any depth when asked to", func() {
+			rec := get(userController.GetUserReports, "/v1/users/:id/reports", "/v1/users/1/reports?recursive=true&limit=10")
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusOK))
+			gomega.Expect(mockUserRepo.listOptions.ReportsTo).To(gomega.Equal(int64(1)))
+			gomega.Expect(mockUserRepo.listOptions.Recursive).To(gomega.BeTrue())
+			gomega.Expect(mockUserRepo.listOptions.Limit).To(gomega.Equal(10))
+		})
+
+		ginkgo.It("should move the reports of a terminated manager where the caller asks", func() {
+			req := httptest.NewRequest(http.MethodPost, "/v1/users/2/terminate?reassign_to=3", strings.NewReader(`{"reason":"Left"}`))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("id")
+			c.SetParamValues("2")
+			gomega.Expect(userController.TerminateUser(c)).To(gomega.Succeed())
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusOK))
+			gomega.Expect(mockUserRepo.users[0].ManagerID).To(gomega.Equal(int64(3)))
+			gomega.Expect(mockUserRepo.users[1].UserStatus).To(gomega.Equal("T"))
+			gomega.Expect(mockUserRepo.rolledBack).To(gomega.BeFalse())
+		})
+
+		ginkgo.It("should refuse to move reports to a user who does not exist", func() {
+			req := httptest.NewRequest(http.MethodPost, "/v1/users/2/terminate?reassign_to=9", strings.NewReader(`{"reason":"Left"}`))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("id")
+			c.SetParamValues("2")
+			if err := userController.TerminateUser(c); err != nil {
+				e.HTTPErrorHandler(err, c)
+			}
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusUnprocessableEntity))
+			gomega.Expect(rec.Body.String()).To(gomega.ContainSubstring(`"field":"reassign_to"`))
+			gomega.Expect(mockUserRepo.users[1].UserStatus).To(gomega.Equal("A"))
+			gomega.Expect(mockUserRepo.rolledBack).To(gomega.BeTrue())
+		})
+	})
+
+	ginkgo.Context("Org chart", func() {
+		get := func(target string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodGet, target, nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			if err := userController.GetOrgChart(c); err != nil {
+				e.HTTPErrorHandler(err, c)
+			}
+			return rec
+		}
+
+		ginkgo.BeforeEach(func() {
+			testUser.ManagerID = 2
+			mockUserRepo.users = []model.User{
+				testUser,
+				{ID: 2, UserName: "manager", FirstName: "Mary", LastName: "Manager", DepartmentID: 1, UserStatus: "T", ManagerID: 3},
+				{ID: 3, UserName: "director", FirstName: "Dana", LastName: "Director", Department: "Engineering", DepartmentID: 1, UserStatus: "A"},
+			}
+		})
+
+		ginkgo.It("should nest the reports of each user in JSON", func() {
+			rec := get("/v1/orgchart?root=3&depth=3")
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusOK))
+			gomega.Expect(mockUserRepo.chartOptions).To(gomega.Equal(repository.OrgChartOptions{Root: 3, Levels: 3}))
+			var body struct {
+				Data []orgchart.Node `json:"data"`
+			}
+			gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &body)).To(gomega.Succeed())
+			gomega.Expect(body.Data).To(gomega.HaveLen(1))
+			gomega.Expect(body.Data[0].UserName).To(gomega.Equal("director"))
+			gomega.Expect(body.Data[0].Reports).To(gomega.HaveLen(1))
+			gomega.Expect(body.Data[0].Reports[0].UserStatus).To(gomega.Equal("T"))
+			gomega.Expect(body.Data[0].Reports[0].Reports[0].ID).To(gomega.Equal(testUser.ID))
+		})
+
+		ginkgo.It("should name statuses in version 2", func() {
+			req := httptest.NewRequest(http.MethodGet, "/v2/orgchart?root=3", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			gomega.Expect(controllers.NewUserControllerV2(mockUserRepo).GetOrgChart(c)).To(gomega.Succeed())
+
+			var body struct {
+				Data []orgchart.Node `json:"data"`
+			}
+			gomega.Expect(json.Unmarshal(rec.Body.Bytes(), &body)).To(gomega.Succeed())
+			gomega.Expect(body.Data[0].UserStatus).To(gomega.Equal("active"))
+			gomega.Expect(body.Data[0].Reports[0].UserStatus).To(gomega.Equal("terminated"))
+		})
+
+		ginkgo.It("should draw the whole hierarchy as an SVG image", func() {
+			rec := get("/v1/orgchart?format=svg")
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusOK))
+			gomega.Expect(rec.Header().Get(echo.HeaderContentType)).To(gomega.Equal("image/svg+xml"))
+			gomega.Expect(rec.Header().Get(echo.HeaderContentDisposition)).To(gomega.Equal(`inline; filename="orgchart.svg"`))
+			gomega.Expect(rec.Body.String()).To(gomega.HavePrefix("<svg "))
+			gomega.Expect(rec.Body.String()).To(gomega.ContainSubstring("Dana Director"))
+			gomega.Expect(mockUserRepo.chartOptions).To(gomega.BeZero())
+		})
+
+		ginkgo.It("should draw the chart of a department", func() {
+			mockUserRepo.users[0].DepartmentID = 2
+			rec := get("/v1/orgchart?root=3&department_id=1&format=dot")
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusOK))
+			gomega.Expect(rec.Header().Get(echo.HeaderContentType)).To(gomega.Equal("text/vnd.graphviz; charset=utf-8"))
+			gomega.Expect(mockUserRepo.chartOptions).To(gomega.Equal(repository.OrgChartOptions{Root: 3, DepartmentID: 1}))
+			gomega.Expect(rec.Body.String()).To(gomega.ContainSubstring("u3 -> u2;"))
+			gomega.Expect(rec.Body.String()).NotTo(gomega.ContainSubstring("u2 -> u1;"))
+		})
+
+		ginkgo.It("should refuse an unknown format or a negative depth", func() {
+			rec := get("/v1/orgchart?format=png")
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusBadRequest))
+			gomega.Expect(rec.Body.String()).To(gomega.ContainSubstring("must be json, dot or svg"))
+
+			rec = get("/v1/orgchart?depth=-1")
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusBadRequest))
+			gomega.Expect(rec.Body.String()).To(gomega.ContainSubstring("depth cannot be negative"))
+		})
+
+		ginkgo.It("should answer 404 for a root that does not exist", func() {
+			rec := get("/v1/orgchart?root=9&format=dot")
+
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusNotFound))
+		})
+	})
 })
 	
 
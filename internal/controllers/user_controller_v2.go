@@ -0,0 +1,378 @@
+package controllers
+
+import (
+	"sample-service/internal/repository"
+
+	"github.com/labstack/echo/v4"
+)
+
+// UserControllerV2 serves version 2 of the API, which names user statuses
+// active, inactive and terminated and shows when users were created and
+// updated. It handles requests as UserController does; its methods carry
+// the documentation of the version. Search, suggestions, bulk writes,
+// imports and exports are only served by version 1.
+type UserControllerV2 struct {
+	*UserController
+}
+
+// NewUserControllerV2 creates a new UserControllerV2
+func NewUserControllerV2(repo repository.UserRepository) *UserControllerV2 {
+	uc := NewUserController(repo)
+	uc.view = v2{}
+	return &UserControllerV2{UserController: uc}
+}
+
+// @Summary Get all users
+// @Description Retrieve a page of users from the database, either by offset or by keyset cursor
+// @Tags v2
+// @Accept json
+// @Produce json,application/hal+json,application/vnd.api+json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Param limit query int false "Page size (default 50, max 200)"
+// @Param offset query int false "Number of users to skip; cannot be combined with cursor"
+// @Param cursor query string false "Opaque cursor taken from next_cursor or prev_cursor of a previous page"
+// @Param filter query string false "Filter expression, e.g. department eq \"Engineering\" and user_status ne \"terminated\""
+// @Param sort query string false "Comma-separated columns to sort by, prefixed with - for descending, e.g. last_name,-department"
+// @Param fields query string false "Comma-separated user fields to return, e.g. user_id,user_name,created_at"
+// @Param include query string false "Comma-separated related resources to embed under _embedded"
+// @Param include_deleted query bool false "Also list soft-deleted users"
+// @Success 200 {object} response.PaginatedResponse{data=[]model.UserV2}
+// @Header 200 {string} Link "RFC 8288 links to the first, next and previous pages"
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 406 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /users [get]
+func (uc *UserControllerV2) GetAllUsers(ctx echo.Context) error {
+	return uc.UserController.GetAllUsers(ctx)
+}
+
+// @Summary Get user by ID
+// @Description Retrieve a user by their ID
+// @Tags v2
+// @Accept json
+// @Produce json,application/hal+json,application/vnd.api+json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Param id path int true "User ID"
+// @Param fields query string false "Comma-separated user fields to return, e.g. user_id,user_name,created_at"
+// @Param include query string false "Comma-separated related resources to embed under _embedded"
+// @Param If-None-Match header string false "ETag of a cached copy; answered with 304 if it is still current"
+// @Success 200 {object} response.SuccessResponse{data=model.UserV2}
+// @Header 200 {string} ETag "Tag of the user in the API version and format of the response, on full representations only"
+// @Success 304 "The cached copy is current"
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 406 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /users/{id} [get]
+func (uc *UserControllerV2) GetUserByID(ctx echo.Context) error {
+	return uc.UserController.GetUserByID(ctx)
+}
+
+// @Summary Create a new user
+// @Description Create a new user in the database. created_at and updated_at are set by the service and ignored in the body.
+// @Description JSON:API clients are answered with 201, as JSON:API requires; others with 200.
+// @Tags v2
+// @Accept json,application/hal+json,application/vnd.api+json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Produce json,application/hal+json,application/vnd.api+json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Param user body model.UserV2 true "User details"
+// @Param Idempotency-Key header string false "Key under which the response is replayed to retries of the same request"
+// @Success 200 {object} response.SuccessResponse{data=model.UserV2}
+// @Success 201 {object} response.SuccessResponse{data=model.UserV2}
+// @Header 200,201 {string} Location "URL of the created user"
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 406 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Failure 415 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /users [post]
+func (uc *UserControllerV2) CreateUser(ctx echo.Context) error {
+	return uc.UserController.CreateUser(ctx)
+}
+
+// @Summary Replace a user
+// @Description Replace the user with the given ID. A user_id in the body must match the path.
+// @Description Replaying a request whose changes are already stored has no further effect and answers 200, even with a stale If-Match.
+// @Description With upsert=true a user that does not exist is created under the path ID, answering 201 with its Location.
+// @Description user_status can only be changed between active and inactive, and each change is recorded as made by X-Actor; terminating and rehiring have their own endpoints.
+// @Tags v2
+// @Accept json,application/hal+json,application/vnd.api+json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Produce json,application/hal+json,application/vnd.api+json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Param id path int true "User ID"
+// @Param user body model.UserV2 true "User details"
+// @Param upsert query bool false "Create the user if it does not exist"
+// @Param If-Match header string false "ETag the user must still have for the update to apply"
+// @Param X-Actor header string false "Who is updating the user"
+// @Success 200 {object} response.SuccessResponse{data=model.UserV2}
+// @Success 201 {object} response.SuccessResponse{data=model.UserV2}
+// @Header 200 {string} ETag "New version of the user"
+// @Header 201 {string} ETag "Version of the created user"
+// @Header 201 {string} Location "URL of the created user"
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 406 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Failure 412 {object} response.ErrorResponse
+// @Failure 415 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /users/{id} [put]
+func (uc *UserControllerV2) UpdateUser(ctx echo.Context) error {
+	return uc.UserController.UpdateUser(ctx)
+}
+
+// @Summary Patch a user
+// @Description Partially update a user with a JSON Merge Patch (RFC 7396), a JSON Patch (RFC 6902) or a JSON:API resource object, applied to the user as this version shows it.
+// @Description The patched user is validated before it is saved; a failed JSON Patch test operation leaves the user unchanged.
+// @Description The update only applies to the version of the user the patch was applied to. created_at and updated_at cannot be changed.
+// @Description user_status can only be changed between active and inactive, and each change is recorded as made by X-Actor; terminating and rehiring have their own endpoints.
+// @Tags v2
+// @Accept application/merge-patch+json
+// @Accept application/json-patch+json
+// @Accept application/vnd.api+json
+// @Produce json,application/hal+json,application/vnd.api+json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Param id path int true "User ID"
+// @Param patch body object true "Merge patch object or array of JSON Patch operations"
+// @Param If-Match header string false "ETag the user must still have for the patch to apply"
+// @Param X-Actor header string false "Who is updating the user"
+// @Success 200 {object} response.SuccessResponse{data=model.UserV2}
+// @Header 200 {string} ETag "New version of the user"
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 406 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Failure 412 {object} response.ErrorResponse
+// @Failure 415 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /users/{id} [patch]
+func (uc *UserControllerV2) PatchUser(ctx echo.Context) error {
+	return uc.UserController.PatchUser(ctx)
+}
+
+// @Summary Delete a user
+// @Description Soft-delete a user, recording when and by whom (X-Actor); it is hidden from reads until restored.
+// @Description With purge=true an administrator (X-Actor-Role: admin) deletes the user permanently instead.
+// @Description X-Actor-Role is not an authorization check: it is believed as sent, so purging is refused unless the service runs with TRUST_ACTOR_ROLE=true behind a gateway that sets the header itself.
+// @Tags v2
+// @Accept json
+// @Produce json,application/hal+json,application/vnd.api+json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Param id path int true "User ID"
+// @Param purge query bool false "Permanently delete the user; administrators only"
+// @Param If-Match header string false "ETag the user must still have for the delete to apply"
+// @Param X-Actor header string false "Who is deleting the user"
+// @Param X-Actor-Role header string false "Role of the caller as set by the gateway; purging requires admin and TRUST_ACTOR_ROLE=true"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 406 {object} response.ErrorResponse
+// @Failure 412 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /users/{id} [delete]
+func (uc *UserControllerV2) DeleteUser(ctx echo.Context) error {
+	return uc.UserController.DeleteUser(ctx)
+}
+
+// @Summary Restore a user
+// @Description Undo a soft delete. Fails if another user has taken the username since.
+// @Tags v2
+// @Produce json,application/hal+json,application/vnd.api+json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Param id path int true "User ID"
+// @Param Idempotency-Key header string false "Key under which the response is replayed to retries of the same request"
+// @Success 200 {object} response.SuccessResponse{data=model.UserV2}
+// @Header 200 {string} ETag "New version of the user"
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 406 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /users/{id}/restore [post]
+func (uc *UserControllerV2) RestoreUser(ctx echo.Context) error {
+	return uc.UserController.RestoreUser(ctx)
+}
+
+// @Summary Activate a user
+// @Description Move an inactive user to active, recording the reason and who did it (X-Actor)
+// @Tags v2
+// @Accept json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Produce json,application/hal+json,application/vnd.api+json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Param id path int true "User ID"
+// @Param transition body model.TransitionRequest true "Why the user is activated"
+// @Param If-Match header string false "ETag the user must still have for the transition to apply"
+// @Param X-Actor header string false "Who is activating the user"
+// @Param Idempotency-Key header string false "Key under which the response is replayed to retries of the same request"
+// @Success 200 {object} response.SuccessResponse{data=model.UserV2}
+// @Header 200 {string} ETag "New version of the user"
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 406 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Failure 412 {object} response.ErrorResponse
+// @Failure 415 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /users/{id}/activate [post]
+func (uc *UserControllerV2) ActivateUser(ctx echo.Context) error {
+	return uc.UserController.ActivateUser(ctx)
+}
+
+// @Summary Deactivate a user
+// @Description Move an active user to inactive, recording the reason and who did it (X-Actor)
+// @Tags v2
+// @Accept json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Produce json,application/hal+json,application/vnd.api+json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Param id path int true "User ID"
+// @Param transition body model.TransitionRequest true "Why the user is deactivated"
+// @Param If-Match header string false "ETag the user must still have for the transition to apply"
+// @Param X-Actor header string false "Who is deactivating the user"
+// @Param Idempotency-Key header string false "Key under which the response is replayed to retries of the same request"
+// @Success 200 {object} response.SuccessResponse{data=model.UserV2}
+// @Header 200 {string} ETag "New version of the user"
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 406 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Failure 412 {object} response.ErrorResponse
+// @Failure 415 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /users/{id}/deactivate [post]
+func (uc *UserControllerV2) DeactivateUser(ctx echo.Context) error {
+	return uc.UserController.DeactivateUser(ctx)
+}
+
+// @Summary Terminate a user
+// @Description Move an active or inactive user to terminated, recording the reason and who did it (X-Actor). Writing user_status cannot terminate a user.
+// @Description Whoever reports to the user moves to reassign_to if it is given, or else up to the user's own manager.
+// @Tags v2
+// @Accept json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Produce json,application/hal+json,application/vnd.api+json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Param id path int true "User ID"
+// @Param transition body model.TransitionRequest true "Why the user is terminated"
+// @Param reassign_to query int false "User to move the reports of the terminated user to"
+// @Param If-Match header string false "ETag the user must still have for the transition to apply"
+// @Param X-Actor header string false "Who is terminating the user"
+// @Param Idempotency-Key header string false "Key under which the response is replayed to retries of the same request"
+// @Success 200 {object} response.SuccessResponse{data=model.UserV2}
+// @Header 200 {string} ETag "New version of the user"
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 406 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Failure 412 {object} response.ErrorResponse
+// @Failure 415 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /users/{id}/terminate [post]
+func (uc *UserControllerV2) TerminateUser(ctx echo.Context) error {
+	return uc.UserController.TerminateUser(ctx)
+}
+
+// @Summary Rehire a user
+// @Description Move a terminated user back to active, recording the reason and who did it (X-Actor). Writing user_status cannot rehire a user.
+// @Tags v2
+// @Accept json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Produce json,application/hal+json,application/vnd.api+json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Param id path int true "User ID"
+// @Param transition body model.TransitionRequest true "Why the user is rehired"
+// @Param If-Match header string false "ETag the user must still have for the transition to apply"
+// @Param X-Actor header string false "Who is rehiring the user"
+// @Param Idempotency-Key header string false "Key under which the response is replayed to retries of the same request"
+// @Success 200 {object} response.SuccessResponse{data=model.UserV2}
+// @Header 200 {string} ETag "New version of the user"
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 406 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Failure 412 {object} response.ErrorResponse
+// @Failure 415 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /users/{id}/rehire [post]
+func (uc *UserControllerV2) RehireUser(ctx echo.Context) error {
+	return uc.UserController.RehireUser(ctx)
+}
+
+// @Summary Get the status history of a user
+// @Description Retrieve every status transition made to a user, oldest first. Transitions made by writing user_status have no reason.
+// @Tags v2
+// @Accept json
+// @Produce json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Param id path int true "User ID"
+// @Success 200 {object} response.SuccessResponse{data=[]model.StatusTransition}
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 406 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /users/{id}/transitions [get]
+func (uc *UserControllerV2) GetUserTransitions(ctx echo.Context) error {
+	return uc.UserController.GetUserTransitions(ctx)
+}
+
+// @Summary Get the reports of a user
+// @Description Retrieve a page of the users who report to a user, with the same parameters as listing all users. Only direct reports are listed unless recursive is set, which lists everyone below the user in the hierarchy; each user's manager_id tells who they report to.
+// @Tags v2
+// @Accept json
+// @Produce json,application/hal+json,application/vnd.api+json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Param id path int true "User ID"
+// @Param recursive query bool false "Also list the reports of reports, at any depth"
+// @Param limit query int false "Page size (default 50, max 200)"
+// @Param offset query int false "Number of users to skip; cannot be combined with cursor"
+// @Param cursor query string false "Opaque cursor taken from next_cursor or prev_cursor of a previous page"
+// @Param filter query string false "Filter expression, e.g. user_status ne \"terminated\""
+// @Param sort query string false "Comma-separated columns to sort by, prefixed with - for descending, e.g. last_name,first_name"
+// @Param fields query string false "Comma-separated user fields to return, e.g. user_id,user_name,manager_id"
+// @Param include query string false "Comma-separated related resources to embed under _embedded"
+// @Param include_deleted query bool false "Also list soft-deleted users"
+// @Success 200 {object} response.PaginatedResponse{data=[]model.UserV2}
+// @Header 200 {string} Link "RFC 8288 links to the first, next and previous pages"
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 406 {object} response.ErrorResponse
+// @Failure 422 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /users/{id}/reports [get]
+func (uc *UserControllerV2) GetUserReports(ctx echo.Context) error {
+	return uc.UserController.GetUserReports(ctx)
+}
+
+// @Summary Get the management chain of a user
+// @Description Retrieve the managers of a user, from the one they report to up to the top of the hierarchy. Deleted managers are left out.
+// @Tags v2
+// @Accept json
+// @Produce json,application/hal+json,application/vnd.api+json,application/xml,application/yaml,application/cbor,application/msgpack
+// @Param id path int true "User ID"
+// @Param fields query string false "Comma-separated user fields to return, e.g. user_id,user_name,manager_id"
+// @Param include query string false "Comma-separated related resources to embed under _embedded"
+// @Success 200 {object} response.SuccessResponse{data=[]model.UserV2}
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 406 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /users/{id}/chain [get]
+func (uc *UserControllerV2) GetUserChain(ctx echo.Context) error {
+	return uc.UserController.GetUserChain(ctx)
+}
+
+// @Summary Get the org chart
+// @Description Draw the reporting lines below a user, or the whole hierarchy from the users who report to no one, with each user's name, department and status.
+// @Description With department_id only the users of that department are drawn, as a chart of the department.
+// @Description As json the chart is a list of nested users, each with their reports and their status named; as dot it is a Graphviz digraph; as svg it is an image laid out top down, ready to print.
+// @Description Terminated users are drawn greyed out with a dashed border. Deleted users are left out, and their reports are drawn under the nearest manager above them.
+// @Tags v2
+// @Produce json
+// @Produce text/vnd.graphviz
+// @Produce image/svg+xml
+// @Param root query int false "User at the top of the chart; all users who report to no one by default"
+// @Param department_id query int false "Department to draw; its users whose manager is in another department are drawn at the top"
+// @Param depth query int false "Number of levels to draw, counting the top one; all levels by default"
+// @Param format query string false "json (default), dot or svg"
+// @Success 200 {object} response.SuccessResponse{data=[]orgchart.Node}
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 500 {object} response.ErrorResponse
+// @Router /orgchart [get]
+func (uc *UserControllerV2) GetOrgChart(ctx echo.Context) error {
+	return uc.UserController.GetOrgChart(ctx)
+}
@@ -0,0 +1,140 @@
+package controllers
+
+import (
+	"fmt"
+	"sample-service/internal/filter"
+	"sample-service/internal/model"
+	"sample-service/internal/orgchart"
+	"sample-service/internal/repository"
+	"sample-service/internal/validate"
+	"strings"
+)
+
+// userView is how a version of the API shows users and reads the users
+// clients send. Handlers work on model.User and leave the differences
+// between versions to the view.
+type userView interface {
+	// name identifies the version in entity tags, e.g. "v1"
+	name() string
+	// show converts a user to the document the version shows
+	show(user model.User) interface{}
+	// showAll is show for a list of users
+	showAll(users []model.User) interface{}
+	// newDocument returns a pointer to an empty document of the version,
+	// for a request body to be decoded into
+	newDocument() interface{}
+	// validate checks a decoded document against the rules of the version
+	validate(doc interface{}) error
+	// toUser converts a decoded document to a user
+	toUser(doc interface{}) model.User
+	// hides reports whether the version leaves a user field out, so that
+	// ?fields= cannot name it
+	hides(field string) bool
+	// storeFilter rewrites the values of a filter the version shows
+	// differently from how they are stored
+	storeFilter(expr filter.Expr) error
+	// showTransitions converts the status history of a user to the
+	// documents the version shows
+	showTransitions(transitions []model.StatusTransition) interface{}
+	// showChart converts the trees of an org chart to the ones the version
+	// shows
+	showChart(roots []*orgchart.Node) []*orgchart.Node
+}
+
+// v1 shows users as they are stored, without their timestamps
+type v1 struct{}
+
+func (v1) name() string                           { return "v1" }
+func (v1) show(user model.User) interface{}       { return user }
+func (v1) showAll(users []model.User) interface{} { return users }
+func (v1) newDocument() interface{}               { return &model.User{} }
+func (v1) validate(doc interface{}) error         { return validateUser(*doc.(*model.User)) }
+func (v1) toUser(doc interface{}) model.User      { return *doc.(*model.User) }
+func (v1) hides(field string) bool                { return field == "created_at" || field == "updated_at" }
+func (v1) storeFilter(expr filter.Expr) error     { return nil }
+
+func (v1) showTransitions(transitions []model.StatusTransition) interface{} { return transitions }
+func (v1) showChart(roots []*orgchart.Node) []*orgchart.Node                { return roots }
+
+// v2 names user statuses and shows when users were created and updated
+type v2 struct{}
+
+func (v2) name() string                     { return "v2" }
+func (v2) show(user model.User) interface{} { return model.NewUserV2(user) }
+
+func (v2) showAll(users []model.User) interface{} {
+	shown := make([]model.UserV2, len(users))
+	for i, user := range users {
+		shown[i] = model.NewUserV2(user)
+	}
+	return shown
+}
+
+func (v2) newDocument() interface{} { return &model.UserV2{} }
+
+func (v2) validate(doc interface{}) error {
+	if fields := validate.Struct(*doc.(*model.UserV2)); len(fields) > 0 {
+		return repository.ValidationError(fields)
+	}
+	return nil
+}
+
+func (v2) toUser(doc interface{}) model.User { return doc.(*model.UserV2).User() }
+
+func (v2) hides(field string) bool { return false }
+
+// showTransitions names the statuses of a history as users show them
+func (v2) showTransitions(transitions []model.StatusTransition) interface{} {
+	shown := make([]model.StatusTransition, len(transitions))
+	for i, t := range transitions {
+		t.FromStatus, t.ToStatus = model.StatusName(t.FromStatus), model.StatusName(t.ToStatus)
+		shown[i] = t
+	}
+	return shown
+}
+
+// showChart names the statuses of an org chart as users show them
+func (v2) showChart(roots []*orgchart.Node) []*orgchart.Node {
+	shown := make([]*orgchart.Node, len(roots))
+	for i, node := range roots {
+		named := *node
+		named.UserStatus = model.StatusName(node.UserStatus)
+		named.Reports = (v2{}).showChart(node.Reports)
+		shown[i] = &named
+	}
+	return shown
+}
+
+// storeFilter turns the status names a filter compares with into the
+// stored codes. Names do not sort like codes, so statuses can only be
+// compared for equality.
+func (v2) storeFilter(expr filter.Expr) error {
+	switch e := expr.(type) {
+	case *filter.Logical:
+		if err := (v2{}).storeFilter(e.Left); err != nil {
+			return err
+		}
+		return (v2{}).storeFilter(e.Right)
+	case *filter.Not:
+		return (v2{}).storeFilter(e.Expr)
+	case *filter.Comparison:
+		if e.Field != "user_status" {
+			return nil
+		}
+		if e.Op != filter.Eq && e.Op != filter.Ne && e.Op != filter.In {
+			return &filter.Error{Pos: e.Pos(), Msg: fmt.Sprintf("operator %s cannot be used with user_status, expected eq, ne or in", e.Op)}
+		}
+		for i, value := range e.Values {
+			if value.Kind != filter.StringValue {
+				continue
+			}
+			code, ok := model.StatusCode(value.Text)
+			if !ok {
+				return &filter.Error{Pos: value.Pos(), Msg: fmt.Sprintf("unknown user_status %q, expected one of %s", value.Text,
+					strings.Join([]string{model.StatusActive, model.StatusInactive, model.StatusTerminated}, ", "))}
+			}
+			e.Values[i].Text = code
+		}
+	}
+	return nil
+}
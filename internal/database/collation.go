@@ -0,0 +1,32 @@
+package database
+
+import (
+	"database/sql"
+
+	"github.com/mattn/go-sqlite3"
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// DriverName is the sqlite3 driver with the service's collations registered
+const DriverName = "sqlite3_collate"
+
+// UnicodeNoCase orders text with the Unicode Collation Algorithm, ignoring
+// case, so that "émilie", "Emilie" and "Émilie" all sort before "Zoe"
+const UnicodeNoCase = "UNICODE_NOCASE"
+
+func init() {
+	sql.Register(DriverName, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			// A collator is not safe for concurrent use, but a connection
+			// only ever runs one statement at a time, so each gets its own
+			collator := collate.New(language.Und, collate.IgnoreCase)
+			if err := conn.RegisterCollation(UnicodeNoCase, collator.CompareString); err != nil {
+				return err
+			}
+			// SQLite only enforces foreign keys when asked to, per connection
+			_, err := conn.Exec("PRAGMA foreign_keys = ON", nil)
+			return err
+		},
+	})
+}
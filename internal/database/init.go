@@ -7,7 +7,7 @@ import (
 )
 
 func InitDB(path string) (*sql.DB, error) {
-	db, err := sql.Open("sqlite3", path)
+	db, err := sql.Open(DriverName, path)
 	if err != nil {
 		return nil, err
 	}
@@ -28,6 +28,16 @@ func InitDB(path string) (*sql.DB, error) {
 		return nil, fmt.Errorf("failed to create tables: %w", err)
 	}
 
+	err = migrate(db)
+	if err != nil {
+		return nil, err
+	}
+
+	err = initSearchIndex(db)
+	if err != nil {
+		return nil, err
+	}
+
 	return db, nil
 }
 
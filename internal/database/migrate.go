@@ -0,0 +1,153 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// migrations change the schema created by InitDB, in order. The number of
+// migrations applied is kept in SQLite's user_version pragma, so each one
+// runs exactly once per database. Only ever append to this list.
+var migrations = []string{
+	// 1: version counts the writes to a user, for optimistic concurrency
+	`ALTER TABLE users ADD COLUMN version INTEGER NOT NULL DEFAULT 1`,
+	// 2: soft deletes keep the row, recording when and by whom it was deleted
+	`ALTER TABLE users ADD COLUMN deleted_at TIMESTAMP;
+	ALTER TABLE users ADD COLUMN deleted_by TEXT`,
+	// 3: responses to requests made with an Idempotency-Key, replayed to
+	// retries until they expire; expires_at is in Unix seconds
+	`CREATE TABLE idempotency_keys (
+		idempotency_key TEXT PRIMARY KEY,
+		fingerprint TEXT NOT NULL,
+		status INTEGER NOT NULL DEFAULT 0,
+		header TEXT,
+		body BLOB,
+		expires_at INTEGER NOT NULL
+	);
+	CREATE INDEX idempotency_keys_expires_at ON idempotency_keys (expires_at)`,
+	// 4: when each user was created and last written; existing users get
+	// the time of the migration, as the real times were never recorded
+	`ALTER TABLE users ADD COLUMN created_at TIMESTAMP;
+	ALTER TABLE users ADD COLUMN updated_at TIMESTAMP;
+	UPDATE users SET created_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP`,
+	// 5: departments, which users point at with department_id. The free-text
+	// department column stays as a copy of the department's name, which the
+	// repository keeps in step, so search, filters and sorting work as
+	// before. Existing names are normalized first: spellings that differ
+	// only in case or surrounding spaces, and the abbreviations below, are
+	// one department, named by its most used spelling.
+	`CREATE TABLE departments (
+		department_id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name VARCHAR(255) NOT NULL UNIQUE COLLATE NOCASE
+	);
+	ALTER TABLE users ADD COLUMN department_id INTEGER REFERENCES departments (department_id);
+	CREATE INDEX users_department_id ON users (department_id);
+
+	UPDATE users SET department = NULLIF(TRIM(department), '');
+	WITH abbreviations (abbreviation, name) AS (
+		VALUES ('eng', 'Engineering'), ('hr', 'Human Resources'), ('it', 'IT Support'), ('fin', 'Finance'), ('mktg', 'Marketing')
+	)
+	UPDATE users SET department = (SELECT name FROM abbreviations WHERE abbreviation = LOWER(users.department))
+	WHERE LOWER(department) IN (SELECT abbreviation FROM abbreviations);
+
+	INSERT INTO departments (name)
+	SELECT department FROM (
+		SELECT department, MAX(uses) FROM (
+			SELECT department, COUNT(*) AS uses FROM users WHERE department IS NOT NULL GROUP BY department
+		) GROUP BY department COLLATE NOCASE
+	);
+	UPDATE users SET department_id = (SELECT department_id FROM departments WHERE name = users.department);
+	UPDATE users SET department = (SELECT name FROM departments WHERE department_id = users.department_id)`,
+	// 6: every change of a user's status, as a transition of its lifecycle
+	`CREATE TABLE user_status_transitions (
+		transition_id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+		transition VARCHAR(16) NOT NULL,
+		from_status VARCHAR(1) NOT NULL,
+		to_status VARCHAR(1) NOT NULL,
+		reason TEXT,
+		actor TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL
+	);
+	CREATE INDEX user_status_transitions_user_id ON user_status_transitions (user_id)`,
+	// 7: changes to users that take effect later, applied by the scheduler
+	// once effective_at, in Unix seconds, has passed. The repository keeps
+	// departments with pending changes into them from being deleted; past
+	// changes forget deleted departments.
+	`CREATE TABLE scheduled_changes (
+		change_id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+		effective_at INTEGER NOT NULL,
+		transition VARCHAR(16),
+		department_id INTEGER REFERENCES departments (department_id) ON DELETE SET NULL,
+		reason TEXT NOT NULL,
+		status VARCHAR(16) NOT NULL DEFAULT 'pending',
+		error TEXT,
+		created_by TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		applied_at TIMESTAMP,
+		cancelled_at TIMESTAMP,
+		cancelled_by TEXT
+	);
+	CREATE INDEX scheduled_changes_due ON scheduled_changes (status, effective_at);
+	CREATE INDEX scheduled_changes_user_id ON scheduled_changes (user_id)`,
+	// 8: who each user reports to. The repository keeps the hierarchy free
+	// of cycles; purging a manager leaves their reports without one.
+	`ALTER TABLE users ADD COLUMN manager_id INTEGER REFERENCES users (user_id) ON DELETE SET NULL;
+	CREATE INDEX users_manager_id ON users (manager_id)`,
+	// 9: a username is held by at most one user that is not deleted, in
+	// any case; deleted users give theirs up to be reclaimed. Where two live
+	// users share one, as seeding used to leave behind on every restart,
+	// all but the first are deleted by "migration" so that none are lost.
+	`UPDATE users SET deleted_at = CURRENT_TIMESTAMP, deleted_by = 'migration', updated_at = CURRENT_TIMESTAMP, version = version + 1
+	WHERE deleted_at IS NULL AND EXISTS (
+		SELECT 1 FROM users earlier
+		WHERE earlier.deleted_at IS NULL AND earlier.user_id < users.user_id AND earlier.user_name = users.user_name COLLATE UNICODE_NOCASE
+	);
+	CREATE UNIQUE INDEX users_user_name_live ON users (user_name COLLATE UNICODE_NOCASE) WHERE deleted_at IS NULL`,
+	// 10: idempotency keys are scoped to the actor that sent them, so two
+	// callers can pick the same key. Stored records do not say whose they
+	// are and expire within IDEMPOTENCY_TTL anyway, so they are dropped.
+	`DROP TABLE idempotency_keys;
+	CREATE TABLE idempotency_keys (
+		actor TEXT NOT NULL,
+		idempotency_key TEXT NOT NULL,
+		fingerprint TEXT NOT NULL,
+		status INTEGER NOT NULL DEFAULT 0,
+		header TEXT,
+		body BLOB,
+		expires_at INTEGER NOT NULL,
+		PRIMARY KEY (actor, idempotency_key)
+	);
+	CREATE INDEX idempotency_keys_expires_at ON idempotency_keys (expires_at)`,
+}
+
+// migrate applies the migrations the database has not seen yet, each in
+// its own transaction
+func migrate(db *sql.DB) error {
+	var applied int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&applied); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	for i := applied; i < len(migrations); i++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d failed: %w", i+1, err)
+		}
+		// PRAGMA does not take bound parameters
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to record migration %d: %w", i+1, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
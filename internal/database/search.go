@@ -0,0 +1,56 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// searchSchema creates the users_fts full-text index over the searchable
+// user columns. It is an external-content table: it stores only the index
+// and reads column values back from users, so triggers keep it in sync.
+// remove_diacritics lets "jose" match "José".
+const searchSchema = `
+	CREATE VIRTUAL TABLE IF NOT EXISTS users_fts USING fts5(
+		first_name, last_name, user_name, email, department,
+		content='users', content_rowid='user_id',
+		tokenize='unicode61 remove_diacritics 2'
+	);
+
+	CREATE TRIGGER IF NOT EXISTS users_fts_insert AFTER INSERT ON users BEGIN
+		INSERT INTO users_fts(rowid, first_name, last_name, user_name, email, department)
+		VALUES (new.user_id, new.first_name, new.last_name, new.user_name, new.email, new.department);
+	END;
+
+	CREATE TRIGGER IF NOT EXISTS users_fts_delete AFTER DELETE ON users BEGIN
+		INSERT INTO users_fts(users_fts, rowid, first_name, last_name, user_name, email, department)
+		VALUES ('delete', old.user_id, old.first_name, old.last_name, old.user_name, old.email, old.department);
+	END;
+
+	CREATE TRIGGER IF NOT EXISTS users_fts_update AFTER UPDATE ON users BEGIN
+		INSERT INTO users_fts(users_fts, rowid, first_name, last_name, user_name, email, department)
+		VALUES ('delete', old.user_id, old.first_name, old.last_name, old.user_name, old.email, old.department);
+		INSERT INTO users_fts(rowid, first_name, last_name, user_name, email, department)
+		VALUES (new.user_id, new.first_name, new.last_name, new.user_name, new.email, new.department);
+	END;`
+
+// initSearchIndex creates the full-text index and its triggers, and
+// backfills the index when it is added to a database that already has users
+func initSearchIndex(db *sql.DB) error {
+	var existing int
+	err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'users_fts'").Scan(&existing)
+	if err != nil {
+		return fmt.Errorf("failed to check for search index: %w", err)
+	}
+
+	if _, err := db.Exec(searchSchema); err != nil {
+		return fmt.Errorf("failed to create search index (is the binary built with -tags sqlite_fts5?): %w", err)
+	}
+
+	if existing == 0 {
+		if _, err := db.Exec("INSERT INTO users_fts(users_fts) VALUES ('rebuild')"); err != nil {
+			return fmt.Errorf("failed to backfill search index: %w", err)
+		}
+	}
+
+	return nil
+}
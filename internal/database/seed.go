@@ -3,8 +3,12 @@ package database
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"sample-service/internal/model"
+	"sample-service/internal/validate"
+	"strings"
 	_ "github.com/mattn/go-sqlite3"
 )
 
@@ -18,7 +22,9 @@ type UserSeed struct {
 	UserName   string `json:"username"`
 }
 
-// SeedDB seeds the database with the user data
+// SeedDB seeds the database with the user data. The departments the users
+// name are created as they are met, and users named in another case join
+// the department as it was first spelled.
 func SeedDB(db *sql.DB) error {
 	seedData, err := os.ReadFile("./seed.json")
 	if err != nil {
@@ -30,10 +36,24 @@ func SeedDB(db *sql.DB) error {
         return fmt.Errorf("could not parse seed JSON: %w", err)
     }
 
-	for _, user := range users {
+	for i, user := range users {
+		if err := validateSeed(user); err != nil {
+			return fmt.Errorf("invalid seed user %d: %w", i+1, err)
+		}
+		department := strings.TrimSpace(user.Department)
+		if department != "" {
+			// INSERT OR IGNORE would use up an ID for every department that exists
+			_, err := db.Exec("INSERT INTO departments (name) SELECT ? WHERE NOT EXISTS (SELECT 1 FROM departments WHERE name = ?)", department, department)
+			if err != nil {
+				return fmt.Errorf("failed to insert department: %w", err)
+			}
+		}
+		// Users whose username is already held are skipped by the unique
+		// index on live usernames, so seeding again on a restart adds nobody
 		_, err := db.Exec(
-			"INSERT OR IGNORE INTO users (first_name, last_name, email, department, user_status, user_name) VALUES (?, ?, ?, ?, ?, ?)",
-			user.FirstName, user.LastName, user.Email, user.Department, user.UserStatus, user.UserName)
+			"INSERT OR IGNORE INTO users (first_name, last_name, email, department, department_id, user_status, user_name, created_at, updated_at) "+
+				"SELECT ?, ?, ?, d.name, d.department_id, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP FROM (SELECT 1) LEFT JOIN departments d ON d.name = ?",
+			user.FirstName, user.LastName, user.Email, user.UserStatus, user.UserName, department)
 		if err != nil {
 			return fmt.Errorf("failed to insert user: %w", err)
 		}
@@ -41,3 +61,20 @@ func SeedDB(db *sql.DB) error {
 
 	return nil
 }
+
+// validateSeed checks a seed user against the same rules as users sent
+// to the API, so the seed cannot store what the API would refuse
+func validateSeed(seed UserSeed) error {
+	fields := validate.Struct(model.User{
+		UserName:   seed.UserName,
+		FirstName:  seed.FirstName,
+		LastName:   seed.LastName,
+		Email:      seed.Email,
+		Department: seed.Department,
+		UserStatus: seed.UserStatus,
+	})
+	if len(fields) > 0 {
+		return errors.New(validate.Summary(fields))
+	}
+	return nil
+}
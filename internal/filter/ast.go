@@ -0,0 +1,84 @@
+package filter
+
+// Expr is a node of a parsed filter expression
+type Expr interface {
+	// Pos is the 1-based character position the expression starts at
+	Pos() int
+}
+
+// LogicalOp joins two expressions
+type LogicalOp string
+
+const (
+	And LogicalOp = "and"
+	Or  LogicalOp = "or"
+)
+
+// Operator compares a field with one or more values
+type Operator string
+
+const (
+	Eq         Operator = "eq"
+	Ne         Operator = "ne"
+	Gt         Operator = "gt"
+	Ge         Operator = "ge"
+	Lt         Operator = "lt"
+	Le         Operator = "le"
+	Contains   Operator = "co"
+	StartsWith Operator = "sw"
+	EndsWith   Operator = "ew"
+	In         Operator = "in"
+)
+
+var operators = map[string]Operator{
+	"eq": Eq, "ne": Ne, "gt": Gt, "ge": Ge, "lt": Lt, "le": Le,
+	"co": Contains, "sw": StartsWith, "ew": EndsWith, "in": In,
+}
+
+// Logical is "left and right" or "left or right"
+type Logical struct {
+	Op    LogicalOp
+	Left  Expr
+	Right Expr
+	pos   int
+}
+
+func (e *Logical) Pos() int { return e.pos }
+
+// Not negates an expression
+type Not struct {
+	Expr Expr
+	pos  int
+}
+
+func (e *Not) Pos() int { return e.pos }
+
+// Comparison tests a field against a value, or a list of values for "in"
+type Comparison struct {
+	Field  string
+	Op     Operator
+	Values []Value
+	pos    int
+	opPos  int
+}
+
+func (e *Comparison) Pos() int { return e.pos }
+
+// ValueKind is the literal type of a Value
+type ValueKind int
+
+const (
+	StringValue ValueKind = iota
+	NumberValue
+	NullValue
+)
+
+// Value is a literal on the right-hand side of a comparison
+type Value struct {
+	Kind ValueKind
+	Text string
+	pos  int
+}
+
+// Pos is the 1-based character position of the literal
+func (v Value) Pos() int { return v.pos }
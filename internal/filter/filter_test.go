@@ -0,0 +1,116 @@
+package filter_test
+
+import (
+	"sample-service/internal/filter"
+	"testing"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+func TestFilter(t *testing.T) {
+	gomega.RegisterFailHandler(ginkgo.Fail)
+	ginkgo.RunSpecs(t, "Filter Suite")
+}
+
+var schema = filter.Schema{
+	"id":     filter.IntegerField,
+	"name":   filter.StringField,
+	"status": filter.StringField,
+}
+
+// positionOf returns the position reported by a filter error
+func positionOf(err error) int {
+	var filterErr *filter.Error
+	gomega.Expect(err).To(gomega.BeAssignableToTypeOf(filterErr))
+	return err.(*filter.Error).Pos
+}
+
+var _ = ginkgo.Describe("Filter", func() {
+	ginkgo.Context("Parse", func() {
+		ginkgo.It("should parse a single comparison", func() {
+			expr, err := filter.Parse(`name eq "Émilie \"Em\" Dupont"`)
+
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			cmp, ok := expr.(*filter.Comparison)
+			gomega.Expect(ok).To(gomega.BeTrue())
+			gomega.Expect(cmp.Field).To(gomega.Equal("name"))
+			gomega.Expect(cmp.Op).To(gomega.Equal(filter.Eq))
+			gomega.Expect(cmp.Values).To(gomega.HaveLen(1))
+			gomega.Expect(cmp.Values[0].Kind).To(gomega.Equal(filter.StringValue))
+			gomega.Expect(cmp.Values[0].Text).To(gomega.Equal(`Émilie "Em" Dupont`))
+		})
+
+		ginkgo.It("should bind and tighter than or", func() {
+			expr, err := filter.Parse(`name sw "a" or status eq "A" and id gt 3`)
+
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			or, ok := expr.(*filter.Logical)
+			gomega.Expect(ok).To(gomega.BeTrue())
+			gomega.Expect(or.Op).To(gomega.Equal(filter.Or))
+			and, ok := or.Right.(*filter.Logical)
+			gomega.Expect(ok).To(gomega.BeTrue())
+			gomega.Expect(and.Op).To(gomega.Equal(filter.And))
+		})
+
+		ginkgo.It("should parse negation, grouping and lists", func() {
+			expr, err := filter.Parse(`NOT (status in ("A", "I") or id le -1)`)
+
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			not, ok := expr.(*filter.Not)
+			gomega.Expect(ok).To(gomega.BeTrue())
+			or := not.Expr.(*filter.Logical)
+			in := or.Left.(*filter.Comparison)
+			gomega.Expect(in.Op).To(gomega.Equal(filter.In))
+			gomega.Expect(in.Values).To(gomega.HaveLen(2))
+			gomega.Expect(or.Right.(*filter.Comparison).Values[0].Text).To(gomega.Equal("-1"))
+		})
+
+		ginkgo.DescribeTable("should point at the position of syntax errors",
+			func(input string, pos int, message string) {
+				_, err := filter.Parse(input)
+
+				gomega.Expect(err).To(gomega.HaveOccurred())
+				gomega.Expect(positionOf(err)).To(gomega.Equal(pos))
+				gomega.Expect(err.Error()).To(gomega.ContainSubstring(message))
+			},
+			ginkgo.Entry("empty filter", "  ", 1, "filter is empty"),
+			ginkgo.Entry("unknown operator", `name is "x"`, 6, "expected an operator"),
+			ginkgo.Entry("missing value", `name eq`, 8, "found end of filter"),
+			ginkgo.Entry("unterminated string", `name eq "abc`, 9, "unterminated string"),
+			ginkgo.Entry("bad character", `name eq 'abc'`, 9, "unexpected character"),
+			ginkgo.Entry("missing closing parenthesis", `(name eq "a"`, 13, `expected ")"`),
+			ginkgo.Entry("dangling and", `name eq "a" and`, 16, "expected a field name"),
+			ginkgo.Entry("trailing tokens", `name eq "a" name`, 13, `expected "and", "or" or end of filter`),
+			ginkgo.Entry("unclosed list", `status in ("A" "I")`, 16, `expected "," or ")"`),
+		)
+	})
+
+	ginkgo.Context("Validate", func() {
+		ginkgo.It("should accept valid filters", func() {
+			expr, err := filter.Parse(`id ge 2 and name co "x" and status ne null`)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			gomega.Expect(filter.Validate(expr, schema)).To(gomega.Succeed())
+		})
+
+		ginkgo.DescribeTable("should point at the position of invalid comparisons",
+			func(input string, pos int, message string) {
+				expr, err := filter.Parse(input)
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+				err = filter.Validate(expr, schema)
+
+				gomega.Expect(err).To(gomega.HaveOccurred())
+				gomega.Expect(positionOf(err)).To(gomega.Equal(pos))
+				gomega.Expect(err.Error()).To(gomega.ContainSubstring(message))
+			},
+			ginkgo.Entry("unknown field", `id eq 1 and dept eq "x"`, 13, `unknown field "dept", expected one of id, name, status`),
+			ginkgo.Entry("text operator on a number", `id sw 1`, 4, `operator "sw" only applies to text fields`),
+			ginkgo.Entry("string for a number", `id eq "1"`, 7, `field "id" expects a number`),
+			ginkgo.Entry("number for a string", `name eq 1`, 9, `field "name" expects a quoted string`),
+			ginkgo.Entry("ordering null", `name gt null`, 9, "null can only be compared with eq or ne"),
+			ginkgo.Entry("number out of range", `id eq 99999999999999999999`, 7, "out of range"),
+		)
+	})
+})
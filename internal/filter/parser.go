@@ -0,0 +1,190 @@
+// Package filter parses the expression language accepted by the ?filter=
+// query parameter, for example:
+//
+//	department eq "Engineering" and (user_status ne "T" or email ew "@company.com")
+//
+// Comparisons are "field op value" with the operators eq, ne, gt, ge, lt, le,
+// co (contains), sw (starts with), ew (ends with) and in ("in" takes a
+// parenthesised list). They can be combined with and, or, not and
+// parentheses; "and" binds tighter than "or".
+package filter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Error reports a malformed or invalid filter along with where it went wrong
+type Error struct {
+	Pos int
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("position %d: %s", e.Pos, e.Msg)
+}
+
+type parser struct {
+	tokens []token
+	next   int
+}
+
+// Parse turns a filter string into an expression tree. It only checks the
+// syntax; use Validate to check the fields and values against a schema.
+func Parse(input string) (Expr, error) {
+	if strings.TrimSpace(input) == "" {
+		return nil, &Error{Pos: 1, Msg: "filter is empty"}
+	}
+
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return nil, p.unexpected(tok, `"and", "or" or end of filter`)
+	}
+	return expr, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.next]
+}
+
+func (p *parser) advance() token {
+	tok := p.tokens[p.next]
+	if tok.kind != tokenEOF {
+		p.next++
+	}
+	return tok
+}
+
+func (p *parser) isKeyword(tok token, keyword string) bool {
+	return tok.kind == tokenIdent && strings.EqualFold(tok.text, keyword)
+}
+
+func (p *parser) unexpected(tok token, expected string) error {
+	return &Error{Pos: tok.pos, Msg: fmt.Sprintf("expected %s, found %s", expected, tok.describe())}
+}
+
+// parseOr handles: and_expr ("or" and_expr)*
+func (p *parser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword(p.peek(), "or") {
+		p.advance()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &Logical{Op: Or, Left: left, Right: right, pos: left.Pos()}
+	}
+	return left, nil
+}
+
+// parseAnd handles: unary ("and" unary)*
+func (p *parser) parseAnd() (Expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword(p.peek(), "and") {
+		p.advance()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &Logical{Op: And, Left: left, Right: right, pos: left.Pos()}
+	}
+	return left, nil
+}
+
+// parseUnary handles: "not" unary | "(" or_expr ")" | comparison
+func (p *parser) parseUnary() (Expr, error) {
+	tok := p.peek()
+	switch {
+	case p.isKeyword(tok, "not"):
+		p.advance()
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &Not{Expr: expr, pos: tok.pos}, nil
+	case tok.kind == tokenLParen:
+		p.advance()
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.advance(); closing.kind != tokenRParen {
+			return nil, p.unexpected(closing, `")"`)
+		}
+		return expr, nil
+	}
+	return p.parseComparison()
+}
+
+// parseComparison handles: field op value | field "in" "(" value ("," value)* ")"
+func (p *parser) parseComparison() (Expr, error) {
+	field := p.advance()
+	if field.kind != tokenIdent || p.isKeyword(field, "and") || p.isKeyword(field, "or") {
+		return nil, p.unexpected(field, "a field name")
+	}
+
+	opTok := p.advance()
+	op, ok := operators[strings.ToLower(opTok.text)]
+	if opTok.kind != tokenIdent || !ok {
+		return nil, p.unexpected(opTok, "an operator (eq, ne, gt, ge, lt, le, co, sw, ew, in)")
+	}
+
+	cmp := &Comparison{Field: field.text, Op: op, pos: field.pos, opPos: opTok.pos}
+
+	if op != In {
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		cmp.Values = []Value{value}
+		return cmp, nil
+	}
+
+	if open := p.advance(); open.kind != tokenLParen {
+		return nil, p.unexpected(open, `"(" to start the list of values`)
+	}
+	for {
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		cmp.Values = append(cmp.Values, value)
+
+		sep := p.advance()
+		if sep.kind == tokenRParen {
+			break
+		}
+		if sep.kind != tokenComma {
+			return nil, p.unexpected(sep, `"," or ")"`)
+		}
+	}
+	return cmp, nil
+}
+
+func (p *parser) parseValue() (Value, error) {
+	tok := p.advance()
+	switch {
+	case tok.kind == tokenString:
+		return Value{Kind: StringValue, Text: tok.value, pos: tok.pos}, nil
+	case tok.kind == tokenNumber:
+		return Value{Kind: NumberValue, Text: tok.value, pos: tok.pos}, nil
+	case p.isKeyword(tok, "null"):
+		return Value{Kind: NullValue, pos: tok.pos}, nil
+	}
+	return Value{}, p.unexpected(tok, "a quoted string, number or null")
+}
@@ -0,0 +1,86 @@
+package filter
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FieldType is the type of a filterable field
+type FieldType int
+
+const (
+	StringField FieldType = iota
+	IntegerField
+)
+
+// Schema lists the fields a filter may reference, keyed by the JSON name
+// clients see in responses. Schemas are written out field by field, so
+// that a field is only filterable once it is listed on purpose.
+type Schema map[string]FieldType
+
+// Fields returns the schema's field names in alphabetical order
+func (s Schema) Fields() []string {
+	fields := make([]string, 0, len(s))
+	for name := range s {
+		fields = append(fields, name)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// Validate checks that every comparison names a known field and that its
+// operator and values suit the field's type
+func Validate(expr Expr, schema Schema) error {
+	switch e := expr.(type) {
+	case *Logical:
+		if err := Validate(e.Left, schema); err != nil {
+			return err
+		}
+		return Validate(e.Right, schema)
+	case *Not:
+		return Validate(e.Expr, schema)
+	case *Comparison:
+		return validateComparison(e, schema)
+	}
+	return &Error{Pos: expr.Pos(), Msg: "unsupported expression"}
+}
+
+func validateComparison(cmp *Comparison, schema Schema) error {
+	fieldType, ok := schema[cmp.Field]
+	if !ok {
+		return &Error{
+			Pos: cmp.pos,
+			Msg: fmt.Sprintf("unknown field %q, expected one of %s", cmp.Field, strings.Join(schema.Fields(), ", ")),
+		}
+	}
+
+	switch cmp.Op {
+	case Contains, StartsWith, EndsWith:
+		if fieldType != StringField {
+			return &Error{Pos: cmp.opPos, Msg: fmt.Sprintf("operator %q only applies to text fields", cmp.Op)}
+		}
+	}
+
+	for _, value := range cmp.Values {
+		switch value.Kind {
+		case NullValue:
+			if cmp.Op != Eq && cmp.Op != Ne {
+				return &Error{Pos: value.pos, Msg: fmt.Sprintf("null can only be compared with eq or ne, not %q", cmp.Op)}
+			}
+		case NumberValue:
+			if fieldType != IntegerField {
+				return &Error{Pos: value.pos, Msg: fmt.Sprintf("field %q expects a quoted string", cmp.Field)}
+			}
+			if _, err := strconv.ParseInt(value.Text, 10, 64); err != nil {
+				return &Error{Pos: value.pos, Msg: fmt.Sprintf("number %s is out of range", value.Text)}
+			}
+		case StringValue:
+			if fieldType != StringField {
+				return &Error{Pos: value.pos, Msg: fmt.Sprintf("field %q expects a number", cmp.Field)}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package model
+
+// Operations a bulk request can apply to a user
+const (
+	BulkCreate = "create"
+	BulkUpdate = "update"
+	BulkDelete = "delete"
+)
+
+// BulkRequest is a batch of user operations, applied in order
+type BulkRequest struct {
+	Items []BulkItem `json:"items"`
+}
+
+// BulkItem is one operation of a bulk request. Creates and updates carry
+// the full user; updates and deletes name the user by UserID, and are only
+// applied to the given Version of it when that is set.
+type BulkItem struct {
+	Op      string `json:"op" enums:"create,update,delete"`
+	UserID  int64  `json:"user_id,omitempty"`
+	Version int64  `json:"version,omitempty"`
+	User    *User  `json:"user,omitempty"`
+}
+
+// BulkResult is the outcome of one bulk item, with the HTTP status the
+// operation would have had on its own. A failed item has the same code and
+// field errors the operation would have had on its own too.
+type BulkResult struct {
+	Index  int          `json:"index"`
+	Op     string       `json:"op"`
+	Status int          `json:"status"`
+	User   *User        `json:"user,omitempty"`
+	Error  string       `json:"error,omitempty"`
+	Code   string       `json:"code,omitempty"`
+	Errors []FieldError `json:"errors,omitempty"`
+}
@@ -0,0 +1,8 @@
+package model
+
+// Department is a department users belong to. Names are unique ignoring
+// case, so that "Engineering" and "engineering" cannot both exist.
+type Department struct {
+	ID   int64  `json:"department_id"`
+	Name string `json:"name" validate:"required,max=255"`
+}
@@ -0,0 +1,16 @@
+package model
+
+// Codes of a FieldError, saying what is wrong with the field
+const (
+	FieldRequired = "required"
+	FieldInvalid  = "invalid"
+	FieldTooLong  = "too_long"
+	FieldReadOnly = "read_only"
+)
+
+// FieldError is what is wrong with one field of the user a client sent
+type FieldError struct {
+	Field  string `json:"field"`
+	Code   string `json:"code" enums:"required,invalid,too_long,read_only"`
+	Detail string `json:"detail"`
+}
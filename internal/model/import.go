@@ -0,0 +1,29 @@
+package model
+
+// ImportUnchanged is the action of an import row that matches the stored
+// user, which is not written again
+const ImportUnchanged = "unchanged"
+
+// ImportReport describes what importing a spreadsheet of users did, or
+// would do on a dry run
+type ImportReport struct {
+	DryRun  bool `json:"dry_run"`
+	Created int  `json:"created"`
+	Updated int  `json:"updated"`
+	// Unchanged counts rows that match the stored user and were skipped
+	Unchanged int         `json:"unchanged"`
+	Failed    int         `json:"failed"`
+	Rows      []ImportRow `json:"rows"`
+}
+
+// ImportRow is the outcome of importing one spreadsheet row, numbered as
+// the spreadsheet numbers it so the header is row 1
+type ImportRow struct {
+	Row    int          `json:"row"`
+	Action string       `json:"action" enums:"create,update,unchanged"`
+	Status int          `json:"status"`
+	User   *User        `json:"user,omitempty"`
+	Error  string       `json:"error,omitempty"`
+	Code   string       `json:"code,omitempty"`
+	Errors []FieldError `json:"errors,omitempty"`
+}
@@ -0,0 +1,10 @@
+package model
+
+// OrgChartEntry places a user in an org chart. Deleted users are left out
+// of charts, so a user whose manager is deleted is placed under the nearest
+// manager above them that is not.
+type OrgChartEntry struct {
+	User User
+	// ParentID is the user the entry is drawn under, or 0 at the top
+	ParentID int64
+}
@@ -0,0 +1,37 @@
+package model
+
+import "time"
+
+// States of a scheduled change. A pending change is applied once it is
+// due, or fails if it no longer applies to the user by then; until it is
+// due it can be cancelled.
+const (
+	ChangePending   = "pending"
+	ChangeApplied   = "applied"
+	ChangeFailed    = "failed"
+	ChangeCancelled = "cancelled"
+)
+
+// ScheduledChange is a change to a user that takes effect at a later time:
+// a transition of its status, a move to another department, or both. The
+// department can be named by department_id or by name, as for users. Only
+// effective_at, transition, the department and reason are read from
+// request bodies; the rest is kept by the service.
+type ScheduledChange struct {
+	ID           int64     `json:"change_id"`
+	UserID       int64     `json:"user_id"`
+	EffectiveAt  time.Time `json:"effective_at"`
+	Transition   string    `json:"transition,omitempty" validate:"oneof=activate deactivate terminate rehire" enums:"activate,deactivate,terminate,rehire"`
+	DepartmentID int64     `json:"department_id,omitempty"`
+	Department   string    `json:"department,omitempty" validate:"max=255"`
+	Reason       string    `json:"reason" validate:"required,max=1000"`
+	Status       string    `json:"status" enums:"pending,applied,failed,cancelled"`
+	// Error is why a failed change could not be applied
+	Error     string     `json:"error,omitempty"`
+	CreatedBy string     `json:"created_by"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	// AppliedAt is when the change was applied or failed
+	AppliedAt   *time.Time `json:"applied_at,omitempty"`
+	CancelledAt *time.Time `json:"cancelled_at,omitempty"`
+	CancelledBy string     `json:"cancelled_by,omitempty"`
+}
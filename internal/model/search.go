@@ -0,0 +1,17 @@
+package model
+
+// UserSearchResult is a user matched by a full-text search, with how well
+// it matched and the matching text marked up with <mark> tags
+type UserSearchResult struct {
+	User       User              `json:"user"`
+	Score      float64           `json:"score"`
+	Snippet    string            `json:"snippet"`
+	Highlights map[string]string `json:"highlights"`
+}
+
+// UserSuggestion is a user offered while typing a name, scored from 0 to 1
+// by how closely it matched what was typed
+type UserSuggestion struct {
+	User  User    `json:"user"`
+	Score float64 `json:"score"`
+}
@@ -0,0 +1,73 @@
+package model
+
+import (
+	"slices"
+	"time"
+)
+
+// Transition is a move of users from some statuses to another. The
+// transitions below are the only way a user's status changes; any other
+// change of user_status is refused.
+type Transition struct {
+	Name string
+	From []string
+	To   string
+	// Plain transitions can also be made by writing user_status, as with
+	// PUT or PATCH; the others only through their own endpoint, which
+	// asks for a reason
+	Plain bool
+}
+
+// Transitions is the lifecycle of a user. Terminating and rehiring change
+// whether someone works for the company, so they need a reason.
+var Transitions = []Transition{
+	{Name: "activate", From: []string{"I"}, To: "A", Plain: true},
+	{Name: "deactivate", From: []string{"A"}, To: "I", Plain: true},
+	{Name: "terminate", From: []string{"A", "I"}, To: "T"},
+	{Name: "rehire", From: []string{"T"}, To: "A"},
+}
+
+// Allows reports whether the transition can be made from a status
+func (t Transition) Allows(from string) bool {
+	return slices.Contains(t.From, from)
+}
+
+// FindTransition looks a transition up by name
+func FindTransition(name string) (Transition, bool) {
+	for _, t := range Transitions {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return Transition{}, false
+}
+
+// TransitionBetween is the transition that moves a user from one status
+// to another, if there is one
+func TransitionBetween(from, to string) (Transition, bool) {
+	for _, t := range Transitions {
+		if t.To == to && t.Allows(from) {
+			return t, true
+		}
+	}
+	return Transition{}, false
+}
+
+// TransitionRequest is the body of a transition endpoint
+type TransitionRequest struct {
+	Reason string `json:"reason" validate:"required,max=1000"`
+}
+
+// StatusTransition records a transition made to a user: which, between
+// which statuses, why and by whom. Transitions made by writing user_status
+// have no reason.
+type StatusTransition struct {
+	ID         int64     `json:"transition_id"`
+	UserID     int64     `json:"user_id"`
+	Transition string    `json:"transition" enums:"activate,deactivate,terminate,rehire"`
+	FromStatus string    `json:"from_status"`
+	ToStatus   string    `json:"to_status"`
+	Reason     string    `json:"reason,omitempty"`
+	Actor      string    `json:"actor"`
+	CreatedAt  time.Time `json:"created_at"`
+}
@@ -1,14 +1,39 @@
 package model
 
-// User represents a user in the system
+import "time"
+
+// User represents a user in the system. The validate tags follow the
+// columns of the users table; user_status is A(ctive), I(nactive) or
+// T(erminated) as in the seed data.
 type User struct {
 	ID       	 int64  `json:"user_id"`
-	UserName     string `json:"user_name"`
-	FirstName    string `json:"first_name"`
-	LastName     string `json:"last_name"`
-	Email        string `json:"email"`
-	UserStatus   string `json:"user_status"`
-	Department   string `json:"department"`
+	UserName     string `json:"user_name" validate:"required,max=50"`
+	FirstName    string `json:"first_name" validate:"required,max=255"`
+	LastName     string `json:"last_name" validate:"required,max=255"`
+	Email        string `json:"email" validate:"required,max=255,email"`
+	UserStatus   string `json:"user_status" validate:"required,oneof=A I T" enums:"A,I,T"`
+	Department   string `json:"department" validate:"max=255"`
+	// DepartmentID is the department the user belongs to, and Department
+	// its name. Either can be sent to move the user; an unknown department
+	// is refused, and an empty one leaves the user without a department.
+	DepartmentID int64  `json:"department_id,omitempty"`
+	// ManagerID is the user this user reports to, if any. A user cannot
+	// report to themselves, to a terminated user or to anyone who reports
+	// to them, directly or not.
+	ManagerID    int64  `json:"manager_id,omitempty"`
+	// Version counts the writes to the user and backs its ETag; it is
+	// read-only and ignored in request bodies
+	Version      int64  `json:"version"`
+	// DeletedAt and DeletedBy are set when the user is soft-deleted
+	DeletedAt    *time.Time `json:"deleted_at,omitempty"`
+	DeletedBy    string     `json:"deleted_by,omitempty"`
+	// CreatedAt and UpdatedAt are when the user was created and last
+	// written; version 1 of the API does not show them
+	CreatedAt    *time.Time `json:"-"`
+	UpdatedAt    *time.Time `json:"-"`
+	// UpdatedBy is who is writing the user, for the status transition the
+	// write may make; it is not stored on the user
+	UpdatedBy    string     `json:"-"`
 }
 
 
@@ -0,0 +1,98 @@
+package model
+
+import "time"
+
+// Names version 2 of the API gives the user statuses stored as A, I and T
+const (
+	StatusActive     = "active"
+	StatusInactive   = "inactive"
+	StatusTerminated = "terminated"
+)
+
+var statusNames = map[string]string{"A": StatusActive, "I": StatusInactive, "T": StatusTerminated}
+
+// StatusName is the name of a stored user status, or the status itself if
+// it has no name
+func StatusName(status string) string {
+	if name, ok := statusNames[status]; ok {
+		return name
+	}
+	return status
+}
+
+// StatusCode is the stored user status a status name stands for
+func StatusCode(name string) (string, bool) {
+	for code, n := range statusNames {
+		if n == name {
+			return code, true
+		}
+	}
+	return "", false
+}
+
+// UserV2 is a user as version 2 of the API shows it: the status is named
+// rather than coded, and the user carries when it was created and last
+// written. The timestamps are read-only and ignored in request bodies.
+type UserV2 struct {
+	ID         int64  `json:"user_id"`
+	UserName   string `json:"user_name" validate:"required,max=50"`
+	FirstName  string `json:"first_name" validate:"required,max=255"`
+	LastName   string `json:"last_name" validate:"required,max=255"`
+	Email      string `json:"email" validate:"required,max=255,email"`
+	UserStatus string `json:"user_status" validate:"required,oneof=active inactive terminated" enums:"active,inactive,terminated"`
+	Department string `json:"department" validate:"max=255"`
+	// DepartmentID is the department the user belongs to, as in version 1
+	DepartmentID int64 `json:"department_id,omitempty"`
+	// ManagerID is the user this user reports to, as in version 1
+	ManagerID int64      `json:"manager_id,omitempty"`
+	Version   int64      `json:"version"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	DeletedBy string     `json:"deleted_by,omitempty"`
+}
+
+// NewUserV2 shows a user as version 2 of the API does
+func NewUserV2(user User) UserV2 {
+	return UserV2{
+		ID:           user.ID,
+		UserName:     user.UserName,
+		FirstName:    user.FirstName,
+		LastName:     user.LastName,
+		Email:        user.Email,
+		UserStatus:   StatusName(user.UserStatus),
+		Department:   user.Department,
+		DepartmentID: user.DepartmentID,
+		ManagerID:    user.ManagerID,
+		Version:      user.Version,
+		CreatedAt:    user.CreatedAt,
+		UpdatedAt:    user.UpdatedAt,
+		DeletedAt:    user.DeletedAt,
+		DeletedBy:    user.DeletedBy,
+	}
+}
+
+// User converts a user of version 2 back. A status without a name is kept
+// as it is, for validation to refuse.
+func (u UserV2) User() User {
+	status, ok := StatusCode(u.UserStatus)
+	if !ok {
+		status = u.UserStatus
+	}
+	return User{
+		ID:           u.ID,
+		UserName:     u.UserName,
+		FirstName:    u.FirstName,
+		LastName:     u.LastName,
+		Email:        u.Email,
+		UserStatus:   status,
+		Department:   u.Department,
+		DepartmentID: u.DepartmentID,
+		ManagerID:    u.ManagerID,
+		Version:      u.Version,
+		CreatedAt:    u.CreatedAt,
+		UpdatedAt:    u.UpdatedAt,
+		DeletedAt:    u.DeletedAt,
+		DeletedBy:    u.DeletedBy,
+	}
+}
@@ -0,0 +1,44 @@
+package orgchart
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// dotEscaper escapes text for a double-quoted DOT string. Line breaks in
+// names would end the label line, so they become spaces.
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\r\n", " ", "\n", " ", "\r", " ")
+
+// WriteDOT writes the trees as a Graphviz digraph, with an edge from every
+// manager to each of their reports
+func WriteDOT(w io.Writer, roots []*Node) error {
+	var b strings.Builder
+	b.WriteString("digraph orgchart {\n")
+	b.WriteString("\trankdir=TB;\n")
+	b.WriteString("\tnode [shape=box, style=\"rounded,filled\", fillcolor=\"#ffffff\", color=\"#333333\", fontname=\"Helvetica\"];\n")
+	b.WriteString("\tedge [arrowhead=none, color=\"#666666\"];\n")
+
+	var edges []string
+	walk(roots, 0, func(node *Node, _ int) {
+		lines := node.lines()
+		for i, line := range lines {
+			lines[i] = dotEscaper.Replace(line)
+		}
+		fmt.Fprintf(&b, "\tu%d [label=\"%s\"", node.ID, strings.Join(lines, `\n`))
+		if node.terminated() {
+			b.WriteString(", style=\"rounded,filled,dashed\", fillcolor=\"#eeeeee\", color=\"#999999\", fontcolor=\"#888888\"")
+		}
+		b.WriteString("];\n")
+		for _, report := range node.Reports {
+			edges = append(edges, fmt.Sprintf("\tu%d -> u%d;\n", node.ID, report.ID))
+		}
+	})
+	for _, edge := range edges {
+		b.WriteString(edge)
+	}
+
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
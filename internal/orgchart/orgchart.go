@@ -0,0 +1,105 @@
+// Package orgchart draws reporting lines as org charts: Graphviz DOT for
+// tools that lay graphs out themselves, SVG laid out here for printing, and
+// nested nodes for JSON. Everything is written in Go; no Graphviz binary is
+// needed. Terminated users are drawn greyed out with a dashed border.
+package orgchart
+
+import (
+	"fmt"
+	"sample-service/internal/model"
+	"strings"
+)
+
+// Format is an org chart format
+type Format string
+
+// Supported formats
+const (
+	JSON Format = "json"
+	DOT  Format = "dot"
+	SVG  Format = "svg"
+)
+
+// ParseFormat parses a format name such as "svg" or "DOT"
+func ParseFormat(name string) (Format, error) {
+	switch Format(strings.ToLower(strings.TrimSpace(name))) {
+	case JSON:
+		return JSON, nil
+	case DOT:
+		return DOT, nil
+	case SVG:
+		return SVG, nil
+	}
+	return "", fmt.Errorf("unsupported format %q: must be json, dot or svg", name)
+}
+
+// ContentType is the media type of charts in the format
+func (f Format) ContentType() string {
+	switch f {
+	case DOT:
+		return "text/vnd.graphviz; charset=utf-8"
+	case SVG:
+		return "image/svg+xml"
+	}
+	return "application/json"
+}
+
+// Node is a user in an org chart with the users who report to them
+type Node struct {
+	ID         int64   `json:"user_id"`
+	UserName   string  `json:"user_name"`
+	FirstName  string  `json:"first_name"`
+	LastName   string  `json:"last_name"`
+	Department string  `json:"department,omitempty"`
+	UserStatus string  `json:"user_status"`
+	Reports    []*Node `json:"reports"`
+}
+
+// Build links chart entries into trees and returns their tops. Entries must
+// come after the one they are drawn under; an entry whose parent is not
+// among them is a top.
+func Build(entries []model.OrgChartEntry) []*Node {
+	nodes := map[int64]*Node{}
+	roots := []*Node{}
+	for _, entry := range entries {
+		user := entry.User
+		node := &Node{
+			ID:         user.ID,
+			UserName:   user.UserName,
+			FirstName:  user.FirstName,
+			LastName:   user.LastName,
+			Department: user.Department,
+			UserStatus: user.UserStatus,
+			Reports:    []*Node{},
+		}
+		nodes[user.ID] = node
+		if parent, ok := nodes[entry.ParentID]; ok {
+			parent.Reports = append(parent.Reports, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+	return roots
+}
+
+// terminated reports whether a node is drawn as a terminated user
+func (n *Node) terminated() bool {
+	return n.UserStatus == "T"
+}
+
+// lines are the lines of text a node is labelled with
+func (n *Node) lines() []string {
+	lines := []string{strings.TrimSpace(n.FirstName + " " + n.LastName)}
+	if n.Department != "" {
+		lines = append(lines, n.Department)
+	}
+	return append(lines, model.StatusName(n.UserStatus))
+}
+
+// walk calls fn for every node of the trees, parents before their reports
+func walk(roots []*Node, depth int, fn func(node *Node, depth int)) {
+	for _, node := range roots {
+		fn(node, depth)
+		walk(node.Reports, depth+1, fn)
+	}
+}
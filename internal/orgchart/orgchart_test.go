@@ -0,0 +1,86 @@
+package orgchart_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"sample-service/internal/model"
+	"sample-service/internal/orgchart"
+	"strings"
+	"testing"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+func TestOrgChart(t *testing.T) {
+	gomega.RegisterFailHandler(ginkgo.Fail)
+	ginkgo.RunSpecs(t, "Org Chart Suite")
+}
+
+var entries = []model.OrgChartEntry{
+	{User: model.User{ID: 1, UserName: "ceo", FirstName: "Ada", LastName: `"The Boss"`, Department: "Board", UserStatus: "A"}},
+	{User: model.User{ID: 2, UserName: "cto", FirstName: "Bob", LastName: "Builder & Sons", Department: "Engineering", UserStatus: "A"}, ParentID: 1},
+	{User: model.User{ID: 3, UserName: "cfo", FirstName: "Cy", LastName: "Counter", UserStatus: "T"}, ParentID: 1},
+	{User: model.User{ID: 4, UserName: "dev", FirstName: "Dee", LastName: "Developer-With-A-Very-Long-Name", UserStatus: "I"}, ParentID: 2},
+}
+
+var _ = ginkgo.Describe("Org chart", func() {
+	ginkgo.It("should nest entries under their parents", func() {
+		roots := orgchart.Build(entries)
+
+		gomega.Expect(roots).To(gomega.HaveLen(1))
+		gomega.Expect(roots[0].Reports).To(gomega.HaveLen(2))
+		gomega.Expect(roots[0].Reports[0].Reports[0].UserName).To(gomega.Equal("dev"))
+		gomega.Expect(roots[0].Reports[1].Reports).To(gomega.BeEmpty())
+	})
+
+	ginkgo.It("should make an entry whose parent is missing a top", func() {
+		roots := orgchart.Build(entries[2:])
+
+		gomega.Expect(roots).To(gomega.HaveLen(2))
+		gomega.Expect(roots[1].UserName).To(gomega.Equal("dev"))
+	})
+
+	ginkgo.It("should write a digraph with escaped labels and terminated users dashed", func() {
+		var buf bytes.Buffer
+		gomega.Expect(orgchart.WriteDOT(&buf, orgchart.Build(entries))).To(gomega.Succeed())
+
+		dot := buf.String()
+		gomega.Expect(dot).To(gomega.HavePrefix("digraph orgchart {\n"))
+		gomega.Expect(dot).To(gomega.ContainSubstring(`u1 [label="Ada \"The Boss\"\nBoard\nactive"];`))
+		gomega.Expect(dot).To(gomega.ContainSubstring(`u3 [label="Cy Counter\nterminated", style="rounded,filled,dashed"`))
+		gomega.Expect(dot).To(gomega.ContainSubstring("u1 -> u2;\n\tu1 -> u3;\n\tu2 -> u4;\n}"))
+	})
+
+	ginkgo.It("should write a well-formed SVG image with terminated users dashed", func() {
+		var buf bytes.Buffer
+		gomega.Expect(orgchart.WriteSVG(&buf, orgchart.Build(entries))).To(gomega.Succeed())
+
+		decoder := xml.NewDecoder(bytes.NewReader(buf.Bytes()))
+		for {
+			_, err := decoder.Token()
+			if err == io.EOF {
+				break
+			}
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		}
+
+		svg := buf.String()
+		gomega.Expect(svg).To(gomega.ContainSubstring("Bob Builder &amp; Sons"))
+		gomega.Expect(svg).To(gomega.ContainSubstring("Dee Developer-With-A-Very-L…"))
+		gomega.Expect(strings.Count(svg, "<path ")).To(gomega.Equal(3))
+		gomega.Expect(strings.Count(svg, `stroke-dasharray`)).To(gomega.Equal(1))
+		gomega.Expect(svg).To(gomega.MatchRegexp(`<g id="user-3">\n<rect [^>]*stroke-dasharray`))
+	})
+
+	ginkgo.It("should tell formats apart by name", func() {
+		format, err := orgchart.ParseFormat(" SVG ")
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(format).To(gomega.Equal(orgchart.SVG))
+		gomega.Expect(format.ContentType()).To(gomega.Equal("image/svg+xml"))
+
+		_, err = orgchart.ParseFormat("png")
+		gomega.Expect(err).To(gomega.MatchError(gomega.ContainSubstring("unsupported format")))
+	})
+})
@@ -0,0 +1,118 @@
+package orgchart
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"strings"
+)
+
+// Layout of SVG charts, in pixels. Every box has the same size, so long
+// names and departments are cut short to fit.
+const (
+	boxWidth   = 200
+	boxHeight  = 64
+	gapX       = 24
+	gapY       = 48
+	margin     = 20
+	lineHeight = 16
+	fontSize   = 12
+	maxChars   = 28
+)
+
+// point is the top left corner of a box
+type point struct {
+	x, y int
+}
+
+// layout places every box: each level of the hierarchy is a row, leaves
+// are set side by side from the left, and a manager is centred above their
+// reports. Subtrees never share columns, so boxes cannot overlap.
+func layout(roots []*Node) (map[*Node]point, int, int) {
+	positions := map[*Node]point{}
+	next, depth := 0, 0
+
+	var place func(node *Node, level int) int
+	place = func(node *Node, level int) int {
+		depth = max(depth, level)
+		var x int
+		if len(node.Reports) == 0 {
+			x = next
+			next += boxWidth + gapX
+		} else {
+			first := place(node.Reports[0], level+1)
+			last := first
+			for _, report := range node.Reports[1:] {
+				last = place(report, level+1)
+			}
+			x = (first + last) / 2
+		}
+		positions[node] = point{margin + x, margin + level*(boxHeight+gapY)}
+		return x
+	}
+	for _, root := range roots {
+		place(root, 0)
+	}
+
+	if len(roots) == 0 {
+		return positions, 2 * margin, 2 * margin
+	}
+	return positions, next - gapX + 2*margin, (depth+1)*boxHeight + depth*gapY + 2*margin
+}
+
+// truncate cuts text longer than maxChars short with an ellipsis
+func truncate(text string) string {
+	runes := []rune(text)
+	if len(runes) <= maxChars {
+		return text
+	}
+	return string(runes[:maxChars-1]) + "…"
+}
+
+// WriteSVG lays the trees out top down and writes them as an SVG image,
+// with lines from every manager to each of their reports
+func WriteSVG(w io.Writer, roots []*Node) error {
+	positions, width, height := layout(roots)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="Helvetica, Arial, sans-serif" font-size="%d">`+"\n",
+		width, height, width, height, fontSize)
+	b.WriteString(`<rect width="100%" height="100%" fill="#ffffff"/>` + "\n")
+
+	// Lines go first so that boxes are drawn over them
+	walk(roots, 0, func(node *Node, _ int) {
+		from := positions[node]
+		for _, report := range node.Reports {
+			to := positions[report]
+			fmt.Fprintf(&b, `<path d="M%d %d V%d H%d V%d" fill="none" stroke="#666666"/>`+"\n",
+				from.x+boxWidth/2, from.y+boxHeight, from.y+boxHeight+gapY/2, to.x+boxWidth/2, to.y)
+		}
+	})
+
+	walk(roots, 0, func(node *Node, _ int) {
+		at := positions[node]
+		fill, stroke, text, dash := "#ffffff", "#333333", "#000000", ""
+		if node.terminated() {
+			fill, stroke, text, dash = "#eeeeee", "#999999", "#888888", ` stroke-dasharray="4 3"`
+		}
+		fmt.Fprintf(&b, `<g id="user-%d">`+"\n", node.ID)
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d" rx="6" fill="%s" stroke="%s"%s/>`+"\n",
+			at.x, at.y, boxWidth, boxHeight, fill, stroke, dash)
+
+		lines := node.lines()
+		top := at.y + (boxHeight-len(lines)*lineHeight)/2 + lineHeight - 4
+		for i, line := range lines {
+			weight := ""
+			if i == 0 {
+				weight = ` font-weight="bold"`
+			}
+			fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="middle" fill="%s"%s>%s</text>`+"\n",
+				at.x+boxWidth/2, top+i*lineHeight, text, weight, html.EscapeString(truncate(line)))
+		}
+		b.WriteString("</g>\n")
+	})
+
+	b.WriteString("</svg>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,352 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// ErrTestFailed is wrapped by the Error returned when a test operation does
+// not match the document
+var ErrTestFailed = errors.New("test failed")
+
+// Error describes which operation of a JSON Patch could not be applied
+type Error struct {
+	Index int
+	Op    string
+	Err   error
+}
+
+func (e *Error) Error() string {
+	if e.Op == "" {
+		return fmt.Sprintf("operation %d: %v", e.Index, e.Err)
+	}
+	return fmt.Sprintf("operation %d (%s): %v", e.Index, e.Op, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// operation is a single JSON Patch operation. Value is kept raw so that an
+// explicit null can be told apart from a missing value.
+type operation struct {
+	Op    string
+	Path  string
+	From  string
+	Value json.RawMessage
+}
+
+// ApplyJSONPatch applies an RFC 6902 JSON Patch to doc. The operations are
+// applied in order and the patch is atomic: if any operation fails,
+// including a test, an *Error is returned and no result is produced.
+func ApplyJSONPatch(doc, patch []byte) ([]byte, error) {
+	target, err := decode(doc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid document: %w", err)
+	}
+
+	var raw []map[string]json.RawMessage
+	if err := json.Unmarshal(patch, &raw); err != nil {
+		return nil, fmt.Errorf("invalid JSON patch: must be an array of operations: %w", err)
+	}
+
+	for i, fields := range raw {
+		op, err := parseOperation(fields)
+		if err != nil {
+			return nil, &Error{Index: i, Op: op.Op, Err: err}
+		}
+		if target, err = apply(target, op); err != nil {
+			return nil, &Error{Index: i, Op: op.Op, Err: err}
+		}
+	}
+	return json.Marshal(target)
+}
+
+func parseOperation(fields map[string]json.RawMessage) (operation, error) {
+	var op operation
+	member := func(name string, dest *string, required bool) error {
+		raw, ok := fields[name]
+		if !ok {
+			if required {
+				return fmt.Errorf("missing %q", name)
+			}
+			return nil
+		}
+		if err := json.Unmarshal(raw, dest); err != nil {
+			return fmt.Errorf("%q must be a string", name)
+		}
+		return nil
+	}
+
+	if err := member("op", &op.Op, true); err != nil {
+		return op, err
+	}
+	if err := member("path", &op.Path, true); err != nil {
+		return op, err
+	}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		value, ok := fields["value"]
+		if !ok {
+			return op, fmt.Errorf("missing %q", "value")
+		}
+		op.Value = value
+	case "move", "copy":
+		if err := member("from", &op.From, true); err != nil {
+			return op, err
+		}
+	case "remove":
+	default:
+		return op, fmt.Errorf("unknown operation %q", op.Op)
+	}
+	return op, nil
+}
+
+func apply(doc interface{}, op operation) (interface{}, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add":
+		value, err := decode(op.Value)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, value)
+
+	case "remove":
+		if len(path) == 0 {
+			return nil, fmt.Errorf("cannot remove the whole document")
+		}
+		doc, _, err := remove(doc, path)
+		return doc, err
+
+	case "replace":
+		value, err := decode(op.Value)
+		if err != nil {
+			return nil, err
+		}
+		if len(path) == 0 {
+			return value, nil
+		}
+		if doc, _, err = remove(doc, path); err != nil {
+			return nil, err
+		}
+		return add(doc, path, value)
+
+	case "move":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		if isPrefix(from, path) {
+			return nil, fmt.Errorf("cannot move %q into one of its own children", op.From)
+		}
+		if len(from) == 0 {
+			return doc, nil
+		}
+		doc, value, err := remove(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, value)
+
+	case "copy":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		value, err := get(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, deepCopy(value))
+
+	case "test":
+		expected, err := decode(op.Value)
+		if err != nil {
+			return nil, err
+		}
+		actual, err := get(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !equal(actual, expected) {
+			return nil, fmt.Errorf("%w: value at %q does not match", ErrTestFailed, op.Path)
+		}
+		return doc, nil
+	}
+	return nil, fmt.Errorf("unknown operation %q", op.Op)
+}
+
+// get returns the value the path refers to
+func get(node interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch n := node.(type) {
+		case map[string]interface{}:
+			child, ok := n[token]
+			if !ok {
+				return nil, fmt.Errorf("member %q not found", token)
+			}
+			node = child
+		case []interface{}:
+			index, err := arrayIndex(token, len(n), false)
+			if err != nil {
+				return nil, err
+			}
+			node = n[index]
+		default:
+			return nil, fmt.Errorf("cannot look up %q in a scalar value", token)
+		}
+	}
+	return node, nil
+}
+
+// add sets the value at path, inserting into arrays, and returns the
+// updated node. Every parent along the path must already exist.
+func add(node interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	token, last := path[0], len(path) == 1
+
+	switch n := node.(type) {
+	case map[string]interface{}:
+		if last {
+			n[token] = value
+			return n, nil
+		}
+		child, ok := n[token]
+		if !ok {
+			return nil, fmt.Errorf("member %q not found", token)
+		}
+		child, err := add(child, path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		n[token] = child
+		return n, nil
+
+	case []interface{}:
+		index, err := arrayIndex(token, len(n), last)
+		if err != nil {
+			return nil, err
+		}
+		if last {
+			n = append(n, nil)
+			copy(n[index+1:], n[index:])
+			n[index] = value
+			return n, nil
+		}
+		if n[index], err = add(n[index], path[1:], value); err != nil {
+			return nil, err
+		}
+		return n, nil
+	}
+	return nil, fmt.Errorf("cannot add %q to a scalar value", token)
+}
+
+// remove deletes the value at path, returning the updated node and the
+// removed value
+func remove(node interface{}, path []string) (interface{}, interface{}, error) {
+	token, last := path[0], len(path) == 1
+
+	switch n := node.(type) {
+	case map[string]interface{}:
+		child, ok := n[token]
+		if !ok {
+			return nil, nil, fmt.Errorf("member %q not found", token)
+		}
+		if last {
+			delete(n, token)
+			return n, child, nil
+		}
+		child, removed, err := remove(child, path[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		n[token] = child
+		return n, removed, nil
+
+	case []interface{}:
+		index, err := arrayIndex(token, len(n), false)
+		if err != nil {
+			return nil, nil, err
+		}
+		if last {
+			removed := n[index]
+			return append(n[:index], n[index+1:]...), removed, nil
+		}
+		child, removed, err := remove(n[index], path[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		n[index] = child
+		return n, removed, nil
+	}
+	return nil, nil, fmt.Errorf("cannot remove %q from a scalar value", token)
+}
+
+// deepCopy copies a decoded JSON value so that a copied value and its
+// source can be changed independently
+func deepCopy(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		object := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			object[key] = deepCopy(child)
+		}
+		return object
+	case []interface{}:
+		array := make([]interface{}, len(v))
+		for i, child := range v {
+			array[i] = deepCopy(child)
+		}
+		return array
+	}
+	return value
+}
+
+// equal compares decoded JSON values as RFC 6902 defines for test: numbers
+// by value, objects regardless of member order, arrays element by element
+func equal(a, b interface{}) bool {
+	switch x := a.(type) {
+	case map[string]interface{}:
+		y, ok := b.(map[string]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for key, value := range x {
+			other, ok := y[key]
+			if !ok || !equal(value, other) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		y, ok := b.([]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !equal(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	case json.Number:
+		y, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		m, okX := new(big.Float).SetString(x.String())
+		n, okY := new(big.Float).SetString(y.String())
+		return okX && okY && m.Cmp(n) == 0
+	}
+	return a == b
+}
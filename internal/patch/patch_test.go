@@ -0,0 +1,136 @@
+package patch_test
+
+import (
+	"errors"
+	"sample-service/internal/patch"
+	"testing"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+func TestPatch(t *testing.T) {
+	gomega.RegisterFailHandler(ginkgo.Fail)
+	ginkgo.RunSpecs(t, "Patch Suite")
+}
+
+var _ = ginkgo.Describe("MergePatch", func() {
+	// The examples from RFC 7396, appendix A
+	ginkgo.DescribeTable("should merge as RFC 7396 specifies",
+		func(doc, mergePatch, expected string) {
+			result, err := patch.MergePatch([]byte(doc), []byte(mergePatch))
+
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(result).To(gomega.MatchJSON(expected))
+		},
+		ginkgo.Entry("replace a member", `{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`),
+		ginkgo.Entry("add a member", `{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`),
+		ginkgo.Entry("remove a member", `{"a":"b"}`, `{"a":null}`, `{}`),
+		ginkgo.Entry("remove one of several members", `{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`),
+		ginkgo.Entry("replace an array", `{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`),
+		ginkgo.Entry("replace with an array", `{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`),
+		ginkgo.Entry("merge nested objects", `{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`),
+		ginkgo.Entry("replace arrays wholesale", `{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`),
+		ginkgo.Entry("replace a scalar document", `["a","b"]`, `["c","d"]`, `["c","d"]`),
+		ginkgo.Entry("replace an object with an array", `{"a":"b"}`, `["c"]`, `["c"]`),
+		ginkgo.Entry("replace a document with null", `{"a":"foo"}`, `null`, `null`),
+		ginkgo.Entry("replace a document with a string", `{"a":"foo"}`, `"bar"`, `"bar"`),
+		ginkgo.Entry("keep explicit nulls out", `{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`),
+		ginkgo.Entry("create objects on demand", `{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`),
+	)
+
+	ginkgo.It("should keep large numbers exact", func() {
+		result, err := patch.MergePatch([]byte(`{"id":9007199254740993}`), []byte(`{"a":1}`))
+
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(string(result)).To(gomega.Equal(`{"a":1,"id":9007199254740993}`))
+	})
+
+	ginkgo.It("should reject a malformed patch", func() {
+		_, err := patch.MergePatch([]byte(`{}`), []byte(`{"a":`))
+
+		gomega.Expect(err).To(gomega.MatchError(gomega.HavePrefix("invalid merge patch")))
+	})
+})
+
+var _ = ginkgo.Describe("ApplyJSONPatch", func() {
+	// Mostly the examples from RFC 6902, appendix A
+	ginkgo.DescribeTable("should apply operations as RFC 6902 specifies",
+		func(doc, jsonPatch, expected string) {
+			result, err := patch.ApplyJSONPatch([]byte(doc), []byte(jsonPatch))
+
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(result).To(gomega.MatchJSON(expected))
+		},
+		ginkgo.Entry("add an object member",
+			`{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`),
+		ginkgo.Entry("add an array element",
+			`{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`),
+		ginkgo.Entry("append to an array",
+			`{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`, `{"foo":["bar",["abc","def"]]}`),
+		ginkgo.Entry("remove an object member",
+			`{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`),
+		ginkgo.Entry("remove an array element",
+			`{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`),
+		ginkgo.Entry("replace a value",
+			`{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`),
+		ginkgo.Entry("move a value",
+			`{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`,
+			`[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`,
+			`{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`),
+		ginkgo.Entry("move an array element",
+			`{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`,
+			`{"foo":["all","cows","eat","grass"]}`),
+		ginkgo.Entry("copy a value independently",
+			`{"a":{"b":1}}`, `[{"op":"copy","from":"/a","path":"/c"},{"op":"replace","path":"/c/b","value":2}]`,
+			`{"a":{"b":1},"c":{"b":2}}`),
+		ginkgo.Entry("test before changing",
+			`{"baz":"qux","foo":["a",2,"c"]}`,
+			`[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2.0},{"op":"remove","path":"/baz"}]`,
+			`{"foo":["a",2,"c"]}`),
+		ginkgo.Entry("test for an explicit null",
+			`{"a":null}`, `[{"op":"test","path":"/a","value":null}]`, `{"a":null}`),
+		ginkgo.Entry("escape ~ and / in member names",
+			`{"/":9,"~1":10}`, `[{"op":"test","path":"/~01","value":10},{"op":"replace","path":"/~1","value":1}]`,
+			`{"/":1,"~1":10}`),
+		ginkgo.Entry("replace the whole document",
+			`{"a":1}`, `[{"op":"replace","path":"","value":{"b":2}}]`, `{"b":2}`),
+	)
+
+	ginkgo.It("should fail a test against a different value", func() {
+		_, err := patch.ApplyJSONPatch([]byte(`{"baz":"qux"}`), []byte(`[{"op":"test","path":"/baz","value":"bar"}]`))
+
+		gomega.Expect(errors.Is(err, patch.ErrTestFailed)).To(gomega.BeTrue())
+		gomega.Expect(err.Error()).To(gomega.Equal(`operation 0 (test): test failed: value at "/baz" does not match`))
+	})
+
+	ginkgo.DescribeTable("should reject operations that cannot be applied",
+		func(jsonPatch, message string) {
+			_, err := patch.ApplyJSONPatch([]byte(`{"foo":"bar","list":[1]}`), []byte(jsonPatch))
+
+			var patchErr *patch.Error
+			gomega.Expect(errors.As(err, &patchErr)).To(gomega.BeTrue())
+			gomega.Expect(err.Error()).To(gomega.Equal(message))
+		},
+		ginkgo.Entry("add to a missing parent",
+			`[{"op":"add","path":"/baz/bat","value":"qux"}]`, `operation 0 (add): member "baz" not found`),
+		ginkgo.Entry("remove a missing member",
+			`[{"op":"test","path":"/foo","value":"bar"},{"op":"remove","path":"/baz"}]`, `operation 1 (remove): member "baz" not found`),
+		ginkgo.Entry("index past the end",
+			`[{"op":"add","path":"/list/2","value":2}]`, `operation 0 (add): array index 2 out of bounds`),
+		ginkgo.Entry("index with a leading zero",
+			`[{"op":"replace","path":"/list/01","value":2}]`, `operation 0 (replace): invalid array index "01"`),
+		ginkgo.Entry("missing value",
+			`[{"op":"add","path":"/baz"}]`, `operation 0 (add): missing "value"`),
+		ginkgo.Entry("unknown operation",
+			`[{"op":"merge","path":"/baz"}]`, `operation 0 (merge): unknown operation "merge"`),
+		ginkgo.Entry("move into a child",
+			`[{"op":"move","from":"/list","path":"/list/0"}]`, `operation 0 (move): cannot move "/list" into one of its own children`),
+	)
+
+	ginkgo.It("should reject a patch that is not an array", func() {
+		_, err := patch.ApplyJSONPatch([]byte(`{}`), []byte(`{"op":"add"}`))
+
+		gomega.Expect(err).To(gomega.MatchError(gomega.HavePrefix("invalid JSON patch")))
+	})
+})
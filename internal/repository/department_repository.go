@@ -0,0 +1,217 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"sample-service/internal/model"
+	"strings"
+	"time"
+)
+
+// DepartmentRepository stores the departments users belong to
+type DepartmentRepository interface {
+	ListDepartments() ([]model.Department, error)
+	GetDepartmentByID(id int) (*model.Department, error)
+	CreateDepartment(department model.Department) (*model.Department, error)
+	UpdateDepartment(department model.Department) (*model.Department, error)
+	DeleteDepartment(id int, reassignTo int) (bool, error)
+}
+
+type departmentRepo struct {
+	db *sql.DB
+	// suggestions is the suggestion index of the user repository, which
+	// holds the department names of users
+	suggestions *suggestionIndex
+}
+
+// NewDepartmentRepository creates a new DepartmentRepository. users is the
+// repository of the users in the same database, whose cached copies of
+// department names are refreshed when departments are renamed or merged.
+func NewDepartmentRepository(db *sql.DB, users UserRepository) DepartmentRepository {
+	repo := &departmentRepo{db: db, suggestions: newSuggestionIndex()}
+	if u, ok := users.(*userRepo); ok {
+		repo.suggestions = u.suggestions
+	}
+	return repo
+}
+
+// findDepartment reads the department matching a condition on a single
+// value, returning sql.ErrNoRows if there is none
+func findDepartment(db dbtx, condition string, value interface{}) (*model.Department, error) {
+	var department model.Department
+	err := db.QueryRow("SELECT department_id, name FROM departments WHERE "+condition, value).Scan(&department.ID, &department.Name)
+	if err != nil {
+		return nil, err
+	}
+	return &department, nil
+}
+
+// departmentTaken is the error for a name held by another department
+func departmentTaken(name string) error {
+	return &Error{Kind: ErrConflict, Code: CodeDepartmentTaken, Err: fmt.Errorf("department '%s' already exists", name)}
+}
+
+// ListDepartments retrieves every department, ordered by name
+func (r *departmentRepo) ListDepartments() ([]model.Department, error) {
+	rows, err := r.db.Query("SELECT department_id, name FROM departments ORDER BY name COLLATE UNICODE_NOCASE")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	departments := []model.Department{}
+	for rows.Next() {
+		var department model.Department
+		if err := rows.Scan(&department.ID, &department.Name); err != nil {
+			return nil, err
+		}
+		departments = append(departments, department)
+	}
+	return departments, rows.Err()
+}
+
+// GetDepartmentByID retrieves a department by its ID
+func (r *departmentRepo) GetDepartmentByID(id int) (*model.Department, error) {
+	department, err := findDepartment(r.db, "department_id = ?", id)
+	if err == sql.ErrNoRows {
+		return nil, Errorf(ErrNotFound, "no department found with ID %d", id)
+	}
+	return department, err
+}
+
+// CreateDepartment creates a department. Its name must not be taken by
+// another department in any case.
+func (r *departmentRepo) CreateDepartment(department model.Department) (*model.Department, error) {
+	department.Name = strings.TrimSpace(department.Name)
+	if _, err := findDepartment(r.db, "name = ?", department.Name); err != sql.ErrNoRows {
+		if err != nil {
+			return nil, err
+		}
+		return nil, departmentTaken(department.Name)
+	}
+
+	result, err := r.db.Exec("INSERT INTO departments (name) VALUES (?)", department.Name)
+	if err != nil {
+		return nil, constraintError(err)
+	}
+	department.ID, err = result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return &department, nil
+}
+
+// UpdateDepartment renames a department, and its users with it. Each of
+// its users gets a new version, as the department they show has changed.
+func (r *departmentRepo) UpdateDepartment(department model.Department) (*model.Department, error) {
+	department.Name = strings.TrimSpace(department.Name)
+	err := r.inTransaction(func(tx *sql.Tx) error {
+		if _, err := findDepartment(tx, "department_id = ?", department.ID); err == sql.ErrNoRows {
+			return Errorf(ErrNotFound, "no department found with ID %d", department.ID)
+		} else if err != nil {
+			return err
+		}
+
+		var taken int
+		err := tx.QueryRow("SELECT COUNT(*) FROM departments WHERE name = ? AND department_id != ?", department.Name, department.ID).Scan(&taken)
+		if err != nil {
+			return err
+		}
+		if taken > 0 {
+			return departmentTaken(department.Name)
+		}
+
+		if _, err := tx.Exec("UPDATE departments SET name = ? WHERE department_id = ?", department.Name, department.ID); err != nil {
+			return constraintError(err)
+		}
+		return moveUsers(tx, department.ID, department)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	r.suggestions.reset()
+	return &department, nil
+}
+
+// DeleteDepartment deletes a department. A department that still has
+// users, deleted ones included, is only deleted if reassignTo names the
+// department to move them to; otherwise it fails with a conflict, as it
+// does for a department users are scheduled to move to. It returns false
+// if there is no such department.
+func (r *departmentRepo) DeleteDepartment(id int, reassignTo int) (bool, error) {
+	found := true
+	err := r.inTransaction(func(tx *sql.Tx) error {
+		if _, err := findDepartment(tx, "department_id = ?", id); err == sql.ErrNoRows {
+			found = false
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		var scheduled int
+		err := tx.QueryRow("SELECT COUNT(*) FROM scheduled_changes WHERE department_id = ? AND status = ?", id, model.ChangePending).Scan(&scheduled)
+		if err != nil {
+			return err
+		}
+		if scheduled > 0 {
+			return &Error{Kind: ErrConflict, Code: CodeDepartmentInUse,
+				Err: fmt.Errorf("department %d has %d scheduled changes moving users into it; cancel them first", id, scheduled)}
+		}
+
+		var members int
+		if err := tx.QueryRow("SELECT COUNT(*) FROM users WHERE department_id = ?", id).Scan(&members); err != nil {
+			return err
+		}
+		if members > 0 {
+			if reassignTo == 0 {
+				return &Error{Kind: ErrConflict, Code: CodeDepartmentInUse,
+					Err: fmt.Errorf("department %d still has %d users; reassign them to another department first", id, members)}
+			}
+			if reassignTo == id {
+				return FieldErrorf("reassign_to", model.FieldInvalid, "users cannot be reassigned to the department being deleted")
+			}
+			target, err := findDepartment(tx, "department_id = ?", reassignTo)
+			if err == sql.ErrNoRows {
+				return FieldErrorf("reassign_to", model.FieldInvalid, "no department found with ID %d", reassignTo)
+			}
+			if err != nil {
+				return err
+			}
+			if err := moveUsers(tx, int64(id), *target); err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.Exec("DELETE FROM departments WHERE department_id = ?", id)
+		return constraintError(err)
+	})
+	if err != nil || !found {
+		return false, err
+	}
+
+	r.suggestions.reset()
+	return true, nil
+}
+
+// moveUsers puts every user of a department into another, or renames them
+// along with their department when it is the same one, bumping their
+// versions
+func moveUsers(tx *sql.Tx, from int64, to model.Department) error {
+	_, err := tx.Exec("UPDATE users SET department_id = ?, department = ?, updated_at = ?, version = version + 1 WHERE department_id = ?",
+		to.ID, to.Name, time.Now().UTC(), from)
+	return err
+}
+
+// inTransaction runs fn in a transaction, committing if it returns nil
+func (r *departmentRepo) inTransaction(fn func(tx *sql.Tx) error) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
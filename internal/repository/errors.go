@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"sample-service/internal/model"
+	"sample-service/internal/validate"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// The kinds of error the repository returns. Callers test for them with
+// errors.Is to decide how to answer, instead of reading error messages.
+var (
+	// ErrNotFound means the user or department asked for does not exist,
+	// or the user is deleted
+	ErrNotFound = errors.New("not found")
+	// ErrConflict means the write clashes with the current state of the
+	// data, such as a username that is already taken
+	ErrConflict = errors.New("conflict")
+	// ErrValidation means the caller's input is unacceptable, such as a
+	// negative page size or an unknown field
+	ErrValidation = errors.New("validation failed")
+	// ErrConstraint means the database refused a write that breaks one of
+	// its constraints
+	ErrConstraint = errors.New("constraint violation")
+)
+
+// Stable codes that clients can switch on instead of reading messages.
+// An error without a code of its own takes the code of its kind.
+const (
+	CodeNotFound          = "not_found"
+	CodeConflict          = "conflict"
+	CodeValidation        = "validation_failed"
+	CodeConstraint        = "constraint_violation"
+	CodeUsernameTaken     = "username_taken"
+	CodeVersionConflict   = "version_conflict"
+	CodeInvalidCursor     = "invalid_cursor"
+	CodeEmptySearch       = "empty_search"
+	CodeDepartmentTaken   = "department_taken"
+	CodeDepartmentInUse   = "department_in_use"
+	CodeInvalidTransition = "invalid_transition"
+	CodeChangeNotPending  = "change_not_pending"
+)
+
+var kindCodes = map[error]string{
+	ErrNotFound:   CodeNotFound,
+	ErrConflict:   CodeConflict,
+	ErrValidation: CodeValidation,
+	ErrConstraint: CodeConstraint,
+}
+
+// Error is an error of one of the kinds above. errors.Is matches it both
+// against its kind and against the error it wraps. Validation errors may
+// say which fields of the input are at fault.
+type Error struct {
+	Kind   error
+	Code   string
+	Fields []model.FieldError
+	Err    error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// ErrorCode is the stable code of the error
+func (e *Error) ErrorCode() string {
+	if e.Code != "" {
+		return e.Code
+	}
+	return kindCodes[e.Kind]
+}
+
+// Errorf formats an error of the given kind; like fmt.Errorf, %w wraps
+// its operand
+func Errorf(kind error, format string, args ...interface{}) error {
+	return &Error{Kind: kind, Err: fmt.Errorf(format, args...)}
+}
+
+// FieldErrorf formats a validation error about a single field
+func FieldErrorf(field, code, format string, args ...interface{}) error {
+	err := fmt.Errorf(format, args...)
+	return &Error{
+		Kind:   ErrValidation,
+		Fields: []model.FieldError{{Field: field, Code: code, Detail: err.Error()}},
+		Err:    err,
+	}
+}
+
+// ValidationError is the error for input with the given fields at fault
+func ValidationError(fields []model.FieldError) error {
+	return &Error{Kind: ErrValidation, Fields: fields, Err: errors.New(validate.Summary(fields))}
+}
+
+// UsernameExists is the error for a write that would give a username to
+// a second user
+func UsernameExists(username string) error {
+	return &Error{Kind: ErrConflict, Code: CodeUsernameTaken, Err: fmt.Errorf("username '%s' already exists", username)}
+}
+
+// liveUsernames is how SQLite names the unique index on the usernames of
+// users that are not deleted when a write breaks it
+const liveUsernames = "users.user_name"
+
+// constraintError classifies errors from SQLite that are caused by a
+// constraint, and passes any other error through unchanged. A username
+// another live user holds is ErrUsernameTaken, even when two writes race
+// past CheckIfUsernameExists.
+func constraintError(err error) error {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrConstraint {
+		if sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique && strings.HasSuffix(sqliteErr.Error(), liveUsernames) {
+			return ErrUsernameTaken
+		}
+		return &Error{Kind: ErrConstraint, Err: err}
+	}
+	return err
+}
+
+// userWriteError is constraintError for a write giving a user username,
+// which a taken username is then reported by as UsernameExists
+func userWriteError(err error, username string) error {
+	if err = constraintError(err); err == ErrUsernameTaken {
+		return UsernameExists(username)
+	}
+	return err
+}
@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"sample-service/internal/model"
+	"strings"
+)
+
+// userFieldOrder lists the model.User JSON fields in users table column
+// order; each field is stored in the column of the same name
+var userFieldOrder = []string{"user_id", "user_name", "first_name", "last_name", "email", "department", "user_status", "version", "deleted_at", "deleted_by", "created_at", "updated_at", "department_id", "manager_id"}
+
+// userFieldColumns maps each model.User JSON field to its users table column
+var userFieldColumns = func() map[string]string {
+	columns := map[string]string{}
+	for _, field := range userFieldOrder {
+		columns[field] = field
+	}
+	return columns
+}()
+
+// ParseFields parses a comma-separated sparse fieldset such as "user_id,user_name"
+func ParseFields(raw string) ([]string, error) {
+	var fields []string
+	seen := map[string]bool{}
+
+	for _, field := range strings.Split(raw, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			return nil, fmt.Errorf("fields contains an empty name")
+		}
+		if _, ok := userFieldColumns[field]; !ok {
+			return nil, fmt.Errorf("unknown field %q", field)
+		}
+		if !seen[field] {
+			seen[field] = true
+			fields = append(fields, field)
+		}
+	}
+
+	return fields, nil
+}
+
+// selectColumns returns the columns to select for a fieldset, in table
+// order, always including the extra fields the query itself needs. An
+// empty fieldset selects every column.
+func selectColumns(fields []string, required ...string) []string {
+	if len(fields) == 0 {
+		return userFieldOrder
+	}
+
+	wanted := map[string]bool{}
+	for _, field := range append(append([]string{}, fields...), required...) {
+		wanted[field] = true
+	}
+
+	var columns []string
+	for _, field := range userFieldOrder {
+		if wanted[field] {
+			columns = append(columns, userFieldColumns[field])
+		}
+	}
+	return columns
+}
+
+// scanUserColumns reads a row selected with the given columns, leaving the
+// fields that were not selected at their zero value
+func scanUserColumns(row rowScanner, columns []string) (model.User, error) {
+	var user model.User
+	targets := map[string]interface{}{
+		"user_id":       &user.ID,
+		"user_name":     &user.UserName,
+		"first_name":    &user.FirstName,
+		"last_name":     &user.LastName,
+		"email":         &user.Email,
+		"department":    nullString{&user.Department},
+		"user_status":   &user.UserStatus,
+		"version":       &user.Version,
+		"deleted_at":    &user.DeletedAt,
+		"deleted_by":    nullString{&user.DeletedBy},
+		"created_at":    &user.CreatedAt,
+		"updated_at":    &user.UpdatedAt,
+		"department_id": nullInt64{&user.DepartmentID},
+		"manager_id":    nullInt64{&user.ManagerID},
+	}
+
+	dest := make([]interface{}, len(columns))
+	for i, column := range columns {
+		dest[i] = targets[column]
+	}
+	err := row.Scan(dest...)
+	return user, err
+}
+
+// nullString scans a nullable text column into a string, reading NULL as ""
+type nullString struct {
+	dest *string
+}
+
+func (n nullString) Scan(value interface{}) error {
+	var s sql.NullString
+	if err := s.Scan(value); err != nil {
+		return err
+	}
+	*n.dest = s.String
+	return nil
+}
+
+// nullInt64 scans a nullable integer column into an int64, reading NULL as 0
+type nullInt64 struct {
+	dest *int64
+}
+
+func (n nullInt64) Scan(value interface{}) error {
+	var i sql.NullInt64
+	if err := i.Scan(value); err != nil {
+		return err
+	}
+	*n.dest = i.Int64
+	return nil
+}
+
+// nullID is the value stored for an optional reference to another row,
+// NULL for the zero ID
+func nullID(id int64) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
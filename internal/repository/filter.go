@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"fmt"
+	"sample-service/internal/filter"
+	"strconv"
+	"strings"
+)
+
+// UserFilterSchema lists the model.User fields a list filter may reference.
+// It is spelled out rather than built from the model so that bookkeeping
+// fields such as version and deleted_by stay out of reach of clients.
+var UserFilterSchema = filter.Schema{
+	"user_id":       filter.IntegerField,
+	"user_name":     filter.StringField,
+	"first_name":    filter.StringField,
+	"last_name":     filter.StringField,
+	"email":         filter.StringField,
+	"user_status":   filter.StringField,
+	"department":    filter.StringField,
+	"department_id": filter.IntegerField,
+	"manager_id":    filter.IntegerField,
+}
+
+var comparisonSQL = map[filter.Operator]string{
+	filter.Eq: "=",
+	filter.Ne: "!=",
+	filter.Gt: ">",
+	filter.Ge: ">=",
+	filter.Lt: "<",
+	filter.Le: "<=",
+}
+
+// likeEscaper escapes LIKE wildcards so user input only matches literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// compileFilter turns a validated filter into a parameterized SQL condition
+func compileFilter(expr filter.Expr) (string, []interface{}, error) {
+	switch e := expr.(type) {
+	case *filter.Logical:
+		left, leftArgs, err := compileFilter(e.Left)
+		if err != nil {
+			return "", nil, err
+		}
+		right, rightArgs, err := compileFilter(e.Right)
+		if err != nil {
+			return "", nil, err
+		}
+		return fmt.Sprintf("(%s %s %s)", left, strings.ToUpper(string(e.Op)), right), append(leftArgs, rightArgs...), nil
+	case *filter.Not:
+		inner, args, err := compileFilter(e.Expr)
+		if err != nil {
+			return "", nil, err
+		}
+		return fmt.Sprintf("NOT (%s)", inner), args, nil
+	case *filter.Comparison:
+		return compileComparison(e)
+	}
+	return "", nil, &filter.Error{Pos: expr.Pos(), Msg: "unsupported expression"}
+}
+
+func compileComparison(cmp *filter.Comparison) (string, []interface{}, error) {
+	column, ok := userFieldColumns[cmp.Field]
+	if !ok {
+		return "", nil, &filter.Error{Pos: cmp.Pos(), Msg: fmt.Sprintf("field %q cannot be filtered on", cmp.Field)}
+	}
+
+	args := make([]interface{}, 0, len(cmp.Values))
+	for _, value := range cmp.Values {
+		switch value.Kind {
+		case filter.NumberValue:
+			n, err := strconv.ParseInt(value.Text, 10, 64)
+			if err != nil {
+				return "", nil, &filter.Error{Pos: value.Pos(), Msg: fmt.Sprintf("invalid number %s", value.Text)}
+			}
+			args = append(args, n)
+		case filter.StringValue:
+			args = append(args, value.Text)
+		}
+	}
+
+	value := cmp.Values[0]
+	switch cmp.Op {
+	case filter.In:
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(args)), ", ")
+		return fmt.Sprintf("%s IN (%s)", column, placeholders), args, nil
+	case filter.Contains:
+		return column + ` LIKE ? ESCAPE '\'`, []interface{}{"%" + likeEscaper.Replace(value.Text) + "%"}, nil
+	case filter.StartsWith:
+		return column + ` LIKE ? ESCAPE '\'`, []interface{}{likeEscaper.Replace(value.Text) + "%"}, nil
+	case filter.EndsWith:
+		return column + ` LIKE ? ESCAPE '\'`, []interface{}{"%" + likeEscaper.Replace(value.Text)}, nil
+	}
+
+	if value.Kind == filter.NullValue {
+		if cmp.Op == filter.Ne {
+			return column + " IS NOT NULL", nil, nil
+		}
+		return column + " IS NULL", nil, nil
+	}
+	return fmt.Sprintf("%s %s ?", column, comparisonSQL[cmp.Op]), args, nil
+}
@@ -0,0 +1,223 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"sample-service/internal/model"
+	"strings"
+	"time"
+)
+
+// managementChain walks up the hierarchy from the user bound to it: the
+// user itself at depth 0, its manager at depth 1 and so on to the root. A
+// chain cannot be longer than there are users, which bounds the walk even
+// if the hierarchy ever had a cycle.
+const managementChain = `WITH RECURSIVE chain (id, next, depth) AS (
+	SELECT user_id, manager_id, 0 FROM users WHERE user_id = ?
+	UNION ALL
+	SELECT users.user_id, users.manager_id, chain.depth + 1 FROM users JOIN chain ON users.user_id = chain.next
+		WHERE chain.depth < (SELECT COUNT(*) FROM users)
+) `
+
+// reportsCondition keeps the users who report to a manager: directly, or
+// with recursive through any number of managers in between. UNION visits
+// each user once, so the walk down ends.
+func reportsCondition(managerID int64, recursive bool) (string, []interface{}) {
+	if !recursive {
+		return "manager_id = ?", []interface{}{managerID}
+	}
+	return `user_id IN (WITH RECURSIVE reports (id) AS (
+		SELECT user_id FROM users WHERE manager_id = ?
+		UNION
+		SELECT users.user_id FROM users JOIN reports ON users.manager_id = reports.id
+	) SELECT id FROM reports)`, []interface{}{managerID}
+}
+
+// checkManager refuses to have userID report to managerID, naming field in
+// the error: a user cannot manage themselves, a manager must exist and not
+// be terminated, and a user cannot report to anyone who reports to them,
+// directly or not. userID is 0 for a user that does not exist yet.
+func (r *userRepo) checkManager(field string, userID, managerID int64) error {
+	if managerID == userID {
+		return FieldErrorf(field, model.FieldInvalid, "user %d cannot manage themselves", userID)
+	}
+	manager, err := r.GetUserByID(int(managerID), "user_id", "user_status")
+	if errors.Is(err, ErrNotFound) {
+		return FieldErrorf(field, model.FieldInvalid, "no user found with ID %d", managerID)
+	}
+	if err != nil {
+		return err
+	}
+	if manager.UserStatus == "T" {
+		return FieldErrorf(field, model.FieldInvalid, "user %d is terminated and cannot manage anyone", managerID)
+	}
+	if userID == 0 {
+		return nil
+	}
+
+	var cycles int
+	if err := r.db.QueryRow(managementChain+"SELECT COUNT(*) FROM chain WHERE id = ?", managerID, userID).Scan(&cycles); err != nil {
+		return err
+	}
+	if cycles > 0 {
+		return FieldErrorf(field, model.FieldInvalid, "user %d reports to user %d, so cannot manage them", managerID, userID)
+	}
+	return nil
+}
+
+// resolveManager checks the manager a user is given. A manager the user
+// already has is kept as it is, so that writing a user does not fail for
+// what was valid when it was set. current is nil for a new user.
+func (r *userRepo) resolveManager(user *model.User, current *model.User) error {
+	if user.ManagerID == 0 || (current != nil && user.ManagerID == current.ManagerID) {
+		return nil
+	}
+	if current == nil {
+		// No one can report to a user that is being created
+		return r.checkManager("manager_id", 0, user.ManagerID)
+	}
+	return r.checkManager("manager_id", user.ID, user.ManagerID)
+}
+
+// OrgChartOptions controls which users OrgChart retrieves. Root is the user
+// at the top of the chart, or 0 for every user who reports to no one.
+// DepartmentID, when set, keeps the chart to the users of a department: its
+// tops are then the department's users whose manager is outside it, and
+// the walk down stops at users of other departments. Levels limits how many
+// levels are retrieved, counting the top one, or not at all for 0.
+type OrgChartOptions struct {
+	Root         int
+	DepartmentID int64
+	Levels       int
+}
+
+// OrgChart retrieves the users of an org chart. Parents come before their
+// reports, and users on a level are in name order. Deleted users are not
+// shown and do not count as a level.
+func (r *userRepo) OrgChart(opts OrgChartOptions) ([]model.OrgChartEntry, error) {
+	start := "SELECT user_id, 0, deleted_at IS NULL, CASE WHEN deleted_at IS NULL THEN user_id ELSE 0 END, 0 FROM users WHERE manager_id IS NULL"
+	args := []interface{}{}
+	step := ""
+	if opts.DepartmentID != 0 {
+		_, err := findDepartment(r.db, "department_id = ?", opts.DepartmentID)
+		if err == sql.ErrNoRows {
+			return nil, Errorf(ErrNotFound, "no department found with ID %d", opts.DepartmentID)
+		}
+		if err != nil {
+			return nil, err
+		}
+		start = `SELECT user_id, 0, deleted_at IS NULL, CASE WHEN deleted_at IS NULL THEN user_id ELSE 0 END, 0 FROM users
+		WHERE department_id = ? AND (manager_id IS NULL OR NOT EXISTS (
+			SELECT 1 FROM users managers WHERE managers.user_id = users.manager_id AND managers.department_id = ?))`
+		args = append(args, opts.DepartmentID, opts.DepartmentID)
+		step = " AND users.department_id = ?"
+	}
+	if opts.Root != 0 {
+		if _, err := r.GetUserByID(opts.Root, "user_id"); err != nil {
+			return nil, err
+		}
+		start = "SELECT user_id, 0, 1, user_id, 0 FROM users WHERE user_id = ?"
+		args = []interface{}{opts.Root}
+	}
+
+	// Each user is drawn under the anchor of its manager: the manager
+	// itself, or for a deleted manager whatever it was drawn under. Steps
+	// bound the walk as for the management chain.
+	query := `WITH RECURSIVE tree (id, parent, level, anchor, steps) AS (
+	` + start + `
+	UNION ALL
+	SELECT users.user_id, tree.anchor, tree.level + (users.deleted_at IS NULL),
+		CASE WHEN users.deleted_at IS NULL THEN users.user_id ELSE tree.anchor END, tree.steps + 1
+	FROM users JOIN tree ON users.manager_id = tree.id
+	WHERE tree.steps < (SELECT COUNT(*) FROM users) AND (? = 0 OR tree.level < ?)` + step + `
+) SELECT tree.parent, users.user_id, users.user_name, users.first_name, users.last_name,
+	users.department, users.user_status, users.manager_id FROM tree JOIN users ON users.user_id = tree.id
+WHERE users.` + notDeleted + `
+ORDER BY tree.level, users.last_name COLLATE UNICODE_NOCASE, users.first_name COLLATE UNICODE_NOCASE, users.user_id`
+	args = append(args, opts.Levels, opts.Levels)
+	if step != "" {
+		args = append(args, opts.DepartmentID)
+	}
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []model.OrgChartEntry{}
+	for rows.Next() {
+		var entry model.OrgChartEntry
+		user := &entry.User
+		if err := rows.Scan(&entry.ParentID, &user.ID, &user.UserName, &user.FirstName, &user.LastName,
+			nullString{&user.Department}, &user.UserStatus, nullInt64{&user.ManagerID}); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// ManagementChain retrieves the managers of a user that has not been
+// deleted, from its own manager up to the root of the hierarchy. Deleted
+// managers are left out, and the chain carries on above them.
+func (r *userRepo) ManagementChain(id int) ([]model.User, error) {
+	if _, err := r.GetUserByID(id, "user_id"); err != nil {
+		return nil, err
+	}
+
+	columns := make([]string, len(userFieldOrder))
+	for i, column := range userFieldOrder {
+		columns[i] = "users." + column
+	}
+	rows, err := r.db.Query(managementChain+"SELECT "+strings.Join(columns, ", ")+
+		" FROM chain JOIN users ON users.user_id = chain.id WHERE chain.depth > 0 AND users."+notDeleted+" ORDER BY chain.depth", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	managers := []model.User{}
+	for rows.Next() {
+		manager, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		managers = append(managers, manager)
+	}
+	return managers, rows.Err()
+}
+
+// ReassignReports moves every direct report of a manager, deleted or
+// terminated ones included, to report to another user instead, bumping
+// their versions, and returns how many were moved. The new manager is
+// checked as for a write of manager_id, naming reassign_to in the error.
+func (r *userRepo) ReassignReports(from, to int) (int, error) {
+	var moved int
+	err := r.atomically(func(tx *userRepo) error {
+		if err := tx.checkManager("reassign_to", int64(from), int64(to)); err != nil {
+			return err
+		}
+		var err error
+		moved, err = tx.moveReports(int64(from), int64(to))
+		return err
+	})
+	return moved, err
+}
+
+// moveReports points the direct reports of a manager at another one, or at
+// no one for 0, without checking it
+func (r *userRepo) moveReports(from, to int64) (int, error) {
+	result, err := r.db.Exec("UPDATE users SET manager_id = ?, updated_at = ?, version = version + 1 WHERE manager_id = ?",
+		nullID(to), time.Now().UTC(), from)
+	if err != nil {
+		return 0, constraintError(err)
+	}
+	moved, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if moved > 0 {
+		r.afterCommit(r.suggestions.reset)
+	}
+	return int(moved), nil
+}
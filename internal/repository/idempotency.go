@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// IdempotencyRecord is a request made under an idempotency key and, once
+// it has completed, the response to replay for retries of it
+type IdempotencyRecord struct {
+	// Actor is who made the request. Keys are scoped to their actor, so
+	// two callers who happen to pick the same key do not collide.
+	Actor string
+	Key   string
+	// Fingerprint identifies the request, so that reusing the key for a
+	// different request can be told apart from a retry
+	Fingerprint string
+	// Status is 0 while the first request is still being handled
+	Status    int
+	Header    http.Header
+	Body      []byte
+	ExpiresAt time.Time
+}
+
+// IdempotencyRepository keeps idempotency records until they expire
+type IdempotencyRepository interface {
+	// ClaimKey stores a record for a new request under its actor and key.
+	// If the actor's key already holds a record that has not expired,
+	// nothing is stored and that record is returned instead.
+	ClaimKey(record IdempotencyRecord, now time.Time) (*IdempotencyRecord, error)
+	// CompleteKey stores the response to the request that claimed a key
+	CompleteKey(record IdempotencyRecord) error
+	// ReleaseKey forgets an actor's key, so that the request can be made
+	// again
+	ReleaseKey(actor, key string) error
+}
+
+type idempotencyRepo struct {
+	db *sql.DB
+}
+
+// NewIdempotencyRepository creates a new IdempotencyRepository
+func NewIdempotencyRepository(db *sql.DB) IdempotencyRepository {
+	return &idempotencyRepo{db: db}
+}
+
+// ClaimKey stores a record for a new request, first clearing out every
+// expired record so the table does not grow without bound. Expiry times
+// are kept as Unix seconds, which compare correctly in SQL.
+func (r *idempotencyRepo) ClaimKey(record IdempotencyRecord, now time.Time) (*IdempotencyRecord, error) {
+	if _, err := r.db.Exec("DELETE FROM idempotency_keys WHERE expires_at <= ?", now.Unix()); err != nil {
+		return nil, err
+	}
+
+	result, err := r.db.Exec(
+		"INSERT INTO idempotency_keys (actor, idempotency_key, fingerprint, expires_at) VALUES (?, ?, ?, ?) ON CONFLICT (actor, idempotency_key) DO NOTHING",
+		record.Actor, record.Key, record.Fingerprint, record.ExpiresAt.Unix())
+	if err != nil {
+		return nil, err
+	}
+	claimed, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if claimed == 1 {
+		return nil, nil
+	}
+
+	var existing IdempotencyRecord
+	var header sql.NullString
+	var expiresAt int64
+	err = r.db.QueryRow(
+		"SELECT actor, idempotency_key, fingerprint, status, header, body, expires_at FROM idempotency_keys WHERE actor = ? AND idempotency_key = ?",
+		record.Actor, record.Key).Scan(&existing.Actor, &existing.Key, &existing.Fingerprint, &existing.Status, &header, &existing.Body, &expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	existing.ExpiresAt = time.Unix(expiresAt, 0).UTC()
+	if header.Valid {
+		if err := json.Unmarshal([]byte(header.String), &existing.Header); err != nil {
+			return nil, err
+		}
+	}
+	return &existing, nil
+}
+
+// CompleteKey stores the response to the request that claimed a key
+func (r *idempotencyRepo) CompleteKey(record IdempotencyRecord) error {
+	header, err := json.Marshal(record.Header)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec("UPDATE idempotency_keys SET status = ?, header = ?, body = ? WHERE actor = ? AND idempotency_key = ?",
+		record.Status, string(header), record.Body, record.Actor, record.Key)
+	return err
+}
+
+// ReleaseKey forgets an actor's key, so that the request can be made again
+func (r *idempotencyRepo) ReleaseKey(actor, key string) error {
+	_, err := r.db.Exec("DELETE FROM idempotency_keys WHERE actor = ? AND idempotency_key = ?", actor, key)
+	return err
+}
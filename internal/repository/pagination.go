@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sample-service/internal/filter"
+	"sample-service/internal/model"
+)
+
+const (
+	// DefaultPageLimit is the page size used when the caller does not ask for one
+	DefaultPageLimit = 50
+	// MaxPageLimit is the largest page size a caller may ask for
+	MaxPageLimit = 200
+)
+
+// ErrInvalidCursor is returned when a pagination cursor cannot be decoded
+var ErrInvalidCursor = &Error{Kind: ErrValidation, Code: CodeInvalidCursor, Err: errors.New("invalid pagination cursor")}
+
+// ListOptions controls which page of users ListUsers returns.
+// Cursor and Offset are mutually exclusive: a cursor always continues
+// from the row it was issued for, and only with the Sort it was issued
+// under. Filter, when set, must already have been validated against
+// UserFilterSchema. Fields narrows the columns loaded; see ParseFields.
+// Soft-deleted users are left out unless IncludeDeleted is set. ReportsTo,
+// when set, keeps only the users who report to that user: directly, or
+// with Recursive through any number of managers in between.
+type ListOptions struct {
+	Limit          int
+	Offset         int
+	Cursor         string
+	Filter         filter.Expr
+	Sort           []SortField
+	Fields         []string
+	IncludeDeleted bool
+	ReportsTo      int64
+	Recursive      bool
+}
+
+// UserPage is a single page of users along with what is needed to fetch its neighbours
+type UserPage struct {
+	Users      []model.User
+	Total      int
+	Limit      int
+	Offset     int
+	NextCursor string
+	PrevCursor string
+}
+
+// cursor is the decoded form of the opaque keyset cursor handed to clients.
+// Values holds the sort key of the row the cursor points at.
+type cursor struct {
+	Sort   string        `json:"s"`
+	Values []interface{} `json:"v"`
+	Before bool          `json:"b,omitempty"`
+}
+
+// Normalize applies defaults and bounds to the options
+func (o ListOptions) Normalize() (ListOptions, error) {
+	if o.Limit < 0 {
+		return o, fmt.Errorf("limit must not be negative")
+	}
+	if o.Offset < 0 {
+		return o, fmt.Errorf("offset must not be negative")
+	}
+	if o.Cursor != "" && o.Offset > 0 {
+		return o, fmt.Errorf("offset and cursor cannot be combined")
+	}
+	if o.Limit == 0 {
+		o.Limit = DefaultPageLimit
+	}
+	if o.Limit > MaxPageLimit {
+		o.Limit = MaxPageLimit
+	}
+	return o, nil
+}
+
+func encodeCursor(c cursor) string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// decodeCursor decodes a cursor issued for the given sort
+func decodeCursor(s string, fields []SortField) (cursor, error) {
+	var c cursor
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&c); err != nil {
+		return c, ErrInvalidCursor
+	}
+	if c.Sort != sortKey(fields) || len(c.Values) != len(fields) {
+		return c, ErrInvalidCursor
+	}
+
+	// JSON numbers only come from integer columns
+	for i, value := range c.Values {
+		if number, ok := value.(json.Number); ok {
+			if c.Values[i], err = number.Int64(); err != nil {
+				return c, ErrInvalidCursor
+			}
+		}
+	}
+	return c, nil
+}
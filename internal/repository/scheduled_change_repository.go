@@ -0,0 +1,231 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sample-service/internal/model"
+	"strings"
+	"time"
+)
+
+// ScheduledChangeRepository stores changes to users that take effect
+// later, and applies them once they are due
+type ScheduledChangeRepository interface {
+	ScheduleChange(change model.ScheduledChange) (*model.ScheduledChange, error)
+	ListScheduledChanges(userID int) ([]model.ScheduledChange, error)
+	CancelScheduledChange(userID, changeID int, cancelledBy string) (*model.ScheduledChange, error)
+	ApplyDueChanges(now time.Time, apply func(users UserRepository, change model.ScheduledChange) error) (int, error)
+}
+
+type scheduledChangeRepo struct {
+	db *sql.DB
+	// suggestions is the suggestion index of the user repository, which
+	// the changes applied to users must keep up to date
+	suggestions *suggestionIndex
+}
+
+// NewScheduledChangeRepository creates a new ScheduledChangeRepository.
+// users is the repository of the users in the same database, whose
+// suggestions follow the changes applied.
+func NewScheduledChangeRepository(db *sql.DB, users UserRepository) ScheduledChangeRepository {
+	repo := &scheduledChangeRepo{db: db, suggestions: newSuggestionIndex()}
+	if u, ok := users.(*userRepo); ok {
+		repo.suggestions = u.suggestions
+	}
+	return repo
+}
+
+// selectScheduledChanges selects the columns scanScheduledChange reads,
+// with the name of the department each change moves the user to
+const selectScheduledChanges = `SELECT c.change_id, c.user_id, c.effective_at, c.transition, c.department_id, d.name, c.reason, c.status, c.error,
+	c.created_by, c.created_at, c.applied_at, c.cancelled_at, c.cancelled_by
+	FROM scheduled_changes c LEFT JOIN departments d ON d.department_id = c.department_id`
+
+// scanScheduledChange reads a change selected with selectScheduledChanges
+func scanScheduledChange(row rowScanner) (model.ScheduledChange, error) {
+	var change model.ScheduledChange
+	var effectiveAt int64
+	var createdAt time.Time
+	var appliedAt, cancelledAt sql.NullTime
+	err := row.Scan(&change.ID, &change.UserID, &effectiveAt, nullString{&change.Transition}, nullInt64{&change.DepartmentID}, nullString{&change.Department},
+		&change.Reason, &change.Status, nullString{&change.Error}, &change.CreatedBy, &createdAt, &appliedAt, &cancelledAt, nullString{&change.CancelledBy})
+	if err != nil {
+		return change, err
+	}
+	change.EffectiveAt = time.Unix(effectiveAt, 0).UTC()
+	change.CreatedAt = &createdAt
+	if appliedAt.Valid {
+		change.AppliedAt = &appliedAt.Time
+	}
+	if cancelledAt.Valid {
+		change.CancelledAt = &cancelledAt.Time
+	}
+	return change, nil
+}
+
+// ScheduleChange stores a pending change to a user that has not been
+// deleted. The department it names is resolved now, by department_id or
+// by name as for users, so that an unknown one is refused at once.
+func (r *scheduledChangeRepo) ScheduleChange(change model.ScheduledChange) (*model.ScheduledChange, error) {
+	users := &userRepo{db: r.db, suggestions: r.suggestions}
+	if _, err := users.GetUserByID(int(change.UserID), "user_id"); err != nil {
+		return nil, err
+	}
+
+	if change.DepartmentID != 0 {
+		department, err := findDepartment(r.db, "department_id = ?", change.DepartmentID)
+		if err == sql.ErrNoRows {
+			return nil, FieldErrorf("department_id", model.FieldInvalid, "no department found with ID %d", change.DepartmentID)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if name := strings.TrimSpace(change.Department); name != "" && !strings.EqualFold(name, department.Name) {
+			return nil, FieldErrorf("department", model.FieldInvalid, "department %q is not department %d, %q", name, department.ID, department.Name)
+		}
+		change.Department = department.Name
+	} else if name := strings.TrimSpace(change.Department); name != "" {
+		department, err := findDepartment(r.db, "name = ?", name)
+		if err == sql.ErrNoRows {
+			return nil, FieldErrorf("department", model.FieldInvalid, "unknown department %q", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		change.DepartmentID, change.Department = department.ID, department.Name
+	}
+
+	now := time.Now().UTC()
+	result, err := r.db.Exec("INSERT INTO scheduled_changes (user_id, effective_at, transition, department_id, reason, status, created_by, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		change.UserID, change.EffectiveAt.Unix(), sql.NullString{String: change.Transition, Valid: change.Transition != ""}, nullID(change.DepartmentID),
+		change.Reason, model.ChangePending, change.CreatedBy, now)
+	if err != nil {
+		return nil, constraintError(err)
+	}
+	change.ID, err = result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	change.Status = model.ChangePending
+	change.EffectiveAt = time.Unix(change.EffectiveAt.Unix(), 0).UTC()
+	change.CreatedAt = &now
+	return &change, nil
+}
+
+// ListScheduledChanges retrieves every change scheduled for a user that has
+// not been deleted, in the order they take effect, including those
+// applied, failed or cancelled
+func (r *scheduledChangeRepo) ListScheduledChanges(userID int) ([]model.ScheduledChange, error) {
+	users := &userRepo{db: r.db, suggestions: r.suggestions}
+	if _, err := users.GetUserByID(userID, "user_id"); err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.Query(selectScheduledChanges+" WHERE c.user_id = ? ORDER BY c.effective_at, c.change_id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []model.ScheduledChange{}
+	for rows.Next() {
+		change, err := scanScheduledChange(rows)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	return changes, rows.Err()
+}
+
+// CancelScheduledChange cancels a pending change to a user, keeping it with
+// when and by whom it was cancelled. A change that has already been
+// applied, has failed or was cancelled before is a conflict.
+func (r *scheduledChangeRepo) CancelScheduledChange(userID, changeID int, cancelledBy string) (*model.ScheduledChange, error) {
+	result, err := r.db.Exec("UPDATE scheduled_changes SET status = ?, cancelled_at = ?, cancelled_by = ? WHERE change_id = ? AND user_id = ? AND status = ?",
+		model.ChangeCancelled, time.Now().UTC(), cancelledBy, changeID, userID, model.ChangePending)
+	if err != nil {
+		return nil, err
+	}
+	cancelled, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	change, err := scanScheduledChange(r.db.QueryRow(selectScheduledChanges+" WHERE c.change_id = ? AND c.user_id = ?", changeID, userID))
+	if err == sql.ErrNoRows {
+		return nil, Errorf(ErrNotFound, "no scheduled change %d for user %d", changeID, userID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if cancelled > 0 {
+		return &change, nil
+	}
+	return nil, &Error{Kind: ErrConflict, Code: CodeChangeNotPending, Err: fmt.Errorf("scheduled change %d is %s and can no longer be cancelled", changeID, change.Status)}
+}
+
+// ApplyDueChanges applies every pending change that took effect by now,
+// oldest first, and returns how many were applied. Each change is applied
+// by apply through a user repository in a transaction of its own, which
+// also marks it applied, so a change is applied exactly once even if the
+// process stops part way. A change apply refuses with a repository error,
+// such as a transition that no longer fits the user's status, is marked
+// failed; any other error stops the run, leaving the change pending for
+// the next one.
+func (r *scheduledChangeRepo) ApplyDueChanges(now time.Time, apply func(users UserRepository, change model.ScheduledChange) error) (int, error) {
+	rows, err := r.db.Query(selectScheduledChanges+" WHERE c.status = ? AND c.effective_at <= ? ORDER BY c.effective_at, c.change_id",
+		model.ChangePending, now.Unix())
+	if err != nil {
+		return 0, err
+	}
+	var due []model.ScheduledChange
+	for rows.Next() {
+		change, err := scanScheduledChange(rows)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		due = append(due, change)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	users := &userRepo{db: r.db, suggestions: r.suggestions}
+	applied := 0
+	for _, change := range due {
+		err := users.InTransaction(func(tx UserRepository) error {
+			// Marking the change first makes a concurrent cancel either
+			// win, leaving nothing to apply, or wait for this transaction
+			result, err := tx.(*userRepo).db.Exec("UPDATE scheduled_changes SET status = ?, applied_at = ? WHERE change_id = ? AND status = ?",
+				model.ChangeApplied, time.Now().UTC(), change.ID, model.ChangePending)
+			if err != nil {
+				return err
+			}
+			if marked, err := result.RowsAffected(); err != nil || marked == 0 {
+				return err
+			}
+			if err := apply(tx, change); err != nil {
+				return err
+			}
+			applied++
+			return nil
+		})
+		if err == nil {
+			continue
+		}
+		var refused *Error
+		if !errors.As(err, &refused) {
+			return applied, fmt.Errorf("failed to apply scheduled change %d: %w", change.ID, err)
+		}
+		_, err = r.db.Exec("UPDATE scheduled_changes SET status = ?, error = ?, applied_at = ? WHERE change_id = ? AND status = ?",
+			model.ChangeFailed, err.Error(), time.Now().UTC(), change.ID, model.ChangePending)
+		if err != nil {
+			return applied, err
+		}
+	}
+	return applied, nil
+}
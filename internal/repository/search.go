@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"errors"
+	"html"
+	"sample-service/internal/model"
+	"strings"
+	"unicode"
+)
+
+const (
+	// DefaultSearchLimit is the number of results returned when the caller does not ask for a number
+	DefaultSearchLimit = 20
+	// MaxSearchLimit is the largest number of results a caller may ask for
+	MaxSearchLimit = 100
+)
+
+// ErrEmptySearch is returned when a search query contains no words
+var ErrEmptySearch = &Error{Kind: ErrValidation, Code: CodeEmptySearch, Err: errors.New("search query must contain at least one word")}
+
+// searchColumns are the users_fts columns, in index order
+var searchColumns = []string{"first_name", "last_name", "user_name", "email", "department"}
+
+// The index marks matches with control characters rather than HTML so the
+// surrounding user data can be escaped before the <mark> tags are added
+const (
+	matchStart = "\x02"
+	matchEnd   = "\x03"
+)
+
+var markReplacer = strings.NewReplacer(matchStart, "<mark>", matchEnd, "</mark>")
+
+// searchQuery ranks matches with bm25, weighting names above usernames,
+// emails and departments, in that order
+const searchQuery = `
+	SELECT u.user_id, u.user_name, u.first_name, u.last_name, u.email, u.department, u.user_status, u.version, u.department_id, u.manager_id,
+		-bm25(users_fts, 5.0, 5.0, 3.0, 2.0, 1.0) AS score,
+		snippet(users_fts, -1, '` + matchStart + `', '` + matchEnd + `', '…', 10),
+		IFNULL(highlight(users_fts, 0, '` + matchStart + `', '` + matchEnd + `'), ''),
+		IFNULL(highlight(users_fts, 1, '` + matchStart + `', '` + matchEnd + `'), ''),
+		IFNULL(highlight(users_fts, 2, '` + matchStart + `', '` + matchEnd + `'), ''),
+		IFNULL(highlight(users_fts, 3, '` + matchStart + `', '` + matchEnd + `'), ''),
+		IFNULL(highlight(users_fts, 4, '` + matchStart + `', '` + matchEnd + `'), '')
+	FROM users_fts
+	JOIN users u ON u.user_id = users_fts.rowid
+	WHERE users_fts MATCH ? AND u.deleted_at IS NULL
+	ORDER BY score DESC, u.user_id
+	LIMIT ?`
+
+// SearchUsers ranks users whose names, username, email or department
+// contain every word of the query, treating each word as a prefix
+func (r *userRepo) SearchUsers(query string, limit int) ([]model.UserSearchResult, error) {
+	match := ftsQuery(query)
+	if match == "" {
+		return nil, ErrEmptySearch
+	}
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+	if limit > MaxSearchLimit {
+		limit = MaxSearchLimit
+	}
+
+	rows, err := r.db.Query(searchQuery, match, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []model.UserSearchResult{}
+	for rows.Next() {
+		var result model.UserSearchResult
+		var snippet string
+		highlights := make([]string, len(searchColumns))
+
+		dest := []interface{}{
+			&result.User.ID, &result.User.UserName, &result.User.FirstName, &result.User.LastName,
+			&result.User.Email, nullString{&result.User.Department}, &result.User.UserStatus, &result.User.Version,
+			nullInt64{&result.User.DepartmentID}, nullInt64{&result.User.ManagerID},
+			&result.Score, &snippet,
+		}
+		for i := range highlights {
+			dest = append(dest, &highlights[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+
+		result.Snippet = markMatches(snippet)
+		result.Highlights = map[string]string{}
+		for i, text := range highlights {
+			if strings.Contains(text, matchStart) {
+				result.Highlights[searchColumns[i]] = markMatches(text)
+			}
+		}
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// ftsQuery turns free text into an FTS5 query matching rows that contain
+// every word as a prefix, e.g. `jo smi` becomes `"jo"* "smi"*`. Anything
+// that is not a letter or digit separates words, so user input can never
+// reach FTS5 as query syntax.
+func ftsQuery(text string) string {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	terms := make([]string, len(words))
+	for i, word := range words {
+		terms[i] = `"` + word + `"*`
+	}
+	return strings.Join(terms, " ")
+}
+
+// markMatches escapes text for HTML and swaps the index's match markers for <mark> tags
+func markMatches(text string) string {
+	return markReplacer.Replace(html.EscapeString(text))
+}
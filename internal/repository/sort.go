@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"fmt"
+	"sample-service/internal/model"
+	"strings"
+)
+
+// SortField orders a listing by one column
+type SortField struct {
+	Column string
+	Desc   bool
+}
+
+// sortColumn describes how a sortable column is ordered and compared
+type sortColumn struct {
+	// expr is the SQL expression ordered on; text columns use the
+	// UNICODE_NOCASE collation registered by the database package so
+	// ordering is case-insensitive and accent-aware
+	expr  string
+	value func(user model.User) interface{}
+}
+
+// sortColumns whitelists the users table columns a listing may be sorted by
+var sortColumns = map[string]sortColumn{
+	"user_id":     {expr: "user_id", value: func(u model.User) interface{} { return u.ID }},
+	"user_name":   {expr: "user_name COLLATE UNICODE_NOCASE", value: func(u model.User) interface{} { return u.UserName }},
+	"first_name":  {expr: "first_name COLLATE UNICODE_NOCASE", value: func(u model.User) interface{} { return u.FirstName }},
+	"last_name":   {expr: "last_name COLLATE UNICODE_NOCASE", value: func(u model.User) interface{} { return u.LastName }},
+	"email":       {expr: "email COLLATE UNICODE_NOCASE", value: func(u model.User) interface{} { return u.Email }},
+	"department":  {expr: "IFNULL(department, '') COLLATE UNICODE_NOCASE", value: func(u model.User) interface{} { return u.Department }},
+	"user_status": {expr: "user_status COLLATE UNICODE_NOCASE", value: func(u model.User) interface{} { return u.UserStatus }},
+}
+
+// ParseSort parses a comma-separated list of columns such as
+// "last_name,-department", where a leading "-" sorts descending
+func ParseSort(raw string) ([]SortField, error) {
+	var fields []SortField
+	seen := map[string]bool{}
+
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		field := SortField{Column: strings.TrimPrefix(part, "-"), Desc: strings.HasPrefix(part, "-")}
+		if field.Column == "" {
+			return nil, fmt.Errorf("sort contains an empty column")
+		}
+		if _, ok := sortColumns[field.Column]; !ok {
+			return nil, fmt.Errorf("cannot sort by %q", field.Column)
+		}
+		if seen[field.Column] {
+			return nil, fmt.Errorf("column %q appears more than once in sort", field.Column)
+		}
+		seen[field.Column] = true
+		fields = append(fields, field)
+	}
+
+	return fields, nil
+}
+
+// withTiebreaker appends user_id unless it is already sorted on, so that
+// the order is total and cursors always point at exactly one row
+func withTiebreaker(fields []SortField) []SortField {
+	for _, field := range fields {
+		if field.Column == "user_id" {
+			return fields
+		}
+	}
+	return append(append([]SortField{}, fields...), SortField{Column: "user_id"})
+}
+
+// sortKey is the canonical text form of a sort, stored in cursors so a
+// cursor cannot be replayed against a different ordering
+func sortKey(fields []SortField) string {
+	parts := make([]string, len(fields))
+	for i, field := range fields {
+		parts[i] = field.Column
+		if field.Desc {
+			parts[i] = "-" + field.Column
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// orderByClause renders the ORDER BY clause, flipping every direction when
+// walking backwards from a cursor
+func orderByClause(fields []SortField, reverse bool) string {
+	parts := make([]string, len(fields))
+	for i, field := range fields {
+		parts[i] = sortColumns[field.Column].expr
+		if field.Desc != reverse {
+			parts[i] += " DESC"
+		}
+	}
+	return " ORDER BY " + strings.Join(parts, ", ")
+}
+
+// keysetCondition selects the rows that come after (or, with before, ahead
+// of) the row with the given sort values. For keys a, b, c that is
+// a > ? OR (a = ? AND b > ?) OR (a = ? AND b = ? AND c > ?),
+// with the comparison flipped for descending keys.
+func keysetCondition(fields []SortField, values []interface{}, before bool) (string, []interface{}) {
+	var terms []string
+	var args []interface{}
+
+	for i, field := range fields {
+		var parts []string
+		for j := 0; j < i; j++ {
+			parts = append(parts, sortColumns[fields[j].Column].expr+" = ?")
+			args = append(args, values[j])
+		}
+
+		op := ">"
+		if field.Desc != before {
+			op = "<"
+		}
+		parts = append(parts, sortColumns[field.Column].expr+" "+op+" ?")
+		args = append(args, values[i])
+
+		terms = append(terms, strings.Join(parts, " AND "))
+	}
+
+	if len(terms) == 1 {
+		return terms[0], args
+	}
+	return "((" + strings.Join(terms, ") OR (") + "))", args
+}
+
+// sortValues extracts the values a cursor needs to resume after user
+func sortValues(fields []SortField, user model.User) []interface{} {
+	values := make([]interface{}, len(fields))
+	for i, field := range fields {
+		values[i] = sortColumns[field.Column].value(user)
+	}
+	return values
+}
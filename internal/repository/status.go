@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"sample-service/internal/model"
+	"time"
+)
+
+// invalidTransition is the error for a status change the lifecycle does
+// not allow from the user's current status
+func invalidTransition(err error) error {
+	return &Error{Kind: ErrConflict, Code: CodeInvalidTransition, Err: err}
+}
+
+// plainTransition is the transition a write of user_status makes, or nil
+// if the status stays the same. Only plain transitions can be made this
+// way; the others need their own endpoint and a reason.
+func plainTransition(current, user model.User) (*model.Transition, error) {
+	if user.UserStatus == current.UserStatus {
+		return nil, nil
+	}
+	from, to := model.StatusName(current.UserStatus), model.StatusName(user.UserStatus)
+	transition, ok := model.TransitionBetween(current.UserStatus, user.UserStatus)
+	if !ok {
+		return nil, invalidTransition(fmt.Errorf("user_status cannot change from %s to %s", from, to))
+	}
+	if !transition.Plain {
+		return nil, invalidTransition(fmt.Errorf("user_status can only change from %s to %s by the %s transition, which needs a reason", from, to, transition.Name))
+	}
+	return &transition, nil
+}
+
+// TransitionUser moves a user along a transition of its lifecycle and
+// records it, with the reason and who made it. It fails with a conflict if
+// the transition does not apply to the user's status. A non-zero version
+// makes it conditional on that version, as for UpdateUser. Terminating a
+// user moves whoever still reports to them up to their own manager, as no
+// one may report to a terminated user.
+func (r *userRepo) TransitionUser(id int, transition model.Transition, reason, actor string, version int64) (*model.User, error) {
+	var user *model.User
+	err := r.atomically(func(tx *userRepo) error {
+		current, err := tx.GetUserByID(id)
+		if err != nil {
+			return err
+		}
+		if version != 0 && current.Version != version {
+			return ErrVersionConflict
+		}
+		if !transition.Allows(current.UserStatus) {
+			return invalidTransition(fmt.Errorf("cannot %s a user who is %s", transition.Name, model.StatusName(current.UserStatus)))
+		}
+
+		from := current.UserStatus
+		now := time.Now().UTC()
+		err = tx.db.QueryRow("UPDATE users SET user_status = ?, updated_at = ?, version = version + 1 WHERE user_id = ? AND version = ? RETURNING version",
+			transition.To, now, id, current.Version).Scan(&current.Version)
+		if err == sql.ErrNoRows {
+			return ErrVersionConflict
+		}
+		if err != nil {
+			return constraintError(err)
+		}
+		current.UserStatus, current.UpdatedAt = transition.To, &now
+		user = current
+		suggested := *current
+		tx.afterCommit(func() { tx.suggestions.put(suggested) })
+		if transition.To == "T" {
+			if _, err := tx.moveReports(current.ID, current.ManagerID); err != nil {
+				return err
+			}
+		}
+		return tx.recordTransition(*current, from, transition, reason, actor)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// recordTransition records that a user was moved from a status along a
+// transition, at the time the user was updated
+func (r *userRepo) recordTransition(user model.User, from string, transition model.Transition, reason, actor string) error {
+	_, err := r.db.Exec("INSERT INTO user_status_transitions (user_id, transition, from_status, to_status, reason, actor, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		user.ID, transition.Name, from, transition.To, sql.NullString{String: reason, Valid: reason != ""}, actor, *user.UpdatedAt)
+	return constraintError(err)
+}
+
+// ListStatusTransitions retrieves the transitions made to a user, oldest
+// first
+func (r *userRepo) ListStatusTransitions(id int) ([]model.StatusTransition, error) {
+	rows, err := r.db.Query("SELECT transition_id, user_id, transition, from_status, to_status, reason, actor, created_at FROM user_status_transitions WHERE user_id = ? ORDER BY transition_id", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transitions := []model.StatusTransition{}
+	for rows.Next() {
+		var t model.StatusTransition
+		if err := rows.Scan(&t.ID, &t.UserID, &t.Transition, &t.FromStatus, &t.ToStatus, nullString{&t.Reason}, &t.Actor, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		transitions = append(transitions, t)
+	}
+	return transitions, rows.Err()
+}
@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"sample-service/internal/model"
+	"sample-service/internal/suggest"
+	"sync"
+)
+
+const (
+	// DefaultSuggestLimit is the number of suggestions returned when the caller does not ask for a number
+	DefaultSuggestLimit = 10
+	// MaxSuggestLimit is the largest number of suggestions a caller may ask for
+	MaxSuggestLimit = 50
+)
+
+// suggestionIndex holds the autocomplete index for a repository. It is
+// loaded from the database on first use and then kept up to date by the
+// repository's writes, which are ignored until it has been loaded.
+type suggestionIndex struct {
+	mu     sync.Mutex
+	loaded bool
+	index  *suggest.Index
+}
+
+func newSuggestionIndex() *suggestionIndex {
+	return &suggestionIndex{index: suggest.NewIndex()}
+}
+
+// get returns the index, loading every user into it the first time
+func (s *suggestionIndex) get(load func() ([]model.User, error)) (*suggest.Index, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.loaded {
+		users, err := load()
+		if err != nil {
+			return nil, err
+		}
+		for _, user := range users {
+			s.index.Put(user)
+		}
+		s.loaded = true
+	}
+	return s.index, nil
+}
+
+func (s *suggestionIndex) put(user model.User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.loaded {
+		s.index.Put(user)
+	}
+}
+
+// reset forgets the index, so that it is loaded again on next use; it is
+// for writes that change many users at once
+func (s *suggestionIndex) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loaded = false
+	s.index = suggest.NewIndex()
+}
+
+func (s *suggestionIndex) remove(id int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.loaded {
+		s.index.Remove(id)
+	}
+}
+
+// SuggestUsers returns the users whose names, username or email best match
+// what has been typed so far, tolerating typos and missing accents
+func (r *userRepo) SuggestUsers(prefix string, limit int) ([]model.UserSuggestion, error) {
+	if limit <= 0 {
+		limit = DefaultSuggestLimit
+	}
+	if limit > MaxSuggestLimit {
+		limit = MaxSuggestLimit
+	}
+
+	index, err := r.suggestions.get(r.GetAllUsers)
+	if err != nil {
+		return nil, err
+	}
+
+	suggestions := []model.UserSuggestion{}
+	for _, match := range index.Suggest(prefix, limit) {
+		suggestions = append(suggestions, model.UserSuggestion{User: match.User, Score: match.Score})
+	}
+	return suggestions, nil
+}
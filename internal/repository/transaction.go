@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// dbtx is the part of *sql.DB and *sql.Tx the repository queries through,
+// so the same code runs inside and outside a transaction
+type dbtx interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// errNestedTransaction is returned by InTransaction on a repository that is
+// already transactional
+var errNestedTransaction = errors.New("transactions cannot be nested")
+
+// InTransaction runs fn with a repository whose reads and writes all go
+// through a single database transaction. The transaction commits if fn
+// returns nil and rolls back otherwise, returning fn's error.
+func (r *userRepo) InTransaction(fn func(tx UserRepository) error) error {
+	db, ok := r.db.(*sql.DB)
+	if !ok {
+		return errNestedTransaction
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	txRepo := &userRepo{db: tx, suggestions: r.suggestions, pending: &[]func(){}}
+	if err := fn(txRepo); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	for _, apply := range *txRepo.pending {
+		apply()
+	}
+	return nil
+}
+
+// atomically runs fn with a repository in a transaction: r itself if it
+// is transactional already, or else one of its own
+func (r *userRepo) atomically(fn func(tx *userRepo) error) error {
+	if r.pending != nil {
+		return fn(r)
+	}
+	return r.InTransaction(func(tx UserRepository) error {
+		return fn(tx.(*userRepo))
+	})
+}
+
+// afterCommit runs fn once the repository's writes are durable: at once
+// outside a transaction, or when the transaction commits. It keeps the
+// in-memory suggestion index from seeing writes that are rolled back.
+func (r *userRepo) afterCommit(fn func()) {
+	if r.pending == nil {
+		fn()
+		return
+	}
+	*r.pending = append(*r.pending, fn)
+}
@@ -2,31 +2,77 @@ package repository
 
 import (
 	"database/sql"
+	"errors"
 	"sample-service/internal/model"
 	"fmt"
+	"strings"
+	"time"
 )
 
 type UserRepository interface {
 	GetAllUsers() ([]model.User, error)
-	GetUserByID(id int) (*model.User, error)
+	EachUser(fn func(model.User) error) error
+	ListUsers(opts ListOptions) (*UserPage, error)
+	SearchUsers(query string, limit int) ([]model.UserSearchResult, error)
+	SuggestUsers(prefix string, limit int) ([]model.UserSuggestion, error)
+	GetUserByID(id int, fields ...string) (*model.User, error)
+	GetUserByUsername(username string) (*model.User, error)
 	CheckIfUsernameExists(username string) (bool, error)
 	CreateUser(user model.User) (*model.User, error)
+	CreateUserWithID(user model.User) (*model.User, error)
 	UpdateUser(user model.User) (*model.User, error)
-	DeleteUser(id int) (bool, error)
+	TransitionUser(id int, transition model.Transition, reason, actor string, version int64) (*model.User, error)
+	ListStatusTransitions(id int) ([]model.StatusTransition, error)
+	ManagementChain(id int) ([]model.User, error)
+	ReassignReports(from, to int) (int, error)
+	OrgChart(opts OrgChartOptions) ([]model.OrgChartEntry, error)
+	DeleteUser(id int, version int64, deletedBy string) (bool, error)
+	RestoreUser(id int) (*model.User, error)
+	PurgeUser(id int) (bool, error)
+	InTransaction(fn func(tx UserRepository) error) error
 }
 
+// ErrVersionConflict is returned when a conditional write finds that the
+// user has been changed since the expected version was read
+var ErrVersionConflict = &Error{Kind: ErrConflict, Code: CodeVersionConflict, Err: errors.New("user was modified by another request")}
+
+// ErrUsernameTaken is returned when restoring a user whose username has
+// been reclaimed by another user since it was deleted
+var ErrUsernameTaken = &Error{Kind: ErrConflict, Code: CodeUsernameTaken, Err: errors.New("username has been taken by another user")}
+
 type userRepo struct {
-	db *sql.DB
+	db          dbtx
+	suggestions *suggestionIndex
+	// pending holds the index updates of a transaction until it commits;
+	// it is nil outside transactions
+	pending *[]func()
+}
+
+// userColumns is the full column list user queries select, in scan order
+var userColumns = strings.Join(userFieldOrder, ", ")
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
 }
 
+// scanUser reads a user selected with userColumns
+func scanUser(row rowScanner) (model.User, error) {
+	return scanUserColumns(row, userFieldOrder)
+}
+
+// notDeleted hides soft-deleted users; every read applies it unless asked
+// for deleted users explicitly
+const notDeleted = "deleted_at IS NULL"
+
 // NewUserRepository creates a new UserRepository
 func NewUserRepository(db *sql.DB) UserRepository {
-	return &userRepo{db: db}
+	return &userRepo{db: db, suggestions: newSuggestionIndex()}
 }
 
 // GetAllUsers retrieves all users from the database
 func (r *userRepo) GetAllUsers() ([]model.User, error) {
-	rows, err := r.db.Query("SELECT * FROM users")
+	rows, err := r.db.Query("SELECT " + userColumns + " FROM users WHERE " + notDeleted)
 	if err != nil {
 		return nil, err
 	}
@@ -34,8 +80,7 @@ func (r *userRepo) GetAllUsers() ([]model.User, error) {
 
 	users := []model.User{}
 	for rows.Next() {
-		var user model.User
-		err := rows.Scan(&user.ID, &user.UserName, &user.FirstName, &user.LastName, &user.Email, &user.Department, &user.UserStatus)
+		user, err := scanUser(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -45,12 +90,156 @@ func (r *userRepo) GetAllUsers() ([]model.User, error) {
 	return users, nil
 }
 
-// GetUserByID retrieves a user by their ID from the database
-func (r *userRepo) GetUserByID(id int) (*model.User, error) {
-	row := r.db.QueryRow("SELECT * FROM users WHERE user_id = ?", id)
+// EachUser calls fn with every user in ID order, reading them one at a time
+// so that all users never need to be in memory at once. It stops at the
+// first error fn returns.
+func (r *userRepo) EachUser(fn func(model.User) error) error {
+	rows, err := r.db.Query("SELECT " + userColumns + " FROM users WHERE " + notDeleted + " ORDER BY user_id")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(user); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// ListUsers retrieves a single page of users matching the filter in the
+// requested order, either by offset or by continuing from a keyset cursor
+func (r *userRepo) ListUsers(opts ListOptions) (*UserPage, error) {
+	opts, err := opts.Normalize()
+	if err != nil {
+		return nil, &Error{Kind: ErrValidation, Err: err}
+	}
+	sort := withTiebreaker(opts.Sort)
+
+	var conditions []string
+	var args []interface{}
+	if !opts.IncludeDeleted {
+		conditions = append(conditions, notDeleted)
+	}
+	if opts.Filter != nil {
+		condition, filterArgs, err := compileFilter(opts.Filter)
+		if err != nil {
+			return nil, &Error{Kind: ErrValidation, Err: err}
+		}
+		conditions = append(conditions, condition)
+		args = append(args, filterArgs...)
+	}
+	if opts.ReportsTo != 0 {
+		condition, reportsArgs := reportsCondition(opts.ReportsTo, opts.Recursive)
+		conditions = append(conditions, condition)
+		args = append(args, reportsArgs...)
+	}
+
+	var total int
+	countQuery := "SELECT COUNT(*) FROM users" + whereClause(conditions)
+	if err := r.db.QueryRow(countQuery, args...).Scan(&total); err != nil {
+		return nil, err
+	}
+
+	// One extra row is fetched to tell whether another page follows
+	var c cursor
+	var page string
+	if opts.Cursor != "" {
+		c, err = decodeCursor(opts.Cursor, sort)
+		if err != nil {
+			return nil, err
+		}
+		condition, keysetArgs := keysetCondition(sort, c.Values, c.Before)
+		conditions = append(conditions, condition)
+		args = append(args, keysetArgs...)
+		page = " LIMIT ?"
+		args = append(args, opts.Limit+1)
+	} else {
+		page = " LIMIT ? OFFSET ?"
+		args = append(args, opts.Limit+1, opts.Offset)
+	}
+
+	// The sort columns are always selected so cursors can be built from the page
+	keys := make([]string, len(sort))
+	for i, field := range sort {
+		keys[i] = field.Column
+	}
+	columns := selectColumns(opts.Fields, keys...)
+	query := "SELECT " + strings.Join(columns, ", ") + " FROM users" + whereClause(conditions) + orderByClause(sort, c.Before) + page
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []model.User{}
+	for rows.Next() {
+		user, err := scanUserColumns(rows, columns)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	hasMore := len(users) > opts.Limit
+	if hasMore {
+		users = users[:opts.Limit]
+	}
+	if c.Before {
+		for i, j := 0, len(users)-1; i < j; i, j = i+1, j-1 {
+			users[i], users[j] = users[j], users[i]
+		}
+	}
+
+	result := &UserPage{Users: users, Total: total, Limit: opts.Limit, Offset: opts.Offset}
+	if len(users) == 0 {
+		return result, nil
+	}
+
+	hasPrev, hasNext := opts.Offset > 0, hasMore
+	if opts.Cursor != "" {
+		// Walking backwards, "more" means more rows before this page
+		// and the cursor's row itself is always after it
+		hasPrev, hasNext = !c.Before || hasMore, c.Before || hasMore
+	}
+	if hasPrev {
+		result.PrevCursor = encodeCursor(cursor{Sort: sortKey(sort), Values: sortValues(sort, users[0]), Before: true})
+	}
+	if hasNext {
+		result.NextCursor = encodeCursor(cursor{Sort: sortKey(sort), Values: sortValues(sort, users[len(users)-1])})
+	}
+
+	return result, nil
+}
+
+// whereClause joins conditions into a WHERE clause, or nothing if there are none
+func whereClause(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
+
+// GetUserByID retrieves a user by their ID from the database, optionally
+// only loading the given fields. Soft-deleted users are not found.
+func (r *userRepo) GetUserByID(id int, fields ...string) (*model.User, error) {
+	columns := selectColumns(fields, "user_id")
+	row := r.db.QueryRow("SELECT "+strings.Join(columns, ", ")+" FROM users WHERE user_id = ? AND "+notDeleted, id)
 
-	var user model.User
-	err := row.Scan(&user.ID, &user.UserName, &user.FirstName, &user.LastName, &user.Email, &user.Department, &user.UserStatus)
+	user, err := scanUserColumns(row, columns)
+	if err == sql.ErrNoRows {
+		return nil, Errorf(ErrNotFound, "no user found with ID %d", id)
+	}
 	if err != nil {
 		return nil, err
 	}	
@@ -58,10 +247,27 @@ func (r *userRepo) GetUserByID(id int) (*model.User, error) {
 	return &user, nil
 }
 
-// CheckIfUsernameExists checks if a username exists in the database
+// GetUserByUsername retrieves the user holding a username
+func (r *userRepo) GetUserByUsername(username string) (*model.User, error) {
+	row := r.db.QueryRow("SELECT "+userColumns+" FROM users WHERE user_name = ? AND "+notDeleted, username)
+
+	user, err := scanUser(row)
+	if err == sql.ErrNoRows {
+		return nil, Errorf(ErrNotFound, "no user found with username '%s'", username)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// CheckIfUsernameExists checks if a username is held by a user that has
+// not been deleted. Usernames of soft-deleted users can be reclaimed at
+// once; restoring such a user then fails with ErrUsernameTaken.
 func (r *userRepo) CheckIfUsernameExists(username string) (bool, error) {
-    var exists bool
-    err := r.db.QueryRow("SELECT COUNT(*) FROM users WHERE user_name = ?", username).Scan(&exists)
+    var count int
+    err := r.db.QueryRow("SELECT COUNT(*) FROM users WHERE user_name = ? AND "+notDeleted, username).Scan(&count)
     if err != nil {
 		if err == sql.ErrNoRows {
 			return false, nil
@@ -69,7 +275,7 @@ func (r *userRepo) CheckIfUsernameExists(username string) (bool, error) {
 
         return false, fmt.Errorf("failed to check username existence: %v", err)
     }
-    return exists, nil
+    return count > 0, nil
 }
 
 // CreateUser creates a new user in the database
@@ -80,42 +286,245 @@ func (r *userRepo) CreateUser(user model.User) (*model.User, error) {
     }
     
     if exists {
-        return nil, fmt.Errorf("username '%s' already exists", user.UserName)
+        return nil, UsernameExists(user.UserName)
     }
+	if err := r.resolveDepartment(&user, nil); err != nil {
+		return nil, err
+	}
+	if err := r.resolveManager(&user, nil); err != nil {
+		return nil, err
+	}
 	
-	result, err := r.db.Exec("INSERT INTO users (user_name, first_name, last_name, email, department, user_status) VALUES (?, ?, ?, ?, ?, ?)",
-		user.UserName, user.FirstName, user.LastName, user.Email, user.Department, user.UserStatus)
+	now := time.Now().UTC()
+	result, err := r.db.Exec("INSERT INTO users (user_name, first_name, last_name, email, department, department_id, manager_id, user_status, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		user.UserName, user.FirstName, user.LastName, user.Email, user.Department, nullID(user.DepartmentID), nullID(user.ManagerID), user.UserStatus, now, now)
 	if err != nil {
-		return nil, err	
+		return nil, userWriteError(err, user.UserName)
 	}
 
 	userID, err := result.LastInsertId()
 	user.ID = userID
+	user.Version = 1
+	user.CreatedAt, user.UpdatedAt = &now, &now
+	r.afterCommit(func() { r.suggestions.put(user) })
 
     return &user, nil
 }
 
-// UpdateUser updates a user in the database
+// CreateUserWithID creates a new user under the ID it already has, for
+// clients that choose the ID themselves. An ID still held by a deleted
+// user is a constraint violation.
+func (r *userRepo) CreateUserWithID(user model.User) (*model.User, error) {
+	exists, err := r.CheckIfUsernameExists(user.UserName)
+	if err != nil {
+		return nil, fmt.Errorf("error checking username: %w", err)
+	}
+	if exists {
+		return nil, UsernameExists(user.UserName)
+	}
+	if err := r.resolveDepartment(&user, nil); err != nil {
+		return nil, err
+	}
+	if err := r.resolveManager(&user, nil); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	_, err = r.db.Exec("INSERT INTO users (user_id, user_name, first_name, last_name, email, department, department_id, manager_id, user_status, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		user.ID, user.UserName, user.FirstName, user.LastName, user.Email, user.Department, nullID(user.DepartmentID), nullID(user.ManagerID), user.UserStatus, now, now)
+	if err != nil {
+		return nil, userWriteError(err, user.UserName)
+	}
+
+	user.Version = 1
+	user.CreatedAt, user.UpdatedAt = &now, &now
+	r.afterCommit(func() { r.suggestions.put(user) })
+	return &user, nil
+}
+
+// UpdateUser updates a user in the database and bumps its version. If
+// user.Version is set, the update only applies to that version of the
+// user and fails with ErrVersionConflict otherwise. A change of status
+// must be a plain transition, which is recorded as made by user.UpdatedBy.
 func (r *userRepo) UpdateUser(user model.User) (*model.User, error) {
 	// Check if user exists
-	_, err := r.GetUserByID(int(user.ID))
+	current, err := r.GetUserByID(int(user.ID))
 	if err != nil {
-		return nil, fmt.Errorf("user with ID %d not found: %w", user.ID, err)
+		return nil, err
+	}
+	// Every write path renames users through here, so this is the one
+	// place that keeps a rename from taking a username already held
+	if user.UserName != current.UserName {
+		exists, err := r.CheckIfUsernameExists(user.UserName)
+		if err != nil {
+			return nil, fmt.Errorf("error checking username: %w", err)
+		}
+		if exists {
+			return nil, UsernameExists(user.UserName)
+		}
+	}
+	if err := r.resolveDepartment(&user, current); err != nil {
+		return nil, err
+	}
+	if err := r.resolveManager(&user, current); err != nil {
+		return nil, err
+	}
+	transition, err := plainTransition(*current, user)
+	if err != nil {
+		return nil, err
+	}
+	if transition == nil {
+		return r.updateUser(user, *current)
+	}
+
+	// The transition is the one from current, so the write must not land
+	// on a later version
+	if user.Version == 0 {
+		user.Version = current.Version
+	}
+	var updated *model.User
+	err = r.atomically(func(tx *userRepo) error {
+		if updated, err = tx.updateUser(user, *current); err != nil {
+			return err
+		}
+		return tx.recordTransition(*updated, current.UserStatus, *transition, "", user.UpdatedBy)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// updateUser writes every field of a user over current, reading back the
+// new version
+func (r *userRepo) updateUser(user model.User, current model.User) (*model.User, error) {
+	now := time.Now().UTC()
+	err := r.db.QueryRow(
+		"UPDATE users SET user_name = ?, first_name = ?, last_name = ?, email = ?, department = ?, department_id = ?, manager_id = ?, user_status = ?, updated_at = ?, version = version + 1 WHERE user_id = ? AND "+notDeleted+" AND (? = 0 OR version = ?) RETURNING version",
+		user.UserName, user.FirstName, user.LastName, user.Email, user.Department, nullID(user.DepartmentID), nullID(user.ManagerID), user.UserStatus, now, user.ID, user.Version, user.Version).Scan(&user.Version)
+	if err == sql.ErrNoRows {
+		return nil, ErrVersionConflict
+	}
+	if err != nil {
+		return nil, userWriteError(err, user.UserName)
+	}
+	user.CreatedAt, user.UpdatedAt = current.CreatedAt, &now
+	r.afterCommit(func() { r.suggestions.put(user) })
+
+	return &user, nil
+}
+
+// resolveDepartment points a user at the department it names, by
+// department_id or by name, and fills in the other. The ID wins, unless it
+// is the one current already has and only the name was changed, as when a
+// patch moves the user by name. Names match ignoring case and surrounding
+// spaces. current is nil for a new user.
+func (r *userRepo) resolveDepartment(user *model.User, current *model.User) error {
+	if current != nil && user.DepartmentID == current.DepartmentID && user.Department == current.Department {
+		return nil
+	}
+
+	nameChanged := current == nil || user.Department != current.Department
+	name := strings.TrimSpace(user.Department)
+	if user.DepartmentID != 0 && (name == "" || current == nil || user.DepartmentID != current.DepartmentID) {
+		department, err := findDepartment(r.db, "department_id = ?", user.DepartmentID)
+		if err == sql.ErrNoRows {
+			return FieldErrorf("department_id", model.FieldInvalid, "no department found with ID %d", user.DepartmentID)
+		}
+		if err != nil {
+			return err
+		}
+		if name != "" && nameChanged && !strings.EqualFold(name, department.Name) {
+			return FieldErrorf("department", model.FieldInvalid, "department %q is not department %d, %q", name, department.ID, department.Name)
+		}
+		user.Department = department.Name
+		return nil
+	}
+
+	if name == "" {
+		user.DepartmentID, user.Department = 0, ""
+		return nil
+	}
+	department, err := findDepartment(r.db, "name = ?", name)
+	if err == sql.ErrNoRows {
+		return FieldErrorf("department", model.FieldInvalid, "unknown department %q", name)
+	}
+	if err != nil {
+		return err
+	}
+	user.DepartmentID, user.Department = department.ID, department.Name
+	return nil
+}
+
+// DeleteUser soft-deletes a user, recording when and by whom; the row is
+// kept and can be restored. A non-zero version makes the delete conditional
+// on it, failing with ErrVersionConflict otherwise.
+func (r *userRepo) DeleteUser(id int, version int64, deletedBy string) (bool, error) {
+	now := time.Now().UTC()
+	result, err := r.db.Exec(
+		"UPDATE users SET deleted_at = ?, deleted_by = ?, updated_at = ?, version = version + 1 WHERE user_id = ? AND "+notDeleted+" AND (? = 0 OR version = ?)",
+		now, deletedBy, now, id, version, version)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if rowsAffected == 0 && version != 0 {
+		// Tell a stale version apart from a missing user
+		if _, err := r.GetUserByID(id, "user_id"); err == nil {
+			return false, ErrVersionConflict
+		}
+	}
+	if rowsAffected > 0 {
+		r.afterCommit(func() { r.suggestions.remove(int64(id)) })
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// RestoreUser undoes a soft delete. It fails with ErrUsernameTaken if
+// another user has reclaimed the username in the meantime.
+func (r *userRepo) RestoreUser(id int) (*model.User, error) {
+	row := r.db.QueryRow("SELECT "+userColumns+" FROM users WHERE user_id = ? AND deleted_at IS NOT NULL", id)
+	user, err := scanUser(row)
+	if err == sql.ErrNoRows {
+		return nil, Errorf(ErrNotFound, "no deleted user with ID %d", id)
 	}
-	
-	// Update the user
-	_, err = r.db.Exec(
-		"UPDATE users SET user_name = ?, first_name = ?, last_name = ?, email = ?, department = ?, user_status = ? WHERE user_id = ?",
-		user.UserName, user.FirstName, user.LastName, user.Email, user.Department, user.UserStatus, user.ID)
 	if err != nil {
 		return nil, err
 	}
 
+	taken, err := r.CheckIfUsernameExists(user.UserName)
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, ErrUsernameTaken
+	}
+
+	now := time.Now().UTC()
+	err = r.db.QueryRow(
+		"UPDATE users SET deleted_at = NULL, deleted_by = NULL, updated_at = ?, version = version + 1 WHERE user_id = ? AND version = ? RETURNING version",
+		now, id, user.Version).Scan(&user.Version)
+	if err == sql.ErrNoRows {
+		return nil, ErrVersionConflict
+	}
+	if err != nil {
+		return nil, constraintError(err)
+	}
+	user.DeletedAt, user.DeletedBy = nil, ""
+	user.UpdatedAt = &now
+	r.afterCommit(func() { r.suggestions.put(user) })
+
 	return &user, nil
 }
 
-// DeleteUser deletes a user from the database
-func (r *userRepo) DeleteUser(id int) (bool, error) {
+// PurgeUser permanently deletes a user, whether or not it has been
+// soft-deleted first
+func (r *userRepo) PurgeUser(id int) (bool, error) {
 	result, err := r.db.Exec("DELETE FROM users WHERE user_id = ?", id)
 	if err != nil {
 		return false, err
@@ -125,6 +534,9 @@ func (r *userRepo) DeleteUser(id int) (bool, error) {
 	if err != nil {
 		return false, err
 	}
+	if rowsAffected > 0 {
+		r.afterCommit(func() { r.suggestions.remove(int64(id)) })
+	}
 
 	return rowsAffected > 0, nil
 }
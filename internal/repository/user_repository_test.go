@@ -4,11 +4,14 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"sample-service/internal/filter"
 	"sample-service/internal/model"
 	"sample-service/internal/repository"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/mattn/go-sqlite3"
 	"github.com/onsi/ginkgo/v2"
 	"github.com/onsi/gomega"
 )
@@ -25,8 +28,10 @@ var expectedUsers = []model.User{
 		FirstName:  "John",
 		LastName:   "Doe",
 		Email:      "john.doe@company.com",
-		Department: "Engineering",
-		UserStatus: "A",
+		Department:   "Engineering",
+		DepartmentID: 1,
+		UserStatus:   "A",
+		Version:    1,
 	},
 	{
 		ID:         2,
@@ -34,8 +39,10 @@ var expectedUsers = []model.User{
 		FirstName:  "Jane",
 		LastName:   "Smith",
 		Email:      "jane.smith@company.com",
-		Department: "Marketing",
-		UserStatus: "A",
+		Department:   "Marketing",
+		DepartmentID: 2,
+		UserStatus:   "A",
+		Version:    1,
 	},
 }
 
@@ -63,15 +70,15 @@ var _ = ginkgo.Describe("UserRepository", func() {
 	ginkgo.Context("GetAllUsers", func() {
 		ginkgo.It("should return all users", func() {
 			// Setup the expected query
-			rows := sqlmock.NewRows([]string{"user_id", "user_name", "first_name", "last_name", "email", "department", "user_status"})
+			rows := sqlmock.NewRows([]string{"user_id", "user_name", "first_name", "last_name", "email", "department", "user_status", "version", "deleted_at", "deleted_by", "created_at", "updated_at", "department_id", "manager_id"})
 			
 			// Add rows to the mock result
 			for _, user := range expectedUsers {
-				rows.AddRow(user.ID, user.UserName, user.FirstName, user.LastName, user.Email, user.Department, user.UserStatus)
+				rows.AddRow(user.ID, user.UserName, user.FirstName, user.LastName, user.Email, user.Department, user.UserStatus, user.Version, nil, nil, nil, nil, user.DepartmentID, nil)
 			}
 
 			// Expect the query to be executed
-			mock.ExpectQuery("SELECT \\* FROM users").WillReturnRows(rows)
+			mock.ExpectQuery("SELECT user_id, user_name, first_name, last_name, email, department, user_status, version, deleted_at, deleted_by, created_at, updated_at, department_id, manager_id FROM users").WillReturnRows(rows)
 
 			// Call the function
 			users, err := userRepo.GetAllUsers()
@@ -90,7 +97,7 @@ var _ = ginkgo.Describe("UserRepository", func() {
 		ginkgo.It("should return an error when the database query fails", func() {
 			// Setup the expected query
 			expectedError := errors.New("database query failed")
-			mock.ExpectQuery("SELECT \\* FROM users").WillReturnError(expectedError)
+			mock.ExpectQuery("SELECT user_id, user_name, first_name, last_name, email, department, user_status, version, deleted_at, deleted_by, created_at, updated_at, department_id, manager_id FROM users").WillReturnError(expectedError)
 
 			// Call the function
 			users, err := userRepo.GetAllUsers()
@@ -105,17 +112,391 @@ var _ = ginkgo.Describe("UserRepository", func() {
 		})
 	})
 
+	ginkgo.Context("EachUser", func() {
+		ginkgo.It("should visit users in ID order until told to stop", func() {
+			rows := sqlmock.NewRows([]string{"user_id", "user_name", "first_name", "last_name", "email", "department", "user_status", "version", "deleted_at", "deleted_by", "created_at", "updated_at", "department_id", "manager_id"})
+			for _, user := range expectedUsers {
+				rows.AddRow(user.ID, user.UserName, user.FirstName, user.LastName, user.Email, user.Department, user.UserStatus, user.Version, nil, nil, nil, nil, user.DepartmentID, nil)
+			}
+			mock.ExpectQuery("SELECT .* FROM users WHERE deleted_at IS NULL ORDER BY user_id").WillReturnRows(rows)
+
+			// Call the function, stopping after the first user
+			stop := errors.New("stop")
+			var visited []model.User
+			err := userRepo.EachUser(func(user model.User) error {
+				visited = append(visited, user)
+				return stop
+			})
+
+			// Assertions
+			gomega.Expect(err).To(gomega.Equal(stop))
+			gomega.Expect(visited).To(gomega.Equal(expectedUsers[:1]))
+
+			// Verify all expectations were met
+			err = mock.ExpectationsWereMet()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		})
+	})
+
+	ginkgo.Context("ListUsers", func() {
+		userRows := func(users ...model.User) *sqlmock.Rows {
+			rows := sqlmock.NewRows([]string{"user_id", "user_name", "first_name", "last_name", "email", "department", "user_status", "version", "deleted_at", "deleted_by", "created_at", "updated_at", "department_id", "manager_id"})
+			for _, user := range users {
+				rows.AddRow(user.ID, user.UserName, user.FirstName, user.LastName, user.Email, user.Department, user.UserStatus, user.Version, nil, nil, nil, nil, user.DepartmentID, nil)
+			}
+			return rows
+		}
+
+		ginkgo.It("should return the first page with a cursor to the next one", func() {
+			// Expect the count and the page query, fetching one extra row
+			mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM users").
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+			mock.ExpectQuery("SELECT user_id, user_name, first_name, last_name, email, department, user_status, version, deleted_at, deleted_by, created_at, updated_at, department_id, manager_id FROM users WHERE deleted_at IS NULL ORDER BY user_id LIMIT \\? OFFSET \\?").
+				WithArgs(2, 0).
+				WillReturnRows(userRows(expectedUsers...))
+
+			// Call the function
+			page, err := userRepo.ListUsers(repository.ListOptions{Limit: 1})
+
+			// Assertions
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(page.Users).To(gomega.Equal(expectedUsers[:1]))
+			gomega.Expect(page.Total).To(gomega.Equal(2))
+			gomega.Expect(page.Limit).To(gomega.Equal(1))
+			gomega.Expect(page.PrevCursor).To(gomega.BeEmpty())
+			gomega.Expect(page.NextCursor).NotTo(gomega.BeEmpty())
+
+			// Verify all expectations were met
+			err = mock.ExpectationsWereMet()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		})
+
+		ginkgo.It("should continue from a next cursor", func() {
+			// First page
+			mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM users").
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+			mock.ExpectQuery("FROM users WHERE deleted_at IS NULL ORDER BY user_id LIMIT \\? OFFSET \\?").
+				WithArgs(2, 0).
+				WillReturnRows(userRows(expectedUsers...))
+			first, err := userRepo.ListUsers(repository.ListOptions{Limit: 1})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			// Second page, continuing after the last user of the first one
+			mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM users").
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+			mock.ExpectQuery("FROM users WHERE deleted_at IS NULL AND user_id > \\? ORDER BY user_id LIMIT \\?").
+				WithArgs(int64(1), 2).
+				WillReturnRows(userRows(expectedUsers[1]))
+			second, err := userRepo.ListUsers(repository.ListOptions{Limit: 1, Cursor: first.NextCursor})
+
+			// Assertions
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(second.Users).To(gomega.Equal(expectedUsers[1:]))
+			gomega.Expect(second.NextCursor).To(gomega.BeEmpty())
+			gomega.Expect(second.PrevCursor).NotTo(gomega.BeEmpty())
+
+			// Walking back from the second page returns the first one in order
+			mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM users").
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+			mock.ExpectQuery("FROM users WHERE deleted_at IS NULL AND user_id < \\? ORDER BY user_id DESC LIMIT \\?").
+				WithArgs(int64(2), 2).
+				WillReturnRows(userRows(expectedUsers[0]))
+			back, err := userRepo.ListUsers(repository.ListOptions{Limit: 1, Cursor: second.PrevCursor})
+
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(back.Users).To(gomega.Equal(expectedUsers[:1]))
+			gomega.Expect(back.PrevCursor).To(gomega.BeEmpty())
+			gomega.Expect(back.NextCursor).NotTo(gomega.BeEmpty())
+
+			// Verify all expectations were met
+			err = mock.ExpectationsWereMet()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		})
+
+		ginkgo.It("should compile the filter into a parameterized condition", func() {
+			// Parse the filter the way the controller does
+			where, err := filter.Parse(`department eq "Engineering" and (user_name sw "jo_" or not email ew "@company.com") and user_status in ("A", "I")`)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			// Both the count and the page query carry the same condition
+			condition := "WHERE deleted_at IS NULL AND \\(\\(department = \\? AND \\(user_name LIKE \\? ESCAPE '\\\\' OR NOT \\(email LIKE \\? ESCAPE '\\\\'\\)\\)\\) AND user_status IN \\(\\?, \\?\\)\\)"
+			mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM users " + condition).
+				WithArgs("Engineering", `jo\_%`, "%@company.com", "A", "I").
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+			mock.ExpectQuery("FROM users " + condition + " ORDER BY user_id LIMIT \\? OFFSET \\?").
+				WithArgs("Engineering", `jo\_%`, "%@company.com", "A", "I", 51, 0).
+				WillReturnRows(userRows(expectedUsers[0]))
+
+			// Call the function
+			page, err := userRepo.ListUsers(repository.ListOptions{Filter: where})
+
+			// Assertions
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(page.Users).To(gomega.Equal(expectedUsers[:1]))
+			gomega.Expect(page.Total).To(gomega.Equal(1))
+
+			// Verify all expectations were met
+			err = mock.ExpectationsWereMet()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		})
+
+		ginkgo.It("should combine the filter with a cursor", func() {
+			where, err := filter.Parse(`department eq null`)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM users WHERE deleted_at IS NULL AND department IS NULL").
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+			mock.ExpectQuery("FROM users WHERE deleted_at IS NULL AND department IS NULL AND user_id > \\? ORDER BY user_id LIMIT \\?").
+				WithArgs(int64(7), 11).
+				WillReturnRows(userRows())
+
+			// Call the function with a cursor continuing after user 7
+			page, err := userRepo.ListUsers(repository.ListOptions{Limit: 10, Filter: where, Cursor: "eyJzIjoidXNlcl9pZCIsInYiOls3XX0"})
+
+			// Assertions
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(page.Users).To(gomega.BeEmpty())
+			gomega.Expect(page.NextCursor).To(gomega.BeEmpty())
+
+			// Verify all expectations were met
+			err = mock.ExpectationsWereMet()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		})
+
+		ginkgo.It("should sort by several columns and resume from a cursor on all of them", func() {
+			sort, err := repository.ParseSort("last_name,-department")
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			// Text columns are ordered with the Unicode collation and user_id breaks ties
+			mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM users").
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+			mock.ExpectQuery("FROM users WHERE deleted_at IS NULL ORDER BY last_name COLLATE UNICODE_NOCASE, IFNULL\\(department, ''\\) COLLATE UNICODE_NOCASE DESC, user_id LIMIT \\? OFFSET \\?").
+				WithArgs(2, 0).
+				WillReturnRows(userRows(expectedUsers...))
+			first, err := userRepo.ListUsers(repository.ListOptions{Limit: 1, Sort: sort})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			// The next page starts strictly after (Doe, Engineering, 1)
+			mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM users").
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+			mock.ExpectQuery("FROM users WHERE deleted_at IS NULL AND \\(\\(last_name COLLATE UNICODE_NOCASE > \\?\\) " +
+				"OR \\(last_name COLLATE UNICODE_NOCASE = \\? AND IFNULL\\(department, ''\\) COLLATE UNICODE_NOCASE < \\?\\) " +
+				"OR \\(last_name COLLATE UNICODE_NOCASE = \\? AND IFNULL\\(department, ''\\) COLLATE UNICODE_NOCASE = \\? AND user_id > \\?\\)\\) " +
+				"ORDER BY last_name COLLATE UNICODE_NOCASE, IFNULL\\(department, ''\\) COLLATE UNICODE_NOCASE DESC, user_id LIMIT \\?").
+				WithArgs("Doe", "Doe", "Engineering", "Doe", "Engineering", int64(1), 2).
+				WillReturnRows(userRows(expectedUsers[1]))
+			second, err := userRepo.ListUsers(repository.ListOptions{Limit: 1, Sort: sort, Cursor: first.NextCursor})
+
+			// Assertions
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(second.Users).To(gomega.Equal(expectedUsers[1:]))
+
+			// The cursor cannot be reused under another ordering
+			mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM users").
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+			_, err = userRepo.ListUsers(repository.ListOptions{Limit: 1, Cursor: first.NextCursor})
+			gomega.Expect(err).To(gomega.Equal(repository.ErrInvalidCursor))
+
+			// Verify all expectations were met
+			err = mock.ExpectationsWereMet()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		})
+
+		ginkgo.It("should select only the requested fields and the sort keys", func() {
+			mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM users").
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+			mock.ExpectQuery("SELECT user_id, user_name, last_name FROM users WHERE deleted_at IS NULL ORDER BY last_name COLLATE UNICODE_NOCASE, user_id LIMIT \\? OFFSET \\?").
+				WithArgs(51, 0).
+				WillReturnRows(sqlmock.NewRows([]string{"user_id", "user_name", "last_name"}).AddRow(1, "jdoe", "Doe"))
+
+			// Call the function
+			page, err := userRepo.ListUsers(repository.ListOptions{
+				Fields: []string{"user_name"},
+				Sort:   []repository.SortField{{Column: "last_name"}},
+			})
+
+			// Assertions
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(page.Users).To(gomega.Equal([]model.User{{ID: 1, UserName: "jdoe", LastName: "Doe"}}))
+
+			// Verify all expectations were met
+			err = mock.ExpectationsWereMet()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		})
+
+		ginkgo.It("should reject a malformed cursor", func() {
+			mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM users").
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+
+			// Call the function
+			_, err := userRepo.ListUsers(repository.ListOptions{Cursor: "not a cursor"})
+
+			// Assertions
+			gomega.Expect(err).To(gomega.Equal(repository.ErrInvalidCursor))
+		})
+
+		ginkgo.It("should reject an offset combined with a cursor", func() {
+			// Call the function
+			_, err := userRepo.ListUsers(repository.ListOptions{Offset: 5, Cursor: "abc"})
+
+			// Assertions
+			gomega.Expect(err).To(gomega.HaveOccurred())
+
+			// No query should have been issued
+			err = mock.ExpectationsWereMet()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		})
+	})
+
+	ginkgo.Context("ParseSort", func() {
+		ginkgo.It("should parse ascending and descending columns in order", func() {
+			sort, err := repository.ParseSort("last_name, -department,user_id")
+
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(sort).To(gomega.Equal([]repository.SortField{
+				{Column: "last_name"},
+				{Column: "department", Desc: true},
+				{Column: "user_id"},
+			}))
+		})
+
+		ginkgo.DescribeTable("should reject invalid sorts",
+			func(raw string, message string) {
+				_, err := repository.ParseSort(raw)
+
+				gomega.Expect(err).To(gomega.MatchError(message))
+			},
+			ginkgo.Entry("unknown column", "last_name,salary", `cannot sort by "salary"`),
+			ginkgo.Entry("empty column", "last_name,,email", "sort contains an empty column"),
+			ginkgo.Entry("repeated column", "email,-email", `column "email" appears more than once in sort`),
+		)
+	})
+
+	ginkgo.Context("SearchUsers", func() {
+		searchRows := func() *sqlmock.Rows {
+			return sqlmock.NewRows([]string{"user_id", "user_name", "first_name", "last_name", "email", "department", "user_status", "version", "department_id", "manager_id",
+				"score", "snippet", "h_first_name", "h_last_name", "h_user_name", "h_email", "h_department"})
+		}
+
+		ginkgo.It("should rank prefix matches and mark them up", func() {
+			user := expectedUsers[0]
+			rows := searchRows().AddRow(user.ID, user.UserName, user.FirstName, user.LastName, user.Email, user.Department, user.UserStatus, user.Version, user.DepartmentID, nil,
+				3.5, "\x02John\x03 & co", "\x02John\x03", "Doe", "johndoe", "\x02john\x03.doe@company.com", "Engineering")
+
+			// Every word becomes a quoted prefix term
+			mock.ExpectQuery("FROM users_fts JOIN users u ON u.user_id = users_fts.rowid WHERE users_fts MATCH \\? AND u.deleted_at IS NULL ORDER BY score DESC, u.user_id LIMIT \\?").
+				WithArgs(`"john"* "OR"* "Eng"*`, repository.DefaultSearchLimit).
+				WillReturnRows(rows)
+
+			// Call the function with syntax that must reach FTS5 as plain words
+			results, err := userRepo.SearchUsers(`john" OR "Eng*`, 0)
+
+			// Assertions
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(results).To(gomega.HaveLen(1))
+			gomega.Expect(results[0].User).To(gomega.Equal(user))
+			gomega.Expect(results[0].Score).To(gomega.Equal(3.5))
+			gomega.Expect(results[0].Snippet).To(gomega.Equal("<mark>John</mark> &amp; co"))
+			gomega.Expect(results[0].Highlights).To(gomega.Equal(map[string]string{
+				"first_name": "<mark>John</mark>",
+				"email":      "<mark>john</mark>.doe@company.com",
+			}))
+
+			// Verify all expectations were met
+			err = mock.ExpectationsWereMet()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		})
+
+		ginkgo.It("should cap the number of results", func() {
+			mock.ExpectQuery("WHERE users_fts MATCH \\?").
+				WithArgs(`"émilie"*`, repository.MaxSearchLimit).
+				WillReturnRows(searchRows())
+
+			// Call the function
+			results, err := userRepo.SearchUsers("émilie", 1000)
+
+			// Assertions
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(results).To(gomega.BeEmpty())
+		})
+
+		ginkgo.It("should reject a query without words", func() {
+			// Call the function
+			_, err := userRepo.SearchUsers(" -*- ", 10)
+
+			// Assertions
+			gomega.Expect(err).To(gomega.Equal(repository.ErrEmptySearch))
+
+			// No query should have been issued
+			err = mock.ExpectationsWereMet()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		})
+	})
+
+	ginkgo.Context("SuggestUsers", func() {
+		ginkgo.It("should load the index once and keep it current as users are written", func() {
+			// The first suggestion loads every user
+			rows := sqlmock.NewRows([]string{"user_id", "user_name", "first_name", "last_name", "email", "department", "user_status", "version", "deleted_at", "deleted_by", "created_at", "updated_at", "department_id", "manager_id"})
+			for _, user := range expectedUsers {
+				rows.AddRow(user.ID, user.UserName, user.FirstName, user.LastName, user.Email, user.Department, user.UserStatus, user.Version, nil, nil, nil, nil, user.DepartmentID, nil)
+			}
+			mock.ExpectQuery("SELECT user_id, user_name, first_name, last_name, email, department, user_status, version, deleted_at, deleted_by, created_at, updated_at, department_id, manager_id FROM users").WillReturnRows(rows)
+
+			suggestions, err := userRepo.SuggestUsers("jhon", 0)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(suggestions).To(gomega.HaveLen(1))
+			gomega.Expect(suggestions[0].User).To(gomega.Equal(expectedUsers[0]))
+
+			// Creating a user adds it without reloading
+			created := model.User{UserName: "jbrown", FirstName: "Jöhn", LastName: "Brown", Email: "jb@company.com", Department: "IT", UserStatus: "A"}
+			mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM users WHERE user_name = \\?").
+				WithArgs(created.UserName).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+			mock.ExpectQuery("SELECT department_id, name FROM departments WHERE name = \\?").
+				WithArgs("IT").
+				WillReturnRows(sqlmock.NewRows([]string{"department_id", "name"}).AddRow(4, "IT"))
+			mock.ExpectExec("INSERT INTO users").WillReturnResult(sqlmock.NewResult(3, 1))
+			_, err = userRepo.CreateUser(created)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			// Deleting a user removes it
+			mock.ExpectExec("UPDATE users SET deleted_at = \\?").WillReturnResult(sqlmock.NewResult(0, 1))
+			_, err = userRepo.DeleteUser(1, 0, "admin")
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			suggestions, err = userRepo.SuggestUsers("john", 5)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(suggestions).To(gomega.HaveLen(1))
+			gomega.Expect(suggestions[0].User.ID).To(gomega.Equal(int64(3)))
+
+			// Verify all expectations were met
+			err = mock.ExpectationsWereMet()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		})
+
+		ginkgo.It("should return an error when the index cannot be loaded", func() {
+			expectedError := errors.New("database query failed")
+			mock.ExpectQuery("SELECT user_id, user_name, first_name, last_name, email, department, user_status, version, deleted_at, deleted_by, created_at, updated_at, department_id, manager_id FROM users").WillReturnError(expectedError)
+
+			// Call the function
+			_, err := userRepo.SuggestUsers("jo", 5)
+
+			// Assertions
+			gomega.Expect(err).To(gomega.Equal(expectedError))
+		})
+	})
+
 	ginkgo.Context("GetUserByID", func() {
 		ginkgo.It("should return a user by ID", func() {
 			// Setup the expected query
-			rows := sqlmock.NewRows([]string{"user_id", "user_name", "first_name", "last_name", "email", "department", "user_status"})
+			rows := sqlmock.NewRows([]string{"user_id", "user_name", "first_name", "last_name", "email", "department", "user_status", "version", "deleted_at", "deleted_by", "created_at", "updated_at", "department_id", "manager_id"})
 			
 			// Add a single row for the expected user
 			expectedUser := expectedUsers[0]
-			rows.AddRow(expectedUser.ID, expectedUser.UserName, expectedUser.FirstName, expectedUser.LastName, expectedUser.Email, expectedUser.Department, expectedUser.UserStatus)
+			rows.AddRow(expectedUser.ID, expectedUser.UserName, expectedUser.FirstName, expectedUser.LastName, expectedUser.Email, expectedUser.Department, expectedUser.UserStatus, expectedUser.Version, nil, nil, nil, nil, expectedUser.DepartmentID, nil)
 
 			// Expect the query to be executed
-			mock.ExpectQuery("SELECT \\* FROM users WHERE user_id = \\?").WithArgs(1).WillReturnRows(rows)
+			mock.ExpectQuery("SELECT user_id, user_name, first_name, last_name, email, department, user_status, version, deleted_at, deleted_by, created_at, updated_at, department_id, manager_id FROM users WHERE user_id = \\?").WithArgs(1).WillReturnRows(rows)
 
 			// Call the function
 			user, err := userRepo.GetUserByID(1)
@@ -132,7 +513,7 @@ var _ = ginkgo.Describe("UserRepository", func() {
 		ginkgo.It("should return an error when the database query fails", func() {
 			// Setup the expected query
 			expectedError := errors.New("database query failed")
-			mock.ExpectQuery("SELECT \\* FROM users WHERE user_id = \\?").WithArgs(1).WillReturnError(expectedError)
+			mock.ExpectQuery("SELECT user_id, user_name, first_name, last_name, email, department, user_status, version, deleted_at, deleted_by, created_at, updated_at, department_id, manager_id FROM users WHERE user_id = \\?").WithArgs(1).WillReturnError(expectedError)
 
 			// Call the function
 			user, err := userRepo.GetUserByID(1)
@@ -147,6 +528,26 @@ var _ = ginkgo.Describe("UserRepository", func() {
 		})
 	})
 
+	ginkgo.Context("GetUserByUsername", func() {
+		ginkgo.It("should return the active user holding a username", func() {
+			user := expectedUsers[1]
+			rows := sqlmock.NewRows([]string{"user_id", "user_name", "first_name", "last_name", "email", "department", "user_status", "version", "deleted_at", "deleted_by", "created_at", "updated_at", "department_id", "manager_id"}).
+				AddRow(user.ID, user.UserName, user.FirstName, user.LastName, user.Email, user.Department, user.UserStatus, user.Version, nil, nil, nil, nil, user.DepartmentID, nil)
+			mock.ExpectQuery("SELECT .* FROM users WHERE user_name = \\? AND deleted_at IS NULL").WithArgs("janesmith").WillReturnRows(rows)
+
+			// Call the function
+			found, err := userRepo.GetUserByUsername("janesmith")
+
+			// Assertions
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(*found).To(gomega.Equal(user))
+
+			// Verify all expectations were met
+			err = mock.ExpectationsWereMet()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		})
+	})
+
 	ginkgo.Context("CheckIfUsernameExists", func() {
 		ginkgo.It("should return true if the username exists", func() {
 			// Setup the expected query with a count column
@@ -202,16 +603,25 @@ var _ = ginkgo.Describe("UserRepository", func() {
 			mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM users WHERE user_name = \\?").
 				WithArgs(expectedUser.UserName).
 				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+			// The department is looked up by its ID
+			mock.ExpectQuery("SELECT department_id, name FROM departments WHERE department_id = \\?").
+				WithArgs(expectedUser.DepartmentID).
+				WillReturnRows(sqlmock.NewRows([]string{"department_id", "name"}).AddRow(1, "Engineering"))
 			
 			// Then, mock the insert query
-			mock.ExpectExec("INSERT INTO users \\(user_name, first_name, last_name, email, department, user_status\\) VALUES \\(\\?, \\?, \\?, \\?, \\?, \\?\\)").
+			mock.ExpectExec("INSERT INTO users \\(user_name, first_name, last_name, email, department, department_id, manager_id, user_status, created_at, updated_at\\) VALUES \\(\\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?\\)").
 				WithArgs(
 					expectedUser.UserName,
 					expectedUser.FirstName,
 					expectedUser.LastName,
 					expectedUser.Email,
 					expectedUser.Department,
+					expectedUser.DepartmentID,
+					nil,
 					expectedUser.UserStatus,
+					sqlmock.AnyArg(),
+					sqlmock.AnyArg(),
 				).
 				WillReturnResult(sqlmock.NewResult(1, 1)) // id=1, affected=1
 			
@@ -222,9 +632,14 @@ var _ = ginkgo.Describe("UserRepository", func() {
 			gomega.Expect(err).NotTo(gomega.HaveOccurred())
 			gomega.Expect(user.ID).To(gomega.Equal(int64(1))) // ID should be set from LastInsertId
 			
+			// The user is stamped with when it was created
+			gomega.Expect(user.CreatedAt).NotTo(gomega.BeNil())
+			gomega.Expect(user.UpdatedAt).To(gomega.Equal(user.CreatedAt))
+
 			// Create a copy of expectedUser with ID=1 for comparison
 			expectedUserWithID := expectedUser
 			expectedUserWithID.ID = 1
+			expectedUserWithID.CreatedAt, expectedUserWithID.UpdatedAt = user.CreatedAt, user.UpdatedAt
 			gomega.Expect(*user).To(gomega.Equal(expectedUserWithID))
 			
 			// Verify all expectations were met
@@ -246,6 +661,7 @@ var _ = ginkgo.Describe("UserRepository", func() {
 			
 			// Assertions
 			gomega.Expect(err).To(gomega.HaveOccurred())
+			gomega.Expect(errors.Is(err, repository.ErrConflict)).To(gomega.BeTrue())
 
 			// Verify all expectations were met
 			err = mock.ExpectationsWereMet()
@@ -260,17 +676,23 @@ var _ = ginkgo.Describe("UserRepository", func() {
 			mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM users WHERE user_name = \\?").
 				WithArgs(expectedUser.UserName).
 				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+			mock.ExpectQuery("FROM departments WHERE department_id = \\?").
+				WillReturnRows(sqlmock.NewRows([]string{"department_id", "name"}).AddRow(1, "Engineering"))
 
 			// Setup the expected query
 			expectedError := errors.New("database query failed")
-			mock.ExpectExec("INSERT INTO users \\(user_name, first_name, last_name, email, department, user_status\\) VALUES \\(\\?, \\?, \\?, \\?, \\?, \\?\\)").
+			mock.ExpectExec("INSERT INTO users \\(user_name, first_name, last_name, email, department, department_id, manager_id, user_status, created_at, updated_at\\) VALUES \\(\\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?\\)").
 				WithArgs(
 					expectedUser.UserName,
 					expectedUser.FirstName,
 					expectedUser.LastName,
 					expectedUser.Email,
 					expectedUser.Department,
+					expectedUser.DepartmentID,
+					nil,
 					expectedUser.UserStatus,
+					sqlmock.AnyArg(),
+					sqlmock.AnyArg(),
 				).
 				WillReturnError(expectedError)
 
@@ -284,6 +706,29 @@ var _ = ginkgo.Describe("UserRepository", func() {
 			err = mock.ExpectationsWereMet()
 			gomega.Expect(err).NotTo(gomega.HaveOccurred())
 		})
+
+		ginkgo.It("should create a user under the ID it is given", func() {
+			expectedUser := expectedUsers[0]
+			expectedUser.ID = 42
+			mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM users WHERE user_name = \\?").
+				WithArgs(expectedUser.UserName).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+			mock.ExpectQuery("FROM departments WHERE department_id = \\?").
+				WillReturnRows(sqlmock.NewRows([]string{"department_id", "name"}).AddRow(1, "Engineering"))
+			mock.ExpectExec("INSERT INTO users \\(user_id, user_name, first_name, last_name, email, department, department_id, manager_id, user_status, created_at, updated_at\\)").
+				WithArgs(int64(42), expectedUser.UserName, expectedUser.FirstName, expectedUser.LastName,
+					expectedUser.Email, expectedUser.Department, expectedUser.DepartmentID, nil, expectedUser.UserStatus, sqlmock.AnyArg(), sqlmock.AnyArg()).
+				WillReturnResult(sqlmock.NewResult(42, 1))
+
+			// Call the function
+			user, err := userRepo.CreateUserWithID(expectedUser)
+
+			// Assertions
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(user.ID).To(gomega.Equal(int64(42)))
+			gomega.Expect(user.Version).To(gomega.Equal(int64(1)))
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
 	})
 
 	ginkgo.Context("UpdateUser", func() {
@@ -292,25 +737,30 @@ var _ = ginkgo.Describe("UserRepository", func() {
 			expectedUser := expectedUsers[0]
     
 			// First, mock the GetUserByID query (not COUNT)
-			rows := sqlmock.NewRows([]string{"user_id", "user_name", "first_name", "last_name", "email", "department", "user_status"})
-			rows.AddRow(expectedUser.ID, expectedUser.UserName, expectedUser.FirstName, expectedUser.LastName, expectedUser.Email, expectedUser.Department, expectedUser.UserStatus)
+			rows := sqlmock.NewRows([]string{"user_id", "user_name", "first_name", "last_name", "email", "department", "user_status", "version", "deleted_at", "deleted_by", "created_at", "updated_at", "department_id", "manager_id"})
+			rows.AddRow(expectedUser.ID, expectedUser.UserName, expectedUser.FirstName, expectedUser.LastName, expectedUser.Email, expectedUser.Department, expectedUser.UserStatus, expectedUser.Version, nil, nil, nil, nil, expectedUser.DepartmentID, nil)
 			
-			mock.ExpectQuery("SELECT \\* FROM users WHERE user_id = \\?").
+			mock.ExpectQuery("SELECT user_id, user_name, first_name, last_name, email, department, user_status, version, deleted_at, deleted_by, created_at, updated_at, department_id, manager_id FROM users WHERE user_id = \\?").
 				WithArgs(expectedUser.ID).
 				WillReturnRows(rows)
 			
 			// Then, mock the update query
-			mock.ExpectExec("UPDATE users SET user_name = \\?, first_name = \\?, last_name = \\?, email = \\?, department = \\?, user_status = \\? WHERE user_id = \\?").
+			mock.ExpectQuery("UPDATE users SET user_name = \\?, first_name = \\?, last_name = \\?, email = \\?, department = \\?, department_id = \\?, manager_id = \\?, user_status = \\?, updated_at = \\?, version = version \\+ 1 WHERE user_id = \\? AND deleted_at IS NULL AND \\(\\? = 0 OR version = \\?\\) RETURNING version").
 				WithArgs(
 					expectedUser.UserName,
 					expectedUser.FirstName,
 					expectedUser.LastName,
 					expectedUser.Email,
 					expectedUser.Department,
+					expectedUser.DepartmentID,
+					nil,
 					expectedUser.UserStatus,
+					sqlmock.AnyArg(),
 					expectedUser.ID,
+					expectedUser.Version,
+					expectedUser.Version,
 				).
-				WillReturnResult(sqlmock.NewResult(1, 1)) // id=1, affected=1
+				WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(2))
 			
 			// Call the function
 			user, err := userRepo.UpdateUser(expectedUser)
@@ -321,6 +771,9 @@ var _ = ginkgo.Describe("UserRepository", func() {
 			// Create a copy of expectedUser with ID=1 for comparison
 			expectedUserWithID := expectedUser
 			expectedUserWithID.ID = 1
+			expectedUserWithID.Version = 2
+			gomega.Expect(user.UpdatedAt).NotTo(gomega.BeNil())
+			expectedUserWithID.UpdatedAt = user.UpdatedAt
 			gomega.Expect(*user).To(gomega.Equal(expectedUserWithID))
 			
 			// Verify all expectations were met
@@ -328,22 +781,62 @@ var _ = ginkgo.Describe("UserRepository", func() {
 			gomega.Expect(err).NotTo(gomega.HaveOccurred())
 		})
 
+		ginkgo.It("should not rename a user to a username another user holds", func() {
+			expectedUser := expectedUsers[0]
+			rows := sqlmock.NewRows([]string{"user_id", "user_name", "first_name", "last_name", "email", "department", "user_status", "version", "deleted_at", "deleted_by", "created_at", "updated_at", "department_id", "manager_id"})
+			rows.AddRow(expectedUser.ID, expectedUser.UserName, expectedUser.FirstName, expectedUser.LastName, expectedUser.Email, expectedUser.Department, expectedUser.UserStatus, expectedUser.Version, nil, nil, nil, nil, expectedUser.DepartmentID, nil)
+			mock.ExpectQuery("FROM users WHERE user_id = \\?").WithArgs(expectedUser.ID).WillReturnRows(rows)
+			mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM users WHERE user_name = \\? AND deleted_at IS NULL").
+				WithArgs("taken").
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+			renamed := expectedUser
+			renamed.UserName = "taken"
+			_, err := userRepo.UpdateUser(renamed)
+
+			// Nothing is written
+			gomega.Expect(err).To(gomega.MatchError("username 'taken' already exists"))
+			gomega.Expect(errors.Is(err, repository.ErrConflict)).To(gomega.BeTrue())
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+
+		ginkgo.It("should refuse to overwrite a newer version", func() {
+			expectedUser := expectedUsers[0]
+			rows := sqlmock.NewRows([]string{"user_id", "user_name", "first_name", "last_name", "email", "department", "user_status", "version", "deleted_at", "deleted_by", "created_at", "updated_at", "department_id", "manager_id"})
+			rows.AddRow(expectedUser.ID, expectedUser.UserName, expectedUser.FirstName, expectedUser.LastName, expectedUser.Email, expectedUser.Department, expectedUser.UserStatus, 2, nil, nil, nil, nil, expectedUser.DepartmentID, nil)
+			mock.ExpectQuery("FROM users WHERE user_id = \\?").WithArgs(expectedUser.ID).WillReturnRows(rows)
+
+			// The update matches no row because version 1 is stale
+			mock.ExpectQuery("UPDATE users SET .* RETURNING version").
+				WillReturnRows(sqlmock.NewRows([]string{"version"}))
+
+			// Call the function
+			_, err := userRepo.UpdateUser(expectedUser)
+
+			// Assertions
+			gomega.Expect(err).To(gomega.Equal(repository.ErrVersionConflict))
+
+			// Verify all expectations were met
+			err = mock.ExpectationsWereMet()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		})
+
 		ginkgo.It("should return error when user not found", func() {
 			// Setup the expected user
 			expectedUser := expectedUsers[0]
 
 			// Mock the GetUserByID query to return an error
 			expectedError := sql.ErrNoRows
-			mock.ExpectQuery("SELECT \\* FROM users WHERE user_id = \\?").
+			mock.ExpectQuery("SELECT user_id, user_name, first_name, last_name, email, department, user_status, version, deleted_at, deleted_by, created_at, updated_at, department_id, manager_id FROM users WHERE user_id = \\?").
 				WithArgs(expectedUser.ID).
 				WillReturnError(expectedError)
 
 			// Call the function
 			_, err := userRepo.UpdateUser(expectedUser)    
 			
-			// Assertions
-			gomega.Expect(err).To(gomega.HaveOccurred())
-			gomega.Expect(err.Error()).To(gomega.ContainSubstring(fmt.Sprintf("user with ID %d not found", expectedUser.ID)))
+			// Assertions: the message is for clients, so it leaves the driver error out
+			gomega.Expect(err).To(gomega.MatchError(fmt.Sprintf("no user found with ID %d", expectedUser.ID)))
+			gomega.Expect(errors.Is(err, repository.ErrNotFound)).To(gomega.BeTrue())
 
 			// Verify all expectations were met
 			err = mock.ExpectationsWereMet()
@@ -355,24 +848,29 @@ var _ = ginkgo.Describe("UserRepository", func() {
 			expectedUser := expectedUsers[0]
     
 			// First, mock the GetUserByID query
-			rows := sqlmock.NewRows([]string{"user_id", "user_name", "first_name", "last_name", "email", "department", "user_status"})
-			rows.AddRow(expectedUser.ID, expectedUser.UserName, expectedUser.FirstName, expectedUser.LastName, expectedUser.Email, expectedUser.Department, expectedUser.UserStatus)
+			rows := sqlmock.NewRows([]string{"user_id", "user_name", "first_name", "last_name", "email", "department", "user_status", "version", "deleted_at", "deleted_by", "created_at", "updated_at", "department_id", "manager_id"})
+			rows.AddRow(expectedUser.ID, expectedUser.UserName, expectedUser.FirstName, expectedUser.LastName, expectedUser.Email, expectedUser.Department, expectedUser.UserStatus, expectedUser.Version, nil, nil, nil, nil, expectedUser.DepartmentID, nil)
 			
-			mock.ExpectQuery("SELECT \\* FROM users WHERE user_id = \\?").
+			mock.ExpectQuery("SELECT user_id, user_name, first_name, last_name, email, department, user_status, version, deleted_at, deleted_by, created_at, updated_at, department_id, manager_id FROM users WHERE user_id = \\?").
 				WithArgs(expectedUser.ID).
 				WillReturnRows(rows)
 
 			// Setup the expected query
 			expectedError := errors.New("database query failed")
-			mock.ExpectExec("UPDATE users SET user_name = \\?, first_name = \\?, last_name = \\?, email = \\?, department = \\?, user_status = \\? WHERE user_id = \\?").
+			mock.ExpectQuery("UPDATE users SET user_name = \\?, first_name = \\?, last_name = \\?, email = \\?, department = \\?, department_id = \\?, manager_id = \\?, user_status = \\?, updated_at = \\?, version = version \\+ 1 WHERE user_id = \\? AND deleted_at IS NULL AND \\(\\? = 0 OR version = \\?\\) RETURNING version").
 				WithArgs(
 					expectedUser.UserName,
 					expectedUser.FirstName,
 					expectedUser.LastName,
 					expectedUser.Email,
 					expectedUser.Department,
+					expectedUser.DepartmentID,
+					nil,
 					expectedUser.UserStatus,
+					sqlmock.AnyArg(),
 					expectedUser.ID,
+					expectedUser.Version,
+					expectedUser.Version,
 				).
 				WillReturnError(expectedError)
 
@@ -387,4 +885,808 @@ var _ = ginkgo.Describe("UserRepository", func() {
 			gomega.Expect(err).NotTo(gomega.HaveOccurred())
 		})
 	})
+
+	ginkgo.Context("DeleteUser", func() {
+		ginkgo.It("should soft-delete a user at the expected version", func() {
+			mock.ExpectExec("UPDATE users SET deleted_at = \\?, deleted_by = \\?, updated_at = \\?, version = version \\+ 1 WHERE user_id = \\? AND deleted_at IS NULL AND \\(\\? = 0 OR version = \\?\\)").
+				WithArgs(sqlmock.AnyArg(), "hr.admin", sqlmock.AnyArg(), 1, int64(3), int64(3)).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+
+			// Call the function
+			deleted, err := userRepo.DeleteUser(1, 3, "hr.admin")
+
+			// Assertions
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(deleted).To(gomega.BeTrue())
+
+			// Verify all expectations were met
+			err = mock.ExpectationsWereMet()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		})
+
+		ginkgo.It("should tell a stale version apart from a missing user", func() {
+			mock.ExpectExec("UPDATE users SET deleted_at").WithArgs(sqlmock.AnyArg(), "hr.admin", sqlmock.AnyArg(), 1, int64(2), int64(2)).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectQuery("SELECT user_id FROM users WHERE user_id = \\? AND deleted_at IS NULL").
+				WithArgs(1).
+				WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(1))
+			mock.ExpectExec("UPDATE users SET deleted_at").WithArgs(sqlmock.AnyArg(), "hr.admin", sqlmock.AnyArg(), 9, int64(2), int64(2)).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectQuery("SELECT user_id FROM users WHERE user_id = \\? AND deleted_at IS NULL").
+				WithArgs(9).
+				WillReturnError(sql.ErrNoRows)
+
+			// Call the function
+			_, stale := userRepo.DeleteUser(1, 2, "hr.admin")
+			deleted, missing := userRepo.DeleteUser(9, 2, "hr.admin")
+
+			// Assertions
+			gomega.Expect(stale).To(gomega.Equal(repository.ErrVersionConflict))
+			gomega.Expect(missing).NotTo(gomega.HaveOccurred())
+			gomega.Expect(deleted).To(gomega.BeFalse())
+
+			// Verify all expectations were met
+			err = mock.ExpectationsWereMet()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		})
+	})
+
+	ginkgo.Context("RestoreUser", func() {
+		deletedRow := func() *sqlmock.Rows {
+			user := expectedUsers[0]
+			return sqlmock.NewRows([]string{"user_id", "user_name", "first_name", "last_name", "email", "department", "user_status", "version", "deleted_at", "deleted_by", "created_at", "updated_at", "department_id", "manager_id"}).
+				AddRow(user.ID, user.UserName, user.FirstName, user.LastName, user.Email, user.Department, user.UserStatus, 2, time.Now(), "hr.admin", nil, nil, user.DepartmentID, nil)
+		}
+
+		ginkgo.It("should clear the deletion and bump the version", func() {
+			mock.ExpectQuery("FROM users WHERE user_id = \\? AND deleted_at IS NOT NULL").WithArgs(1).WillReturnRows(deletedRow())
+			mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM users WHERE user_name = \\? AND deleted_at IS NULL").
+				WithArgs("johndoe").
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+			mock.ExpectQuery("UPDATE users SET deleted_at = NULL, deleted_by = NULL, updated_at = \\?, version = version \\+ 1 WHERE user_id = \\? AND version = \\? RETURNING version").
+				WithArgs(sqlmock.AnyArg(), 1, int64(2)).
+				WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(3))
+
+			// Call the function
+			user, err := userRepo.RestoreUser(1)
+
+			// Assertions
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			restored := expectedUsers[0]
+			restored.Version = 3
+			gomega.Expect(user.UpdatedAt).NotTo(gomega.BeNil())
+			restored.UpdatedAt = user.UpdatedAt
+			gomega.Expect(*user).To(gomega.Equal(restored))
+
+			// Verify all expectations were met
+			err = mock.ExpectationsWereMet()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		})
+
+		ginkgo.It("should refuse when the username has been reclaimed", func() {
+			mock.ExpectQuery("FROM users WHERE user_id = \\? AND deleted_at IS NOT NULL").WithArgs(1).WillReturnRows(deletedRow())
+			mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM users WHERE user_name = \\?").
+				WithArgs("johndoe").
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+			// Call the function
+			_, err := userRepo.RestoreUser(1)
+
+			// Assertions
+			gomega.Expect(err).To(gomega.Equal(repository.ErrUsernameTaken))
+
+			// Verify all expectations were met
+			err = mock.ExpectationsWereMet()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		})
+
+		ginkgo.It("should only restore deleted users", func() {
+			mock.ExpectQuery("FROM users WHERE user_id = \\? AND deleted_at IS NOT NULL").WithArgs(1).WillReturnError(sql.ErrNoRows)
+
+			// Call the function
+			_, err := userRepo.RestoreUser(1)
+
+			// Assertions
+			gomega.Expect(err).To(gomega.MatchError(gomega.ContainSubstring("no deleted user with ID 1")))
+		})
+	})
+
+	ginkgo.Context("PurgeUser", func() {
+		ginkgo.It("should remove the row for good", func() {
+			mock.ExpectExec("DELETE FROM users WHERE user_id = \\?").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+
+			// Call the function
+			purged, err := userRepo.PurgeUser(1)
+
+			// Assertions
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(purged).To(gomega.BeTrue())
+
+			// Verify all expectations were met
+			err = mock.ExpectationsWereMet()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		})
+	})
+
+	ginkgo.Context("Errors", func() {
+		ginkgo.It("should match both the kind and the wrapped error", func() {
+			err := repository.Errorf(repository.ErrNotFound, "no user found with ID %d: %w", 7, sql.ErrNoRows)
+
+			gomega.Expect(err).To(gomega.MatchError("no user found with ID 7: sql: no rows in result set"))
+			gomega.Expect(errors.Is(err, repository.ErrNotFound)).To(gomega.BeTrue())
+			gomega.Expect(errors.Is(err, sql.ErrNoRows)).To(gomega.BeTrue())
+			gomega.Expect(errors.Is(err, repository.ErrConflict)).To(gomega.BeFalse())
+			gomega.Expect(errors.Is(repository.ErrVersionConflict, repository.ErrConflict)).To(gomega.BeTrue())
+		})
+
+		ginkgo.It("should carry a stable code, falling back to the code of the kind", func() {
+			var repoErr *repository.Error
+			gomega.Expect(errors.As(repository.Errorf(repository.ErrNotFound, "no user"), &repoErr)).To(gomega.BeTrue())
+			gomega.Expect(repoErr.ErrorCode()).To(gomega.Equal(repository.CodeNotFound))
+			gomega.Expect(repository.ErrVersionConflict.ErrorCode()).To(gomega.Equal(repository.CodeVersionConflict))
+
+			gomega.Expect(errors.As(repository.UsernameExists("jdoe"), &repoErr)).To(gomega.BeTrue())
+			gomega.Expect(repoErr.ErrorCode()).To(gomega.Equal(repository.CodeUsernameTaken))
+			gomega.Expect(repoErr).To(gomega.MatchError("username 'jdoe' already exists"))
+		})
+
+		ginkgo.It("should name the field at fault in a field error", func() {
+			err := repository.FieldErrorf("email", model.FieldInvalid, "email %q is not a valid address", "x")
+
+			var repoErr *repository.Error
+			gomega.Expect(errors.As(err, &repoErr)).To(gomega.BeTrue())
+			gomega.Expect(errors.Is(err, repository.ErrValidation)).To(gomega.BeTrue())
+			gomega.Expect(repoErr.Fields).To(gomega.Equal([]model.FieldError{
+				{Field: "email", Code: model.FieldInvalid, Detail: `email "x" is not a valid address`},
+			}))
+		})
+
+		ginkgo.It("should classify constraint failures from SQLite", func() {
+			expectedUser := expectedUsers[0]
+			mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM users WHERE user_name = \\?").
+				WithArgs(expectedUser.UserName).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+			mock.ExpectQuery("FROM departments WHERE department_id = \\?").
+				WillReturnRows(sqlmock.NewRows([]string{"department_id", "name"}).AddRow(1, "Engineering"))
+			mock.ExpectExec("INSERT INTO users").WillReturnError(sqlite3.Error{Code: sqlite3.ErrConstraint})
+
+			// Call the function
+			_, err := userRepo.CreateUser(expectedUser)
+
+			// Assertions
+			gomega.Expect(errors.Is(err, repository.ErrConstraint)).To(gomega.BeTrue())
+
+			// Verify all expectations were met
+			err = mock.ExpectationsWereMet()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		})
+
+		ginkgo.It("should report a username taken by a write that got in first", func() {
+			// SQLite names the index column in the message, so the error
+			// comes from a real database breaking a unique index like it
+			db, err := sql.Open("sqlite3", ":memory:")
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			defer db.Close()
+			_, err = db.Exec(`CREATE TABLE users (user_name TEXT UNIQUE); INSERT INTO users VALUES ('johndoe')`)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			_, uniqueErr := db.Exec(`INSERT INTO users VALUES ('johndoe')`)
+			gomega.Expect(uniqueErr).To(gomega.HaveOccurred())
+
+			expectedUser := expectedUsers[0]
+			mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM users WHERE user_name = \\?").
+				WithArgs(expectedUser.UserName).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+			mock.ExpectQuery("FROM departments WHERE department_id = \\?").
+				WillReturnRows(sqlmock.NewRows([]string{"department_id", "name"}).AddRow(1, "Engineering"))
+			mock.ExpectExec("INSERT INTO users").WillReturnError(uniqueErr)
+
+			_, err = userRepo.CreateUser(expectedUser)
+
+			gomega.Expect(err).To(gomega.MatchError("username 'johndoe' already exists"))
+			gomega.Expect(errors.Is(err, repository.ErrConflict)).To(gomega.BeTrue())
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+	})
+
+	ginkgo.Context("InTransaction", func() {
+		ginkgo.It("should commit when the function succeeds", func() {
+			mock.ExpectBegin()
+			mock.ExpectExec("DELETE FROM users WHERE user_id = \\?").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			// Call the function
+			err := userRepo.InTransaction(func(tx repository.UserRepository) error {
+				_, err := tx.PurgeUser(1)
+				return err
+			})
+
+			// Assertions
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			// Verify all expectations were met
+			err = mock.ExpectationsWereMet()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		})
+
+		ginkgo.It("should roll back when the function fails", func() {
+			failed := errors.New("item failed")
+			mock.ExpectBegin()
+			mock.ExpectExec("DELETE FROM users WHERE user_id = \\?").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectRollback()
+
+			// Call the function
+			err := userRepo.InTransaction(func(tx repository.UserRepository) error {
+				if _, err := tx.PurgeUser(1); err != nil {
+					return err
+				}
+				return failed
+			})
+
+			// Assertions
+			gomega.Expect(err).To(gomega.Equal(failed))
+
+			// Verify all expectations were met
+			err = mock.ExpectationsWereMet()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		})
+
+		ginkgo.It("should not nest transactions", func() {
+			mock.ExpectBegin()
+			mock.ExpectRollback()
+
+			// Call the function
+			err := userRepo.InTransaction(func(tx repository.UserRepository) error {
+				return tx.InTransaction(func(repository.UserRepository) error { return nil })
+			})
+
+			// Assertions
+			gomega.Expect(err).To(gomega.MatchError("transactions cannot be nested"))
+
+			// Verify all expectations were met
+			err = mock.ExpectationsWereMet()
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		})
+	})
+
+	ginkgo.Context("IdempotencyRepository", func() {
+		var idempotencyRepo repository.IdempotencyRepository
+		now := time.Unix(1700000000, 0)
+		record := repository.IdempotencyRecord{Actor: "hr.admin", Key: "key-1", Fingerprint: "abc", ExpiresAt: now.Add(time.Hour)}
+
+		ginkgo.BeforeEach(func() {
+			idempotencyRepo = repository.NewIdempotencyRepository(mockDB)
+		})
+
+		ginkgo.It("should claim a new key after clearing out expired ones", func() {
+			mock.ExpectExec("DELETE FROM idempotency_keys WHERE expires_at <= \\?").
+				WithArgs(now.Unix()).
+				WillReturnResult(sqlmock.NewResult(0, 2))
+			mock.ExpectExec("INSERT INTO idempotency_keys \\(actor, idempotency_key, fingerprint, expires_at\\) VALUES \\(\\?, \\?, \\?, \\?\\) ON CONFLICT \\(actor, idempotency_key\\) DO NOTHING").
+				WithArgs("hr.admin", "key-1", "abc", now.Add(time.Hour).Unix()).
+				WillReturnResult(sqlmock.NewResult(1, 1))
+
+			// Call the function
+			existing, err := idempotencyRepo.ClaimKey(record, now)
+
+			// Assertions
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(existing).To(gomega.BeNil())
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+
+		ginkgo.It("should return the record of a key that is already claimed", func() {
+			mock.ExpectExec("DELETE FROM idempotency_keys").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("INSERT INTO idempotency_keys").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectQuery("SELECT actor, idempotency_key, fingerprint, status, header, body, expires_at FROM idempotency_keys WHERE actor = \\? AND idempotency_key = \\?").
+				WithArgs("hr.admin", "key-1").
+				WillReturnRows(sqlmock.NewRows([]string{"actor", "idempotency_key", "fingerprint", "status", "header", "body", "expires_at"}).
+					AddRow("hr.admin", "key-1", "abc", 201, `{"Location":["/users/7"]}`, []byte(`{"ok":true}`), now.Add(time.Hour).Unix()))
+
+			// Call the function
+			existing, err := idempotencyRepo.ClaimKey(record, now)
+
+			// Assertions
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(existing.Status).To(gomega.Equal(201))
+			gomega.Expect(existing.Header.Get("Location")).To(gomega.Equal("/users/7"))
+			gomega.Expect(string(existing.Body)).To(gomega.Equal(`{"ok":true}`))
+			gomega.Expect(existing.ExpiresAt.Equal(now.Add(time.Hour))).To(gomega.BeTrue())
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+
+		ginkgo.It("should store the response and forget released keys", func() {
+			mock.ExpectExec("UPDATE idempotency_keys SET status = \\?, header = \\?, body = \\? WHERE actor = \\? AND idempotency_key = \\?").
+				WithArgs(200, `{"Etag":["\"1\""]}`, []byte("{}"), "hr.admin", "key-1").
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec("DELETE FROM idempotency_keys WHERE actor = \\? AND idempotency_key = \\?").
+				WithArgs("hr.admin", "key-2").
+				WillReturnResult(sqlmock.NewResult(0, 1))
+
+			// Call the functions
+			err := idempotencyRepo.CompleteKey(repository.IdempotencyRecord{
+				Actor:  "hr.admin",
+				Key:    "key-1",
+				Status: 200,
+				Header: map[string][]string{"Etag": {`"1"`}},
+				Body:   []byte("{}"),
+			})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(idempotencyRepo.ReleaseKey("hr.admin", "key-2")).To(gomega.Succeed())
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+	})
+
+	ginkgo.Context("Departments of users", func() {
+		currentRow := func(user model.User) *sqlmock.Rows {
+			return sqlmock.NewRows([]string{"user_id", "user_name", "first_name", "last_name", "email", "department", "user_status", "version", "deleted_at", "deleted_by", "created_at", "updated_at", "department_id", "manager_id"}).
+				AddRow(user.ID, user.UserName, user.FirstName, user.LastName, user.Email, user.Department, user.UserStatus, user.Version, nil, nil, nil, nil, user.DepartmentID, nil)
+		}
+
+		ginkgo.It("should move a user by name, ignoring case, when only the name changes", func() {
+			user := expectedUsers[0]
+			mock.ExpectQuery("FROM users WHERE user_id = \\?").WithArgs(user.ID).WillReturnRows(currentRow(user))
+			mock.ExpectQuery("SELECT department_id, name FROM departments WHERE name = \\?").
+				WithArgs("marketing").
+				WillReturnRows(sqlmock.NewRows([]string{"department_id", "name"}).AddRow(2, "Marketing"))
+			mock.ExpectQuery("UPDATE users SET").
+				WithArgs(user.UserName, user.FirstName, user.LastName, user.Email, "Marketing", int64(2), nil, user.UserStatus,
+					sqlmock.AnyArg(), user.ID, user.Version, user.Version).
+				WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(2))
+
+			// Call the function with the name patched but the ID as it was
+			patched := user
+			patched.Department = " marketing "
+			updated, err := userRepo.UpdateUser(patched)
+
+			// Assertions
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(updated.DepartmentID).To(gomega.Equal(int64(2)))
+			gomega.Expect(updated.Department).To(gomega.Equal("Marketing"))
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+
+		ginkgo.It("should refuse unknown departments and names that contradict the ID", func() {
+			user := expectedUsers[0]
+			user.DepartmentID, user.Department = 0, "Eng"
+			mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM users WHERE user_name = \\?").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+			mock.ExpectQuery("FROM departments WHERE name = \\?").WithArgs("Eng").WillReturnError(sql.ErrNoRows)
+
+			// Call the function
+			_, unknown := userRepo.CreateUser(user)
+
+			user.DepartmentID = 1
+			mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM users WHERE user_name = \\?").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+			mock.ExpectQuery("FROM departments WHERE department_id = \\?").WithArgs(int64(1)).
+				WillReturnRows(sqlmock.NewRows([]string{"department_id", "name"}).AddRow(1, "Engineering"))
+			_, contradicting := userRepo.CreateUser(user)
+
+			// Assertions
+			var repoErr *repository.Error
+			gomega.Expect(errors.As(unknown, &repoErr)).To(gomega.BeTrue())
+			gomega.Expect(repoErr.Fields).To(gomega.Equal([]model.FieldError{
+				{Field: "department", Code: model.FieldInvalid, Detail: `unknown department "Eng"`},
+			}))
+			gomega.Expect(errors.Is(contradicting, repository.ErrValidation)).To(gomega.BeTrue())
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+	})
+
+	ginkgo.Context("DepartmentRepository", func() {
+		var departmentRepo repository.DepartmentRepository
+
+		ginkgo.BeforeEach(func() {
+			departmentRepo = repository.NewDepartmentRepository(mockDB, userRepo)
+		})
+
+		ginkgo.It("should refuse a name another department has in any case", func() {
+			mock.ExpectQuery("SELECT department_id, name FROM departments WHERE name = \\?").
+				WithArgs("Engineering").
+				WillReturnRows(sqlmock.NewRows([]string{"department_id", "name"}).AddRow(1, "engineering"))
+
+			// Call the function
+			_, err := departmentRepo.CreateDepartment(model.Department{Name: " Engineering"})
+
+			// Assertions
+			var repoErr *repository.Error
+			gomega.Expect(errors.As(err, &repoErr)).To(gomega.BeTrue())
+			gomega.Expect(repoErr.ErrorCode()).To(gomega.Equal(repository.CodeDepartmentTaken))
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+
+		ginkgo.It("should rename the users of a renamed department", func() {
+			mock.ExpectBegin()
+			mock.ExpectQuery("FROM departments WHERE department_id = \\?").WithArgs(int64(1)).
+				WillReturnRows(sqlmock.NewRows([]string{"department_id", "name"}).AddRow(1, "Eng"))
+			mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM departments WHERE name = \\? AND department_id != \\?").
+				WithArgs("Engineering", int64(1)).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+			mock.ExpectExec("UPDATE departments SET name = \\? WHERE department_id = \\?").
+				WithArgs("Engineering", int64(1)).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec("UPDATE users SET department_id = \\?, department = \\?, updated_at = \\?, version = version \\+ 1 WHERE department_id = \\?").
+				WithArgs(int64(1), "Engineering", sqlmock.AnyArg(), int64(1)).
+				WillReturnResult(sqlmock.NewResult(0, 4))
+			mock.ExpectCommit()
+
+			// Call the function
+			renamed, err := departmentRepo.UpdateDepartment(model.Department{ID: 1, Name: "Engineering"})
+
+			// Assertions
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(*renamed).To(gomega.Equal(model.Department{ID: 1, Name: "Engineering"}))
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+
+		ginkgo.It("should refuse to delete a department that still has users", func() {
+			mock.ExpectBegin()
+			mock.ExpectQuery("FROM departments WHERE department_id = \\?").WithArgs(1).
+				WillReturnRows(sqlmock.NewRows([]string{"department_id", "name"}).AddRow(1, "Engineering"))
+			mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM scheduled_changes WHERE department_id = \\? AND status = \\?").WithArgs(1, "pending").
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+			mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM users WHERE department_id = \\?").WithArgs(1).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+			mock.ExpectRollback()
+
+			// Call the function
+			deleted, err := departmentRepo.DeleteDepartment(1, 0)
+
+			// Assertions
+			gomega.Expect(deleted).To(gomega.BeFalse())
+			gomega.Expect(errors.Is(err, repository.ErrConflict)).To(gomega.BeTrue())
+			gomega.Expect(err).To(gomega.MatchError(gomega.ContainSubstring("still has 2 users")))
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+
+		ginkgo.It("should refuse to delete a department users are scheduled to move to", func() {
+			mock.ExpectBegin()
+			mock.ExpectQuery("FROM departments WHERE department_id = \\?").WithArgs(1).
+				WillReturnRows(sqlmock.NewRows([]string{"department_id", "name"}).AddRow(1, "Engineering"))
+			mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM scheduled_changes").WithArgs(1, "pending").
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+			mock.ExpectRollback()
+
+			deleted, err := departmentRepo.DeleteDepartment(1, 3)
+
+			gomega.Expect(deleted).To(gomega.BeFalse())
+			gomega.Expect(err).To(gomega.MatchError(gomega.ContainSubstring("1 scheduled changes")))
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+
+		ginkgo.It("should move the users to another department before deleting", func() {
+			mock.ExpectBegin()
+			mock.ExpectQuery("FROM departments WHERE department_id = \\?").WithArgs(1).
+				WillReturnRows(sqlmock.NewRows([]string{"department_id", "name"}).AddRow(1, "Eng"))
+			mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM scheduled_changes WHERE department_id = \\? AND status = \\?").WithArgs(1, "pending").
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+			mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM users WHERE department_id = \\?").WithArgs(1).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+			mock.ExpectQuery("FROM departments WHERE department_id = \\?").WithArgs(3).
+				WillReturnRows(sqlmock.NewRows([]string{"department_id", "name"}).AddRow(3, "Engineering"))
+			mock.ExpectExec("UPDATE users SET department_id = \\?, department = \\?").
+				WithArgs(int64(3), "Engineering", sqlmock.AnyArg(), int64(1)).
+				WillReturnResult(sqlmock.NewResult(0, 2))
+			mock.ExpectExec("DELETE FROM departments WHERE department_id = \\?").WithArgs(1).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			// Call the function
+			deleted, err := departmentRepo.DeleteDepartment(1, 3)
+
+			// Assertions
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(deleted).To(gomega.BeTrue())
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+	})
+
+	ginkgo.Context("Status transitions", func() {
+		userRows := func(status string) *sqlmock.Rows {
+			user := expectedUsers[0]
+			return sqlmock.NewRows([]string{"user_id", "user_name", "first_name", "last_name", "email", "department", "user_status", "version", "deleted_at", "deleted_by", "created_at", "updated_at", "department_id", "manager_id"}).
+				AddRow(user.ID, user.UserName, user.FirstName, user.LastName, user.Email, user.Department, status, user.Version, nil, nil, nil, nil, user.DepartmentID, nil)
+		}
+
+		ginkgo.It("should record a plain transition made by writing the status", func() {
+			user := expectedUsers[0]
+			user.UserStatus, user.UpdatedBy = "I", "hr.admin"
+			mock.ExpectQuery("FROM users WHERE user_id = \\?").WithArgs(user.ID).WillReturnRows(userRows("A"))
+			mock.ExpectBegin()
+			mock.ExpectQuery("UPDATE users SET .* RETURNING version").
+				WithArgs(user.UserName, user.FirstName, user.LastName, user.Email, user.Department, user.DepartmentID, nil, "I",
+					sqlmock.AnyArg(), user.ID, user.Version, user.Version).
+				WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(2))
+			mock.ExpectExec("INSERT INTO user_status_transitions").
+				WithArgs(user.ID, "deactivate", "A", "I", nil, "hr.admin", sqlmock.AnyArg()).
+				WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectCommit()
+
+			updated, err := userRepo.UpdateUser(user)
+
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(updated.UserStatus).To(gomega.Equal("I"))
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+
+		ginkgo.It("should refuse to rehire a user by writing the status", func() {
+			user := expectedUsers[0]
+			mock.ExpectQuery("FROM users WHERE user_id = \\?").WithArgs(user.ID).WillReturnRows(userRows("T"))
+
+			_, err := userRepo.UpdateUser(user)
+
+			gomega.Expect(errors.Is(err, repository.ErrConflict)).To(gomega.BeTrue())
+			gomega.Expect(err.(*repository.Error).Code).To(gomega.Equal(repository.CodeInvalidTransition))
+			gomega.Expect(err.Error()).To(gomega.ContainSubstring("rehire"))
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+
+		ginkgo.It("should make a transition and record its reason", func() {
+			user := expectedUsers[0]
+			terminate, _ := model.FindTransition("terminate")
+			mock.ExpectBegin()
+			mock.ExpectQuery("FROM users WHERE user_id = \\?").WithArgs(user.ID).WillReturnRows(userRows("I"))
+			mock.ExpectQuery("UPDATE users SET user_status = \\?, updated_at = \\?, version = version \\+ 1 WHERE user_id = \\? AND version = \\? RETURNING version").
+				WithArgs("T", sqlmock.AnyArg(), user.ID, user.Version).
+				WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(2))
+			mock.ExpectExec("UPDATE users SET manager_id = \\?, updated_at = \\?, version = version \\+ 1 WHERE manager_id = \\?").
+				WithArgs(nil, sqlmock.AnyArg(), user.ID).
+				WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("INSERT INTO user_status_transitions").
+				WithArgs(user.ID, "terminate", "I", "T", "Left the company", "hr.admin", sqlmock.AnyArg()).
+				WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectCommit()
+
+			updated, err := userRepo.TransitionUser(int(user.ID), terminate, "Left the company", "hr.admin", 0)
+
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(updated.UserStatus).To(gomega.Equal("T"))
+			gomega.Expect(updated.Version).To(gomega.Equal(int64(2)))
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+
+		ginkgo.It("should show the new status in suggestions after a transition", func() {
+			user := expectedUsers[0]
+			deactivate, _ := model.FindTransition("deactivate")
+			mock.ExpectQuery("SELECT user_id, user_name, first_name, last_name, email, department, user_status, version, deleted_at, deleted_by, created_at, updated_at, department_id, manager_id FROM users").
+				WillReturnRows(userRows("A"))
+			_, err := userRepo.SuggestUsers("john", 5)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			mock.ExpectBegin()
+			mock.ExpectQuery("FROM users WHERE user_id = \\?").WithArgs(user.ID).WillReturnRows(userRows("A"))
+			mock.ExpectQuery("UPDATE users SET user_status = \\?").
+				WithArgs("I", sqlmock.AnyArg(), user.ID, user.Version).
+				WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(2))
+			mock.ExpectExec("INSERT INTO user_status_transitions").WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectCommit()
+			_, err = userRepo.TransitionUser(int(user.ID), deactivate, "Leave", "hr.admin", 0)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			suggestions, err := userRepo.SuggestUsers("john", 5)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(suggestions).To(gomega.HaveLen(1))
+			gomega.Expect(suggestions[0].User.UserStatus).To(gomega.Equal("I"))
+			gomega.Expect(suggestions[0].User.Version).To(gomega.Equal(int64(2)))
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+
+		ginkgo.It("should refuse a transition that does not apply to the user's status", func() {
+			user := expectedUsers[0]
+			activate, _ := model.FindTransition("activate")
+			mock.ExpectBegin()
+			mock.ExpectQuery("FROM users WHERE user_id = \\?").WithArgs(user.ID).WillReturnRows(userRows("A"))
+			mock.ExpectRollback()
+
+			_, err := userRepo.TransitionUser(int(user.ID), activate, "Back", "hr.admin", 0)
+
+			gomega.Expect(err).To(gomega.MatchError(gomega.ContainSubstring("cannot activate a user who is active")))
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+	})
+	ginkgo.Context("ScheduledChangeRepository", func() {
+		var changeRepo repository.ScheduledChangeRepository
+
+		ginkgo.BeforeEach(func() {
+			changeRepo = repository.NewScheduledChangeRepository(mockDB, userRepo)
+		})
+
+		// changeRows returns change 5 to user 1, due a minute ago, with the given status
+		changeRows := func(status string) *sqlmock.Rows {
+			return sqlmock.NewRows([]string{"change_id", "user_id", "effective_at", "transition", "department_id", "name", "reason", "status", "error",
+				"created_by", "created_at", "applied_at", "cancelled_at", "cancelled_by"}).
+				AddRow(5, 1, time.Now().Add(-time.Minute).Unix(), "deactivate", nil, nil, "Leave", status, nil, "hr.admin", time.Now(), nil, nil, nil)
+		}
+
+		ginkgo.It("should apply a due change in the transaction that marks it applied", func() {
+			mock.ExpectQuery("FROM scheduled_changes c LEFT JOIN departments d .* WHERE c.status = \\? AND c.effective_at <= \\?").
+				WithArgs("pending", sqlmock.AnyArg()).WillReturnRows(changeRows("pending"))
+			mock.ExpectBegin()
+			mock.ExpectExec("UPDATE scheduled_changes SET status = \\?, applied_at = \\? WHERE change_id = \\? AND status = \\?").
+				WithArgs("applied", sqlmock.AnyArg(), 5, "pending").WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			var changes []model.ScheduledChange
+			applied, err := changeRepo.ApplyDueChanges(time.Now(), func(users repository.UserRepository, change model.ScheduledChange) error {
+				changes = append(changes, change)
+				return nil
+			})
+
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(applied).To(gomega.Equal(1))
+			gomega.Expect(changes).To(gomega.HaveLen(1))
+			gomega.Expect(changes[0].Transition).To(gomega.Equal("deactivate"))
+			gomega.Expect(changes[0].CreatedBy).To(gomega.Equal("hr.admin"))
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+
+		ginkgo.It("should mark a change failed when the user no longer allows it", func() {
+			mock.ExpectQuery("FROM scheduled_changes").WillReturnRows(changeRows("pending"))
+			mock.ExpectBegin()
+			mock.ExpectExec("UPDATE scheduled_changes SET status = \\?, applied_at").WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectRollback()
+			mock.ExpectExec("UPDATE scheduled_changes SET status = \\?, error = \\?, applied_at = \\?").
+				WithArgs("failed", "cannot deactivate a user who is terminated", sqlmock.AnyArg(), 5, "pending").
+				WillReturnResult(sqlmock.NewResult(0, 1))
+
+			applied, err := changeRepo.ApplyDueChanges(time.Now(), func(users repository.UserRepository, change model.ScheduledChange) error {
+				return repository.Errorf(repository.ErrConflict, "cannot deactivate a user who is terminated")
+			})
+
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(applied).To(gomega.Equal(0))
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+
+		ginkgo.It("should refuse to cancel a change that has been applied", func() {
+			mock.ExpectExec("UPDATE scheduled_changes SET status = \\?, cancelled_at = \\?, cancelled_by = \\?").
+				WithArgs("cancelled", sqlmock.AnyArg(), "hr.admin", 5, 1, "pending").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectQuery("FROM scheduled_changes c LEFT JOIN departments d .* WHERE c.change_id = \\? AND c.user_id = \\?").
+				WithArgs(5, 1).WillReturnRows(changeRows("applied"))
+
+			_, err := changeRepo.CancelScheduledChange(1, 5, "hr.admin")
+
+			gomega.Expect(errors.Is(err, repository.ErrConflict)).To(gomega.BeTrue())
+			gomega.Expect(err.(*repository.Error).Code).To(gomega.Equal(repository.CodeChangeNotPending))
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+	})
+	ginkgo.Context("Manager hierarchy", func() {
+		// managerRows returns the user ID and status checkManager reads
+		managerRows := func(id int64, status string) *sqlmock.Rows {
+			return sqlmock.NewRows([]string{"user_id", "user_status"}).AddRow(id, status)
+		}
+
+		ginkgo.It("should refuse a manager who reports to the user", func() {
+			user := expectedUsers[0]
+			mock.ExpectQuery("FROM users WHERE user_id = \\?").WithArgs(user.ID).
+				WillReturnRows(sqlmock.NewRows([]string{"user_id", "user_name", "first_name", "last_name", "email", "department", "user_status", "version", "deleted_at", "deleted_by", "created_at", "updated_at", "department_id", "manager_id"}).
+					AddRow(user.ID, user.UserName, user.FirstName, user.LastName, user.Email, user.Department, user.UserStatus, user.Version, nil, nil, nil, nil, user.DepartmentID, nil))
+			mock.ExpectQuery("SELECT user_id, user_status FROM users WHERE user_id = \\?").WithArgs(2).WillReturnRows(managerRows(2, "A"))
+			mock.ExpectQuery("WITH RECURSIVE chain .* SELECT COUNT\\(\\*\\) FROM chain WHERE id = \\?").WithArgs(int64(2), user.ID).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+			user.ManagerID = 2
+			_, err := userRepo.UpdateUser(user)
+
+			gomega.Expect(errors.Is(err, repository.ErrValidation)).To(gomega.BeTrue())
+			gomega.Expect(err.Error()).To(gomega.ContainSubstring("user 2 reports to user 1"))
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+
+		ginkgo.It("should refuse a terminated manager", func() {
+			user := expectedUsers[1]
+			user.ID, user.ManagerID = 0, 3
+			mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM users WHERE user_name = \\?").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+			mock.ExpectQuery("FROM departments WHERE department_id = \\?").
+				WillReturnRows(sqlmock.NewRows([]string{"department_id", "name"}).AddRow(2, "Marketing"))
+			mock.ExpectQuery("SELECT user_id, user_status FROM users WHERE user_id = \\?").WithArgs(3).WillReturnRows(managerRows(3, "T"))
+
+			_, err := userRepo.CreateUser(user)
+
+			gomega.Expect(err).To(gomega.MatchError(gomega.ContainSubstring("user 3 is terminated")))
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+
+		ginkgo.It("should list every report below a manager with a recursive query", func() {
+			mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM users WHERE deleted_at IS NULL AND user_id IN \\(WITH RECURSIVE reports").
+				WithArgs(int64(1)).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+			mock.ExpectQuery("FROM users WHERE deleted_at IS NULL AND user_id IN \\(WITH RECURSIVE reports .* LIMIT \\? OFFSET \\?").
+				WithArgs(int64(1), 51, 0).
+				WillReturnRows(sqlmock.NewRows([]string{"user_id"}))
+
+			page, err := userRepo.ListUsers(repository.ListOptions{ReportsTo: 1, Recursive: true})
+
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(page.Users).To(gomega.BeEmpty())
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+
+		ginkgo.It("should reassign the reports of a manager", func() {
+			mock.ExpectBegin()
+			mock.ExpectQuery("SELECT user_id, user_status FROM users WHERE user_id = \\?").WithArgs(2).WillReturnRows(managerRows(2, "A"))
+			mock.ExpectQuery("WITH RECURSIVE chain").WithArgs(int64(2), int64(1)).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+			mock.ExpectExec("UPDATE users SET manager_id = \\?, updated_at = \\?, version = version \\+ 1 WHERE manager_id = \\?").
+				WithArgs(int64(2), sqlmock.AnyArg(), int64(1)).
+				WillReturnResult(sqlmock.NewResult(0, 3))
+			mock.ExpectCommit()
+
+			moved, err := userRepo.ReassignReports(1, 2)
+
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(moved).To(gomega.Equal(3))
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+	})
+
+	ginkgo.Context("Org chart", func() {
+		chartColumns := []string{"parent", "user_id", "user_name", "first_name", "last_name", "department", "user_status", "manager_id"}
+
+		ginkgo.It("should draw the whole hierarchy from the users who report to no one", func() {
+			mock.ExpectQuery("WITH RECURSIVE tree .* WHERE manager_id IS NULL .* AND \\(\\? = 0 OR tree.level < \\?\\)").
+				WithArgs(0, 0).
+				WillReturnRows(sqlmock.NewRows(chartColumns).
+					AddRow(0, 1, "ceo", "Ada", "Boss", "Board", "A", nil).
+					AddRow(1, 3, "dev", "Dee", "Dev", nil, "T", 2))
+
+			entries, err := userRepo.OrgChart(repository.OrgChartOptions{})
+
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(entries).To(gomega.HaveLen(2))
+			gomega.Expect(entries[0].ParentID).To(gomega.BeZero())
+			gomega.Expect(entries[0].User.Department).To(gomega.Equal("Board"))
+			// Drawn under user 1, as its own manager 2 was deleted
+			gomega.Expect(entries[1].ParentID).To(gomega.Equal(int64(1)))
+			gomega.Expect(entries[1].User.ManagerID).To(gomega.Equal(int64(2)))
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+
+		ginkgo.It("should start from a root that exists, down to a number of levels", func() {
+			mock.ExpectQuery("SELECT user_id FROM users WHERE user_id = \\?").WithArgs(5).
+				WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(5))
+			mock.ExpectQuery("WITH RECURSIVE tree .* WHERE user_id = \\?").
+				WithArgs(5, 2, 2).
+				WillReturnRows(sqlmock.NewRows(chartColumns).AddRow(0, 5, "lead", "Lee", "Lead", nil, "A", 1))
+
+			entries, err := userRepo.OrgChart(repository.OrgChartOptions{Root: 5, Levels: 2})
+
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(entries).To(gomega.HaveLen(1))
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+
+		ginkgo.It("should keep the chart to the users of a department", func() {
+			mock.ExpectQuery("SELECT department_id, name FROM departments WHERE department_id = \\?").WithArgs(int64(2)).
+				WillReturnRows(sqlmock.NewRows([]string{"department_id", "name"}).AddRow(2, "Marketing"))
+			mock.ExpectQuery("(?s)WITH RECURSIVE tree .* WHERE department_id = \\? AND \\(manager_id IS NULL OR NOT EXISTS .* " +
+				"AND \\(\\? = 0 OR tree.level < \\?\\) AND users.department_id = \\?").
+				WithArgs(int64(2), int64(2), 0, 0, int64(2)).
+				WillReturnRows(sqlmock.NewRows(chartColumns).AddRow(0, 2, "janesmith", "Jane", "Smith", "Marketing", "A", 1))
+
+			entries, err := userRepo.OrgChart(repository.OrgChartOptions{DepartmentID: 2})
+
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(entries).To(gomega.HaveLen(1))
+			gomega.Expect(entries[0].ParentID).To(gomega.BeZero())
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+
+		ginkgo.It("should not draw the chart of a department that does not exist", func() {
+			mock.ExpectQuery("FROM departments WHERE department_id = \\?").WithArgs(int64(9)).
+				WillReturnRows(sqlmock.NewRows([]string{"department_id", "name"}))
+
+			_, err := userRepo.OrgChart(repository.OrgChartOptions{DepartmentID: 9})
+
+			gomega.Expect(errors.Is(err, repository.ErrNotFound)).To(gomega.BeTrue())
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+
+		ginkgo.It("should not draw from a root that does not exist", func() {
+			mock.ExpectQuery("SELECT user_id FROM users WHERE user_id = \\?").WithArgs(9).
+				WillReturnRows(sqlmock.NewRows([]string{"user_id"}))
+
+			_, err := userRepo.OrgChart(repository.OrgChartOptions{Root: 9})
+
+			gomega.Expect(errors.Is(err, repository.ErrNotFound)).To(gomega.BeTrue())
+			gomega.Expect(mock.ExpectationsWereMet()).To(gomega.Succeed())
+		})
+	})
 })	
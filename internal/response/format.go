@@ -0,0 +1,385 @@
+package response
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/labstack/echo/v4"
+	"github.com/vmihailenco/msgpack/v5"
+	"gopkg.in/yaml.v3"
+)
+
+// Media types of the formats other than JSON and XML
+const (
+	MIMEApplicationYAML    = "application/yaml"
+	MIMEApplicationCBOR    = "application/cbor"
+	MIMEApplicationMsgpack = "application/msgpack"
+)
+
+// Format is a way of writing responses and reading request bodies. Every
+// format carries the same document as JSON, with the same field names, so
+// that clients can switch formats without learning a new shape.
+type Format struct {
+	// MediaType labels responses written in the format
+	MediaType string
+	// aliases are other media types clients use for the format
+	aliases []string
+	// byName keeps the format from being chosen through a wildcard
+	byName    bool
+	marshal   func(v interface{}) ([]byte, error)
+	unmarshal func(data []byte, v interface{}) error
+}
+
+// The formats the service speaks. Problem details are JSON too, so a
+// client that accepts only them still gets JSON for success responses.
+// HAL is JSON with the links handlers add when it is asked for, and
+// JSON:API the envelope rewritten as a JSON:API document.
+var (
+	JSON = &Format{
+		MediaType: echo.MIMEApplicationJSON,
+		aliases:   []string{MIMEApplicationProblemJSON},
+		marshal:   json.Marshal,
+		unmarshal: json.Unmarshal,
+	}
+	HAL = &Format{
+		MediaType: MIMEApplicationHALJSON,
+		byName:    true,
+		marshal:   json.Marshal,
+		unmarshal: json.Unmarshal,
+	}
+	JSONAPI = &Format{
+		MediaType: MIMEApplicationJSONAPI,
+		byName:    true,
+		marshal:   json.Marshal,
+		unmarshal: json.Unmarshal,
+	}
+	XML = &Format{
+		MediaType: echo.MIMEApplicationXML,
+		aliases:   []string{echo.MIMETextXML},
+		marshal:   marshalXML,
+		unmarshal: unmarshalXML,
+	}
+	YAML = &Format{
+		MediaType: MIMEApplicationYAML,
+		aliases:   []string{"application/x-yaml", "text/yaml"},
+		marshal:   marshalYAML,
+		unmarshal: viaJSON(yaml.Unmarshal),
+	}
+	CBOR = &Format{
+		MediaType: MIMEApplicationCBOR,
+		marshal:   marshalCBOR,
+		unmarshal: viaJSON(cborDecMode.Unmarshal),
+	}
+	Msgpack = &Format{
+		MediaType: MIMEApplicationMsgpack,
+		aliases:   []string{"application/x-msgpack", "application/vnd.msgpack"},
+		marshal:   marshalMsgpack,
+		unmarshal: viaJSON(msgpack.Unmarshal),
+	}
+)
+
+// Formats lists every format, JSON first as the default
+var Formats = []*Format{JSON, HAL, JSONAPI, XML, YAML, CBOR, Msgpack}
+
+// Marshal writes v in the format
+func (f *Format) Marshal(v interface{}) ([]byte, error) {
+	return f.marshal(v)
+}
+
+// Unmarshal reads data in the format into v, as JSON with the same
+// content would be read
+func (f *Format) Unmarshal(data []byte, v interface{}) error {
+	return f.unmarshal(data, v)
+}
+
+// MediaTypes lists the media type of every format
+func MediaTypes() []string {
+	types := make([]string, len(Formats))
+	for i, format := range Formats {
+		types[i] = format.MediaType
+	}
+	return types
+}
+
+// FormatOf finds the format of a Content-Type header value, or nil when
+// the service does not speak it
+func FormatOf(contentType string) *Format {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil
+	}
+	for _, format := range Formats {
+		if format.MediaType == mediaType || slices.Contains(format.aliases, mediaType) {
+			return format
+		}
+	}
+	return nil
+}
+
+// Negotiate picks the format to answer with from an Accept header value:
+// the one the client gives the highest quality, preferring a type it named
+// over one matched by a wildcard, and JSON among equals. HAL and JSON:API
+// are only picked when the client names them. When it accepts none of them, ok is
+// false and the format is JSON.
+func Negotiate(accept string) (format *Format, ok bool) {
+	if strings.TrimSpace(accept) == "" {
+		return JSON, true
+	}
+	ranges := acceptedRanges(accept)
+
+	best, bestQ, bestSpecificity := JSON, 0.0, -1
+	for _, f := range Formats {
+		for i, mediaType := range append([]string{f.MediaType}, f.aliases...) {
+			q, specificity := quality(ranges, mediaType)
+			// Wildcards only reach a format through its own media type,
+			// and not at all for a format that must be asked for by name
+			if (i > 0 || f.byName) && specificity < 2 {
+				continue
+			}
+			if q > bestQ || (q == bestQ && q > 0 && specificity > bestSpecificity) {
+				best, bestQ, bestSpecificity = f, q, specificity
+			}
+		}
+	}
+	return best, bestQ > 0
+}
+
+// acceptedRange is one media range of an Accept header with its quality
+type acceptedRange struct {
+	mediaType string
+	q         float64
+}
+
+// acceptedRanges parses an Accept header value, skipping malformed ranges.
+// JSON:API is skipped too when it has parameters other than the ext and
+// profile that specification allows, as it requires.
+func acceptedRanges(accept string) []acceptedRange {
+	var ranges []acceptedRange
+	for _, accepted := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(accepted)
+		if err != nil {
+			continue
+		}
+		if mediaType == MIMEApplicationJSONAPI && !JSONAPIParams(params) {
+			continue
+		}
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+		ranges = append(ranges, acceptedRange{mediaType: mediaType, q: q})
+	}
+	return ranges
+}
+
+// quality is the quality the client gives a media type, taken from the
+// most specific range that matches it: the type itself (2), its type with
+// any subtype (1) or any type (0)
+func quality(ranges []acceptedRange, mediaType string) (q float64, specificity int) {
+	kind, _, _ := strings.Cut(mediaType, "/")
+	specificity = -1
+	for _, r := range ranges {
+		s := -1
+		switch r.mediaType {
+		case mediaType:
+			s = 2
+		case kind + "/*":
+			s = 1
+		case "*/*":
+			s = 0
+		}
+		if s > specificity {
+			q, specificity = r.q, s
+		}
+	}
+	return q, specificity
+}
+
+// member is one field of an object in a document tree
+type member struct {
+	key   string
+	value interface{}
+}
+
+// object is an object of a document tree, keeping its fields in order
+type object []member
+
+// documentTree turns v into the document it is as JSON: an object, a
+// []interface{}, a json.Number, a string, a bool or nil. Going through JSON
+// gives every format the field names and omissions of the JSON tags.
+func documentTree(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return readTree(dec)
+}
+
+func readTree(dec *json.Decoder) (interface{}, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch token {
+	case json.Delim('{'):
+		obj := object{}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := readTree(dec)
+			if err != nil {
+				return nil, err
+			}
+			obj = append(obj, member{key: key.(string), value: value})
+		}
+		_, err = dec.Token()
+		return obj, err
+	case json.Delim('['):
+		list := []interface{}{}
+		for dec.More() {
+			value, err := readTree(dec)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		_, err = dec.Token()
+		return list, err
+	}
+	return token, nil
+}
+
+// plainTree turns objects into maps and numbers into int64 or float64, for
+// the binary formats, which write maps as they are
+func plainTree(tree interface{}) interface{} {
+	switch v := tree.(type) {
+	case object:
+		m := make(map[string]interface{}, len(v))
+		for _, field := range v {
+			m[field.key] = plainTree(field.value)
+		}
+		return m
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = plainTree(item)
+		}
+		return list
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	}
+	return tree
+}
+
+// viaJSON reads a body by decoding it generically and handing the result
+// to encoding/json, so that every format fills v as JSON would
+func viaJSON(decode func(data []byte, v interface{}) error) func(data []byte, v interface{}) error {
+	return func(data []byte, v interface{}) error {
+		var tree interface{}
+		if err := decode(data, &tree); err != nil {
+			return err
+		}
+		data, err := json.Marshal(tree)
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(data, v)
+	}
+}
+
+func marshalYAML(v interface{}) ([]byte, error) {
+	tree, err := documentTree(v)
+	if err != nil {
+		return nil, err
+	}
+	node, err := yamlNode(tree)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(node); err != nil {
+		return nil, err
+	}
+	err = enc.Close()
+	return buf.Bytes(), err
+}
+
+// yamlNode builds the YAML node of a document tree, which keeps fields in
+// the order JSON has them
+func yamlNode(tree interface{}) (*yaml.Node, error) {
+	switch v := tree.(type) {
+	case object:
+		node := &yaml.Node{Kind: yaml.MappingNode}
+		for _, field := range v {
+			value, err := yamlNode(field.value)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: field.key}, value)
+		}
+		return node, nil
+	case []interface{}:
+		node := &yaml.Node{Kind: yaml.SequenceNode}
+		for _, item := range v {
+			value, err := yamlNode(item)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, value)
+		}
+		return node, nil
+	case json.Number:
+		tag := "!!int"
+		if _, err := v.Int64(); err != nil {
+			tag = "!!float"
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: v.String()}, nil
+	}
+	node := &yaml.Node{}
+	err := node.Encode(tree)
+	return node, err
+}
+
+// cborEncMode sorts map keys so that equal documents encode the same way
+var cborEncMode, _ = cbor.CoreDetEncOptions().EncMode()
+
+// cborDecMode decodes maps with string keys, which encoding/json can take
+var cborDecMode, _ = cbor.DecOptions{DefaultMapType: reflect.TypeOf(map[string]interface{}(nil))}.DecMode()
+
+func marshalCBOR(v interface{}) ([]byte, error) {
+	tree, err := documentTree(v)
+	if err != nil {
+		return nil, err
+	}
+	return cborEncMode.Marshal(plainTree(tree))
+}
+
+func marshalMsgpack(v interface{}) ([]byte, error) {
+	tree, err := documentTree(v)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetSortMapKeys(true)
+	err = enc.Encode(plainTree(tree))
+	return buf.Bytes(), err
+}
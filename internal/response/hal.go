@@ -0,0 +1,27 @@
+package response
+
+import "github.com/labstack/echo/v4"
+
+// MIMEApplicationHALJSON is the media type of HAL documents
+const MIMEApplicationHALJSON = "application/hal+json"
+
+// LinksKey is the member HAL documents keep their links in
+const LinksKey = "_links"
+
+// Link is a link of a HAL document. Method is not part of HAL: links to
+// actions carry the method to follow them with, so that clients can offer
+// exactly the actions a resource allows.
+type Link struct {
+	Href   string `json:"href"`
+	Method string `json:"method,omitempty"`
+}
+
+// Links are the links of a HAL document, keyed by relation
+type Links map[string]Link
+
+// WantsHAL reports whether the response to a request is negotiated as HAL,
+// and so should carry links
+func WantsHAL(ctx echo.Context) bool {
+	format, _ := Negotiate(ctx.Request().Header.Get(echo.HeaderAccept))
+	return format == HAL
+}
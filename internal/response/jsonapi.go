@@ -0,0 +1,136 @@
+package response
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// MIMEApplicationJSONAPI is the media type of JSON:API documents
+const MIMEApplicationJSONAPI = "application/vnd.api+json"
+
+// jsonAPIVersion is the version of JSON:API documents follow
+const jsonAPIVersion = "1.1"
+
+// Resource is a JSON:API resource object
+type Resource struct {
+	Type          string                  `json:"type"`
+	ID            string                  `json:"id"`
+	Attributes    map[string]interface{}  `json:"attributes,omitempty"`
+	Relationships map[string]Relationship `json:"relationships,omitempty"`
+	Links         Links                   `json:"links,omitempty"`
+}
+
+// ResourceIdentifier names a resource in a relationship
+type ResourceIdentifier struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// Relationship is a to-one JSON:API relationship; Data is nil when there
+// is no related resource
+type Relationship struct {
+	Data *ResourceIdentifier `json:"data"`
+}
+
+// Compound is the primary data of a JSON:API document, a Resource or a
+// []Resource, with the related resources it includes
+type Compound struct {
+	Data     interface{}
+	Included []Resource
+}
+
+// JSONAPIParams reports whether the parameters of a JSON:API media type are
+// ones the specification allows: ext, profile and, in Accept, q
+func JSONAPIParams(params map[string]string) bool {
+	for name := range params {
+		if name != "ext" && name != "profile" && name != "q" {
+			return false
+		}
+	}
+	return true
+}
+
+// WantsJSONAPI reports whether the response to a request is negotiated as
+// JSON:API, and so should carry resource objects
+func WantsJSONAPI(ctx echo.Context) bool {
+	format, _ := Negotiate(ctx.Request().Header.Get(echo.HeaderAccept))
+	return format == JSONAPI
+}
+
+// jsonAPIDocument is a JSON:API top-level document
+type jsonAPIDocument struct {
+	Data     interface{}            `json:"data,omitempty"`
+	Included []Resource             `json:"included,omitempty"`
+	Errors   []jsonAPIError         `json:"errors,omitempty"`
+	Links    Links                  `json:"links,omitempty"`
+	Meta     map[string]interface{} `json:"meta,omitempty"`
+	JSONAPI  struct {
+		Version string `json:"version"`
+	} `json:"jsonapi"`
+}
+
+// jsonAPIError is a JSON:API error object
+type jsonAPIError struct {
+	Status string              `json:"status"`
+	Code   string              `json:"code,omitempty"`
+	Title  string              `json:"title,omitempty"`
+	Detail string              `json:"detail,omitempty"`
+	Source *jsonAPIErrorSource `json:"source,omitempty"`
+}
+
+// jsonAPIErrorSource points at the member of the request body at fault
+type jsonAPIErrorSource struct {
+	Pointer string `json:"pointer"`
+}
+
+// toJSONAPI turns a response envelope into a JSON:API document. Resources
+// become the primary data and the message goes into meta; data that is not
+// made of resources, such as search results, goes into meta as well.
+// Errors become one error object per field at fault, pointing at the
+// attribute, or a single one when no field is named.
+func toJSONAPI(status int, v interface{}) jsonAPIDocument {
+	var doc jsonAPIDocument
+	doc.JSONAPI.Version = jsonAPIVersion
+
+	switch r := v.(type) {
+	case SuccessResponse:
+		doc.Meta = map[string]interface{}{"message": r.Message}
+		doc.setData(r.Data)
+	case PaginatedResponse:
+		doc.Meta = map[string]interface{}{"message": r.Message, "pagination": r.Pagination}
+		doc.Links = r.Links
+		doc.setData(r.Data)
+	case ErrorResponse:
+		statusText := strconv.Itoa(status)
+		if len(r.Errors) == 0 {
+			doc.Errors = []jsonAPIError{{Status: statusText, Code: r.Code, Title: r.Message, Detail: r.Error}}
+		}
+		for _, field := range r.Errors {
+			doc.Errors = append(doc.Errors, jsonAPIError{
+				Status: statusText,
+				Code:   r.Code,
+				Title:  r.Message,
+				Detail: field.Detail,
+				Source: &jsonAPIErrorSource{Pointer: "/data/attributes/" + strings.ReplaceAll(field.Field, ".", "/")},
+			})
+		}
+	default:
+		doc.Meta = map[string]interface{}{"data": v}
+	}
+	return doc
+}
+
+// setData puts resources into the primary data and anything else into meta
+func (doc *jsonAPIDocument) setData(data interface{}) {
+	switch d := data.(type) {
+	case nil:
+	case Compound:
+		doc.Data, doc.Included = d.Data, d.Included
+	case Resource, []Resource:
+		doc.Data = d
+	default:
+		doc.Meta["data"] = d
+	}
+}
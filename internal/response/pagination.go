@@ -0,0 +1,93 @@
+package response
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Pagination describes where a page sits within the full result set
+type Pagination struct {
+	Total      int    `json:"total"`
+	Limit      int    `json:"limit"`
+	Offset     int    `json:"offset"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
+}
+
+type PaginatedResponse struct {
+	Message    string      `json:"message"`
+	Data       interface{} `json:"data"`
+	Pagination Pagination  `json:"pagination"`
+	// Links are the page itself and its neighbours, in HAL and JSON:API
+	// responses only
+	Links Links `json:"_links,omitempty"`
+}
+
+// JSONPaginatedResponse returns a page of results and advertises the
+// neighbouring pages through an RFC 8288 Link header, and through _links
+// in HAL, in the format the client accepts
+func JSONPaginatedResponse(ctx echo.Context, message string, data interface{}, pagination Pagination) error {
+	links := paginationLinks(ctx, pagination)
+	header := make([]string, len(links))
+	for i, link := range links {
+		header[i] = fmt.Sprintf(`<%s>; rel="%s"`, link.href, link.rel)
+	}
+	// Added alongside any other links, such as a deprecated route's successor
+	ctx.Response().Header().Add("Link", strings.Join(header, ", "))
+
+	page := PaginatedResponse{
+		Message:    message,
+		Data:       data,
+		Pagination: pagination,
+	}
+	if WantsHAL(ctx) || WantsJSONAPI(ctx) {
+		page.Links = Links{"self": {Href: requestURL(ctx).String()}}
+		for _, link := range links {
+			page.Links[link.rel] = Link{Href: link.href}
+		}
+	}
+	return Render(ctx, http.StatusOK, page)
+}
+
+// pageLink is a link to a page of results
+type pageLink struct {
+	rel  string
+	href string
+}
+
+// paginationLinks builds the links to the first, next and previous pages,
+// keeping every other query parameter of the request
+func paginationLinks(ctx echo.Context, pagination Pagination) []pageLink {
+	link := func(rel, cursor string) pageLink {
+		u := requestURL(ctx)
+		query := u.Query()
+		query.Del("offset")
+		query.Del("cursor")
+		query.Set("limit", strconv.Itoa(pagination.Limit))
+		if cursor != "" {
+			query.Set("cursor", cursor)
+		}
+		u.RawQuery = query.Encode()
+		return pageLink{rel: rel, href: u.String()}
+	}
+
+	links := []pageLink{link("first", "")}
+	if pagination.PrevCursor != "" {
+		links = append(links, link("prev", pagination.PrevCursor))
+	}
+	if pagination.NextCursor != "" {
+		links = append(links, link("next", pagination.NextCursor))
+	}
+	return links
+}
+
+// requestURL is the absolute URL of the request
+func requestURL(ctx echo.Context) *url.URL {
+	req := ctx.Request()
+	return &url.URL{Scheme: ctx.Scheme(), Host: req.Host, Path: req.URL.Path, RawQuery: req.URL.RawQuery}
+}
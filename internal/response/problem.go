@@ -0,0 +1,65 @@
+package response
+
+import (
+	"net/http"
+	"sample-service/internal/model"
+
+	"github.com/labstack/echo/v4"
+)
+
+// MIMEApplicationProblemJSON is the media type of RFC 9457 problem details
+const MIMEApplicationProblemJSON = "application/problem+json"
+
+// problemTypePrefix turns an error code into the type of a problem. A URN
+// names the type without pretending there is a page to fetch about it.
+const problemTypePrefix = "urn:sample-service:problem:"
+
+// Problem is an RFC 9457 problem details object. Code and Errors are
+// extension members holding the stable code of the error and the fields
+// of the request that are at fault.
+type Problem struct {
+	Type     string             `json:"type"`
+	Title    string             `json:"title"`
+	Status   int                `json:"status"`
+	Detail   string             `json:"detail,omitempty"`
+	Instance string             `json:"instance,omitempty"`
+	Code     string             `json:"code"`
+	Errors   []model.FieldError `json:"errors,omitempty"`
+}
+
+// NewProblem describes an error with the given status and code that
+// occurred while serving the request
+func NewProblem(ctx echo.Context, status int, code, detail string, errors []model.FieldError) Problem {
+	return Problem{
+		Type:     problemTypePrefix + code,
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: ctx.Request().URL.RequestURI(),
+		Code:     code,
+		Errors:   errors,
+	}
+}
+
+// JSONProblemResponse returns a problem details response
+func JSONProblemResponse(ctx echo.Context, problem Problem) error {
+	ctx.Response().Header().Set(echo.HeaderContentType, MIMEApplicationProblemJSON)
+	return ctx.JSON(problem.Status, problem)
+}
+
+// WantsProblem reports whether the client opted in to problem details in
+// its Accept header. The problem type has to be named, and preferred at
+// least as much as plain JSON; wildcards keep the ErrorResponse that
+// existing clients expect.
+func WantsProblem(req *http.Request) bool {
+	problem, json := -1.0, -1.0
+	for _, r := range acceptedRanges(req.Header.Get(echo.HeaderAccept)) {
+		switch r.mediaType {
+		case MIMEApplicationProblemJSON:
+			problem = max(problem, r.q)
+		case echo.MIMEApplicationJSON:
+			json = max(json, r.q)
+		}
+	}
+	return problem > 0 && problem >= json
+}
@@ -2,6 +2,8 @@ package response
 
 import (
 	"net/http"
+	"sample-service/internal/model"
+	"slices"
 	"github.com/labstack/echo/v4"
 )
 
@@ -10,23 +12,52 @@ type SuccessResponse struct {
 	Data interface{} `json:"data"`
 }
 
+// ErrorResponse describes a failed request. Code is a stable name for the
+// error that clients can switch on, and Errors lists the fields at fault.
+// The central error handler writes it with Render, in the client's format.
 type ErrorResponse struct {
 	Message string `json:"message"`
 	Error string `json:"error"`
+	Code string `json:"code,omitempty"`
+	Errors []model.FieldError `json:"errors,omitempty"`
 }
 
-// JSONSuccessResponse returns a success response
+// JSONSuccessResponse returns a success response in the format the client
+// accepts. The name predates the formats other than JSON.
 func JSONSuccessResponse(ctx echo.Context, message string, data interface{}) error {
-	return ctx.JSON(http.StatusOK, SuccessResponse{
+	return Render(ctx, http.StatusOK, SuccessResponse{
 		Message: message,
 		Data: data,
 	})
 }
 
-// JSONErrorResponse returns an error response
-func JSONErrorResponse(ctx echo.Context, message string, error string) error {
-	return ctx.JSON(http.StatusInternalServerError, ErrorResponse{
+// JSONSuccessResponseWithStatus returns a success response with the given HTTP status
+func JSONSuccessResponseWithStatus(ctx echo.Context, status int, message string, data interface{}) error {
+	return Render(ctx, status, SuccessResponse{
 		Message: message,
-		Error: error,
+		Data: data,
 	})
 }
+
+// Render writes v with the given status in the format negotiated from the
+// Accept header, or in JSON when the client accepts none of the formats.
+// Routes refuse such clients with 406 up front; errors are still answered.
+func Render(ctx echo.Context, status int, v interface{}) error {
+	header := ctx.Response().Header()
+	if !slices.Contains(header.Values(echo.HeaderVary), echo.HeaderAccept) {
+		header.Add(echo.HeaderVary, echo.HeaderAccept)
+	}
+
+	format, _ := Negotiate(ctx.Request().Header.Get(echo.HeaderAccept))
+	if format == JSON {
+		return ctx.JSON(status, v)
+	}
+	if format == JSONAPI {
+		v = toJSONAPI(status, v)
+	}
+	data, err := format.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return ctx.Blob(status, format.MediaType, data)
+}
@@ -86,35 +86,168 @@ var _ = ginkgo.Describe("Response", func() {
 		})
 	})
 
-	ginkgo.Context("JSONErrorResponse", func() {
-		ginkgo.It("should return an error response with status 500", func() {
-			// Test data
-			message := "Error message"
-			errorStr := "Something went wrong"
+	ginkgo.Context("JSONPaginatedResponse", func() {
+		ginkgo.It("should include the pagination block and Link header", func() {
+			// Request a middle page with an unrelated parameter that must be kept
+			req := httptest.NewRequest(http.MethodGet, "/users?offset=10&limit=10&q=x", nil)
+			ctx = e.NewContext(req, rec)
 
 			// Call the function
-			err := response.JSONErrorResponse(ctx, message, errorStr)
+			err := response.JSONPaginatedResponse(ctx, "Page", []string{"a"}, response.Pagination{
+				Total:      30,
+				Limit:      10,
+				Offset:     10,
+				NextCursor: "n",
+				PrevCursor: "p",
+			})
 
 			// Assertions
 			gomega.Expect(err).To(gomega.BeNil())
-			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusInternalServerError))
-			gomega.Expect(rec.Body.String()).To(gomega.ContainSubstring(`"message":"Error message"`))
-			gomega.Expect(rec.Body.String()).To(gomega.ContainSubstring(`"error":"Something went wrong"`))
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusOK))
+			gomega.Expect(rec.Body.String()).To(gomega.ContainSubstring(`"pagination":{"total":30,"limit":10,"offset":10,"next_cursor":"n","prev_cursor":"p"}`))
+			gomega.Expect(rec.Header().Get("Link")).To(gomega.Equal(
+				`<http://example.com/users?limit=10&q=x>; rel="first", ` +
+					`<http://example.com/users?cursor=p&limit=10&q=x>; rel="prev", ` +
+					`<http://example.com/users?cursor=n&limit=10&q=x>; rel="next"`))
 		})
 
-		ginkgo.It("should work with empty error string", func() {
-			// Test data
-			message := "Error with empty error string"
-			errorStr := ""
-
+		ginkgo.It("should only link to the first page when there are no neighbours", func() {
 			// Call the function
-			err := response.JSONErrorResponse(ctx, message, errorStr)
+			err := response.JSONPaginatedResponse(ctx, "Page", []string{}, response.Pagination{Limit: 50})
 
 			// Assertions
 			gomega.Expect(err).To(gomega.BeNil())
-			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusInternalServerError))
-			gomega.Expect(rec.Body.String()).To(gomega.ContainSubstring(`"message":"Error with empty error string"`))
-			gomega.Expect(rec.Body.String()).To(gomega.ContainSubstring(`"error":""`))
+			gomega.Expect(rec.Header().Get("Link")).To(gomega.Equal(`<http://example.com/?limit=50>; rel="first"`))
+			gomega.Expect(rec.Body.String()).NotTo(gomega.ContainSubstring("next_cursor"))
+		})
+	})
+
+	ginkgo.Context("WantsProblem", func() {
+		ginkgo.DescribeTable("should only opt in when problem details are asked for",
+			func(accept string, want bool) {
+				req := httptest.NewRequest(http.MethodGet, "/", nil)
+				if accept != "" {
+					req.Header.Set(echo.HeaderAccept, accept)
+				}
+				gomega.Expect(response.WantsProblem(req)).To(gomega.Equal(want))
+			},
+			ginkgo.Entry("no Accept header", "", false),
+			ginkgo.Entry("wildcard", "*/*", false),
+			ginkgo.Entry("plain JSON", "application/json", false),
+			ginkgo.Entry("problem details", "application/problem+json", true),
+			ginkgo.Entry("problem details preferred", "application/json;q=0.5, application/problem+json", true),
+			ginkgo.Entry("plain JSON preferred", "application/problem+json;q=0.5, application/json", false),
+			ginkgo.Entry("refused", "application/problem+json;q=0", false),
+		)
+
+		ginkgo.It("should write problem details with their own content type", func() {
+			err := response.JSONProblemResponse(ctx, response.NewProblem(ctx, http.StatusNotFound, "not_found", "no user", nil))
+
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(rec.Code).To(gomega.Equal(http.StatusNotFound))
+			gomega.Expect(rec.Header().Get(echo.HeaderContentType)).To(gomega.Equal(response.MIMEApplicationProblemJSON))
+			gomega.Expect(rec.Body.String()).To(gomega.Equal(
+				`{"type":"urn:sample-service:problem:not_found","title":"Not Found","status":404,"detail":"no user","instance":"/","code":"not_found"}` + "\n"))
+		})
+	})
+
+	ginkgo.Context("Formats", func() {
+		ginkgo.DescribeTable("should negotiate the format from the Accept header",
+			func(accept string, want *response.Format, acceptable bool) {
+				format, ok := response.Negotiate(accept)
+				gomega.Expect(format).To(gomega.Equal(want))
+				gomega.Expect(ok).To(gomega.Equal(acceptable))
+			},
+			ginkgo.Entry("no Accept header", "", response.JSON, true),
+			ginkgo.Entry("wildcard", "*/*", response.JSON, true),
+			ginkgo.Entry("XML", "application/xml", response.XML, true),
+			ginkgo.Entry("an alias", "application/x-msgpack", response.Msgpack, true),
+			ginkgo.Entry("a named type over a wildcard", "*/*, text/yaml", response.YAML, true),
+			ginkgo.Entry("a subtype wildcard", "application/*", response.JSON, true),
+			ginkgo.Entry("the highest quality", "application/json;q=0.5, application/cbor", response.CBOR, true),
+			ginkgo.Entry("problem details", "application/problem+json", response.JSON, true),
+			ginkgo.Entry("JSON refused", "application/json;q=0, */*", response.XML, true),
+			ginkgo.Entry("HAL", "application/hal+json, application/json;q=0.9", response.HAL, true),
+			ginkgo.Entry("JSON:API", "application/vnd.api+json", response.JSONAPI, true),
+			ginkgo.Entry("JSON:API with a parameter it forbids", "application/vnd.api+json; charset=utf-8", response.JSON, false),
+			ginkgo.Entry("nothing acceptable", "text/csv", response.JSON, false),
+		)
+
+		ginkgo.It("should find the format of a Content-Type", func() {
+			gomega.Expect(response.FormatOf("application/xml; charset=utf-8")).To(gomega.Equal(response.XML))
+			gomega.Expect(response.FormatOf("application/x-yaml")).To(gomega.Equal(response.YAML))
+			gomega.Expect(response.FormatOf("text/plain")).To(gomega.BeNil())
+		})
+
+		type item struct {
+			ID   int64    `json:"id"`
+			Name string   `json:"name"`
+			Tags []string `json:"tags,omitempty"`
+			Note *string  `json:"note"`
+		}
+		items := []item{{ID: 1, Name: "a", Tags: []string{"x", "y"}}, {ID: 2, Name: "b"}}
+
+		ginkgo.DescribeTable("should write a response that reads back as written",
+			func(format *response.Format) {
+				ctx.Request().Header.Set(echo.HeaderAccept, format.MediaType)
+
+				err := response.JSONSuccessResponse(ctx, "Found", items)
+
+				gomega.Expect(err).To(gomega.BeNil())
+				gomega.Expect(rec.Header().Get(echo.HeaderContentType)).To(gomega.HavePrefix(format.MediaType))
+				gomega.Expect(rec.Header().Values(echo.HeaderVary)).To(gomega.Equal([]string{echo.HeaderAccept}))
+				var got struct {
+					Message string `json:"message"`
+					Data    []item `json:"data"`
+				}
+				gomega.Expect(format.Unmarshal(rec.Body.Bytes(), &got)).To(gomega.Succeed())
+				gomega.Expect(got.Message).To(gomega.Equal("Found"))
+				gomega.Expect(got.Data).To(gomega.Equal(items))
+			},
+			ginkgo.Entry("JSON", response.JSON),
+			ginkgo.Entry("XML", response.XML),
+			ginkgo.Entry("YAML", response.YAML),
+			ginkgo.Entry("CBOR", response.CBOR),
+			ginkgo.Entry("MessagePack", response.Msgpack),
+		)
+
+		ginkgo.It("should write XML with the JSON field names, in order", func() {
+			data, err := response.XML.Marshal(response.SuccessResponse{Message: "Found", Data: items})
+
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(string(data)).To(gomega.Equal(`<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+				`<response><message>Found</message><data>` +
+				`<item><id>1</id><name>a</name><tags><item>x</item><item>y</item></tags><note></note></item>` +
+				`<item><id>2</id><name>b</name><note></note></item>` +
+				`</data></response>`))
+		})
+
+		ginkgo.It("should write YAML with the JSON field names, in order", func() {
+			data, err := response.YAML.Marshal(response.SuccessResponse{Message: "Found", Data: items[1:]})
+
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(string(data)).To(gomega.Equal("message: Found\ndata:\n  - id: 2\n    name: b\n    note: null\n"))
+		})
+
+		ginkgo.It("should read XML by the types of the fields", func() {
+			var got item
+			err := response.XML.Unmarshal([]byte(`<item><id> 7 </id><name>12</name><tags><tag>a</tag></tags><extra/></item>`), &got)
+
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(got).To(gomega.Equal(item{ID: 7, Name: "12", Tags: []string{"a"}}))
+
+			err = response.XML.Unmarshal([]byte(`<item><id>seven</id></item>`), &got)
+			gomega.Expect(err).To(gomega.MatchError(`item.id: "seven" is not a number`))
+		})
+
+		ginkgo.It("should answer in JSON when the client accepts no format", func() {
+			ctx.Request().Header.Set(echo.HeaderAccept, "text/csv")
+
+			err := response.Render(ctx, http.StatusNotAcceptable, response.ErrorResponse{Message: "Not acceptable", Error: "no format"})
+
+			gomega.Expect(err).To(gomega.BeNil())
+			gomega.Expect(rec.Header().Get(echo.HeaderContentType)).To(gomega.HavePrefix(echo.MIMEApplicationJSON))
+			gomega.Expect(rec.Body.String()).To(gomega.ContainSubstring(`"error":"no format"`))
 		})
 	})
-})
\ No newline at end of file
+})
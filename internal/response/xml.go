@@ -0,0 +1,250 @@
+package response
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// XML documents are the JSON document with an element for each field,
+// inside a response element. Arrays hold an item element per value and
+// null is an empty element, as is an empty string.
+const (
+	xmlRoot = "response"
+	xmlItem = "item"
+)
+
+func marshalXML(v interface{}) ([]byte, error) {
+	tree, err := documentTree(v)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	if err := writeXML(enc, xmlRoot, tree); err != nil {
+		return nil, err
+	}
+	err = enc.Flush()
+	return buf.Bytes(), err
+}
+
+func writeXML(enc *xml.Encoder, name string, tree interface{}) error {
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+	switch v := tree.(type) {
+	case object:
+		for _, field := range v {
+			if err := writeXML(enc, field.key, field.value); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if err := writeXML(enc, xmlItem, item); err != nil {
+				return err
+			}
+		}
+	case nil:
+	default:
+		if err := enc.EncodeToken(xml.CharData(fmt.Sprint(v))); err != nil {
+			return err
+		}
+	}
+	return enc.EncodeToken(start.End())
+}
+
+// xmlElement is an element of a request body, with its text when it has
+// no child elements
+type xmlElement struct {
+	name     string
+	text     string
+	children []*xmlElement
+}
+
+// unmarshalXML reads an XML body into v. XML says nothing of types, so
+// the body is turned into JSON by the types of the fields of v: numbers
+// and booleans are parsed from text, an empty element is null for a
+// pointer, and every child of an element bound to a slice is an item of
+// it whatever its name.
+func unmarshalXML(data []byte, v interface{}) error {
+	root, err := parseXML(data)
+	if err != nil {
+		return err
+	}
+	tree, err := xmlValue(root, reflect.TypeOf(v), root.name)
+	if err != nil {
+		return err
+	}
+	data, err = json.Marshal(tree)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func parseXML(data []byte) (*xmlElement, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	var stack []*xmlElement
+	var root *xmlElement
+	for {
+		token, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			el := &xmlElement{name: t.Name.Local}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, el)
+			} else if root == nil {
+				root = el
+			}
+			stack = append(stack, el)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text += string(t)
+			}
+		}
+	}
+	if root == nil {
+		return nil, fmt.Errorf("no root element")
+	}
+	return root, nil
+}
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// xmlValue turns an element into the JSON value of type t. path names the
+// element in errors.
+func xmlValue(el *xmlElement, t reflect.Type, path string) (interface{}, error) {
+	empty := len(el.children) == 0 && strings.TrimSpace(el.text) == ""
+	if t.Kind() == reflect.Pointer && empty {
+		return nil, nil
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		if empty {
+			return nil, nil
+		}
+		return strings.TrimSpace(el.text), nil
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return el.text, nil
+	case reflect.Struct, reflect.Map:
+		if empty {
+			return nil, nil
+		}
+		obj := map[string]interface{}{}
+		for _, child := range el.children {
+			ft, ok := xmlFieldType(t, child.name)
+			if !ok {
+				continue
+			}
+			value, err := xmlValue(child, ft, path+"."+child.name)
+			if err != nil {
+				return nil, err
+			}
+			obj[child.name] = value
+		}
+		return obj, nil
+	case reflect.Slice, reflect.Array:
+		list := []interface{}{}
+		for i, child := range el.children {
+			value, err := xmlValue(child, t.Elem(), fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		return list, nil
+	case reflect.Interface:
+		return xmlAny(el), nil
+	}
+
+	text := strings.TrimSpace(el.text)
+	if text == "" {
+		return nil, nil
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %q is not a boolean", path, text)
+		}
+		return b, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		if _, err := strconv.ParseFloat(text, 64); err != nil {
+			return nil, fmt.Errorf("%s: %q is not a number", path, text)
+		}
+		return json.Number(text), nil
+	}
+	return nil, fmt.Errorf("%s: cannot read %s from XML", path, t)
+}
+
+// xmlAny turns an element into JSON without a type to go by: objects for
+// elements with children, strings for the rest
+func xmlAny(el *xmlElement) interface{} {
+	if len(el.children) == 0 {
+		return el.text
+	}
+	obj := map[string]interface{}{}
+	for _, child := range el.children {
+		obj[child.name] = xmlAny(child)
+	}
+	return obj
+}
+
+// xmlFieldType finds the type of the field of a struct, or of the values
+// of a map, that a child element is read into
+func xmlFieldType(t reflect.Type, name string) (reflect.Type, bool) {
+	if t.Kind() == reflect.Map {
+		return t.Elem(), t.Key().Kind() == reflect.String
+	}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		tag, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		if tag == "-" {
+			continue
+		}
+		if sf.Anonymous && tag == "" {
+			ft := sf.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				if found, ok := xmlFieldType(ft, name); ok {
+					return found, true
+				}
+				continue
+			}
+		}
+		if tag == name || (tag == "" && strings.EqualFold(sf.Name, name)) {
+			return sf.Type, true
+		}
+	}
+	return nil, false
+}
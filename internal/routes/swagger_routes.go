@@ -3,10 +3,15 @@ package routes
 import (
 	"github.com/labstack/echo/v4"
 	echoSwagger "github.com/swaggo/echo-swagger"
-	_ "sample-service/docs"
+	_ "sample-service/docs/v1"
+	_ "sample-service/docs/v2"
 )
 
-// RegisterSwaggerRoutes registers the swagger routes
+// RegisterSwaggerRoutes registers the swagger routes, one document per
+// version of the API. /swagger/ is version 1, as the unversioned paths are.
 func RegisterSwaggerRoutes(e *echo.Echo) {
-	e.GET("/swagger/*", echoSwagger.WrapHandler)
-}
+	v1 := echoSwagger.EchoWrapHandler(echoSwagger.InstanceName("v1"))
+	e.GET("/swagger/*", v1)
+	e.GET("/swagger/v1/*", v1)
+	e.GET("/swagger/v2/*", echoSwagger.EchoWrapHandler(echoSwagger.InstanceName("v2")))
+}
\ No newline at end of file
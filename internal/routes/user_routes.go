@@ -5,16 +5,58 @@ import (
     "sample-service/internal/controllers"
     "sample-service/internal/repository"
     "database/sql"
+    "time"
 )
 
-// RegisterUserRoutes registers the user routes
-func RegisterUserRoutes(e *echo.Echo, db *sql.DB) {
-    userRepo := repository.NewUserRepository(db)
-    userController := controllers.NewUserController(userRepo)
+// unversioned are the paths from before the API was versioned. They serve
+// version 1 until the sunset, telling clients to move to /v1.
+var unversioned = controllers.Deprecation{
+    Since:     time.Date(2026, time.October, 17, 0, 0, 0, 0, time.UTC),
+    Sunset:    time.Date(2027, time.April, 17, 0, 0, 0, 0, time.UTC),
+    Successor: "/v1",
+}
 
-    e.GET("/users", userController.GetAllUsers)
-    e.GET("/users/:id", userController.GetUserByID)
-    e.POST("/users", userController.CreateUser)
-    e.PUT("/users/:id", userController.UpdateUser)
-    e.DELETE("/users/:id", userController.DeleteUser)
+// retired are the versions that are still served but deprecated, keyed by
+// their prefix. Retiring a version is a matter of adding it here, e.g.
+//
+//	"/v1": {Since: ..., Sunset: ..., Prefix: "/v1", Successor: "/v2"}
+var retired = map[string]controllers.Deprecation{}
+
+// RegisterUserRoutes registers the user and department routes under /v1
+// and /v2, and the unversioned paths as a deprecated copy of /v1. Users can
+// include their department with ?include=department. POST requests with an
+// Idempotency-Key get their response replayed to retries for idempotencyTTL.
+// Every route but the export, which picks its own format, answers in the
+// format negotiated from the Accept header. userRepo is the repository of
+// the users in db, shared with the scheduler so that both keep the same
+// suggestions up to date. Users can only be purged if trustActorRole is
+// set, as X-Actor-Role is taken at its word.
+func RegisterUserRoutes(e *echo.Echo, db *sql.DB, userRepo repository.UserRepository, idempotencyTTL time.Duration, trustActorRole bool) {
+    departmentRepo := repository.NewDepartmentRepository(db, userRepo)
+    idempotent := controllers.Idempotency(repository.NewIdempotencyRepository(db), idempotencyTTL)
+    v1 := controllers.NewUserController(userRepo)
+    v1.RegisterInclude("department", controllers.DepartmentInclude(departmentRepo))
+    v2 := controllers.NewUserControllerV2(userRepo)
+    v2.RegisterInclude("department", controllers.DepartmentInclude(departmentRepo))
+    if trustActorRole {
+        v1.TrustActorRole()
+        v2.TrustActorRole()
+    }
+    v1Departments := controllers.NewDepartmentController(departmentRepo, v1)
+    changeRepo := repository.NewScheduledChangeRepository(db, userRepo)
+    v1Changes := controllers.NewScheduledChangeController(changeRepo)
+
+    registerV1(e.Group("/v1"), v1, v1Departments, v1Changes, idempotent, deprecation("/v1")...)
+    registerV2(e.Group("/v2"), v2, controllers.NewDepartmentControllerV2(departmentRepo, v2), controllers.NewScheduledChangeControllerV2(changeRepo), idempotent, deprecation("/v2")...)
+    registerV1(e.Group(""), v1, v1Departments, v1Changes, idempotent, controllers.Deprecated(unversioned))
+}
+
+// deprecation is the middleware marking the routes of a version as
+// deprecated, if it is retired
+func deprecation(prefix string) []echo.MiddlewareFunc {
+    d, ok := retired[prefix]
+    if !ok {
+        return nil
+    }
+    return []echo.MiddlewareFunc{controllers.Deprecated(d)}
 }
\ No newline at end of file
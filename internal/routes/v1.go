@@ -0,0 +1,50 @@
+package routes
+
+import (
+	"github.com/labstack/echo/v4"
+	"sample-service/internal/controllers"
+	"slices"
+)
+
+// @title Sample Service API
+// @version 1.0
+// @description API for managing users and their departments. Statuses are the codes A(ctive), I(nactive) and T(erminated).
+// @host localhost:1323
+// @BasePath /v1
+
+// registerV1 adds the routes of version 1 of the API to g, each behind m
+func registerV1(g *echo.Group, uc *controllers.UserController, dc *controllers.DepartmentController, sc *controllers.ScheduledChangeController, idempotent echo.MiddlewareFunc, m ...echo.MiddlewareFunc) {
+	negotiated := slices.Concat(m, []echo.MiddlewareFunc{controllers.Negotiate})
+	replayable := slices.Concat(negotiated, []echo.MiddlewareFunc{idempotent})
+
+	g.GET("/users", uc.GetAllUsers, negotiated...)
+	g.GET("/users/search", uc.SearchUsers, negotiated...)
+	g.GET("/users/suggest", uc.SuggestUsers, negotiated...)
+	g.GET("/users/export", uc.ExportUsers, m...)
+	g.GET("/users/:id", uc.GetUserByID, negotiated...)
+	g.POST("/users", uc.CreateUser, replayable...)
+	g.POST("/users/bulk", uc.BulkUsers, replayable...)
+	g.POST("/users/import", uc.ImportUsers, replayable...)
+	g.PUT("/users/:id", uc.UpdateUser, negotiated...)
+	g.PATCH("/users/:id", uc.PatchUser, negotiated...)
+	g.DELETE("/users/:id", uc.DeleteUser, negotiated...)
+	g.POST("/users/:id/restore", uc.RestoreUser, replayable...)
+	g.GET("/users/:id/transitions", uc.GetUserTransitions, negotiated...)
+	g.GET("/users/:id/reports", uc.GetUserReports, negotiated...)
+	g.GET("/users/:id/chain", uc.GetUserChain, negotiated...)
+	g.POST("/users/:id/activate", uc.ActivateUser, replayable...)
+	g.POST("/users/:id/deactivate", uc.DeactivateUser, replayable...)
+	g.POST("/users/:id/terminate", uc.TerminateUser, replayable...)
+	g.POST("/users/:id/rehire", uc.RehireUser, replayable...)
+	g.GET("/users/:id/scheduled-changes", sc.GetScheduledChanges, negotiated...)
+	g.POST("/users/:id/scheduled-changes", sc.ScheduleChange, replayable...)
+	g.DELETE("/users/:id/scheduled-changes/:change_id", sc.CancelScheduledChange, negotiated...)
+	g.GET("/orgchart", uc.GetOrgChart, m...)
+
+	g.GET("/departments", dc.GetAllDepartments, negotiated...)
+	g.GET("/departments/:id", dc.GetDepartmentByID, negotiated...)
+	g.GET("/departments/:id/users", dc.GetDepartmentUsers, negotiated...)
+	g.POST("/departments", dc.CreateDepartment, replayable...)
+	g.PUT("/departments/:id", dc.UpdateDepartment, negotiated...)
+	g.DELETE("/departments/:id", dc.DeleteDepartment, negotiated...)
+}
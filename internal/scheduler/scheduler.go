@@ -0,0 +1,87 @@
+// Package scheduler applies scheduled changes to users once they take
+// effect. Changes are kept in the database, so the scheduler picks up where
+// it left off after a restart: its first run, at start, applies every
+// change that fell due while the service was down.
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sample-service/internal/model"
+	"sample-service/internal/repository"
+	"time"
+)
+
+// DefaultInterval is how often the scheduler looks for due changes
+const DefaultInterval = time.Minute
+
+// Scheduler applies due changes at a fixed interval
+type Scheduler struct {
+	changes  repository.ScheduledChangeRepository
+	interval time.Duration
+}
+
+// New creates a Scheduler that looks for due changes every interval
+func New(changes repository.ScheduledChangeRepository, interval time.Duration) *Scheduler {
+	return &Scheduler{changes: changes, interval: interval}
+}
+
+// Run applies due changes at once and then every interval, until ctx is
+// done. A run that fails is logged and retried at the next tick.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if applied, err := s.RunOnce(); err != nil {
+			log.Printf("scheduler: %v", err)
+		} else if applied > 0 {
+			log.Printf("scheduler: applied %d scheduled changes", applied)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce applies every change that is due, returning how many were applied
+func (s *Scheduler) RunOnce() (int, error) {
+	return s.changes.ApplyDueChanges(time.Now(), Apply)
+}
+
+// Apply makes a scheduled change to its user through users: the
+// transition first, for the reason the change gives, then the move to
+// another department. Both are recorded as made by whoever scheduled the
+// change.
+func Apply(users repository.UserRepository, change model.ScheduledChange) error {
+	if change.Transition != "" {
+		transition, ok := model.FindTransition(change.Transition)
+		if !ok {
+			return repository.Errorf(repository.ErrValidation, "unknown transition %q", change.Transition)
+		}
+		if _, err := users.TransitionUser(int(change.UserID), transition, change.Reason, change.CreatedBy, 0); err != nil {
+			return err
+		}
+	}
+
+	if change.DepartmentID == 0 {
+		return nil
+	}
+	user, err := users.GetUserByID(int(change.UserID))
+	if err != nil {
+		return err
+	}
+	if user.DepartmentID == change.DepartmentID {
+		return nil
+	}
+	user.DepartmentID, user.Department = change.DepartmentID, ""
+	user.UpdatedBy = change.CreatedBy
+	if _, err := users.UpdateUser(*user); err != nil {
+		return fmt.Errorf("failed to move user %d to department %d: %w", change.UserID, change.DepartmentID, err)
+	}
+	return nil
+}
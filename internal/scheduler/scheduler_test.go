@@ -0,0 +1,121 @@
+package scheduler_test
+
+import (
+	"errors"
+	"sample-service/internal/model"
+	"sample-service/internal/repository"
+	"sample-service/internal/scheduler"
+	"testing"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+func TestScheduler(t *testing.T) {
+	gomega.RegisterFailHandler(ginkgo.Fail)
+	ginkgo.RunSpecs(t, "Scheduler Suite")
+}
+
+// fakeUsers records the writes a change makes to a single user; the
+// methods a change does not use are left to the embedded interface
+type fakeUsers struct {
+	repository.UserRepository
+	user        model.User
+	transitions []string
+	actor       string
+	updates     []model.User
+}
+
+func (f *fakeUsers) GetUserByID(id int, fields ...string) (*model.User, error) {
+	user := f.user
+	return &user, nil
+}
+
+func (f *fakeUsers) TransitionUser(id int, transition model.Transition, reason, actor string, version int64) (*model.User, error) {
+	if !transition.Allows(f.user.UserStatus) {
+		return nil, &repository.Error{Kind: repository.ErrConflict, Code: repository.CodeInvalidTransition, Err: errors.New("cannot " + transition.Name)}
+	}
+	f.transitions = append(f.transitions, transition.Name+": "+reason)
+	f.actor = actor
+	f.user.UserStatus = transition.To
+	return &f.user, nil
+}
+
+func (f *fakeUsers) UpdateUser(user model.User) (*model.User, error) {
+	f.updates = append(f.updates, user)
+	f.user = user
+	return &user, nil
+}
+
+// fakeChanges hands its due changes to apply, as ApplyDueChanges does
+type fakeChanges struct {
+	repository.ScheduledChangeRepository
+	users  *fakeUsers
+	due    []model.ScheduledChange
+	asOf   time.Time
+	failed []error
+}
+
+func (f *fakeChanges) ApplyDueChanges(now time.Time, apply func(users repository.UserRepository, change model.ScheduledChange) error) (int, error) {
+	f.asOf = now
+	applied := 0
+	for _, change := range f.due {
+		if err := apply(f.users, change); err != nil {
+			f.failed = append(f.failed, err)
+			continue
+		}
+		applied++
+	}
+	return applied, nil
+}
+
+var _ = ginkgo.Describe("Scheduler", func() {
+	var users *fakeUsers
+
+	ginkgo.BeforeEach(func() {
+		users = &fakeUsers{user: model.User{ID: 7, UserName: "jdoe", UserStatus: "A", Department: "Engineering", DepartmentID: 1, Version: 3}}
+	})
+
+	ginkgo.It("should make the transition and then move the user, as whoever scheduled it", func() {
+		change := model.ScheduledChange{UserID: 7, Transition: "deactivate", DepartmentID: 2, Reason: "Parental leave", CreatedBy: "hr.admin"}
+
+		gomega.Expect(scheduler.Apply(users, change)).To(gomega.Succeed())
+
+		gomega.Expect(users.transitions).To(gomega.Equal([]string{"deactivate: Parental leave"}))
+		gomega.Expect(users.actor).To(gomega.Equal("hr.admin"))
+		gomega.Expect(users.updates).To(gomega.HaveLen(1))
+		gomega.Expect(users.updates[0].DepartmentID).To(gomega.Equal(int64(2)))
+		gomega.Expect(users.updates[0].Department).To(gomega.BeEmpty())
+		gomega.Expect(users.updates[0].UserStatus).To(gomega.Equal("I"))
+		gomega.Expect(users.updates[0].UpdatedBy).To(gomega.Equal("hr.admin"))
+	})
+
+	ginkgo.It("should not write a user already in the department", func() {
+		gomega.Expect(scheduler.Apply(users, model.ScheduledChange{UserID: 7, DepartmentID: 1, Reason: "Transfer"})).To(gomega.Succeed())
+
+		gomega.Expect(users.updates).To(gomega.BeEmpty())
+	})
+
+	ginkgo.It("should refuse a transition that no longer fits the user's status", func() {
+		err := scheduler.Apply(users, model.ScheduledChange{UserID: 7, Transition: "rehire", DepartmentID: 2, Reason: "Back"})
+
+		gomega.Expect(errors.Is(err, repository.ErrConflict)).To(gomega.BeTrue())
+		gomega.Expect(users.updates).To(gomega.BeEmpty())
+	})
+
+	ginkgo.It("should apply every change due by the time it runs", func() {
+		changes := &fakeChanges{users: users, due: []model.ScheduledChange{
+			{UserID: 7, Transition: "terminate", Reason: "Left"},
+			{UserID: 7, Transition: "activate", Reason: "Too late"},
+		}}
+		before := time.Now()
+
+		applied, err := scheduler.New(changes, time.Minute).RunOnce()
+
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(applied).To(gomega.Equal(1))
+		gomega.Expect(changes.failed).To(gomega.HaveLen(1))
+		gomega.Expect(changes.asOf).NotTo(gomega.BeTemporally("<", before))
+	})
+})
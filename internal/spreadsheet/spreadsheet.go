@@ -0,0 +1,210 @@
+// Package spreadsheet reads and writes tables of text cells as CSV or XLSX,
+// so the user directory can be exchanged with the spreadsheets HR works in.
+// Writers stream rows out as they are given; readers return the rows of the
+// first sheet. CSV cells that a spreadsheet program would run as formulas
+// are written with a leading ', which the CSV reader takes off again; XLSX
+// cells are always stored as text and need no escaping.
+package spreadsheet
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Format is a spreadsheet file format
+type Format string
+
+// Supported formats
+const (
+	CSV  Format = "csv"
+	XLSX Format = "xlsx"
+)
+
+// sheetName names the sheet XLSX files are written to
+const sheetName = "Users"
+
+// formulaStarts are the first characters that make spreadsheet programs
+// read a cell as a formula
+const formulaStarts = "=+-@\t\r"
+
+// escapeCell keeps a cell such as =HYPERLINK(...) from being run when the
+// file is opened, by prefixing it with ' so that it is read as text
+func escapeCell(cell string) string {
+	if cell != "" && strings.IndexByte(formulaStarts, cell[0]) >= 0 {
+		return "'" + cell
+	}
+	return cell
+}
+
+// unescapeCell takes off the ' escapeCell put in front of a cell
+func unescapeCell(cell string) string {
+	if len(cell) > 1 && cell[0] == '\'' && strings.IndexByte(formulaStarts, cell[1]) >= 0 {
+		return cell[1:]
+	}
+	return cell
+}
+
+// escapeRow escapes every cell of a row
+func escapeRow(row []string) []string {
+	escaped := make([]string, len(row))
+	for i, cell := range row {
+		escaped[i] = escapeCell(cell)
+	}
+	return escaped
+}
+
+// ParseFormat parses a format name such as "csv" or "XLSX"
+func ParseFormat(name string) (Format, error) {
+	switch Format(strings.ToLower(strings.TrimSpace(name))) {
+	case CSV:
+		return CSV, nil
+	case XLSX:
+		return XLSX, nil
+	}
+	return "", fmt.Errorf("unsupported format %q: must be csv or xlsx", name)
+}
+
+// FormatOf infers the format of a file from its extension
+func FormatOf(filename string) (Format, error) {
+	ext := strings.TrimPrefix(filepath.Ext(filename), ".")
+	if ext == "" {
+		return "", fmt.Errorf("cannot tell the format of %q: give the format explicitly", filename)
+	}
+	return ParseFormat(ext)
+}
+
+// ContentType is the media type of files in the format
+func (f Format) ContentType() string {
+	if f == XLSX {
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// Writer writes a spreadsheet one row at a time. Close must be called to
+// finish the file.
+type Writer interface {
+	Write(row []string) error
+	Close() error
+}
+
+// NewWriter returns a Writer of the given format that writes to w
+func NewWriter(w io.Writer, format Format) (Writer, error) {
+	switch format {
+	case CSV:
+		return &csvWriter{csv.NewWriter(w)}, nil
+	case XLSX:
+		return newXLSXWriter(w)
+	}
+	return nil, fmt.Errorf("unsupported format %q", format)
+}
+
+// ReadAll reads every row of a spreadsheet, or of the first sheet of a
+// workbook. Rows may have fewer cells than the header where trailing cells
+// are empty.
+func ReadAll(r io.Reader, format Format) ([][]string, error) {
+	var rows [][]string
+	var err error
+	switch format {
+	case CSV:
+		reader := csv.NewReader(r)
+		reader.FieldsPerRecord = -1
+		reader.TrimLeadingSpace = true
+		rows, err = reader.ReadAll()
+		for _, row := range rows {
+			for i, cell := range row {
+				row[i] = unescapeCell(cell)
+			}
+		}
+	case XLSX:
+		rows, err = readXLSX(r)
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+	return rows, err
+}
+
+// csvWriter flushes after every row so rows reach the client as they are
+// written rather than when the buffer fills
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func (c *csvWriter) Write(row []string) error {
+	if err := c.w.Write(escapeRow(row)); err != nil {
+		return err
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// xlsxWriter writes rows through excelize's stream writer, which keeps only
+// a bounded number of rows in memory and spills the rest to a temporary
+// file. The workbook itself can only be written out once it is complete.
+type xlsxWriter struct {
+	out    io.Writer
+	file   *excelize.File
+	stream *excelize.StreamWriter
+	rows   int
+}
+
+func newXLSXWriter(w io.Writer) (*xlsxWriter, error) {
+	file := excelize.NewFile()
+	if err := file.SetSheetName(file.GetSheetName(0), sheetName); err != nil {
+		file.Close()
+		return nil, err
+	}
+	stream, err := file.NewStreamWriter(sheetName)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &xlsxWriter{out: w, file: file, stream: stream}, nil
+}
+
+func (x *xlsxWriter) Write(row []string) error {
+	x.rows++
+	cell, err := excelize.CoordinatesToCellName(1, x.rows)
+	if err != nil {
+		return err
+	}
+	// Strings are written as string cells, which are never evaluated, so
+	// unlike CSV they are stored as they are
+	values := make([]interface{}, len(row))
+	for i, value := range row {
+		values[i] = value
+	}
+	return x.stream.SetRow(cell, values)
+}
+
+func (x *xlsxWriter) Close() error {
+	defer x.file.Close()
+	if err := x.stream.Flush(); err != nil {
+		return err
+	}
+	return x.file.Write(x.out)
+}
+
+func readXLSX(r io.Reader) ([][]string, error) {
+	file, err := excelize.OpenReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid xlsx file: %w", err)
+	}
+	defer file.Close()
+
+	sheets := file.GetSheetList()
+	if len(sheets) == 0 {
+		return nil, nil
+	}
+	return file.GetRows(sheets[0])
+}
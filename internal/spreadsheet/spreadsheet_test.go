@@ -0,0 +1,94 @@
+package spreadsheet_test
+
+import (
+	"bytes"
+	"sample-service/internal/spreadsheet"
+	"strings"
+	"testing"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+func TestSpreadsheet(t *testing.T) {
+	gomega.RegisterFailHandler(ginkgo.Fail)
+	ginkgo.RunSpecs(t, "Spreadsheet Suite")
+}
+
+var rows = [][]string{
+	{"user_name", "first_name", "department"},
+	{"johndoe", "John", "Engineering"},
+	{"josé", "José, Jr.", ""},
+}
+
+var _ = ginkgo.Describe("Spreadsheet", func() {
+	ginkgo.DescribeTable("should read back what it writes",
+		func(format spreadsheet.Format, trailing [][]string) {
+			var buf bytes.Buffer
+			w, err := spreadsheet.NewWriter(&buf, format)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			for _, row := range rows {
+				gomega.Expect(w.Write(row)).To(gomega.Succeed())
+			}
+			gomega.Expect(w.Close()).To(gomega.Succeed())
+
+			read, err := spreadsheet.ReadAll(&buf, format)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(read[:2]).To(gomega.Equal(rows[:2]))
+			gomega.Expect(read[2:]).To(gomega.Equal(trailing))
+		},
+		ginkgo.Entry("CSV", spreadsheet.CSV, [][]string{{"josé", "José, Jr.", ""}}),
+		// XLSX drops empty trailing cells
+		ginkgo.Entry("XLSX", spreadsheet.XLSX, [][]string{{"josé", "José, Jr."}}),
+	)
+
+	ginkgo.DescribeTable("should write cells that look like formulas as text and read them back",
+		func(format spreadsheet.Format) {
+			row := []string{"=HYPERLINK(\"http://evil\",\"x\")", "+cmd|' /C calc'!A0", "-1", "@SUM(A1)", "a=b"}
+			var buf bytes.Buffer
+			w, err := spreadsheet.NewWriter(&buf, format)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(w.Write(row)).To(gomega.Succeed())
+			gomega.Expect(w.Close()).To(gomega.Succeed())
+			// XLSX stores them as text cells, which are never run, so only
+			// CSV needs the leading '
+			if format == spreadsheet.CSV {
+				gomega.Expect(buf.String()).To(gomega.Equal(`"'=HYPERLINK(""http://evil"",""x"")",'+cmd|' /C calc'!A0,'-1,'@SUM(A1),a=b` + "\n"))
+			}
+
+			read, err := spreadsheet.ReadAll(&buf, format)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(read).To(gomega.Equal([][]string{row}))
+		},
+		ginkgo.Entry("CSV", spreadsheet.CSV),
+		ginkgo.Entry("XLSX", spreadsheet.XLSX),
+	)
+
+	ginkgo.It("should read rows of uneven length from CSV", func() {
+		read, err := spreadsheet.ReadAll(strings.NewReader("a,b,c\n1\n"), spreadsheet.CSV)
+
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(read).To(gomega.Equal([][]string{{"a", "b", "c"}, {"1"}}))
+	})
+
+	ginkgo.It("should reject a file that is not a workbook", func() {
+		_, err := spreadsheet.ReadAll(strings.NewReader("a,b,c\n"), spreadsheet.XLSX)
+
+		gomega.Expect(err).To(gomega.MatchError(gomega.ContainSubstring("invalid xlsx file")))
+	})
+
+	ginkgo.It("should tell formats apart by name and extension", func() {
+		format, err := spreadsheet.ParseFormat(" XLSX ")
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(format).To(gomega.Equal(spreadsheet.XLSX))
+
+		format, err = spreadsheet.FormatOf("HR export.CSV")
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(format).To(gomega.Equal(spreadsheet.CSV))
+
+		_, err = spreadsheet.FormatOf("users.ods")
+		gomega.Expect(err).To(gomega.MatchError(gomega.ContainSubstring("unsupported format")))
+		_, err = spreadsheet.FormatOf("users")
+		gomega.Expect(err).To(gomega.HaveOccurred())
+	})
+})
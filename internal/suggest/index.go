@@ -0,0 +1,199 @@
+// Package suggest provides an in-memory, typo-tolerant prefix index over
+// users for autocomplete. Names are folded to lower case without accents,
+// broken into trigrams to find candidates, and candidates are scored by
+// prefix match or by edit distance so that "jsoe" still finds "José".
+package suggest
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"sample-service/internal/model"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Suggestion is a matched user and how closely it matched, from 0 to 1
+type Suggestion struct {
+	User  model.User
+	Score float64
+}
+
+type entry struct {
+	user  model.User
+	terms []string
+}
+
+// Index maps trigrams of user names, usernames and email addresses to the
+// users that contain them. It is safe for concurrent use.
+type Index struct {
+	mu       sync.RWMutex
+	entries  map[int64]*entry
+	postings map[string]map[int64]struct{}
+}
+
+// NewIndex creates an empty index
+func NewIndex() *Index {
+	return &Index{
+		entries:  map[int64]*entry{},
+		postings: map[string]map[int64]struct{}{},
+	}
+}
+
+// Put adds a user to the index, replacing any previous version of it
+func (idx *Index) Put(user model.User) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.remove(user.ID)
+
+	e := &entry{user: user, terms: userTerms(user)}
+	idx.entries[user.ID] = e
+	for _, term := range e.terms {
+		for _, gram := range trigrams(term) {
+			if idx.postings[gram] == nil {
+				idx.postings[gram] = map[int64]struct{}{}
+			}
+			idx.postings[gram][user.ID] = struct{}{}
+		}
+	}
+}
+
+// Remove drops a user from the index
+func (idx *Index) Remove(id int64) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.remove(id)
+}
+
+func (idx *Index) remove(id int64) {
+	e, ok := idx.entries[id]
+	if !ok {
+		return
+	}
+	for _, term := range e.terms {
+		for _, gram := range trigrams(term) {
+			delete(idx.postings[gram], id)
+			if len(idx.postings[gram]) == 0 {
+				delete(idx.postings, gram)
+			}
+		}
+	}
+	delete(idx.entries, id)
+}
+
+// Len returns the number of indexed users
+func (idx *Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.entries)
+}
+
+// Suggest returns up to limit users for which every word of prefix starts,
+// or nearly starts, one of their names, best matches first
+func (idx *Index) Suggest(prefix string, limit int) []Suggestion {
+	words := strings.Fields(fold(prefix))
+	if len(words) == 0 || limit <= 0 {
+		return []Suggestion{}
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	candidates := map[int64]struct{}{}
+	for _, word := range words {
+		for _, gram := range trigrams(word) {
+			for id := range idx.postings[gram] {
+				candidates[id] = struct{}{}
+			}
+		}
+	}
+
+	suggestions := []Suggestion{}
+	for id := range candidates {
+		e := idx.entries[id]
+		total := 0.0
+		for _, word := range words {
+			best := 0.0
+			for _, term := range e.terms {
+				if score := matchScore(word, term); score > best {
+					best = score
+				}
+			}
+			if best == 0 {
+				total = 0
+				break
+			}
+			total += best
+		}
+		if total > 0 {
+			suggestions = append(suggestions, Suggestion{User: e.user, Score: total / float64(len(words))})
+		}
+	}
+
+	sort.Slice(suggestions, func(i, j int) bool {
+		a, b := suggestions[i], suggestions[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.User.LastName != b.User.LastName {
+			return fold(a.User.LastName) < fold(b.User.LastName)
+		}
+		return a.User.ID < b.User.ID
+	})
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions
+}
+
+// userTerms lists the folded words a user can be found by
+func userTerms(user model.User) []string {
+	local := user.Email
+	if at := strings.LastIndex(local, "@"); at >= 0 {
+		local = local[:at]
+	}
+
+	var terms []string
+	seen := map[string]bool{}
+	for _, text := range []string{user.FirstName, user.LastName, user.UserName, local} {
+		words := strings.FieldsFunc(fold(text), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		for _, word := range words {
+			if !seen[word] {
+				seen[word] = true
+				terms = append(terms, word)
+			}
+		}
+	}
+	return terms
+}
+
+// accentRemover strips combining marks after decomposition, so "é" becomes "e"
+var accentRemover = transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+
+// fold lower-cases text and removes its accents
+func fold(text string) string {
+	folded, _, err := transform.String(accentRemover, text)
+	if err != nil {
+		folded = text
+	}
+	return strings.ToLower(folded)
+}
+
+// trigrams splits a word into overlapping three-rune sequences. The word is
+// padded at the start only, so a prefix shares all of its trigrams with the
+// words it starts.
+func trigrams(word string) []string {
+	padded := []rune("  " + word)
+	grams := make([]string, 0, len(padded)-2)
+	for i := 0; i+3 <= len(padded); i++ {
+		grams = append(grams, string(padded[i:i+3]))
+	}
+	return grams
+}
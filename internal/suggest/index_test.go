@@ -0,0 +1,94 @@
+package suggest_test
+
+import (
+	"sample-service/internal/model"
+	"sample-service/internal/suggest"
+	"testing"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+func TestSuggest(t *testing.T) {
+	gomega.RegisterFailHandler(ginkgo.Fail)
+	ginkgo.RunSpecs(t, "Suggest Suite")
+}
+
+var users = []model.User{
+	{ID: 1, UserName: "jgarcia", FirstName: "José", LastName: "García", Email: "jose.garcia@company.com"},
+	{ID: 2, UserName: "jsmith", FirstName: "Jane", LastName: "Smith", Email: "jane.smith@company.com"},
+	{ID: 3, UserName: "ebrun", FirstName: "Émilie", LastName: "Brun", Email: "emilie.brun@company.com"},
+	{ID: 4, UserName: "josephine", FirstName: "Josephine", LastName: "Baker", Email: "jbaker@company.com"},
+}
+
+// ids returns the IDs of the suggested users, in order
+func ids(suggestions []suggest.Suggestion) []int64 {
+	result := []int64{}
+	for _, s := range suggestions {
+		result = append(result, s.User.ID)
+	}
+	return result
+}
+
+var _ = ginkgo.Describe("Index", func() {
+	var index *suggest.Index
+
+	ginkgo.BeforeEach(func() {
+		index = suggest.NewIndex()
+		for _, user := range users {
+			index.Put(user)
+		}
+	})
+
+	ginkgo.It("should match prefixes regardless of case and accents", func() {
+		gomega.Expect(ids(index.Suggest("jose", 10))).To(gomega.Equal([]int64{1, 4}))
+		gomega.Expect(ids(index.Suggest("EMI", 10))).To(gomega.Equal([]int64{3}))
+		gomega.Expect(ids(index.Suggest("garcí", 10))).To(gomega.Equal([]int64{1}))
+	})
+
+	ginkgo.It("should rank whole words above longer prefixes", func() {
+		suggestions := index.Suggest("jose", 10)
+
+		gomega.Expect(suggestions).To(gomega.HaveLen(2))
+		gomega.Expect(suggestions[0].Score).To(gomega.Equal(1.0))
+		gomega.Expect(suggestions[1].Score).To(gomega.BeNumerically("<", 1.0))
+	})
+
+	ginkgo.It("should tolerate typos", func() {
+		gomega.Expect(ids(index.Suggest("jsoe", 10))).To(gomega.ContainElement(int64(1)))
+		gomega.Expect(ids(index.Suggest("smiht", 10))).To(gomega.Equal([]int64{2}))
+		gomega.Expect(ids(index.Suggest("emlie", 10))).To(gomega.Equal([]int64{3}))
+	})
+
+	ginkgo.It("should rank exact prefixes above typos", func() {
+		suggestions := index.Suggest("jane", 10)
+
+		gomega.Expect(ids(suggestions)[0]).To(gomega.Equal(int64(2)))
+	})
+
+	ginkgo.It("should require every word to match", func() {
+		gomega.Expect(ids(index.Suggest("jose gar", 10))).To(gomega.Equal([]int64{1}))
+		gomega.Expect(ids(index.Suggest("jane brun", 10))).To(gomega.BeEmpty())
+	})
+
+	ginkgo.It("should not guess at very short words", func() {
+		gomega.Expect(ids(index.Suggest("xa", 10))).To(gomega.BeEmpty())
+		gomega.Expect(ids(index.Suggest("   ", 10))).To(gomega.BeEmpty())
+	})
+
+	ginkgo.It("should respect the limit", func() {
+		gomega.Expect(index.Suggest("j", 2)).To(gomega.HaveLen(2))
+	})
+
+	ginkgo.It("should reflect updates and removals", func() {
+		renamed := users[1]
+		renamed.LastName = "Doe"
+		index.Put(renamed)
+		index.Remove(1)
+
+		gomega.Expect(index.Len()).To(gomega.Equal(3))
+		gomega.Expect(ids(index.Suggest("smith", 10))).To(gomega.Equal([]int64{2}), "email still mentions smith")
+		gomega.Expect(ids(index.Suggest("doe", 10))).To(gomega.Equal([]int64{2}))
+		gomega.Expect(ids(index.Suggest("garcia", 10))).To(gomega.BeEmpty())
+	})
+})
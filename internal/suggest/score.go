@@ -0,0 +1,73 @@
+package suggest
+
+// matchScore rates how well a typed word matches the start of a term:
+// 1 for the whole term, just under 1 for a clean prefix, lower for a
+// prefix reached within the allowed number of typos, and 0 otherwise
+func matchScore(word, term string) float64 {
+	w, t := []rune(word), []rune(term)
+
+	if len(w) <= len(t) && string(t[:len(w)]) == word {
+		return 0.9 + 0.1*float64(len(w))/float64(len(t))
+	}
+
+	allowed := maxTypos(len(w))
+	if allowed == 0 {
+		return 0
+	}
+
+	// The typed word may be a character shorter or longer than the
+	// matching part of the term
+	best := allowed + 1
+	for n := len(w) - 1; n <= len(w)+1; n++ {
+		if n < 1 || n > len(t) {
+			continue
+		}
+		if d := editDistance(w, t[:n]); d < best {
+			best = d
+		}
+	}
+	if best > allowed {
+		return 0
+	}
+	return 0.8 * (1 - float64(best)/float64(len(w)+1))
+}
+
+// maxTypos is how many edits a word of the given length may contain;
+// very short words must match exactly or they would match everything
+func maxTypos(length int) int {
+	switch {
+	case length < 3:
+		return 0
+	case length < 6:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// editDistance is the optimal string alignment distance between a and b:
+// insertions, deletions, substitutions and transpositions of adjacent runes
+func editDistance(a, b []rune) int {
+	prev2 := make([]int, len(b)+1)
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return prev[len(b)]
+}
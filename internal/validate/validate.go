@@ -0,0 +1,133 @@
+// Package validate checks structs against rules declared in their
+// `validate` tags, such as `validate:"required,max=50"`, and reports every
+// field that breaks one. Fields are named as in JSON so the report matches
+// what the client sent. Rules apply to string fields; each field reports
+// only the first rule it breaks.
+package validate
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"sample-service/internal/model"
+)
+
+// A rule checks a value against the parameter given in the tag, such as
+// the 50 of max=50, and describes what is wrong with it
+type rule func(value, param string) (code, detail string, ok bool)
+
+// rules are the rules a validate tag can use
+var rules = map[string]rule{
+	"required": func(value, _ string) (string, string, bool) {
+		return model.FieldRequired, "is required", strings.TrimSpace(value) != ""
+	},
+	"max": func(value, param string) (string, string, bool) {
+		n, _ := strconv.Atoi(param)
+		return model.FieldTooLong, fmt.Sprintf("must be at most %d characters", n), utf8.RuneCountInString(value) <= n
+	},
+	"email": func(value, _ string) (string, string, bool) {
+		return model.FieldInvalid, fmt.Sprintf("%q is not a valid address", value), value == "" || isEmail(value)
+	},
+	"oneof": func(value, param string) (string, string, bool) {
+		allowed := strings.Fields(param)
+		return model.FieldInvalid, fmt.Sprintf("must be one of %s, got %q", strings.Join(allowed, ", "), value),
+			value == "" || slices.Contains(allowed, value)
+	},
+}
+
+// isEmail reports whether value is a bare address such as jo@example.com,
+// without a display name or angle brackets
+func isEmail(value string) bool {
+	addr, err := mail.ParseAddress(value)
+	return err == nil && addr.Address == value
+}
+
+// check is one rule of one field
+type check struct {
+	rule  rule
+	param string
+}
+
+type field struct {
+	index  int
+	name   string
+	checks []check
+}
+
+// fieldsCache holds the parsed tags of each struct type
+var fieldsCache sync.Map
+
+// Struct checks every tagged field of v, a struct or a pointer to one, and
+// returns what is wrong with each field that fails, in field order. It
+// panics on a tag it does not understand, which is a programming error.
+func Struct(v interface{}) []model.FieldError {
+	value := reflect.Indirect(reflect.ValueOf(v))
+
+	var errs []model.FieldError
+	for _, f := range fieldsOf(value.Type()) {
+		s := value.Field(f.index).String()
+		for _, c := range f.checks {
+			if code, detail, ok := c.rule(s, c.param); !ok {
+				errs = append(errs, model.FieldError{Field: f.name, Code: code, Detail: f.name + " " + detail})
+				break
+			}
+		}
+	}
+	return errs
+}
+
+// Summary describes every field at fault in one line
+func Summary(fields []model.FieldError) string {
+	details := make([]string, len(fields))
+	for i, field := range fields {
+		details[i] = field.Detail
+	}
+	return strings.Join(details, "; ")
+}
+
+// fieldsOf parses the validate tags of a struct type once
+func fieldsOf(t reflect.Type) []field {
+	if cached, ok := fieldsCache.Load(t); ok {
+		return cached.([]field)
+	}
+
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("validate")
+		if tag == "" {
+			continue
+		}
+		if sf.Type.Kind() != reflect.String {
+			panic(fmt.Sprintf("validate: %s.%s is not a string", t.Name(), sf.Name))
+		}
+
+		f := field{index: i, name: jsonName(sf)}
+		for _, spec := range strings.Split(tag, ",") {
+			name, param, _ := strings.Cut(spec, "=")
+			r, ok := rules[name]
+			if !ok {
+				panic(fmt.Sprintf("validate: unknown rule %q on %s.%s", name, t.Name(), sf.Name))
+			}
+			f.checks = append(f.checks, check{rule: r, param: param})
+		}
+		fields = append(fields, f)
+	}
+
+	fieldsCache.Store(t, fields)
+	return fields
+}
+
+// jsonName is the name of a field in JSON
+func jsonName(sf reflect.StructField) string {
+	if name, _, _ := strings.Cut(sf.Tag.Get("json"), ","); name != "" && name != "-" {
+		return name
+	}
+	return sf.Name
+}
@@ -0,0 +1,76 @@
+package validate_test
+
+import (
+	"strings"
+	"testing"
+
+	"sample-service/internal/model"
+	"sample-service/internal/validate"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+func TestValidate(t *testing.T) {
+	gomega.RegisterFailHandler(ginkgo.Fail)
+	ginkgo.RunSpecs(t, "Validate Suite")
+}
+
+var validUser = model.User{
+	UserName:   "jdoe",
+	FirstName:  "John",
+	LastName:   "Doe",
+	Email:      "john.doe@company.com",
+	Department: "Engineering",
+	UserStatus: "A",
+}
+
+var _ = ginkgo.Describe("Struct", func() {
+	ginkgo.It("should accept a valid user", func() {
+		gomega.Expect(validate.Struct(validUser)).To(gomega.BeEmpty())
+		gomega.Expect(validate.Struct(&validUser)).To(gomega.BeEmpty())
+	})
+
+	ginkgo.DescribeTable("should report a field that breaks a rule",
+		func(change func(*model.User), field, code, detail string) {
+			user := validUser
+			change(&user)
+
+			gomega.Expect(validate.Struct(user)).To(gomega.Equal([]model.FieldError{
+				{Field: field, Code: code, Detail: detail},
+			}))
+		},
+		ginkgo.Entry("blank", func(u *model.User) { u.UserName = "  " }, "user_name", model.FieldRequired, "user_name is required"),
+		ginkgo.Entry("too long", func(u *model.User) { u.UserName = strings.Repeat("x", 51) }, "user_name", model.FieldTooLong, "user_name must be at most 50 characters"),
+		ginkgo.Entry("not an address", func(u *model.User) { u.Email = "nobody" }, "email", model.FieldInvalid, `email "nobody" is not a valid address`),
+		ginkgo.Entry("display name", func(u *model.User) { u.Email = "John <j@x.io>" }, "email", model.FieldInvalid, `email "John <j@x.io>" is not a valid address`),
+		ginkgo.Entry("unknown status", func(u *model.User) { u.UserStatus = "X" }, "user_status", model.FieldInvalid, `user_status must be one of A, I, T, got "X"`),
+	)
+
+	ginkgo.It("should count characters rather than bytes", func() {
+		user := validUser
+		user.UserName = strings.Repeat("é", 50)
+		gomega.Expect(validate.Struct(user)).To(gomega.BeEmpty())
+	})
+
+	ginkgo.It("should report every field at once, each with its first failure", func() {
+		fields := validate.Struct(model.User{Email: "nobody", UserStatus: "X", Department: strings.Repeat("x", 256)})
+
+		gomega.Expect(fields).To(gomega.Equal([]model.FieldError{
+			{Field: "user_name", Code: model.FieldRequired, Detail: "user_name is required"},
+			{Field: "first_name", Code: model.FieldRequired, Detail: "first_name is required"},
+			{Field: "last_name", Code: model.FieldRequired, Detail: "last_name is required"},
+			{Field: "email", Code: model.FieldInvalid, Detail: `email "nobody" is not a valid address`},
+			{Field: "user_status", Code: model.FieldInvalid, Detail: `user_status must be one of A, I, T, got "X"`},
+			{Field: "department", Code: model.FieldTooLong, Detail: "department must be at most 255 characters"},
+		}))
+		gomega.Expect(validate.Summary(fields[:2])).To(gomega.Equal("user_name is required; first_name is required"))
+	})
+
+	ginkgo.It("should refuse a rule it does not know", func() {
+		type bad struct {
+			Name string `validate:"shiny"`
+		}
+		gomega.Expect(func() { validate.Struct(bad{}) }).To(gomega.PanicWith(gomega.ContainSubstring(`unknown rule "shiny"`)))
+	})
+})